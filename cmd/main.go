@@ -2,16 +2,80 @@ package main
 
 import (
 	"context"
-	"log"
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/CloudDetail/apo-receiver/pkg/receiver"
+	"github.com/CloudDetail/apo-receiver/pkg/version"
 )
 
+const defaultConfigPath = "receiver-config.yml"
+
+const usage = `Usage: apo-receiver [command] [flags]
+
+Commands:
+  run           Start the receiver, the default command
+  migrate       Create the ClickHouse tables and run the schema migrations
+  check-config  Validate the configuration file
+  version       Print the build info
+
+Run 'apo-receiver <command> -h' for the flags of a command.
+`
+
 func main() {
-	err := receiver.Run(context.Background())
+	os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// runCommand runs the command in args and returns the exit code.
+func runCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	command := "run"
+	// Keep `apo-receiver --config=xxx` working for the existing deployments.
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", defaultConfigPath, "Configuration file")
+	dryRun := false
+	if command == "migrate" {
+		flags.BoolVar(&dryRun, "dry-run", false, "Print the rendered SQL without connecting to ClickHouse")
+	}
+
+	var err error
+	switch command {
+	case "run", "migrate", "check-config":
+		if err = flags.Parse(args); err != nil {
+			return 2
+		}
+	}
+	switch command {
+	case "run":
+		// The receiver shuts down gracefully when ctx is done.
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		err = receiver.Run(ctx, *configPath)
+		stop()
+	case "migrate":
+		err = receiver.Migrate(*configPath, dryRun, stdout)
+	case "check-config":
+		if err = receiver.CheckConfig(*configPath); err == nil {
+			fmt.Fprintf(stdout, "%s is valid\n", *configPath)
+		}
+	case "version":
+		fmt.Fprintln(stdout, version.Info())
+	case "help":
+		fmt.Fprint(stdout, usage)
+	default:
+		fmt.Fprintf(stderr, "Unknown command %q\n\n%s", command, usage)
+		return 2
+	}
 	if err != nil {
-		log.Fatalf("Failed to run application: %v", err)
-		os.Exit(1)
+		fmt.Fprintf(stderr, "Failed to run %s: %v\n", command, err)
+		return 1
 	}
+	return 0
 }
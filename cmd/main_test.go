@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		code     int
+		stdout   string
+		stderr   string
+		rootPath bool
+	}{
+		{name: "help", args: []string{"help"}, stdout: "Commands:"},
+		{name: "unknown", args: []string{"serve"}, code: 2, stderr: `Unknown command "serve"`},
+		{name: "check-config", args: []string{"check-config", "--config", "../receiver-config.yml"}, stdout: "../receiver-config.yml is valid"},
+		{name: "check-config missing", args: []string{"check-config", "--config=missing.yml"}, code: 1, stderr: "Failed to run check-config"},
+		// The flags without command are parsed by run, so `apo-receiver --config=xxx` still works.
+		{name: "legacy flags", args: []string{"--unknown"}, code: 2, stderr: "flag provided but not defined: -unknown"},
+		{name: "dry-run only for migrate", args: []string{"check-config", "--dry-run"}, code: 2, stderr: "-dry-run"},
+		{name: "migrate dry-run", args: []string{"migrate", "--dry-run", "--config=receiver-config.yml"}, stdout: "CREATE TABLE IF NOT EXISTS schema_migrations", rootPath: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.rootPath {
+				chdir(t, "..")
+			}
+			var stdout, stderr bytes.Buffer
+			assert.Equal(t, tt.code, runCommand(tt.args, &stdout, &stderr), stderr.String())
+			assert.Contains(t, stdout.String(), tt.stdout)
+			assert.Contains(t, stderr.String(), tt.stderr)
+		})
+	}
+}
+
+// chdir runs the test in dir, as the sql scripts are read from the working directory.
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+}
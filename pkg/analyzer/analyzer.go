@@ -1,19 +1,25 @@
 package analyzer
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/CloudDetail/apo-receiver/pkg/analyzer/external"
 	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
 	"github.com/CloudDetail/apo-receiver/pkg/componment/onoffmetric"
 	"github.com/CloudDetail/apo-receiver/pkg/componment/profile"
 	"github.com/CloudDetail/apo-receiver/pkg/config"
 	"github.com/CloudDetail/apo-receiver/pkg/global"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
 
 	apmclient "github.com/CloudDetail/apo-module/apm/client/v1"
 	apmmodel "github.com/CloudDetail/apo-module/apm/model/v1"
@@ -29,8 +35,8 @@ var (
 
 type ReportAnalyzer struct {
 	signals         *profile.SingalsCache
-	waitMap         sync.Map
-	checkMissMap    sync.Map // <traceId, traceApmType>
+	waitMap         sync.Map // <traceKey, expireTime>
+	checkMissMap    sync.Map // <traceKey, traceApmType>
 	taskPool        *taskPool
 	delayPeriod     int64
 	retryTimes      int
@@ -38,13 +44,28 @@ type ReportAnalyzer struct {
 	threadCount     int
 	minuteTaskCount int
 	taskIndex       int
-	muatedRatio     int
 	profileDuration int64
-	mutateNodeMode  string
 	topologyPeriod  uint64
-	externalFactory *external.ExternalFactory
+	settings        atomic.Pointer[analyzeSettings]
+	mqCorrelator    *report.MqCorrelator
+	dependencies    *report.DependencyAggregator
+	changes         *report.DependencyChangeDetector
 	taskChans       []chan *traceTask
 	stopChan        chan bool
+	// cancelSubscribe stops consuming the report trace ids.
+	cancelSubscribe context.CancelFunc
+	routines        sync.WaitGroup
+	stopOnce        sync.Once
+}
+
+// analyzeSettings can be reloaded without restarting the analyzer.
+type analyzeSettings struct {
+	muatedRatio     int
+	mutateNodeMode  string
+	externalFactory *external.ExternalFactory
+	// urlNormalizer is kept by the reloads with the same urlNormalizerCfg, so the learned templates are not reset.
+	urlNormalizer    *external.UrlNormalizer
+	urlNormalizerCfg config.UrlNormalizerConfig
 }
 
 func NewReportAnalyzer(cfg *config.AnalyzerConfig, signals *profile.SingalsCache) *ReportAnalyzer {
@@ -57,7 +78,7 @@ func NewReportAnalyzer(cfg *config.AnalyzerConfig, signals *profile.SingalsCache
 	if topologyPeriod == 0 {
 		topologyPeriod = 60
 	}
-	return &ReportAnalyzer{
+	analyzer := &ReportAnalyzer{
 		signals:         signals,
 		taskPool:        newTaskPool(cfg.RetryDuration),
 		delayPeriod:     cfg.DelayDuration,
@@ -66,72 +87,181 @@ func NewReportAnalyzer(cfg *config.AnalyzerConfig, signals *profile.SingalsCache
 		threadCount:     cfg.ThreadCount,
 		minuteTaskCount: 0,
 		taskIndex:       0,
-		muatedRatio:     cfg.RatioThreshold,
 		profileDuration: int64(cfg.SegmentSize / 2),
-		mutateNodeMode:  cfg.MuateNodeMode,
 		topologyPeriod:  topologyPeriod * 1000000000,
-		externalFactory: external.NewExternalFactory(cfg.HttpParser),
+		mqCorrelator:    report.NewMqCorrelator(&cfg.MqCorrelation, topologyPeriod*1000000000),
+		dependencies:    report.NewDependencyAggregator(&cfg.DependencyAggregation, storeDependencies),
+		changes:         report.NewDependencyChangeDetector(&cfg.DependencyChange, storeDependencyChanges),
 		taskChans:       taskChans,
 		stopChan:        make(chan bool),
 	}
+	analyzer.UpdateSettings(cfg)
+	return analyzer
+}
+
+// UpdateSettings applies the reloaded settings, the traces in analyzing keep the previous settings.
+// The templates learned by the url normalizer are only reset when url_normalizer is changed.
+func (analyzer *ReportAnalyzer) UpdateSettings(cfg *config.AnalyzerConfig) {
+	var urlNormalizer *external.UrlNormalizer
+	if previous := analyzer.settings.Load(); previous != nil && reflect.DeepEqual(previous.urlNormalizerCfg, cfg.UrlNormalizer) {
+		urlNormalizer = previous.urlNormalizer
+	} else {
+		urlNormalizer = external.NewUrlNormalizer(&cfg.UrlNormalizer)
+	}
+	analyzer.settings.Store(&analyzeSettings{
+		muatedRatio:    cfg.RatioThreshold,
+		mutateNodeMode: cfg.MuateNodeMode,
+		externalFactory: external.NewExternalFactory(&external.ParserOptions{
+			UrlParser:     cfg.HttpParser,
+			UrlNormalizer: &cfg.UrlNormalizer,
+			Normalizer:    urlNormalizer,
+			Rules:         cfg.ExternalRules,
+		}),
+		urlNormalizer:    urlNormalizer,
+		urlNormalizerCfg: cfg.UrlNormalizer,
+	})
 }
 
 func (analyzer *ReportAnalyzer) Start() {
 	for i, taskChan := range analyzer.taskChans {
 		// go routine Pool
+		analyzer.routines.Add(1)
 		go analyzer.analyze(i, taskChan)
 	}
+	analyzer.routines.Add(1)
 	go analyzer.checkTask()
-	go global.CACHE.SubscribeReportTraceId(analyzer)
+	subscribeCtx, cancelSubscribe := context.WithCancel(context.Background())
+	analyzer.cancelSubscribe = cancelSubscribe
+	analyzer.routines.Add(1)
+	go func() {
+		defer analyzer.routines.Done()
+		global.CACHE.SubscribeReportTraceId(subscribeCtx, analyzer)
+	}()
+	if analyzer.mqCorrelator != nil {
+		analyzer.mqCorrelator.Start()
+	}
+	if analyzer.dependencies != nil {
+		analyzer.dependencies.Start()
+	}
+	if analyzer.changes != nil {
+		analyzer.changes.Start()
+	}
 }
 
+// Stop can be called more than once, eg. Drain after Stop.
 func (analyzer *ReportAnalyzer) Stop() {
-	close(analyzer.stopChan)
+	analyzer.stopOnce.Do(func() {
+		close(analyzer.stopChan)
+		if analyzer.cancelSubscribe != nil {
+			analyzer.cancelSubscribe()
+		}
+	})
+	analyzer.routines.Wait()
+	if analyzer.mqCorrelator != nil {
+		analyzer.mqCorrelator.Stop()
+	}
+	if analyzer.dependencies != nil {
+		analyzer.dependencies.Stop()
+	}
+	if analyzer.changes != nil {
+		analyzer.changes.Stop()
+	}
 }
 
-func (analyzer *ReportAnalyzer) CacheMetric(metricJson string) {
+// Drain stops the workers, then analyzes the waiting traces and the pending tasks without delay until ctx is done.
+// The tasks failed again are retried at most retry_times, the tasks left when ctx is done are dropped.
+// The open minutes of the dependencies are flushed at last.
+func (analyzer *ReportAnalyzer) Drain(ctx context.Context) {
+	analyzer.Stop()
+	if analyzer.dependencies != nil {
+		defer analyzer.dependencies.Flush()
+	}
+
+	checkTime := time.Now().Unix()
+	analyzer.checkMissMap.Range(func(k, v interface{}) bool {
+		traceKey := k.(string)
+		if global.CACHE.GetTraceTime(traceKey) == v.(*traceApmType).checkNanoTime {
+			analyzer.waitMap.Store(traceKey, checkTime)
+		}
+		analyzer.checkMissMap.Delete(k)
+		return true
+	})
+	waitCount := 0
+	analyzer.waitMap.Range(func(k, v interface{}) bool {
+		analyzer.Consume(k.(string))
+		analyzer.waitMap.Delete(k)
+		waitCount++
+		return true
+	})
+
+	processCount := 0
+	for {
+		tasks := analyzer.taskPool.getToProcessTasks(math.MaxInt64)
+		if len(tasks) == 0 {
+			log.Printf("[Drain Analyzer] Consume %d waiting traces, process %d tasks", waitCount, processCount)
+			return
+		}
+		for i, task := range tasks {
+			if ctx.Err() != nil {
+				log.Printf("[x Drain Analyzer] %s, drop %d tasks", ctx.Err().Error(), len(tasks)-i)
+				for _, task := range tasks[i:] {
+					ReportDropsTotal.WithLabelValues(reportTypeLabel(task.reportType), reasonShutdown).Inc()
+				}
+				return
+			}
+			analyzer.processTask(task)
+			processCount++
+		}
+	}
+}
+
+// CacheMetric caches the on/off metric in json sent by the old agents.
+func (analyzer *ReportAnalyzer) CacheMetric(metricJson string, identity *auth.Identity) {
 	onOffMetricGroup := &model.OnOffMetricGroup{}
 	if err := json.Unmarshal([]byte(metricJson), onOffMetricGroup); err != nil {
 		log.Printf("[x Parse OnOff Metric] Error: %s", err.Error())
 		return
 	}
-	global.CACHE.StoreMetric(onOffMetricGroup, metricJson)
+	analyzer.CacheOnOffMetric(onOffMetricGroup, identity)
 }
 
-func (analyzer *ReportAnalyzer) CacheTrace(traceJson string) {
+func (analyzer *ReportAnalyzer) CacheOnOffMetric(onOffMetricGroup *model.OnOffMetricGroup, identity *auth.Identity) {
+	global.CACHE.StoreMetric(tenant.Key(identity.GetTenant(), onOffMetricGroup.TraceId), onOffMetricGroup)
+}
+
+// CacheTrace caches the trace in json sent by the old agents.
+func (analyzer *ReportAnalyzer) CacheTrace(traceJson string, identity *auth.Identity) {
 	trace := &model.Trace{Labels: &model.TraceLabels{ThresholdMultiple: 1.0}}
 	if err := json.Unmarshal([]byte(traceJson), trace); err != nil {
 		log.Printf("[x Parse Trace] Error: %s", err.Error())
 		return
 	}
+	analyzer.CacheSpanTrace(trace, identity)
+}
 
-	if fillK8sMetadataInSpanTrace(trace) {
-		jsonValue := ""
-		if !global.CACHE.IsLocal() {
-			jsonBytes, _ := json.Marshal(trace)
-			jsonValue = string(jsonBytes)
-		}
-		global.CACHE.StoreTrace(trace, jsonValue)
-	} else {
-		global.CACHE.StoreTrace(trace, traceJson)
-	}
-
+// CacheSpanTrace caches the trace sent by the agent of identity, identity is nil if auth is disabled.
+func (analyzer *ReportAnalyzer) CacheSpanTrace(trace *model.Trace, identity *auth.Identity) {
 	traceLabel := trace.Labels
+	// The traces of the tenants are isolated in the caches.
+	traceKey := tenant.Key(identity.GetTenant(), traceLabel.TraceId)
+	fillK8sMetadataInSpanTrace(trace)
+	global.CACHE.StoreTrace(traceKey, trace, identity)
+
 	if analyzer.missTopTime > 0 {
 		if traceLabel.TopSpan {
 			// When top is collected by one collector, mark the flag to -1.
-			global.CACHE.RecordTraceTime(traceLabel.TraceId, -1)
+			global.CACHE.RecordTraceTime(traceKey, -1)
 		} else {
 			timeNano := time.Now().UnixNano()
-			analyzer.checkMissMap.Store(traceLabel.TraceId, &traceApmType{
+			analyzer.checkMissMap.Store(traceKey, &traceApmType{
 				apmType:       traceLabel.ApmType,
 				expireTime:    time.Now().Unix() + analyzer.missTopTime,
 				checkNanoTime: timeNano,
 			})
-			flag := global.CACHE.GetTraceTime(traceLabel.TraceId)
+			flag := global.CACHE.GetTraceTime(traceKey)
 			if flag >= 0 {
 				// If the top is not collected, all collectors will raced for the trace.
-				global.CACHE.RecordTraceTime(traceLabel.TraceId, timeNano)
+				global.CACHE.RecordTraceTime(traceKey, timeNano)
 			}
 		}
 	}
@@ -141,45 +271,52 @@ func (analyzer *ReportAnalyzer) CacheTrace(traceJson string) {
 	}
 
 	// Wait delay_duration.
-	analyzer.waitMap.Store(traceLabel.TraceId, time.Now().Unix()+analyzer.getWaitTime(traceLabel.ApmType))
+	analyzer.waitMap.Store(traceKey, time.Now().Unix()+analyzer.getWaitTime(traceLabel.ApmType))
 }
 
-func (analyzer *ReportAnalyzer) Consume(traceId string) {
-	traces := getTracesFromCache(traceId)
+// Consume analyzes the trace of traceKey, which is the traceId namespaced by tenant.Key.
+func (analyzer *ReportAnalyzer) Consume(traceKey string) {
+	tenantName, traceId := tenant.SplitKey(traceKey)
+	traces, identities := getTracesFromCache(tenantName, traceId)
 	if analyzer.missTopTime <= 0 && traces.RootTrace == nil {
-		log.Printf("[x Miss RootTrace] TraceId: %s", traceId)
+		log.Printf("[x Miss RootTrace] TraceId: %s", traceKey)
 		return
 	}
 	if len(traces.Traces) == 0 {
-		log.Printf("[x Miss Trace] TraceId: %s", traceId)
+		log.Printf("[x Miss Trace] TraceId: %s", traceKey)
 		return
 	}
 	for _, trace := range traces.Traces {
-		sendProfiledSpanTrace(trace)
+		sendProfiledSpanTrace(tenantName, trace, identities)
 	}
 	if traces.HasSingleTrace() || traces.HasChangedSample() {
 		// Do not build Relation.
 		return
 	}
 	if traces.HasSlow {
-		analyzer.taskPool.addTask(newSlowTraceTask(traces))
+		analyzer.taskPool.addTask(newSlowTraceTask(tenantName, traces, identities))
 	}
 	if traces.HasError {
-		analyzer.taskPool.addTask(newErrorTraceTask(traces))
+		analyzer.taskPool.addTask(newErrorTraceTask(tenantName, traces, identities))
 	}
 	if !traces.HasSlow && !traces.HasError && traces.UnSentTraceCount > 0 {
-		analyzer.taskPool.addTask(newNormalTraceTask(traces))
+		analyzer.taskPool.addTask(newNormalTraceTask(tenantName, traces, identities))
 	}
 }
 
-func getTracesFromCache(traceId string) *model.Traces {
+func getTracesFromCache(tenantName string, traceId string) (*model.Traces, traceIdentities) {
+	traceKey := tenant.Key(tenantName, traceId)
 	traces := model.NewTraces(traceId)
-	for _, trace := range global.CACHE.GetTraces(traceId) {
-		traces.AddTrace(trace)
+	identities := make(traceIdentities)
+	cachedTraces := global.CACHE.GetTraces(traceKey)
+	recordCacheLookup("trace", len(cachedTraces) > 0)
+	for _, cachedTrace := range cachedTraces {
+		traces.AddTrace(cachedTrace.Trace)
+		identities.add(cachedTrace)
 	}
 
 	// Relate OnOffMetric
-	metrics := global.CACHE.GetMetrics(traceId)
+	metrics := global.CACHE.GetMetrics(traceKey)
 	for _, onOffMetricGroup := range metrics {
 		if matchTrace := traces.FindTrace(onOffMetricGroup.SpanId); matchTrace != nil {
 			matchTrace.SetOnOffMetrics(onOffMetricGroup.Metrics)
@@ -195,17 +332,17 @@ func getTracesFromCache(traceId string) *model.Traces {
 	}
 	traces.MetricCount = len(metrics)
 
-	return traces
+	return traces, identities
 }
 
-func mergeTraces(oldTraces *model.Traces, newTraces *model.Traces) {
+func mergeTraces(tenantName string, oldTraces *model.Traces, newTraces *model.Traces, identities traceIdentities) {
 	existTraces := make(map[string]*model.Trace)
 	for _, oldTrace := range oldTraces.Traces {
 		existTraces[oldTrace.Labels.ApmSpanId] = oldTrace
 	}
 	for _, newTrace := range newTraces.Traces {
 		if _, exist := existTraces[newTrace.Labels.ApmSpanId]; !exist {
-			sendProfiledSpanTrace(newTrace)
+			sendProfiledSpanTrace(tenantName, newTrace, identities)
 			oldTraces.AddTrace(newTrace)
 		}
 	}
@@ -221,11 +358,13 @@ func (analyzer *ReportAnalyzer) getWaitTime(apmType string) int64 {
 }
 
 func (analyzer *ReportAnalyzer) analyze(index int, taskChan chan *traceTask) {
+	defer analyzer.routines.Done()
 	for {
 		select {
 		case task := <-taskChan:
 			log.Printf("[Channel - %d] Analyze Trace %s, TraceNum: %d, RetryTime: %d", index+1, task.traces.TraceId, task.traces.GetTraceCount(), task.retryTimes)
 			analyzer.processTask(task)
+			WorkerBacklog.WithLabelValues(workerLabel(index)).Dec()
 		case <-analyzer.stopChan:
 			return
 		}
@@ -236,46 +375,50 @@ func (analyzer *ReportAnalyzer) processTask(task *traceTask) {
 	if task.retryTimes > 0 {
 		// Check whether there will be new Trace/OnOffMetric.
 		traces := task.traces
-		traceCount := global.CACHE.GetTraceSize(traces.TraceId)
-		metricCount := global.CACHE.GetMetricSize(traces.TraceId)
+		traceKey := tenant.Key(task.tenant, traces.TraceId)
+		traceCount := global.CACHE.GetTraceSize(traceKey)
+		metricCount := global.CACHE.GetMetricSize(traceKey)
 		if traceCount > traces.GetTraceCount() || metricCount > traces.MetricCount {
 			// Update New Traces.
-			mergeTraces(task.traces, getTracesFromCache(traces.TraceId))
+			newTraces, newIdentities := getTracesFromCache(task.tenant, traces.TraceId)
+			task.identities = task.identities.merge(newIdentities)
+			mergeTraces(task.tenant, task.traces, newTraces, task.identities)
 		}
 	}
-	retry, err := analyzer.buildReport(task.traces, task.reportType)
+	retry, err := analyzer.buildReport(task.tenant, task.traces, task.identities, task.reportType)
 	if err != nil {
 		if retry {
 			if task.retryTimes < analyzer.retryTimes {
+				ReportRetriesTotal.WithLabelValues(reportTypeLabel(task.reportType), errorReason(err)).Inc()
 				analyzer.taskPool.retryTask(task)
 			} else {
-				recordDropReport(task.traces, err, task.reportType)
+				recordDropReport(task.tenant, task.traces, task.identities, err, task.reportType)
 			}
 		} else {
-			recordDropReport(task.traces, err, task.reportType)
+			recordDropReport(task.tenant, task.traces, task.identities, err, task.reportType)
 		}
 	}
 }
 
-func sendProfiledSpanTrace(trace *model.Trace) {
+func sendProfiledSpanTrace(tenantName string, trace *model.Trace, identities traceIdentities) {
 	if trace.Labels.IsProfiled || trace.Labels.IsSingleTrace() {
 		if trace.Labels.IsSlow {
 			if trace.MutatedType == "" {
 				trace.MutatedType = "unknown"
 			}
 		}
-		storeTrace(trace)
+		storeTrace(tenantName, trace, identities)
 	}
 }
 
-func (analyzer *ReportAnalyzer) buildReport(traces *model.Traces, reportType report.ReportType) (retry bool, err error) {
+func (analyzer *ReportAnalyzer) buildReport(tenantName string, traces *model.Traces, identities traceIdentities, reportType report.ReportType) (retry bool, err error) {
 	switch reportType {
 	case report.ErrorReportType:
-		return analyzer.buildErrorReports(traces)
+		return analyzer.buildErrorReports(tenantName, traces, identities)
 	case report.SlowReportType:
-		return analyzer.buildSlowReports(traces)
+		return analyzer.buildSlowReports(tenantName, traces, identities)
 	case report.NormalReportType:
-		if _, err := analyzer.buildRelations(traces); err != nil {
+		if _, err := analyzer.buildRelations(tenantName, traces, identities); err != nil {
 			return true, err
 		}
 		return false, nil
@@ -284,23 +427,23 @@ func (analyzer *ReportAnalyzer) buildReport(traces *model.Traces, reportType rep
 	}
 }
 
-func (analyzer *ReportAnalyzer) buildErrorReports(traces *model.Traces) (retry bool, err error) {
-	serviceNodes, err := analyzer.buildRelations(traces)
+func (analyzer *ReportAnalyzer) buildErrorReports(tenantName string, traces *model.Traces, identities traceIdentities) (retry bool, err error) {
+	serviceNodes, err := analyzer.buildRelations(tenantName, traces, identities)
 	if err != nil {
 		return true, err
 	}
 	if traces.RootTrace != nil {
-		return analyzer.buildSingleErrorReport(serviceNodes, traces)
+		return analyzer.buildSingleErrorReport(tenantName, serviceNodes, traces, identities)
 	} else {
-		return analyzer.buildMultiErrorReports(serviceNodes, traces)
+		return analyzer.buildMultiErrorReports(tenantName, serviceNodes, traces, identities)
 	}
 }
 
-func (analyzer *ReportAnalyzer) buildSingleErrorReport(serviceNodes []*apmmodel.OtelServiceNode, traces *model.Traces) (retry bool, err error) {
+func (analyzer *ReportAnalyzer) buildSingleErrorReport(tenantName string, serviceNodes []*apmmodel.OtelServiceNode, traces *model.Traces, identities traceIdentities) (retry bool, err error) {
 	entryTrace := traces.RootTrace
 	apmType := entryTrace.Labels.ApmType
 	if serviceNodes == nil {
-		serviceNodes, err = global.TRACE_CLIENT.QueryServices(apmType, traces.TraceId, entryTrace.Labels.StartTime/1e6)
+		serviceNodes, err = queryServices(tenantName, apmType, traces.TraceId, entryTrace.Labels.StartTime/1e6)
 		if err != nil {
 			return true, err
 		}
@@ -309,17 +452,17 @@ func (analyzer *ReportAnalyzer) buildSingleErrorReport(serviceNodes []*apmmodel.
 	spanTraces := apmclient.NewNodeSpanTraces(apmType, serviceNodes, traces)
 	for _, spanTrace := range spanTraces.Traces {
 		if spanTrace.SampledTrace.Labels.ApmSpanId == entryTrace.Labels.ApmSpanId {
-			return analyzer.generateErrorReport(apmType, traces, spanTrace)
+			return analyzer.generateErrorReport(tenantName, apmType, traces, identities, spanTrace)
 		}
 	}
-	return true, fmt.Errorf("entry[%s-%s] is not collected by apo", entryTrace.Labels.ServiceName, entryTrace.Labels.Url)
+	return true, newReportError(reasonNotFound, "entry[%s-%s] is not collected by apo", entryTrace.Labels.ServiceName, entryTrace.Labels.Url)
 }
 
-func (analyzer *ReportAnalyzer) buildMultiErrorReports(serviceNodes []*apmmodel.OtelServiceNode, traces *model.Traces) (retry bool, err error) {
+func (analyzer *ReportAnalyzer) buildMultiErrorReports(tenantName string, serviceNodes []*apmmodel.OtelServiceNode, traces *model.Traces, identities traceIdentities) (retry bool, err error) {
 	queryTrace := traces.GetQueryTrace()
 	apmType := queryTrace.Labels.ApmType
 	if serviceNodes == nil {
-		serviceNodes, err = global.TRACE_CLIENT.QueryServices(apmType, traces.TraceId, queryTrace.Labels.StartTime/1e6)
+		serviceNodes, err = queryServices(tenantName, apmType, traces.TraceId, queryTrace.Labels.StartTime/1e6)
 		if err != nil {
 			return true, err
 		}
@@ -327,11 +470,11 @@ func (analyzer *ReportAnalyzer) buildMultiErrorReports(serviceNodes []*apmmodel.
 
 	spanTraces := apmclient.NewNodeSpanTraces(apmType, serviceNodes, traces)
 	if len(spanTraces.Traces) == 0 {
-		return true, fmt.Errorf("trace[%s] is not found in Apm System", traces.TraceId)
+		return true, newReportError(reasonNotFound, "trace[%s] is not found in Apm System", traces.TraceId)
 	}
 
 	for _, spanTrace := range spanTraces.Traces {
-		if _, err := analyzer.generateErrorReport(apmType, traces, spanTrace); err != nil {
+		if _, err := analyzer.generateErrorReport(tenantName, apmType, traces, identities, spanTrace); err != nil {
 			log.Print(err.Error())
 		}
 	}
@@ -339,7 +482,7 @@ func (analyzer *ReportAnalyzer) buildMultiErrorReports(serviceNodes []*apmmodel.
 	return false, nil
 }
 
-func (analyzer *ReportAnalyzer) generateErrorReport(apmType string, traces *model.Traces, spanTrace *apmclient.NodeSpanTrace) (retry bool, err error) {
+func (analyzer *ReportAnalyzer) generateErrorReport(tenantName string, apmType string, traces *model.Traces, identities traceIdentities, spanTrace *apmclient.NodeSpanTrace) (retry bool, err error) {
 	apmErrorTree := apmclient.ConvertErrorTree(spanTrace)
 	// [Fix for Arms] Add all error nodes.
 	if global.TRACE_CLIENT.NeedGetDetailSpan(apmType) {
@@ -347,7 +490,7 @@ func (analyzer *ReportAnalyzer) generateErrorReport(apmType string, traces *mode
 			if errorNode.IsError && errorNode.IsSampled {
 				if node := spanTrace.GetServiceNode(spanId); node != nil {
 					if err := global.TRACE_CLIENT.FillMutatedSpan(apmType, traces.TraceId, node); err != nil {
-						return true, err
+						return true, withReason(reasonApmQuery, err)
 					}
 					errorNode.ErrorSpans = apmclient.GetErrorSpans(node)
 				}
@@ -356,14 +499,14 @@ func (analyzer *ReportAnalyzer) generateErrorReport(apmType string, traces *mode
 	}
 	mutatedTrace, err := apmErrorTree.GetRootCauseErrorNode(traces.TraceId)
 	if err != nil {
-		return false, err
+		return false, withReason(reasonNoRootCause, err)
 	}
 
 	if !mutatedTrace.IsProfiled {
-		return false, fmt.Errorf("error instance(%s) is not profiled", mutatedTrace.Id)
+		return false, newReportError(reasonNotProfiled, "error instance(%s) is not profiled", mutatedTrace.Id)
 	}
 
-	storeTraces(traces)
+	storeTraces(tenantName, traces, identities)
 	log.Printf("[Write Error Report] Trace: %s", traces.TraceId)
 
 	data := &report.ErrorReportData{
@@ -397,41 +540,42 @@ func (analyzer *ReportAnalyzer) generateErrorReport(apmType string, traces *mode
 		data.CauseMessage = ""
 	}
 	errorReport := report.NewErrorReport(apmErrorTree.Root.StartTime, traces.TraceId, apmErrorTree.Root.TotalTime, data)
+	errorReport.Identity = identities.get(tenantName, spanTrace.SampledTrace)
 	global.CLICK_HOUSE.StoreErrorReport(errorReport)
 
 	return false, nil
 }
 
-func storeTraces(traces *model.Traces) {
+func storeTraces(tenantName string, traces *model.Traces, identities traceIdentities) {
 	for _, trace := range traces.Traces {
-		storeTrace(trace)
+		storeTrace(tenantName, trace, identities)
 	}
 }
 
-func storeTrace(trace *model.Trace) {
+func storeTrace(tenantName string, trace *model.Trace, identities traceIdentities) {
 	if !trace.IsSent {
 		trace.MarkSent()
-		global.CLICK_HOUSE.StoreTraceGroup(trace)
+		global.CLICK_HOUSE.StoreTraceGroup(trace, identities.get(tenantName, trace))
 	}
 }
 
-func (analyzer *ReportAnalyzer) buildSlowReports(traces *model.Traces) (retry bool, err error) {
-	serviceNodes, err := analyzer.buildRelations(traces)
+func (analyzer *ReportAnalyzer) buildSlowReports(tenantName string, traces *model.Traces, identities traceIdentities) (retry bool, err error) {
+	serviceNodes, err := analyzer.buildRelations(tenantName, traces, identities)
 	if err != nil {
 		return true, err
 	}
 
 	if traces.RootTrace != nil {
-		return analyzer.buildSingleSlowReport(serviceNodes, traces)
+		return analyzer.buildSingleSlowReport(tenantName, serviceNodes, traces, identities)
 	} else {
-		return analyzer.buildMultiSlowReports(serviceNodes, traces)
+		return analyzer.buildMultiSlowReports(tenantName, serviceNodes, traces, identities)
 	}
 }
 
-func (analyzer *ReportAnalyzer) buildSingleSlowReport(serviceNodes []*apmmodel.OtelServiceNode, traces *model.Traces) (bool, error) {
+func (analyzer *ReportAnalyzer) buildSingleSlowReport(tenantName string, serviceNodes []*apmmodel.OtelServiceNode, traces *model.Traces, identities traceIdentities) (bool, error) {
 	entryTrace := traces.RootTrace.Labels
 	if uint64(entryTrace.ThresholdValue) >= entryTrace.Duration {
-		return false, fmt.Errorf("entry service(%s) duration(%d) is less than threshold(%s(%s)=%f)",
+		return false, newReportError(reasonBelowThreshold, "entry service(%s) duration(%d) is less than threshold(%s(%s)=%f)",
 			entryTrace.ServiceName, entryTrace.Duration, entryTrace.ThresholdType, entryTrace.ThresholdRange,
 			entryTrace.ThresholdValue)
 	}
@@ -450,14 +594,14 @@ func (analyzer *ReportAnalyzer) buildSingleSlowReport(serviceNodes []*apmmodel.O
 	// [FIX Arms] Drop sampled duration rate < 50% entry duration
 	if maxSampledTrace.Duration*2 < traces.RootTrace.Labels.Duration {
 		rate := uint64(maxSampledTrace.Duration * 100.0 / entryTrace.Duration)
-		return false, fmt.Errorf("top Sampled service(%s) duration(%d) has not enough rate(%d) with service(%s) duration(%d)",
+		return false, newReportError(reasonNotSampled, "top Sampled service(%s) duration(%d) has not enough rate(%d) with service(%s) duration(%d)",
 			maxSampledTrace.ServiceName, maxSampledTrace.Duration, rate, entryTrace.ServiceName, entryTrace.Duration)
 	}
 
 	apmType := entryTrace.ApmType
 	var err error
 	if serviceNodes == nil {
-		serviceNodes, err = global.TRACE_CLIENT.QueryServices(apmType, traces.TraceId, entryTrace.StartTime/1e6)
+		serviceNodes, err = queryServices(tenantName, apmType, traces.TraceId, entryTrace.StartTime/1e6)
 		if err != nil {
 			return true, err
 		}
@@ -466,17 +610,17 @@ func (analyzer *ReportAnalyzer) buildSingleSlowReport(serviceNodes []*apmmodel.O
 	spanTraces := apmclient.NewNodeSpanTraces(apmType, serviceNodes, traces)
 	for _, spanTrace := range spanTraces.Traces {
 		if spanTrace.SampledTrace.Labels.ApmSpanId == entryTrace.ApmSpanId {
-			return analyzer.generateSlowReport(apmType, traces, spanTrace)
+			return analyzer.generateSlowReport(tenantName, apmType, traces, identities, spanTrace)
 		}
 	}
-	return true, fmt.Errorf("entry[%s-%s] is not collected by apo", entryTrace.ServiceName, entryTrace.Url)
+	return true, newReportError(reasonNotFound, "entry[%s-%s] is not collected by apo", entryTrace.ServiceName, entryTrace.Url)
 }
 
-func (analyzer *ReportAnalyzer) buildMultiSlowReports(serviceNodes []*apmmodel.OtelServiceNode, traces *model.Traces) (retry bool, err error) {
+func (analyzer *ReportAnalyzer) buildMultiSlowReports(tenantName string, serviceNodes []*apmmodel.OtelServiceNode, traces *model.Traces, identities traceIdentities) (retry bool, err error) {
 	queryTrace := traces.GetQueryTrace().Labels
 	apmType := queryTrace.ApmType
 	if serviceNodes == nil {
-		serviceNodes, err = global.TRACE_CLIENT.QueryServices(apmType, traces.TraceId, queryTrace.StartTime/1e6)
+		serviceNodes, err = queryServices(tenantName, apmType, traces.TraceId, queryTrace.StartTime/1e6)
 		if err != nil {
 			return true, err
 		}
@@ -484,7 +628,7 @@ func (analyzer *ReportAnalyzer) buildMultiSlowReports(serviceNodes []*apmmodel.O
 
 	spanTraces := apmclient.NewNodeSpanTraces(apmType, serviceNodes, traces)
 	if len(spanTraces.Traces) == 0 {
-		return true, fmt.Errorf("trace[%s] is not found in Apm System", traces.TraceId)
+		return true, newReportError(reasonNotFound, "trace[%s] is not found in Apm System", traces.TraceId)
 	}
 
 	for _, spanTrace := range spanTraces.Traces {
@@ -494,7 +638,7 @@ func (analyzer *ReportAnalyzer) buildMultiSlowReports(serviceNodes []*apmmodel.O
 				entryTrace.ServiceName, entryTrace.Duration, entryTrace.ThresholdType, entryTrace.ThresholdRange,
 				entryTrace.ThresholdValue)
 		} else {
-			if _, err := analyzer.generateSlowReport(entryTrace.ApmType, traces, spanTrace); err != nil {
+			if _, err := analyzer.generateSlowReport(tenantName, entryTrace.ApmType, traces, identities, spanTrace); err != nil {
 				log.Print(err.Error())
 			}
 		}
@@ -502,17 +646,18 @@ func (analyzer *ReportAnalyzer) buildMultiSlowReports(serviceNodes []*apmmodel.O
 	return false, nil
 }
 
-func (analyzer *ReportAnalyzer) generateSlowReport(apmType string, traces *model.Traces, spanTrace *apmclient.NodeSpanTrace) (retry bool, err error) {
+func (analyzer *ReportAnalyzer) generateSlowReport(tenantName string, apmType string, traces *model.Traces, identities traceIdentities, spanTrace *apmclient.NodeSpanTrace) (retry bool, err error) {
 	apmTraceTree := apmclient.ConvertSlowTree(spanTrace)
-	mutatedTrace, err := apmTraceTree.GetMutatedTraceNode(traces.TraceId, analyzer.muatedRatio, analyzer.mutateNodeMode)
+	settings := analyzer.settings.Load()
+	mutatedTrace, err := apmTraceTree.GetMutatedTraceNode(traces.TraceId, settings.muatedRatio, settings.mutateNodeMode)
 	if err != nil {
-		return false, err
+		return false, withReason(reasonNoRootCause, err)
 	}
 
 	// [FIX Arms] Add Spans for Clients and Excpetions
 	if global.TRACE_CLIENT.NeedGetDetailSpan(apmType) {
 		if err := global.TRACE_CLIENT.FillMutatedSpan(apmType, traces.TraceId, spanTrace.GetServiceNode(mutatedTrace.SpanId)); err != nil {
-			return true, err
+			return true, withReason(reasonApmQuery, err)
 		}
 	}
 
@@ -527,19 +672,19 @@ func (analyzer *ReportAnalyzer) generateSlowReport(apmType string, traces *model
 				needProfile = true
 			}
 		}
-		analyzer.signals.AddSignal(entryTrace.ServiceName, entryTrace.Url, foundTrace, needProfile)
+		analyzer.signals.AddSignal(tenantName, entryTrace.ServiceName, entryTrace.Url, foundTrace, needProfile)
 
 		if !foundTraceLabels.IsSampled {
-			return false, fmt.Errorf("instance(%s) is not sampled", foundTrace.GetInstanceId())
+			return false, newReportError(reasonNotSampled, "instance(%s) is not sampled", foundTrace.GetInstanceId())
 		}
 		if !foundTraceLabels.IsProfiled {
-			return false, fmt.Errorf("instance(%s) is not profiled", foundTrace.GetInstanceId())
+			return false, newReportError(reasonNotProfiled, "instance(%s) is not profiled", foundTrace.GetInstanceId())
 		}
 
 		mutatedType = foundTrace.MutatedType
-		storeTraces(traces)
+		storeTraces(tenantName, traces, identities)
 	} else {
-		return false, fmt.Errorf("instance(%s) is not monited", mutatedTrace.Id)
+		return false, newReportError(reasonNotMonitored, "instance(%s) is not monited", mutatedTrace.Id)
 	}
 
 	log.Printf("[Write Slow Report] Trace: %s", traces.TraceId)
@@ -570,25 +715,29 @@ func (analyzer *ReportAnalyzer) generateSlowReport(apmType string, traces *model
 	}
 
 	nodeReport := report.NewNodeReport(apmTraceTree.Root.StartTime, traces.TraceId, apmTraceTree.Root.TotalTime, data)
+	nodeReport.Identity = identities.get(tenantName, spanTrace.SampledTrace)
 	global.CLICK_HOUSE.StoreNodeReport(nodeReport)
 	return false, nil
 }
 
-func (analyzer *ReportAnalyzer) buildRelations(traces *model.Traces) ([]*apmmodel.OtelServiceNode, error) {
+func (analyzer *ReportAnalyzer) buildRelations(tenantName string, traces *model.Traces, identities traceIdentities) ([]*apmmodel.OtelServiceNode, error) {
 	entryTrace := traces.GetQueryTrace()
 	if entryTrace == nil {
 		return nil, nil
 	}
 	entryTraceLabels := entryTrace.Labels
 	if traces.RootTrace != nil {
-		key := analyzer.getRelationKey(entryTraceLabels.ServiceName, entryTraceLabels.Url, entryTraceLabels.StartTime, false)
-		if global.CACHE.GetRelationTraceId(key) != "" {
-			storeTraces(traces)
+		key := analyzer.getRelationKey(tenantName, entryTraceLabels.ServiceName, entryTraceLabels.Url, entryTraceLabels.StartTime, false)
+		found := global.CACHE.GetRelationTraceId(key) != ""
+		recordCacheLookup("relation", found)
+		if found {
+			storeTraces(tenantName, traces, identities)
+			analyzer.analyzeLocalTopology(tenantName, traces)
 			return nil, nil
 		}
 	}
 
-	serviceNodes, err := global.TRACE_CLIENT.QueryServices(entryTraceLabels.ApmType, traces.TraceId, entryTraceLabels.StartTime/1e6)
+	serviceNodes, err := queryServices(tenantName, entryTraceLabels.ApmType, traces.TraceId, entryTraceLabels.StartTime/1e6)
 	if err != nil {
 		return nil, err
 	}
@@ -603,41 +752,121 @@ func (analyzer *ReportAnalyzer) buildRelations(traces *model.Traces) ([]*apmmode
 			}
 		}
 		if !foundRoot {
-			return serviceNodes, fmt.Errorf("no matched entry span is found in Apm System")
+			return serviceNodes, newReportError(reasonNotFound, "no matched entry span is found in Apm System")
 		}
 	}
 
-	topology := report.NewTopology(entryTraceLabels.ApmType, serviceNodes, traces.GetSpanIdTraceMap(), analyzer.externalFactory)
+	topology := report.NewTopology(entryTraceLabels.ApmType, serviceNodes, traces.GetSpanIdTraceMap(), analyzer.settings.Load().externalFactory)
+	observe := analyzer.markObserved(tenantName, traces.TraceId)
+	if observe {
+		analyzer.correlateMq(tenantName, traces.TraceId, topology.Nodes)
+	}
 	for _, topologyNode := range topology.Nodes {
-		key := analyzer.getRelationKey(topologyNode.ServiceName, topologyNode.Url, topologyNode.StartTime, topologyNode.TopNode)
-		if global.CACHE.GetRelationTraceId(key) == "" {
+		relation := report.NewRelation(tenantName, traces.TraceId, topologyNode)
+		if observe {
+			analyzer.observeRelation(relation)
+		}
+		key := analyzer.getRelationKey(tenantName, topologyNode.ServiceName, topologyNode.Url, topologyNode.StartTime, topologyNode.TopNode)
+		found := global.CACHE.GetRelationTraceId(key) != ""
+		recordCacheLookup("relation", found)
+		if !found {
 			global.CACHE.StoreRelationTraceId(key, traces.TraceId)
-			global.CLICK_HOUSE.StoreRelation(report.NewRelation(traces.TraceId, topologyNode))
+			global.CLICK_HOUSE.StoreRelation(relation)
 
-			storeTraces(traces)
+			storeTraces(tenantName, traces, identities)
 		}
 	}
 	return serviceNodes, nil
 }
 
-func (analyzer *ReportAnalyzer) getRelationKey(serviceName, url string, timestamp uint64, vnode bool) string {
-	return fmt.Sprintf("%s-%s-%d-%t", serviceName, url, timestamp/analyzer.topologyPeriod, vnode)
+// correlateMq writes the relationships of the consumers in the trace and the producers in other traces.
+func (analyzer *ReportAnalyzer) correlateMq(tenantName string, traceId string, nodes []*report.TopologyNode) {
+	if analyzer.mqCorrelator == nil {
+		return
+	}
+	links := analyzer.mqCorrelator.Correlate(tenantName, traceId, nodes)
+	if len(links) == 0 {
+		report.MqCorrelationTracesTotal.WithLabelValues("unlinked").Inc()
+		return
+	}
+	report.MqCorrelationTracesTotal.WithLabelValues("linked").Inc()
+	global.CLICK_HOUSE.StoreMqLinks(tenantName, links)
+}
+
+// analyzeLocalTopology correlates the mq and observes the relations of the trace whose relation is already written in the topology period,
+// only the pushed spans are used as querying the APM trace backend for each trace is too expensive.
+// The trace is not aggregated into the dependencies without the pushed spans, as the agent traces have no clients and parents.
+func (analyzer *ReportAnalyzer) analyzeLocalTopology(tenantName string, traces *model.Traces) {
+	if !analyzer.markObserved(tenantName, traces.TraceId) {
+		return
+	}
+	serviceNodes := global.TRACE_CLIENT.QueryLocalServices(tenantName, traces.TraceId)
+	if serviceNodes == nil {
+		if analyzer.dependencies != nil {
+			report.DependencySkippedTracesTotal.Inc()
+		}
+		if analyzer.mqCorrelator != nil {
+			report.MqCorrelationTracesTotal.WithLabelValues("skipped").Inc()
+		}
+		return
+	}
+	entryTrace := traces.GetQueryTrace()
+	topology := report.NewTopology(entryTrace.Labels.ApmType, serviceNodes, traces.GetSpanIdTraceMap(), analyzer.settings.Load().externalFactory)
+	analyzer.correlateMq(tenantName, traces.TraceId, topology.Nodes)
+	for _, topologyNode := range topology.Nodes {
+		analyzer.observeRelation(report.NewRelation(tenantName, traces.TraceId, topologyNode))
+	}
+}
+
+// markObserved returns true if the trace is not correlated and observed yet,
+// the slow and error tasks of a trace and their retries share the marker so the trace is correlated and aggregated once.
+func (analyzer *ReportAnalyzer) markObserved(tenantName string, traceId string) bool {
+	if analyzer.mqCorrelator == nil && analyzer.dependencies == nil && analyzer.changes == nil {
+		return false
+	}
+	return global.CACHE.MarkTraceObserved(tenant.Key(tenantName, traceId))
 }
 
-func recordDropReport(traces *model.Traces, err error, reportType report.ReportType) {
+// observeRelation aggregates the dependencies and detects the dependency changes of the analyzed trace, including the traces not written.
+func (analyzer *ReportAnalyzer) observeRelation(relation *report.Relation) {
+	if analyzer.dependencies != nil {
+		analyzer.dependencies.Add(relation)
+	}
+	if analyzer.changes != nil {
+		analyzer.changes.Add(relation)
+	}
+}
+
+func storeDependencies(tenantName string, dependencies []*report.ServiceDependency) {
+	global.CLICK_HOUSE.StoreServiceDependencies(tenantName, dependencies)
+}
+
+func storeDependencyChanges(tenantName string, changes []*report.DependencyChange) {
+	global.CLICK_HOUSE.StoreDependencyChanges(tenantName, changes)
+}
+
+func (analyzer *ReportAnalyzer) getRelationKey(tenantName, serviceName, url string, timestamp uint64, vnode bool) string {
+	return tenant.Key(tenantName, fmt.Sprintf("%s-%s-%d-%t", serviceName, url, timestamp/analyzer.topologyPeriod, vnode))
+}
+
+func recordDropReport(tenantName string, traces *model.Traces, identities traceIdentities, err error, reportType report.ReportType) {
 	log.Printf("[x Build Report] TraceId: %s, Error: %s", traces.TraceId, err.Error())
+	ReportDropsTotal.WithLabelValues(reportTypeLabel(reportType), errorReason(err)).Inc()
 	if reportType == report.ErrorReportType {
 		dropReport := report.NewDropErrorReport(report.CameraErrorReport, traces.GetQueryTrace(), err.Error())
+		dropReport.Identity = identities.get(tenantName, traces.GetQueryTrace())
 		global.CLICK_HOUSE.StoreErrorReport(dropReport)
 	} else if reportType == report.SlowReportType {
 		dropReport := report.NewDropReport(report.CameraNodeReport, traces.GetQueryTrace(), err.Error())
+		dropReport.Identity = identities.get(tenantName, traces.GetQueryTrace())
 		global.CLICK_HOUSE.StoreNodeReport(dropReport)
 	} else if reportType == report.NormalReportType {
-		storeTraces(traces)
+		storeTraces(tenantName, traces, identities)
 	}
 }
 
 func (analyzer *ReportAnalyzer) checkTask() {
+	defer analyzer.routines.Done()
 	timer := time.NewTicker(1 * time.Second)
 	currentMinute := time.Now().Minute()
 	for {
@@ -645,8 +874,18 @@ func (analyzer *ReportAnalyzer) checkTask() {
 		case <-timer.C:
 			checkTime := time.Now().Unix()
 			tasks := analyzer.taskPool.getToProcessTasks(checkTime)
-			for _, task := range tasks {
-				analyzer.taskChans[analyzer.taskIndex] <- task
+			for i, task := range tasks {
+				backlog := WorkerBacklog.WithLabelValues(workerLabel(analyzer.taskIndex))
+				backlog.Inc()
+				select {
+				case analyzer.taskChans[analyzer.taskIndex] <- task:
+				case <-analyzer.stopChan:
+					backlog.Dec()
+					// Left the tasks to Drain.
+					analyzer.taskPool.requeueTasks(tasks[i:])
+					timer.Stop()
+					return
+				}
 				if analyzer.taskIndex == analyzer.threadCount-1 {
 					analyzer.taskIndex = 0
 				} else {
@@ -661,26 +900,35 @@ func (analyzer *ReportAnalyzer) checkTask() {
 				analyzer.minuteTaskCount = 0
 			}
 
+			waitCount := 0
 			analyzer.waitMap.Range(func(k, v interface{}) bool {
 				expireTime := v.(int64)
 				if expireTime < checkTime {
 					global.CACHE.NotifyReportTraceId(k.(string))
 					analyzer.waitMap.Delete(k)
+				} else {
+					waitCount++
 				}
 				return true
 			})
 
+			checkMissCount := 0
 			analyzer.checkMissMap.Range(func(k, v interface{}) bool {
+				checkMissCount++
 				traceValue := v.(*traceApmType)
 				if traceValue.expireTime < checkTime {
-					traceId := k.(string)
-					if global.CACHE.GetTraceTime(traceId) == traceValue.checkNanoTime {
-						analyzer.waitMap.Store(traceId, checkTime+analyzer.getWaitTime(traceValue.apmType))
+					traceKey := k.(string)
+					if global.CACHE.GetTraceTime(traceKey) == traceValue.checkNanoTime {
+						analyzer.waitMap.Store(traceKey, checkTime+analyzer.getWaitTime(traceValue.apmType))
 					}
 					analyzer.checkMissMap.Delete(k)
+					checkMissCount--
 				}
 				return true
 			})
+			// The traces moved from checkMissMap are counted in the next check.
+			PendingTraces.WithLabelValues("wait").Set(float64(waitCount))
+			PendingTraces.WithLabelValues("check_miss").Set(float64(checkMissCount))
 		case <-analyzer.stopChan:
 			timer.Stop()
 			return
@@ -716,6 +964,7 @@ func newTaskPool(checkPeriod int64) *taskPool {
 func (pool *taskPool) addTask(task *traceTask) {
 	pool.taskLock.Lock()
 	defer pool.taskLock.Unlock()
+	defer pool.updateGauges()
 
 	log.Printf("[Add %s Task] %s, TraceNum: %d", task.reportType.String(), task.traces.TraceId, task.traces.GetTraceCount())
 	pool.todoTasks = append(pool.todoTasks, task)
@@ -724,15 +973,26 @@ func (pool *taskPool) addTask(task *traceTask) {
 func (pool *taskPool) retryTask(task *traceTask) {
 	pool.taskLock.Lock()
 	defer pool.taskLock.Unlock()
+	defer pool.updateGauges()
 
 	task.retryTimes += 1
 	task.checkTime = time.Now().Unix() + pool.checkPeriod
 	pool.retryTasks = append(pool.retryTasks, task)
 }
 
+// requeueTasks puts back the tasks which are not processed.
+func (pool *taskPool) requeueTasks(tasks []*traceTask) {
+	pool.taskLock.Lock()
+	defer pool.taskLock.Unlock()
+	defer pool.updateGauges()
+
+	pool.todoTasks = append(pool.todoTasks, tasks...)
+}
+
 func (pool *taskPool) getToProcessTasks(checkTime int64) []*traceTask {
 	pool.taskLock.Lock()
 	defer pool.taskLock.Unlock()
+	defer pool.updateGauges()
 
 	var tasks []*traceTask = make([]*traceTask, 0)
 	size := len(pool.todoTasks)
@@ -763,32 +1023,46 @@ func (pool *taskPool) getToProcessTasks(checkTime int64) []*traceTask {
 	return tasks
 }
 
+// updateGauges exports the sizes of the queues, it is called with taskLock held.
+func (pool *taskPool) updateGauges() {
+	TaskPoolTasks.WithLabelValues("todo").Set(float64(len(pool.todoTasks)))
+	TaskPoolTasks.WithLabelValues("retry").Set(float64(len(pool.retryTasks)))
+}
+
 type traceTask struct {
+	tenant     string
 	traces     *model.Traces
+	identities traceIdentities
 	reportType report.ReportType
 	retryTimes int
 	checkTime  int64
 }
 
-func newSlowTraceTask(traces *model.Traces) *traceTask {
+func newSlowTraceTask(tenantName string, traces *model.Traces, identities traceIdentities) *traceTask {
 	return &traceTask{
+		tenant:     tenantName,
 		traces:     traces,
+		identities: identities,
 		reportType: report.SlowReportType,
 		retryTimes: 0,
 	}
 }
 
-func newErrorTraceTask(traces *model.Traces) *traceTask {
+func newErrorTraceTask(tenantName string, traces *model.Traces, identities traceIdentities) *traceTask {
 	return &traceTask{
+		tenant:     tenantName,
 		traces:     traces,
+		identities: identities,
 		reportType: report.ErrorReportType,
 		retryTimes: 0,
 	}
 }
 
-func newNormalTraceTask(traces *model.Traces) *traceTask {
+func newNormalTraceTask(tenantName string, traces *model.Traces, identities traceIdentities) *traceTask {
 	return &traceTask{
+		tenant:     tenantName,
 		traces:     traces,
+		identities: identities,
 		reportType: report.NormalReportType,
 		retryTimes: 0,
 	}
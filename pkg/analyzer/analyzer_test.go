@@ -6,7 +6,10 @@ import (
 	"testing"
 
 	"github.com/CloudDetail/apo-module/model/v1"
+	"github.com/stretchr/testify/assert"
+
 	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
 )
 
 type ReportDataE struct {
@@ -228,3 +231,19 @@ func BenchmarkDirectToJson(b *testing.B) {
 		fmt.Println("ok")
 	}
 }
+
+func TestUpdateSettingsKeepUrlNormalizer(t *testing.T) {
+	analyzer := &ReportAnalyzer{}
+	cfg := &config.AnalyzerConfig{HttpParser: "normalizedUrl", RatioThreshold: 20}
+	analyzer.UpdateSettings(cfg)
+	normalizer := analyzer.settings.Load().urlNormalizer
+
+	// The templates learned are kept when url_normalizer is not changed.
+	cfg.RatioThreshold = 30
+	analyzer.UpdateSettings(cfg)
+	assert.Same(t, normalizer, analyzer.settings.Load().urlNormalizer)
+
+	cfg.UrlNormalizer.VariableThreshold = 5
+	analyzer.UpdateSettings(cfg)
+	assert.NotSame(t, normalizer, analyzer.settings.Load().urlNormalizer)
+}
@@ -2,9 +2,8 @@ package external
 
 import (
 	"fmt"
-	"log"
+	"strings"
 
-	apmclient "github.com/CloudDetail/apo-module/apm/client/v1"
 	"github.com/CloudDetail/apo-module/apm/model/v1"
 )
 
@@ -23,47 +22,68 @@ func (db *dbParser) Parse(span *model.OtelSpan) *External {
 	if !dbFound {
 		return nil
 	}
-	name := ""
-	if dbSystem == "redis" || dbSystem == "memcached" || dbSystem == "aerospike" {
-		name = span.Name
-	}
 	dbStatement := span.Attributes[model.AttributeDBStatement]
 	operationName := span.Attributes[model.AttributeDBOperation]
-	if name == "" {
-		dbName := span.Attributes[model.AttributeDBName]
-		tableName := span.Attributes[model.AttributeDBSQLTable]
-		if tableName != "" && operationName != "" {
-			if dbName != "" {
-				// SELECT <db>.<table>
-				name = fmt.Sprintf("%s %s.%s", operationName, dbName, tableName)
-			} else {
-				// SELECT <table>
-				name = fmt.Sprintf("%s %s", operationName, tableName)
-			}
-		} else if dbStatement != "" {
-			if operationName, tableName = apmclient.SQLParseOperationAndTableNEW(dbStatement); operationName != "" {
-				if dbName != "" {
-					name = fmt.Sprintf("%s %s.%s", operationName, dbName, tableName)
-				} else {
-					name = fmt.Sprintf("%s %s", operationName, tableName)
-				}
-			} else {
-				log.Printf("[x Parse Sql] %s", dbStatement)
+	if dbSystem == "redis" || dbSystem == "memcached" || dbSystem == "aerospike" {
+		// The keys are unbounded, so the commands are fingerprinted rather than the statements.
+		return newExternal(span).
+			WithGroup(GroupDb).
+			WithType(dbSystem).
+			WithName(span.Name).
+			WithPeer(span.GetPeer("")).
+			WithDetail(orDefault(dbStatement, operationName)).
+			WithFingerprint(fingerprint(span.Name))
+	}
+
+	name := ""
+	dbName := span.Attributes[model.AttributeDBName]
+	tableName := span.Attributes[model.AttributeDBSQLTable]
+	normalized := normalizeStatement(dbSystem, dbStatement)
+	if tableName != "" && operationName != "" {
+		if dbName != "" {
+			// SELECT <db>.<table>
+			name = fmt.Sprintf("%s %s.%s", operationName, dbName, tableName)
+		} else {
+			// SELECT <table>
+			name = fmt.Sprintf("%s %s", operationName, tableName)
+		}
+	} else if normalized != nil && normalized.Operation != "" && len(normalized.Tables) > 0 {
+		// SELECT <db>.<table>,<db>.<joined table>
+		tables := make([]string, 0, len(normalized.Tables))
+		for _, table := range normalized.Tables {
+			if dbName != "" && !strings.Contains(table, ".") {
+				table = dbName + "." + table
 			}
+			tables = append(tables, table)
 		}
+		name = fmt.Sprintf("%s %s", normalized.Operation, strings.Join(tables, ","))
 	}
 	if name == "" {
 		name = span.Name
 	}
-	dbDetail := dbStatement
-	if dbStatement == "" {
-		dbDetail = operationName
-	}
 
-	return newExternal(span).
+	external := newExternal(span).
 		WithGroup(GroupDb).
 		WithType(dbSystem).
 		WithName(name).
 		WithPeer(span.GetPeer("")).
-		WithDetail(dbDetail)
+		WithDetail(operationName)
+	if normalized != nil {
+		external.WithDetail(normalized.Statement).WithFingerprint(normalized.Fingerprint)
+	}
+	return external
+}
+
+// normalizeStatement normalizes the query documents of MongoDB and Elasticsearch, the other statements are normalized as SQL.
+// The documents which are not JSON are normalized as SQL, so the literals are still stripped.
+func normalizeStatement(dbSystem string, dbStatement string) *NormalizedStatement {
+	if dbStatement == "" {
+		return nil
+	}
+	if documentSystems[dbSystem] || strings.HasPrefix(strings.TrimSpace(dbStatement), "{") {
+		if normalized := NormalizeDocument(dbStatement, dbSystem == "mongodb"); normalized != nil {
+			return normalized
+		}
+	}
+	return NormalizeSql(dbStatement)
 }
@@ -0,0 +1,90 @@
+package external
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/CloudDetail/apo-module/apm/model/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDbParser(t *testing.T) {
+	tests := []struct {
+		attributes map[string]string
+		spanName   string
+		name       string
+		detail     string
+	}{
+		{
+			attributes: map[string]string{"db.system": "mysql", "db.name": "shop", "db.statement": "select * from orders o join customers c on o.cid = c.id where o.id = 1"},
+			spanName:   "SELECT shop",
+			name:       "SELECT shop.orders,shop.customers",
+			detail:     "select * from orders o join customers c on o.cid = c.id where o.id = ?",
+		},
+		{
+			attributes: map[string]string{"db.system": "postgresql", "db.name": "shop", "db.operation": "SELECT", "db.sql.table": "orders", "db.statement": "SELECT * FROM orders WHERE id = 1"},
+			spanName:   "SELECT shop.orders",
+			name:       "SELECT shop.orders",
+			detail:     "SELECT * FROM orders WHERE id = ?",
+		},
+		{
+			attributes: map[string]string{"db.system": "mysql", "db.statement": "BEGIN"},
+			spanName:   "mysql",
+			name:       "mysql",
+			detail:     "BEGIN",
+		},
+		{
+			attributes: map[string]string{"db.system": "mongodb", "db.name": "shop", "db.operation": "find", "db.statement": `{"find": "orders", "filter": {"_id": 1}}`},
+			spanName:   "find shop.orders",
+			name:       "find shop.orders",
+			detail:     `{"find":"orders","filter":{"_id":"?"}}`,
+		},
+		{
+			attributes: map[string]string{"db.system": "elasticsearch", "db.operation": "search", "db.statement": `{"query": {"term": {"user": "kimchy"}}}`},
+			spanName:   "GET /users/_search",
+			name:       "GET /users/_search",
+			detail:     `{"query":{"term":{"user":"?"}}}`,
+		},
+		{
+			attributes: map[string]string{"db.system": "cassandra", "db.name": "ks", "db.statement": "SELECT * FROM users WHERE id = 5"},
+			spanName:   "SELECT ks.users",
+			name:       "SELECT ks.users",
+			detail:     "SELECT * FROM users WHERE id = ?",
+		},
+		{
+			attributes: map[string]string{"db.system": "redis", "db.statement": "SET aa ?"},
+			spanName:   "SET",
+			name:       "SET",
+			detail:     "SET aa ?",
+		},
+		{
+			attributes: map[string]string{"db.system": "redis", "db.operation": "GET"},
+			spanName:   "GET",
+			name:       "GET",
+			detail:     "GET",
+		},
+	}
+	parser := newDbParser()
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("Test-%d", i+1), func(t *testing.T) {
+			got := parser.Parse(&model.OtelSpan{Kind: model.SpanKindClient, Name: tt.spanName, Attributes: tt.attributes})
+			assert.Equal(t, tt.name, got.Name)
+			assert.Equal(t, tt.detail, got.Detail)
+			assert.NotEmpty(t, got.Fingerprint)
+		})
+	}
+}
+
+func TestDbFingerprint(t *testing.T) {
+	parser := newDbParser()
+	parse := func(attributes map[string]string) *External {
+		return parser.Parse(&model.OtelSpan{Kind: model.SpanKindClient, Name: "SET", Attributes: attributes})
+	}
+	assert.Equal(t,
+		parse(map[string]string{"db.system": "mysql", "db.statement": "select * from t where id = 1"}).Fingerprint,
+		parse(map[string]string{"db.system": "mysql", "db.statement": "SELECT * FROM t WHERE id = 2"}).Fingerprint)
+	// The redis commands are fingerprinted without the keys.
+	assert.Equal(t,
+		parse(map[string]string{"db.system": "redis", "db.statement": "SET aa ?"}).Fingerprint,
+		parse(map[string]string{"db.system": "redis", "db.statement": "SET bb ?"}).Fingerprint)
+}
@@ -11,20 +11,13 @@ const (
 )
 
 type ExternalFactory struct {
-	dbParser      ExternalParser
-	httpParser    ExternalParser
-	rpcParser     ExternalParser
-	unknownParser ExternalParser
-	mqParser      ExternalParser
+	parsers []ExternalParser
 }
 
-func NewExternalFactory(urlParser string) *ExternalFactory {
+// NewExternalFactory creates the parsers registered in order.
+func NewExternalFactory(options *ParserOptions) *ExternalFactory {
 	return &ExternalFactory{
-		dbParser:      newDbParser(),
-		httpParser:    newHttpParser(urlParser),
-		rpcParser:     newRpcParser(),
-		unknownParser: newUnknownParser(),
-		mqParser:      newMqParser(),
+		parsers: newParsers(options),
 	}
 }
 
@@ -43,27 +36,12 @@ func (factory *ExternalFactory) BuildExternals(service *model.OtelServiceNode) [
 	return externals
 }
 
+// buildExternal returns the external parsed by the first matched parser.
 func (factory *ExternalFactory) buildExternal(span *model.OtelSpan) *External {
-	if span.Kind == model.SpanKindClient {
-		if external := factory.dbParser.Parse(span); external != nil {
+	for _, parser := range factory.parsers {
+		if external := parser.Parse(span); external != nil {
 			return external
 		}
-		if external := factory.httpParser.Parse(span); external != nil {
-			return external
-		}
-		if external := factory.rpcParser.Parse(span); external != nil {
-			return external
-		}
-		if _, mqFound := span.Attributes[model.AttributeMessageSystem]; mqFound {
-			return factory.mqParser.Parse(span)
-		} else {
-			_, dbFound := span.Attributes[model.AttributeDBSystem]
-			if !dbFound {
-				return factory.unknownParser.Parse(span)
-			}
-		}
-	} else if span.Kind == model.SpanKindConsumer || span.Kind == model.SpanKindProducer {
-		return factory.mqParser.Parse(span)
 	}
 	return nil
 }
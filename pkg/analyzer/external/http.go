@@ -5,16 +5,26 @@ import (
 	"strings"
 
 	"github.com/CloudDetail/apo-module/apm/model/v1"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
 )
 
 type httpParser struct {
-	urlParser string
+	urlParser  string
+	normalizer *UrlNormalizer
 }
 
-func newHttpParser(urlParser string) *httpParser {
-	return &httpParser{
+func newHttpParser(urlParser string, normalizerCfg *config.UrlNormalizerConfig, normalizer *UrlNormalizer) *httpParser {
+	parser := &httpParser{
 		urlParser: urlParser,
 	}
+	if urlParser == "normalizedUrl" {
+		parser.normalizer = normalizer
+		if parser.normalizer == nil {
+			parser.normalizer = NewUrlNormalizer(normalizerCfg)
+		}
+	}
+	return parser
 }
 
 func (http *httpParser) Parse(span *model.OtelSpan) *External {
@@ -22,20 +32,23 @@ func (http *httpParser) Parse(span *model.OtelSpan) *External {
 		return nil
 	}
 	httpMethod := span.GetHttpMethod()
-	if httpMethod == "" {
+	if httpMethod == "" || isGrpcWeb(span) {
 		return nil
 	}
 
 	url := span.GetHttpDetail()
+	peer := span.GetPeer("")
 	name := httpMethod
 	if http.urlParser == "topUrl" {
 		name = fmt.Sprintf("%s %s", httpMethod, GetTopUrl(url))
+	} else if http.normalizer != nil {
+		name = fmt.Sprintf("%s %s", httpMethod, http.normalizer.Normalize(peer, url))
 	}
 	return newExternal(span).
 		WithGroup(GroupExternal).
 		WithType("http").
 		WithName(name).
-		WithPeer(span.GetPeer("")).
+		WithPeer(peer).
 		WithDetail(url)
 }
 
@@ -1,6 +1,19 @@
 package external
 
-import "github.com/CloudDetail/apo-module/apm/model/v1"
+import (
+	"strings"
+
+	"github.com/CloudDetail/apo-module/apm/model/v1"
+)
+
+// AttributeSpanLinks keeps the links of the pushed spans as <traceId>:<spanId> separated by comma.
+const AttributeSpanLinks = "apo.span.links"
+
+var (
+	messageIdAttributes      = []string{"messaging.message.id", "messaging.message_id", "messaging.rocketmq.message_id"}
+	kafkaPartitionAttributes = []string{"messaging.destination.partition.id", "messaging.kafka.destination.partition", "messaging.kafka.partition"}
+	kafkaOffsetAttributes    = []string{"messaging.kafka.message.offset", "messaging.kafka.offset"}
+)
 
 type mqParser struct {
 }
@@ -35,10 +48,41 @@ func (mq *mqParser) Parse(span *model.OtelSpan) *External {
 		detail = span.Name
 	}
 
-	return newExternal(span).
+	external := newExternal(span).
 		WithGroup(GroupMq).
 		WithType(mqSystem).
 		WithName(name).
 		WithPeer(span.GetPeer("")).
 		WithDetail(detail)
+	if span.Kind != model.SpanKindClient {
+		external.WithMessage(getMessageId(span), getLinkedSpanIds(span))
+	}
+	return external
+}
+
+// getMessageId returns the message id, the kafka messages are identified by <partition>:<offset> in the destination.
+func getMessageId(span *model.OtelSpan) string {
+	if messageId := firstAttribute(span, messageIdAttributes, "", ""); messageId != "" {
+		return messageId
+	}
+	partition := firstAttribute(span, kafkaPartitionAttributes, "", "")
+	offset := firstAttribute(span, kafkaOffsetAttributes, "", "")
+	if partition != "" && offset != "" {
+		return partition + ":" + offset
+	}
+	return ""
+}
+
+func getLinkedSpanIds(span *model.OtelSpan) []string {
+	links := span.Attributes[AttributeSpanLinks]
+	if links == "" {
+		return nil
+	}
+	spanIds := make([]string, 0)
+	for _, link := range strings.Split(links, ",") {
+		if index := strings.IndexByte(link, ':'); index >= 0 && index+1 < len(link) {
+			spanIds = append(spanIds, link[index+1:])
+		}
+	}
+	return spanIds
 }
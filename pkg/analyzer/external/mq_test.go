@@ -0,0 +1,32 @@
+package external
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/apo-module/apm/model/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMqMessage(t *testing.T) {
+	externals := buildExternalDatas(t, "otel-2.9.0", "kafka")
+	if assert.Len(t, externals, 2) {
+		// The kafka messages are identified by <partition>:<offset>.
+		assert.Equal(t, "2:0", externals[0].MessageId)
+		assert.Equal(t, externals[0].MessageId, externals[1].MessageId)
+	}
+
+	parser := newMqParser()
+	consumer := parser.Parse(&model.OtelSpan{Kind: model.SpanKindConsumer, Name: "orders process", Attributes: map[string]string{
+		model.AttributeMessageSystem: "rocketmq",
+		"messaging.message.id":       "7F000001",
+		AttributeSpanLinks:           "0af7651916cd43dd8448eb211c80319c:00f067aa0ba902b7,0af7651916cd43dd8448eb211c80319d:00f067aa0ba902b8",
+	}})
+	assert.Equal(t, "7F000001", consumer.MessageId)
+	assert.Equal(t, []string{"00f067aa0ba902b7", "00f067aa0ba902b8"}, consumer.LinkedSpanIds)
+
+	client := parser.Parse(&model.OtelSpan{Kind: model.SpanKindClient, Name: "queue.declare", Attributes: map[string]string{
+		model.AttributeMessageSystem: "rabbitmq",
+		"messaging.message.id":       "1",
+	}})
+	assert.Empty(t, client.MessageId)
+}
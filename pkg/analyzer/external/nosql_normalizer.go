@@ -0,0 +1,147 @@
+package external
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const maxDocumentDepth = 32
+
+var errDocumentTooDeep = errors.New("the document is too deep")
+
+// documentSystems are the db.system sending the query documents in db.statement.
+var documentSystems = map[string]bool{
+	"mongodb":       true,
+	"elasticsearch": true,
+	"opensearch":    true,
+}
+
+// NormalizeDocument replaces the values of the query document with ?, the keys are kept in order and
+// the same elements of an array are collapsed, eg. {"$in":[1,2,3]} is {"$in":["?"]}.
+// If keepCommand is true, the first value is kept as it is the collection of the MongoDB command, eg. {"find":"orders"}.
+// nil is returned if the statement is not a JSON document.
+func NormalizeDocument(statement string, keepCommand bool) *NormalizedStatement {
+	decoder := json.NewDecoder(strings.NewReader(statement))
+	decoder.UseNumber()
+	token, err := decoder.Token()
+	if err != nil || token != json.Delim('{') {
+		return nil
+	}
+	var builder bytes.Buffer
+	operation, collection, err := normalizeObject(decoder, &builder, keepCommand, 1)
+	if err != nil {
+		return nil
+	}
+	if _, err = decoder.Token(); err != io.EOF {
+		return nil
+	}
+	normalized := &NormalizedStatement{
+		Operation:   operation,
+		Statement:   builder.String(),
+		Fingerprint: fingerprint(builder.String()),
+	}
+	if collection != "" {
+		normalized.Tables = []string{collection}
+	}
+	return normalized
+}
+
+// normalizeObject writes the object after the read {, the first key and its string value are returned if keepCommand is true.
+func normalizeObject(decoder *json.Decoder, builder *bytes.Buffer, keepCommand bool, depth int) (string, string, error) {
+	if depth > maxDocumentDepth {
+		return "", "", errDocumentTooDeep
+	}
+	var command, collection string
+	builder.WriteByte('{')
+	for i := 0; decoder.More(); i++ {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", "", err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return "", "", errors.New("the key is not a string")
+		}
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(strconv.Quote(key))
+		builder.WriteByte(':')
+		if i == 0 && keepCommand {
+			command = key
+			value, err := decoder.Token()
+			if err != nil {
+				return "", "", err
+			}
+			if name, isString := value.(string); isString {
+				collection = name
+				builder.WriteString(strconv.Quote(name))
+				continue
+			}
+			if err = normalizeToken(decoder, builder, value, depth); err != nil {
+				return "", "", err
+			}
+			continue
+		}
+		if err = normalizeValue(decoder, builder, depth); err != nil {
+			return "", "", err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return "", "", err
+	}
+	builder.WriteByte('}')
+	return command, collection, nil
+}
+
+func normalizeValue(decoder *json.Decoder, builder *bytes.Buffer, depth int) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	return normalizeToken(decoder, builder, token, depth)
+}
+
+func normalizeToken(decoder *json.Decoder, builder *bytes.Buffer, token json.Token, depth int) error {
+	switch token {
+	case json.Delim('{'):
+		_, _, err := normalizeObject(decoder, builder, false, depth+1)
+		return err
+	case json.Delim('['):
+		return normalizeArray(decoder, builder, depth+1)
+	}
+	builder.WriteString(strconv.Quote(placeholderValue))
+	return nil
+}
+
+// normalizeArray keeps the distinct elements in order, so the arrays of values and the documents of bulk writes are collapsed.
+func normalizeArray(decoder *json.Decoder, builder *bytes.Buffer, depth int) error {
+	if depth > maxDocumentDepth {
+		return errDocumentTooDeep
+	}
+	found := make(map[string]bool)
+	builder.WriteByte('[')
+	for decoder.More() {
+		var element bytes.Buffer
+		if err := normalizeValue(decoder, &element, depth); err != nil {
+			return err
+		}
+		if found[element.String()] {
+			continue
+		}
+		if len(found) > 0 {
+			builder.WriteByte(',')
+		}
+		found[element.String()] = true
+		builder.Write(element.Bytes())
+	}
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	builder.WriteByte(']')
+	return nil
+}
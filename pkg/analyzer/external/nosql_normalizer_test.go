@@ -0,0 +1,48 @@
+package external
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeDocument(t *testing.T) {
+	tests := []struct {
+		statement   string
+		keepCommand bool
+		operation   string
+		tables      []string
+		want        string
+	}{
+		{
+			statement:   `{"find": "orders", "filter": {"status": "paid", "amount": {"$gt": 100}, "_id": {"$in": [1, 2, 3]}}, "limit": 10}`,
+			keepCommand: true,
+			operation:   "find", tables: []string{"orders"},
+			want: `{"find":"orders","filter":{"status":"?","amount":{"$gt":"?"},"_id":{"$in":["?"]}},"limit":"?"}`,
+		},
+		{
+			statement:   `{"insert": "users", "documents": [{"name": "a", "age": 1}, {"name": "b", "age": 2}, {"name": "c"}]}`,
+			keepCommand: true,
+			operation:   "insert", tables: []string{"users"},
+			want: `{"insert":"users","documents":[{"name":"?","age":"?"},{"name":"?"}]}`,
+		},
+		{
+			statement: `{"query": {"bool": {"must": [{"match": {"title": "go"}}, {"range": {"year": {"gte": 2020}}}]}}, "size": 20}`,
+			want:      `{"query":{"bool":{"must":[{"match":{"title":"?"}},{"range":{"year":{"gte":"?"}}}]}},"size":"?"}`,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("Test-%d", i+1), func(t *testing.T) {
+			got := NormalizeDocument(tt.statement, tt.keepCommand)
+			assert.Equal(t, tt.operation, got.Operation)
+			assert.Equal(t, tt.tables, got.Tables)
+			assert.Equal(t, tt.want, got.Statement)
+		})
+	}
+	assert.Nil(t, NormalizeDocument(`db.orders.find({"status": "paid"})`, true))
+	assert.Nil(t, NormalizeDocument(`{"find": "orders"} trailing`, true))
+	assert.Equal(t,
+		NormalizeDocument(`{"find": "orders", "filter": {"_id": 1}}`, true).Fingerprint,
+		NormalizeDocument(`{"find":"orders","filter":{"_id":"5f1d"}}`, true).Fingerprint)
+}
@@ -15,6 +15,12 @@ type External struct {
 	Peer       string
 	Error      bool
 	Detail     string
+	// Fingerprint is the hash of the normalized statement, only set for the db clients.
+	Fingerprint string `json:",omitempty"`
+	// MessageId identifies the message sent by the producer and received by the consumer, only set for the mq clients.
+	MessageId string `json:",omitempty"`
+	// LinkedSpanIds are the spans linked by the mq clients, eg. the producers of the messages received in a batch.
+	LinkedSpanIds []string `json:",omitempty"`
 }
 
 func newExternal(span *model.OtelSpan) *External {
@@ -54,6 +60,17 @@ func (external *External) WithDetail(clientDetail string) *External {
 	return external
 }
 
+func (external *External) WithFingerprint(fingerprint string) *External {
+	external.Fingerprint = fingerprint
+	return external
+}
+
+func (external *External) WithMessage(messageId string, linkedSpanIds []string) *External {
+	external.MessageId = messageId
+	external.LinkedSpanIds = linkedSpanIds
+	return external
+}
+
 // For test
 func NewExternal(
 	clientTime uint64,
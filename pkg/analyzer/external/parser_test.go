@@ -178,6 +178,39 @@ func TestUnknownMiddlewares(t *testing.T) {
 	})
 }
 
+// The rpc fixtures are synthetic, see testdata/rpc/README.md.
+func TestRpcMiddlewares(t *testing.T) {
+	testMiddlewares(t, "rpc", map[string][]*External{
+		"thrift": {
+			NewExternal(1731000000010000000, 120000000, "c000000000000001", "b000000000000001", "external", "thrift", model.SpanKindClient, "tutorial.CalculatorService/add", "thrift-server:9090", false, "tutorial.CalculatorService/add"),
+			NewExternal(1731000000140000000, 30000000, "", "b000000000000002", "external", "thrift", model.SpanKindClient, "tutorial.CalculatorService/divide", "thrift-server:9090", true, "tutorial.CalculatorService/divide"),
+		},
+		"sofarpc": {
+			NewExternal(1731000001010000000, 80000000, "c000000000000011", "b000000000000011", "external", "sofarpc", model.SpanKindClient, "com.alipay.sofa.HelloService:1.0/sayHello", "10.0.0.21:12200", false, "com.alipay.sofa.HelloService:1.0/sayHello"),
+			NewExternal(1731000001100000000, 3000000000, "", "b000000000000012", "external", "sofarpc", model.SpanKindClient, "com.alipay.sofa.HelloService:1.0/sayHello", "10.0.0.21:12200", true, "com.alipay.sofa.HelloService:1.0/sayHello"),
+		},
+		"brpc": {
+			NewExternal(1731000002010000000, 5000000, "c000000000000021", "b000000000000021", "external", "brpc", model.SpanKindClient, "example.EchoService/Echo", "10.0.0.31:8000", false, "example.EchoService/Echo"),
+			NewExternal(1731000002020000000, 1000000000, "", "b000000000000022", "external", "brpc", model.SpanKindClient, "example.EchoService/Echo", "10.0.0.31:8000", true, "example.EchoService/Echo"),
+		},
+		"motan": {
+			NewExternal(1731000003010000000, 40000000, "c000000000000031", "b000000000000031", "external", "motan", model.SpanKindClient, "com.weibo.motan.demo.MotanDemoService/hello", "10.0.0.41:8002", false, "com.weibo.motan.demo.MotanDemoService/hello"),
+			NewExternal(1731000003060000000, 20000000, "", "b000000000000032", "external", "motan", model.SpanKindClient, "com.weibo.motan.demo.MotanDemoService/hello", "10.0.0.41:8002", true, "com.weibo.motan.demo.MotanDemoService/hello"),
+		},
+		"trpc": {
+			NewExternal(1731000004010000000, 15000000, "c000000000000041", "b000000000000041", "external", "trpc", model.SpanKindClient, "trpc.app.greeter.Greeter/SayHello", "10.0.0.51:8080", false, "trpc.app.greeter.Greeter/SayHello"),
+			NewExternal(1731000004030000000, 15000000, "", "b000000000000042", "external", "trpc", model.SpanKindClient, "trpc.app.greeter.Greeter/SayHello", "10.0.0.51:8080", true, "trpc.app.greeter.Greeter/SayHello"),
+		},
+		"grpc-web": {
+			NewExternal(1731000005010000000, 25000000, "c000000000000051", "b000000000000051", "external", "grpc_web", model.SpanKindClient, "helloworld.Greeter/SayHello", "envoy:8443", false, "helloworld.Greeter/SayHello"),
+			NewExternal(1731000005040000000, 25000000, "", "b000000000000052", "external", "grpc_web", model.SpanKindClient, "helloworld.Greeter/SayHello", "envoy:8443", true, "helloworld.Greeter/SayHello"),
+		},
+		"grpc": {
+			NewExternal(1731000006010000000, 10000000000, "", "b000000000000061", "external", "grpc", model.SpanKindClient, "Greeter/SayHello", "localhost:9002", true, "Greeter/SayHello"),
+		},
+	})
+}
+
 func testMiddlewares(t *testing.T, apmType string, data map[string][]*External) {
 	for testCase, expects := range data {
 		testClientCase := buildExternalDatas(t, apmType, testCase)
@@ -254,7 +287,7 @@ func checkBoolEqual(t *testing.T, key string, expect bool, got bool) {
 }
 
 func collectExternalDatas(clientDatas *[]*External, services []*model.OtelServiceNode) {
-	factory := NewExternalFactory("topUrl")
+	factory := NewExternalFactory(&ParserOptions{UrlParser: "topUrl"})
 	for _, service := range services {
 		*clientDatas = append(*clientDatas, factory.BuildExternals(service)...)
 		collectExternalDatas(clientDatas, service.Children)
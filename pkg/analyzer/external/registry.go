@@ -0,0 +1,101 @@
+package external
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+// The orders of the built-in parsers, the span is parsed by the parsers in ascending order until one is matched.
+const (
+	OrderRule    = 100
+	OrderDb      = 200
+	OrderHttp    = 300
+	OrderRpc     = 400
+	OrderMq      = 500
+	OrderUnknown = 600
+)
+
+// ParserOptions are the analyzer settings used to create the parsers.
+type ParserOptions struct {
+	UrlParser     string
+	UrlNormalizer *config.UrlNormalizerConfig
+	// Normalizer keeps the learned templates across the factories, it is created by UrlNormalizer if not set.
+	Normalizer *UrlNormalizer
+	Rules      []config.ExternalRule
+}
+
+// NewParserFunc creates the parser, nil is returned if the parser is not used with the options.
+type NewParserFunc func(options *ParserOptions) ExternalParser
+
+type registeredParser struct {
+	name      string
+	order     int
+	newParser NewParserFunc
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = make(map[string]*registeredParser)
+)
+
+func init() {
+	RegisterParser("rule", OrderRule, func(options *ParserOptions) ExternalParser {
+		return newRuleParser(options.Rules)
+	})
+	RegisterParser("db", OrderDb, func(options *ParserOptions) ExternalParser {
+		return newDbParser()
+	})
+	RegisterParser("http", OrderHttp, func(options *ParserOptions) ExternalParser {
+		return newHttpParser(options.UrlParser, options.UrlNormalizer, options.Normalizer)
+	})
+	RegisterParser("rpc", OrderRpc, func(options *ParserOptions) ExternalParser {
+		return newRpcParser()
+	})
+	RegisterParser("mq", OrderMq, func(options *ParserOptions) ExternalParser {
+		return newMqParser()
+	})
+	RegisterParser("unknown", OrderUnknown, func(options *ParserOptions) ExternalParser {
+		return newUnknownParser()
+	})
+}
+
+// RegisterParser adds the parser tried at the order, the parser registered with the same name is replaced.
+// The parsers are only used by the factories created after the registration.
+func RegisterParser(name string, order int, newParser NewParserFunc) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry[name] = &registeredParser{name: name, order: order, newParser: newParser}
+}
+
+// UnregisterParser removes the parser, the built-in parsers can be removed too.
+func UnregisterParser(name string) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	delete(registry, name)
+}
+
+func newParsers(options *ParserOptions) []ExternalParser {
+	registryMutex.Lock()
+	registered := make([]*registeredParser, 0, len(registry))
+	for _, parser := range registry {
+		registered = append(registered, parser)
+	}
+	registryMutex.Unlock()
+
+	// The parsers with the same order are sorted by name to be stable.
+	sort.Slice(registered, func(i, j int) bool {
+		if registered[i].order != registered[j].order {
+			return registered[i].order < registered[j].order
+		}
+		return registered[i].name < registered[j].name
+	})
+	parsers := make([]ExternalParser, 0, len(registered))
+	for _, parser := range registered {
+		if created := parser.newParser(options); created != nil {
+			parsers = append(parsers, created)
+		}
+	}
+	return parsers
+}
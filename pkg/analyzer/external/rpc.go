@@ -1,9 +1,107 @@
 package external
 
 import (
+	"strings"
+
 	"github.com/CloudDetail/apo-module/apm/model/v1"
 )
 
+const (
+	attributeGrpcStatusCode     = "rpc.grpc.status_code"
+	attributeGrpcWebContentType = "http.request.header.content-type"
+	attributeGrpcWebStatus      = "http.response.header.grpc-status"
+	contentTypeGrpcWeb          = "application/grpc-web"
+)
+
+// rpcFramework describes the semantic attributes of the spans of an RPC framework,
+// the first found attribute is used when several attributes are listed.
+type rpcFramework struct {
+	// name is the type of the externals.
+	name string
+	// systems are the values of rpc.system, they are compared in lower case with '-' as '_'.
+	systems []string
+	// markers identify the spans without rpc.system.
+	markers           []string
+	serviceAttributes []string
+	methodAttributes  []string
+	// peerAttributes are used before the peer attributes of the semantic conventions.
+	peerAttributes []string
+	statuses       []rpcStatus
+	// splitName takes the service and the method from the span name if they are not in the attributes.
+	splitName func(name string) (string, string)
+}
+
+// rpcStatus is the status code attribute of a framework, the call is failed if the value is not one of okValues.
+type rpcStatus struct {
+	attribute string
+	okValues  []string
+}
+
+var rpcFrameworks = []*rpcFramework{
+	{
+		name:     "grpc",
+		systems:  []string{"grpc"},
+		statuses: []rpcStatus{{attribute: attributeGrpcStatusCode, okValues: []string{"0"}}},
+	},
+	{
+		name:     "grpc_web",
+		systems:  []string{"grpc_web", "grpcweb"},
+		statuses: []rpcStatus{{attribute: attributeGrpcStatusCode, okValues: []string{"0"}}, {attribute: attributeGrpcWebStatus, okValues: []string{"0"}}},
+	},
+	{
+		name:              "thrift",
+		systems:           []string{"apache_thrift", "thrift"},
+		serviceAttributes: []string{"thrift.service"},
+		methodAttributes:  []string{"thrift.method"},
+	},
+	{
+		// SOFATracer tags the service with version as service:version, result.code is 00 for success.
+		name:              "sofarpc",
+		systems:           []string{"sofarpc", "sofa_rpc"},
+		serviceAttributes: []string{"sofa.rpc.service", "service"},
+		methodAttributes:  []string{"sofa.rpc.method", "method"},
+		peerAttributes:    []string{"remote.ip"},
+		statuses:          []rpcStatus{{attribute: "result.code", okValues: []string{"00"}}},
+	},
+	{
+		name:     "brpc",
+		systems:  []string{"brpc"},
+		statuses: []rpcStatus{{attribute: "rpc.brpc.error_code", okValues: []string{"0"}}},
+	},
+	{
+		name:              "motan",
+		systems:           []string{"motan", "motan2"},
+		serviceAttributes: []string{"motan.service"},
+		methodAttributes:  []string{"motan.method"},
+		statuses:          []rpcStatus{{attribute: "motan.response.code", okValues: []string{"0", "200"}}},
+		// SkyWalking names the motan spans by the java method as <Service>.<method>(<parameter types>).
+		splitName: splitJavaMethod,
+	},
+	{
+		// tRPC reports the framework and the business return codes separately.
+		name:              "trpc",
+		systems:           []string{"trpc"},
+		markers:           []string{"trpc.callee_service"},
+		serviceAttributes: []string{"trpc.callee_service"},
+		methodAttributes:  []string{"trpc.callee_method"},
+		statuses: []rpcStatus{
+			{attribute: "trpc.status_code", okValues: []string{"0"}},
+			{attribute: "trpc.framework_ret", okValues: []string{"0"}},
+			{attribute: "trpc.func_ret", okValues: []string{"0"}},
+		},
+	},
+}
+
+var rpcFrameworkBySystem = make(map[string]*rpcFramework)
+
+func init() {
+	for _, framework := range rpcFrameworks {
+		for _, system := range framework.systems {
+			rpcFrameworkBySystem[system] = framework
+		}
+	}
+}
+
 type rpcParser struct {
 }
 
@@ -16,14 +114,145 @@ func (rpc *rpcParser) Parse(span *model.OtelSpan) *External {
 		return nil
 	}
 	rpcSystem, rpcFound := span.Attributes[model.AttributeRpcSystem]
-	if !rpcFound {
-		return nil
+	framework := findRpcFramework(span, rpcSystem)
+	if framework == rpcFrameworkBySystem["grpc_web"] || isGrpcWeb(span) {
+		return parseGrpcWeb(span)
+	}
+	if framework == nil {
+		if !rpcFound {
+			return nil
+		}
+		// The generic rpc.system without dedicated handling, eg. apache_dubbo.
+		return newExternal(span).
+			WithGroup(GroupExternal).
+			WithType(rpcSystem).
+			WithName(span.Name).
+			WithPeer(span.GetPeer("")).
+			WithDetail(span.GetRpcDetail(span.Name))
 	}
 
-	return newExternal(span).
+	name := span.Name
+	detail := span.GetRpcDetail(span.Name)
+	service := firstAttribute(span, framework.serviceAttributes, model.AttributeRpcService, "")
+	method := firstAttribute(span, framework.methodAttributes, model.AttributeRpcMethod, "")
+	if service != "" && method != "" {
+		name = service + "/" + method
+		detail = name
+	} else if framework.splitName != nil {
+		if service, method = framework.splitName(span.Name); service != "" && method != "" {
+			name = service + "/" + method
+			detail = name
+		}
+	}
+	external := newExternal(span).
 		WithGroup(GroupExternal).
-		WithType(rpcSystem).
-		WithName(span.Name).
+		WithType(framework.name).
+		WithName(name).
+		WithPeer(firstAttribute(span, framework.peerAttributes, "", span.GetPeer(""))).
+		WithDetail(detail)
+	external.Error = external.Error || framework.isError(span)
+	return external
+}
+
+func findRpcFramework(span *model.OtelSpan, rpcSystem string) *rpcFramework {
+	if rpcSystem != "" {
+		return rpcFrameworkBySystem[strings.ReplaceAll(strings.ToLower(rpcSystem), "-", "_")]
+	}
+	for _, framework := range rpcFrameworks {
+		for _, marker := range framework.markers {
+			if _, found := span.Attributes[marker]; found {
+				return framework
+			}
+		}
+	}
+	return nil
+}
+
+func (framework *rpcFramework) isError(span *model.OtelSpan) bool {
+	for _, status := range framework.statuses {
+		value, found := span.Attributes[status.attribute]
+		if !found {
+			continue
+		}
+		value = headerValue(value)
+		isOk := false
+		for _, okValue := range status.okValues {
+			if value == okValue {
+				isOk = true
+				break
+			}
+		}
+		if !isOk {
+			return true
+		}
+	}
+	return false
+}
+
+// isGrpcWeb checks the HTTP spans of gRPC-Web calls without rpc.system, which are parsed as rpc rather than http.
+func isGrpcWeb(span *model.OtelSpan) bool {
+	return strings.Contains(span.Attributes[attributeGrpcWebContentType], contentTypeGrpcWeb)
+}
+
+// parseGrpcWeb takes the service and method from the path /<package.Service>/<Method> if rpc.service is not set.
+func parseGrpcWeb(span *model.OtelSpan) *External {
+	framework := rpcFrameworkBySystem["grpc_web"]
+	service := span.Attributes[model.AttributeRpcService]
+	method := span.Attributes[model.AttributeRpcMethod]
+	if service == "" || method == "" {
+		segments := strings.Split(strings.Trim(urlPath(span.GetHttpDetail()), "/"), "/")
+		if len(segments) >= 2 {
+			service = segments[len(segments)-2]
+			method = segments[len(segments)-1]
+		}
+	}
+	name := span.Name
+	if service != "" && method != "" {
+		name = service + "/" + method
+	}
+	external := newExternal(span).
+		WithGroup(GroupExternal).
+		WithType(framework.name).
+		WithName(name).
 		WithPeer(span.GetPeer("")).
-		WithDetail(span.GetRpcDetail(span.Name))
+		WithDetail(name)
+	external.Error = external.Error || framework.isError(span)
+	return external
+}
+
+// splitJavaMethod splits com.example.Service.method(java.lang.String) into com.example.Service and method.
+func splitJavaMethod(name string) (string, string) {
+	if index := strings.IndexByte(name, '('); index >= 0 {
+		name = name[:index]
+	}
+	index := strings.LastIndexByte(name, '.')
+	if index <= 0 || index == len(name)-1 {
+		return "", ""
+	}
+	return name[:index], name[index+1:]
+}
+
+// firstAttribute returns the first found attribute, then the default attribute and then the default value.
+func firstAttribute(span *model.OtelSpan, attributes []string, defaultAttribute string, defaultValue string) string {
+	for _, attribute := range attributes {
+		if value := span.Attributes[attribute]; value != "" {
+			return value
+		}
+	}
+	if value := span.Attributes[defaultAttribute]; value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// headerValue unwraps the header values captured as the json array, eg. ["0"].
+func headerValue(value string) string {
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		value = strings.Trim(value, "[]")
+		if index := strings.IndexByte(value, ','); index >= 0 {
+			value = value[:index]
+		}
+		value = strings.Trim(value, `"`)
+	}
+	return value
 }
@@ -0,0 +1,140 @@
+package external
+
+import (
+	"log"
+	"os"
+	"regexp"
+
+	"github.com/CloudDetail/apo-module/apm/model/v1"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+const (
+	variableSpanName = "span.name"
+	variableSpanPeer = "span.peer"
+)
+
+var spanKinds = map[string]model.OtelSpanKind{
+	"internal": model.SpanKindInternal,
+	"server":   model.SpanKindServer,
+	"client":   model.SpanKindClient,
+	"producer": model.SpanKindProducer,
+	"consumer": model.SpanKindConsumer,
+}
+
+// ruleParser parses the spans by the rules configured in analyzer.external_rules.
+type ruleParser struct {
+	rules []*externalRule
+}
+
+type externalRule struct {
+	kinds   map[model.OtelSpanKind]bool
+	matches []*attributeMatch
+	group   string
+	typ     string
+	name    string
+	peer    string
+	detail  string
+}
+
+type attributeMatch struct {
+	attribute string
+	regex     *regexp.Regexp
+}
+
+// newRuleParser returns nil if no rule is configured, the invalid rules are skipped.
+func newRuleParser(rules []config.ExternalRule) ExternalParser {
+	parser := &ruleParser{}
+	for _, rule := range rules {
+		if externalRule, err := newExternalRule(rule); err != nil {
+			log.Printf("[x Add External Rule] Rule: %s, Error: %s", rule.Name, err.Error())
+		} else {
+			parser.rules = append(parser.rules, externalRule)
+		}
+	}
+	if len(parser.rules) == 0 {
+		return nil
+	}
+	return parser
+}
+
+func newExternalRule(rule config.ExternalRule) (*externalRule, error) {
+	externalRule := &externalRule{
+		kinds:  make(map[model.OtelSpanKind]bool),
+		group:  orDefault(rule.External.Group, GroupExternal),
+		typ:    orDefault(rule.External.Type, rule.Name),
+		name:   orDefault(rule.External.Name, "${"+variableSpanName+"}"),
+		peer:   orDefault(rule.External.Peer, "${"+variableSpanPeer+"}"),
+		detail: rule.External.Detail,
+	}
+	kinds := rule.Kinds
+	if len(kinds) == 0 {
+		kinds = []string{"client"}
+	}
+	for _, kind := range kinds {
+		externalRule.kinds[spanKinds[kind]] = true
+	}
+	for _, match := range rule.Match {
+		attributeMatch := &attributeMatch{attribute: match.Attribute}
+		if match.Regex != "" {
+			regex, err := regexp.Compile(match.Regex)
+			if err != nil {
+				return nil, err
+			}
+			attributeMatch.regex = regex
+		}
+		externalRule.matches = append(externalRule.matches, attributeMatch)
+	}
+	return externalRule, nil
+}
+
+func (parser *ruleParser) Parse(span *model.OtelSpan) *External {
+	for _, rule := range parser.rules {
+		if rule.match(span) {
+			return newExternal(span).
+				WithGroup(rule.expand(rule.group, span)).
+				WithType(rule.expand(rule.typ, span)).
+				WithName(rule.expand(rule.name, span)).
+				WithPeer(rule.expand(rule.peer, span)).
+				WithDetail(rule.expand(rule.detail, span))
+		}
+	}
+	return nil
+}
+
+func (rule *externalRule) match(span *model.OtelSpan) bool {
+	if !rule.kinds[span.Kind] {
+		return false
+	}
+	for _, match := range rule.matches {
+		value, found := span.Attributes[match.attribute]
+		if !found {
+			return false
+		}
+		if match.regex != nil && !match.regex.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// expand replaces ${<attribute>} with the span attributes, the missing attributes are replaced with empty.
+func (rule *externalRule) expand(template string, span *model.OtelSpan) string {
+	return os.Expand(template, func(variable string) string {
+		switch variable {
+		case variableSpanName:
+			return span.Name
+		case variableSpanPeer:
+			return span.GetPeer("")
+		}
+		return span.Attributes[variable]
+	})
+}
+
+func orDefault(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
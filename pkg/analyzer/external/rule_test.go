@@ -0,0 +1,115 @@
+package external
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/apo-module/apm/model/v1"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+func newRuleSpan(kind model.OtelSpanKind, attributes map[string]string) *model.OtelSpan {
+	span := model.NewOtelSpan()
+	span.SetName("OrderService/order")
+	span.SetSpanId("01")
+	span.SetKind(kind)
+	for key, value := range attributes {
+		span.AddAttribute(key, value)
+	}
+	return span
+}
+
+func TestRuleParser(t *testing.T) {
+	rules := []config.ExternalRule{
+		{
+			Name:  "tars",
+			Match: []config.ExternalRuleMatch{{Attribute: "tars.servant"}, {Attribute: "tars.protocol", Regex: "^(tars|tup)$"}},
+			External: config.ExternalTemplate{
+				Name:   "${tars.servant}.${tars.func}",
+				Detail: "tars://${span.peer}/${tars.servant}",
+			},
+		},
+		{
+			Name:     "bus",
+			Kinds:    []string{"producer", "consumer"},
+			Match:    []config.ExternalRuleMatch{{Attribute: "bus.topic"}},
+			External: config.ExternalTemplate{Group: GroupMq, Type: "in-house-bus", Name: "${bus.topic}", Peer: "-"},
+		},
+	}
+	tests := []struct {
+		name   string
+		span   *model.OtelSpan
+		expect *External
+	}{
+		{
+			name: "template",
+			span: newRuleSpan(model.SpanKindClient, map[string]string{
+				"tars.servant": "Shop.OrderServer.OrderObj", "tars.func": "order", "tars.protocol": "tars", model.AttributeNetPeerName: "10.0.0.1",
+			}),
+			expect: NewExternal(0, 0, "", "01", GroupExternal, "tars", model.SpanKindClient, "Shop.OrderServer.OrderObj.order", "10.0.0.1", false, "tars://10.0.0.1/Shop.OrderServer.OrderObj"),
+		},
+		{
+			name:   "regex not matched",
+			span:   newRuleSpan(model.SpanKindClient, map[string]string{"tars.servant": "Shop.OrderServer.OrderObj", "tars.protocol": "json"}),
+			expect: nil,
+		},
+		{
+			name:   "kind not matched",
+			span:   newRuleSpan(model.SpanKindServer, map[string]string{"tars.servant": "Shop.OrderServer.OrderObj", "tars.protocol": "tars"}),
+			expect: nil,
+		},
+		{
+			name:   "second rule",
+			span:   newRuleSpan(model.SpanKindConsumer, map[string]string{"bus.topic": "order-created"}),
+			expect: NewExternal(0, 0, "", "01", GroupMq, "in-house-bus", model.SpanKindConsumer, "order-created", "-", false, ""),
+		},
+	}
+	parser := newRuleParser(rules)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, parser.Parse(tt.span))
+		})
+	}
+	assert.Nil(t, newRuleParser(nil))
+}
+
+func TestRuleBeforeBuiltinParsers(t *testing.T) {
+	// The dubbo client without rpc.system is unknown without the rule.
+	testMiddlewares(t, "unknown", map[string][]*External{
+		"dubbo": {
+			NewExternal(1730959641752503000, 965725000, "7e07b2ece6a18a58", "c33eeea5038d5daa", "external", "unknown", model.SpanKindClient, "io.apo.dubbo.api.service.OrderService/order2", "", false, ""),
+		},
+	})
+
+	factory := NewExternalFactory(&ParserOptions{Rules: []config.ExternalRule{{
+		Name:     "dubbo",
+		Match:    []config.ExternalRuleMatch{{Attribute: model.AttributeURLFULL, Regex: "^dubbo://"}},
+		External: config.ExternalTemplate{Detail: "${" + model.AttributeURLFULL + "}"},
+	}}})
+	span := newRuleSpan(model.SpanKindClient, map[string]string{model.AttributeURLFULL: "dubbo://localhost:30002/io.apo.dubbo.api.service.OrderService.order2"})
+	external := factory.buildExternal(span)
+	assert.Equal(t, "dubbo", external.Type)
+	assert.Equal(t, "dubbo://localhost:30002/io.apo.dubbo.api.service.OrderService.order2", external.Detail)
+}
+
+type fixedParser struct {
+	clientType string
+}
+
+func (parser *fixedParser) Parse(span *model.OtelSpan) *External {
+	return newExternal(span).WithGroup(GroupExternal).WithType(parser.clientType)
+}
+
+func TestRegisterParser(t *testing.T) {
+	RegisterParser("custom", OrderDb-1, func(options *ParserOptions) ExternalParser {
+		return &fixedParser{clientType: "custom"}
+	})
+	defer UnregisterParser("custom")
+
+	span := newRuleSpan(model.SpanKindClient, map[string]string{model.AttributeDBSystem: "mysql"})
+	assert.Equal(t, "custom", NewExternalFactory(&ParserOptions{}).buildExternal(span).Type)
+
+	UnregisterParser("custom")
+	assert.Equal(t, "mysql", NewExternalFactory(&ParserOptions{}).buildExternal(span).Type)
+}
@@ -0,0 +1,500 @@
+package external
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+const (
+	placeholderValue  = "?"
+	placeholderValues = "?+"
+)
+
+type sqlTokenType int
+
+const (
+	tokenWord sqlTokenType = iota
+	tokenQuoted
+	tokenValue
+	tokenPunct
+)
+
+type sqlToken struct {
+	typ  sqlTokenType
+	text string
+	// space is true if the token is separated from the previous token by spaces or comments.
+	space bool
+}
+
+// NormalizedStatement is the statement with the literals replaced by ?, the statements differ only in literals share the fingerprint.
+type NormalizedStatement struct {
+	Operation   string
+	Tables      []string
+	Statement   string
+	Fingerprint string
+}
+
+// tableKeywords are followed by the table names.
+var tableKeywords = map[string]bool{
+	"from":   true,
+	"join":   true,
+	"into":   true,
+	"update": true,
+	"table":  true,
+	"using":  true,
+}
+
+// aliasStopwords can not be the alias of a table.
+var aliasStopwords = map[string]bool{
+	"where": true, "join": true, "inner": true, "left": true, "right": true, "full": true, "outer": true,
+	"cross": true, "natural": true, "straight_join": true, "on": true, "using": true, "group": true,
+	"order": true, "limit": true, "offset": true, "having": true, "union": true, "except": true,
+	"intersect": true, "set": true, "values": true, "value": true, "select": true, "for": true,
+	"window": true, "returning": true, "partition": true, "force": true, "use": true, "ignore": true,
+	"lateral": true, "fetch": true, "when": true, "if": true, "default": true, "as": true,
+	"of": true, "nowait": true, "skip": true, "wait": true,
+}
+
+// NormalizeSql strips the literals, collapses the IN lists and the rows of VALUES,
+// and extracts the operation and the tables of the statement including the tables in JOINs and CTEs.
+func NormalizeSql(statement string) *NormalizedStatement {
+	tokens := collapseSqlTokens(tokenizeSql(statement))
+	if len(tokens) == 0 {
+		return nil
+	}
+	operation, ctes := parseSqlOperation(tokens)
+	return &NormalizedStatement{
+		Operation:   operation,
+		Tables:      parseSqlTables(tokens, ctes),
+		Statement:   joinSqlTokens(tokens),
+		Fingerprint: sqlFingerprint(tokens),
+	}
+}
+
+func tokenizeSql(statement string) []*sqlToken {
+	tokens := make([]*sqlToken, 0)
+	space := false
+	for i := 0; i < len(statement); {
+		c := statement[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			space = true
+			i++
+			continue
+		case c == '-' && i+1 < len(statement) && statement[i+1] == '-', c == '#':
+			for i < len(statement) && statement[i] != '\n' {
+				i++
+			}
+			space = true
+			continue
+		case c == '/' && i+1 < len(statement) && statement[i+1] == '*':
+			end := strings.Index(statement[i+2:], "*/")
+			if end < 0 {
+				i = len(statement)
+			} else {
+				i += end + 4
+			}
+			space = true
+			continue
+		}
+
+		token := &sqlToken{space: space && len(tokens) > 0}
+		start := i
+		switch {
+		case c == '\'':
+			i = skipQuoted(statement, i, '\'')
+			token.typ = tokenValue
+		case c == '"' && isComparedValue(tokens):
+			// The double quoted strings of MySQL, eg. name = "text".
+			i = skipQuoted(statement, i, c)
+			token.typ = tokenValue
+		case c == '"' || c == '`':
+			i = skipQuoted(statement, i, c)
+			token.typ, token.text = tokenQuoted, statement[start:i]
+		case c == '[' && isSqlBracketIdentifier(statement, i, tokens):
+			i = skipQuoted(statement, i, ']')
+			token.typ, token.text = tokenQuoted, statement[start:i]
+		case isDigit(c) || (c == '.' && i+1 < len(statement) && isDigit(statement[i+1])):
+			i = skipNumber(statement, i)
+			token.typ = tokenValue
+			if signed := signedValue(tokens); signed != nil {
+				// -1 is a value rather than the minus of 1.
+				tokens = tokens[:len(tokens)-1]
+				token.space = signed.space
+			}
+		case c == '?' || (c == '$' && i+1 < len(statement) && isDigit(statement[i+1])):
+			i++
+			for i < len(statement) && isDigit(statement[i]) {
+				i++
+			}
+			token.typ = tokenValue
+		case isWordByte(c):
+			for i < len(statement) && (isWordByte(statement[i]) || isDigit(statement[i])) {
+				i++
+			}
+			token.typ, token.text = tokenWord, statement[start:i]
+			if (token.text == "x" || token.text == "X" || token.text == "b" || token.text == "B" || token.text == "N" || token.text == "n") &&
+				i < len(statement) && statement[i] == '\'' {
+				// The prefixed strings, eg. x'0F' and N'text'.
+				i = skipQuoted(statement, i, '\'')
+				token.typ, token.text = tokenValue, ""
+			}
+		default:
+			i++
+			// The operators of multiple chars are kept together, eg. <=, <> and ::.
+			for i < len(statement) && strings.IndexByte("<>=!:|&", statement[i]) >= 0 && strings.IndexByte("<>=!:|&", c) >= 0 {
+				i++
+			}
+			token.typ, token.text = tokenPunct, statement[start:i]
+		}
+		if token.typ == tokenValue {
+			token.text = placeholderValue
+		}
+		tokens = append(tokens, token)
+		space = false
+	}
+	return tokens
+}
+
+// collapseSqlTokens collapses the values of IN lists to (?+) and keeps the first row of VALUES.
+func collapseSqlTokens(tokens []*sqlToken) []*sqlToken {
+	result := make([]*sqlToken, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		result = append(result, token)
+		if token.typ != tokenWord {
+			continue
+		}
+		keyword := strings.ToLower(token.text)
+		if keyword == "in" && i+1 < len(tokens) && tokens[i+1].text == "(" {
+			if end, ok := valueListEnd(tokens, i+1); ok {
+				result = append(result, tokens[i+1],
+					&sqlToken{typ: tokenValue, text: placeholderValues},
+					tokens[end])
+				i = end
+			}
+		} else if (keyword == "values" || keyword == "value") && i+1 < len(tokens) && tokens[i+1].text == "(" {
+			end := matchParen(tokens, i+1)
+			result = append(result, tokens[i+1:end+1]...)
+			i = end
+			// The next rows are dropped, eg. VALUES (?, ?), (?, ?).
+			for i+2 < len(tokens) && tokens[i+1].text == "," && tokens[i+2].text == "(" {
+				i = matchParen(tokens, i+2)
+			}
+		}
+	}
+	return result
+}
+
+// valueListEnd returns the index of the ) closing the list, ok is false if the list is not only values, eg. a subquery.
+func valueListEnd(tokens []*sqlToken, open int) (int, bool) {
+	for i := open + 1; i < len(tokens); i++ {
+		switch {
+		case tokens[i].text == ")":
+			return i, i > open+1
+		case tokens[i].typ == tokenValue || tokens[i].text == ",":
+			continue
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// matchParen returns the index of the ) closing the ( at open, or the last index if it is not closed.
+func matchParen(tokens []*sqlToken, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch tokens[i].text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(tokens) - 1
+}
+
+// parseSqlOperation returns the operation of the main statement and the names of CTEs.
+func parseSqlOperation(tokens []*sqlToken) (string, map[string]bool) {
+	ctes := make(map[string]bool)
+	i := 0
+	for i < len(tokens) && tokens[i].text == "(" {
+		i++
+	}
+	if i < len(tokens) && isKeyword(tokens[i], "with") {
+		i++
+		if i < len(tokens) && isKeyword(tokens[i], "recursive") {
+			i++
+		}
+		// WITH <name> [(<columns>)] AS [NOT] [MATERIALIZED] (<query>) [, ...]
+		for i < len(tokens) && tokens[i].typ != tokenPunct {
+			ctes[strings.ToLower(identifierName(tokens[i]))] = true
+			i++
+			if i < len(tokens) && tokens[i].text == "(" {
+				i = matchParen(tokens, i) + 1
+			}
+			for i < len(tokens) && tokens[i].typ == tokenWord && tokens[i].text != "(" {
+				i++
+			}
+			if i < len(tokens) && tokens[i].text == "(" {
+				i = matchParen(tokens, i) + 1
+			}
+			if i < len(tokens) && tokens[i].text == "," {
+				i++
+				continue
+			}
+			break
+		}
+	}
+	for i < len(tokens) && tokens[i].text == "(" {
+		i++
+	}
+	if i >= len(tokens) || tokens[i].typ != tokenWord {
+		return "", ctes
+	}
+	return strings.ToUpper(tokens[i].text), ctes
+}
+
+// parseSqlTables returns the distinct tables following FROM, JOIN, INTO, UPDATE, TABLE and USING,
+// the keywords in the parentheses of functions are skipped, eg. EXTRACT(YEAR FROM <column>).
+func parseSqlTables(tokens []*sqlToken, ctes map[string]bool) []string {
+	tables := make([]string, 0)
+	found := make(map[string]bool)
+	addTable := func(table string) {
+		if table != "" && !ctes[strings.ToLower(table)] && !found[table] {
+			found[table] = true
+			tables = append(tables, table)
+		}
+	}
+	queryParens := []bool{true}
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch {
+		case token.text == "(":
+			isQuery := i+1 < len(tokens) && (isKeyword(tokens[i+1], "select") || isKeyword(tokens[i+1], "with") || isKeyword(tokens[i+1], "values"))
+			queryParens = append(queryParens, isQuery)
+			continue
+		case token.text == ")":
+			if len(queryParens) > 1 {
+				queryParens = queryParens[:len(queryParens)-1]
+			}
+			continue
+		case token.typ != tokenWord || !queryParens[len(queryParens)-1] || !tableKeywords[strings.ToLower(token.text)]:
+			continue
+		}
+		keyword := strings.ToLower(token.text)
+		for {
+			table, next := parseTableName(tokens, i+1)
+			if table == "" {
+				break
+			}
+			if keyword == "update" && next < len(tokens) && tokens[next].text == "=" {
+				// ON DUPLICATE KEY UPDATE <column> = ?
+				break
+			}
+			addTable(table)
+			i = next - 1
+			if keyword != "from" && keyword != "update" {
+				break
+			}
+			// FROM <table> [AS] [<alias>], <table> ...
+			if i+1 < len(tokens) && isKeyword(tokens[i+1], "as") {
+				i++
+			}
+			if i+1 < len(tokens) && (tokens[i+1].typ == tokenQuoted || (tokens[i+1].typ == tokenWord && !aliasStopwords[strings.ToLower(tokens[i+1].text)])) {
+				i++
+			}
+			if i+1 >= len(tokens) || tokens[i+1].text != "," {
+				break
+			}
+			i++
+		}
+	}
+	return tables
+}
+
+// parseTableName returns the qualified name starting at start and the index after the name, eg. <db>.<table>.
+func parseTableName(tokens []*sqlToken, start int) (string, int) {
+	i := start
+	for i < len(tokens) && tokens[i].typ == tokenWord && isTableModifier(tokens[i].text) {
+		i++
+	}
+	parts := make([]string, 0)
+	for i < len(tokens) && (tokens[i].typ == tokenWord || tokens[i].typ == tokenQuoted) {
+		if tokens[i].typ == tokenWord && aliasStopwords[strings.ToLower(tokens[i].text)] {
+			break
+		}
+		parts = append(parts, identifierName(tokens[i]))
+		i++
+		if i+1 < len(tokens) && tokens[i].text == "." && !tokens[i].space {
+			i++
+			continue
+		}
+		break
+	}
+	if len(parts) == 0 {
+		return "", start
+	}
+	return strings.Join(parts, "."), i
+}
+
+// isTableModifier checks the words between the keyword and the table, eg. DELETE FROM ONLY <table>.
+func isTableModifier(word string) bool {
+	switch strings.ToLower(word) {
+	case "only", "if", "not", "exists", "ignore", "low_priority", "temporary":
+		return true
+	}
+	return false
+}
+
+func identifierName(token *sqlToken) string {
+	if token.typ == tokenQuoted && len(token.text) >= 2 {
+		return token.text[1 : len(token.text)-1]
+	}
+	return token.text
+}
+
+func joinSqlTokens(tokens []*sqlToken) string {
+	var builder strings.Builder
+	for i, token := range tokens {
+		if i > 0 && token.space {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(token.text)
+	}
+	return builder.String()
+}
+
+// sqlFingerprint ignores the spaces, comments and the case of words.
+func sqlFingerprint(tokens []*sqlToken) string {
+	texts := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if token.typ == tokenWord {
+			texts = append(texts, strings.ToLower(token.text))
+		} else {
+			texts = append(texts, token.text)
+		}
+	}
+	return fingerprint(strings.Join(texts, " "))
+}
+
+func fingerprint(text string) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(text))
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
+
+// signedValue returns the sign before a number if the sign is not an operator, eg. = -1 and (-1, +2).
+func signedValue(tokens []*sqlToken) *sqlToken {
+	if len(tokens) == 0 {
+		return nil
+	}
+	sign := tokens[len(tokens)-1]
+	if sign.text != "-" && sign.text != "+" {
+		return nil
+	}
+	if len(tokens) == 1 {
+		return sign
+	}
+	previous := tokens[len(tokens)-2]
+	if previous.typ == tokenPunct && previous.text != ")" {
+		return sign
+	}
+	if previous.typ == tokenWord && aliasStopwords[strings.ToLower(previous.text)] {
+		return sign
+	}
+	switch strings.ToLower(previous.text) {
+	case "and", "or", "not", "between", "like", "is", "in", "then", "else", "by":
+		return sign
+	}
+	return nil
+}
+
+// isComparedValue checks the token after a comparison, which is a value rather than an identifier.
+func isComparedValue(tokens []*sqlToken) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	previous := tokens[len(tokens)-1]
+	switch strings.ToLower(previous.text) {
+	case "=", "<", ">", "<=", ">=", "<>", "!=", "like", "regexp":
+		return true
+	}
+	return false
+}
+
+// isSqlBracketIdentifier checks [<name>] of SQL Server, the brackets after values or names are arrays or subscripts.
+func isSqlBracketIdentifier(statement string, index int, tokens []*sqlToken) bool {
+	if len(tokens) > 0 {
+		previous := tokens[len(tokens)-1]
+		if previous.typ == tokenValue || previous.typ == tokenQuoted || previous.text == ")" ||
+			(previous.typ == tokenWord && !aliasStopwords[strings.ToLower(previous.text)] && !tableKeywords[strings.ToLower(previous.text)]) {
+			return false
+		}
+	}
+	end := strings.IndexByte(statement[index:], ']')
+	return end > 1 && !strings.ContainsAny(statement[index+1:index+end], ",'\"[")
+}
+
+func skipQuoted(statement string, index int, quote byte) int {
+	for i := index + 1; i < len(statement); i++ {
+		switch statement[i] {
+		case '\\':
+			if quote == '\'' {
+				i++
+			}
+		case quote:
+			// The quote is escaped by doubling, eg. 'it''s'.
+			if i+1 < len(statement) && statement[i+1] == quote && quote != ']' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(statement)
+}
+
+func skipNumber(statement string, index int) int {
+	i := index
+	if statement[i] == '0' && i+1 < len(statement) && (statement[i+1] == 'x' || statement[i+1] == 'X') {
+		i += 2
+		for i < len(statement) && isHex(statement[i:i+1]) {
+			i++
+		}
+		return i
+	}
+	for i < len(statement) && (isDigit(statement[i]) || statement[i] == '.') {
+		i++
+	}
+	if i < len(statement) && (statement[i] == 'e' || statement[i] == 'E') {
+		next := i + 1
+		if next < len(statement) && (statement[next] == '+' || statement[next] == '-') {
+			next++
+		}
+		if next < len(statement) && isDigit(statement[next]) {
+			i = next
+			for i < len(statement) && isDigit(statement[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+func isKeyword(token *sqlToken, keyword string) bool {
+	return token.typ == tokenWord && strings.EqualFold(token.text, keyword)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '@' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
@@ -0,0 +1,96 @@
+package external
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeSql(t *testing.T) {
+	tests := []struct {
+		statement string
+		operation string
+		tables    []string
+		want      string
+	}{
+		{
+			statement: "select id, city from weather where temp_lo<=? and temp_hi>=?",
+			operation: "SELECT", tables: []string{"weather"},
+			want: "select id, city from weather where temp_lo<=? and temp_hi>=?",
+		},
+		{
+			statement: "SELECT * FROM users WHERE name = 'it''s' AND age > -18.5 AND flag = x'0F' AND id = $1",
+			operation: "SELECT", tables: []string{"users"},
+			want: "SELECT * FROM users WHERE name = ? AND age > ? AND flag = ? AND id = ?",
+		},
+		{
+			statement: "SELECT * FROM orders WHERE status = \"paid\" AND id IN (1, 2, 3) -- comment\n LIMIT 10",
+			operation: "SELECT", tables: []string{"orders"},
+			want: "SELECT * FROM orders WHERE status = ? AND id IN (?+) LIMIT ?",
+		},
+		{
+			statement: "INSERT INTO shop.orders (id, name) VALUES (1, 'a'), (2, 'b'), (3, 'c')",
+			operation: "INSERT", tables: []string{"shop.orders"},
+			want: "INSERT INTO shop.orders (id, name) VALUES (?, ?)",
+		},
+		{
+			statement: "select o.id from orders o inner join customers as c on o.cid = c.id left outer join `items` i using (oid) where c.rid in (select id from zones)",
+			operation: "SELECT", tables: []string{"orders", "customers", "items", "zones"},
+			want: "select o.id from orders o inner join customers as c on o.cid = c.id left outer join `items` i using (oid) where c.rid in (select id from zones)",
+		},
+		{
+			statement: "select a.x from a, b as bb, \"public\".\"C\" where a.id = bb.id",
+			operation: "SELECT", tables: []string{"a", "b", "public.C"},
+			want: "select a.x from a, b as bb, \"public\".\"C\" where a.id = bb.id",
+		},
+		{
+			statement: "WITH recent AS (SELECT * FROM orders WHERE created > '2024-01-01'), top AS (SELECT cid FROM recent) SELECT * FROM top JOIN customers ON top.cid = customers.id",
+			operation: "SELECT", tables: []string{"orders", "customers"},
+			want: "WITH recent AS (SELECT * FROM orders WHERE created > ?), top AS (SELECT cid FROM recent) SELECT * FROM top JOIN customers ON top.cid = customers.id",
+		},
+		{
+			statement: "UPDATE stock SET count = count - 1 WHERE id = 7",
+			operation: "UPDATE", tables: []string{"stock"},
+			want: "UPDATE stock SET count = count - ? WHERE id = ?",
+		},
+		{
+			statement: "insert into t (a) values (1) on duplicate key update a = 2",
+			operation: "INSERT", tables: []string{"t"},
+			want: "insert into t (a) values (?) on duplicate key update a = ?",
+		},
+		{
+			statement: "select extract(year from created), count(*) from logs for update nowait",
+			operation: "SELECT", tables: []string{"logs"},
+			want: "select extract(year from created), count(*) from logs for update nowait",
+		},
+		{
+			statement: "SELECT * FROM ks.users WHERE user_id = 123e4567 /* cql */ ALLOW FILTERING",
+			operation: "SELECT", tables: []string{"ks.users"},
+			want: "SELECT * FROM ks.users WHERE user_id = ? ALLOW FILTERING",
+		},
+		{
+			statement: "SELECT 1",
+			operation: "SELECT", tables: []string{},
+			want: "SELECT ?",
+		},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("Test-%d", i+1), func(t *testing.T) {
+			got := NormalizeSql(tt.statement)
+			assert.Equal(t, tt.operation, got.Operation)
+			assert.Equal(t, tt.tables, got.Tables)
+			assert.Equal(t, tt.want, got.Statement)
+		})
+	}
+	assert.Nil(t, NormalizeSql(" -- comment only"))
+}
+
+func TestSqlFingerprint(t *testing.T) {
+	fingerprint := NormalizeSql("SELECT * FROM orders WHERE id IN (1, 2) AND name = 'a'").Fingerprint
+	assert.NotEmpty(t, fingerprint)
+	// The literals, spaces, comments and the case of keywords are ignored.
+	assert.Equal(t, fingerprint, NormalizeSql("select *\n  from orders /* hint */ where id in (3,4,5,6) and name='b'").Fingerprint)
+	assert.Equal(t, NormalizeSql("insert into t values (1)").Fingerprint, NormalizeSql("insert into t values (1), (2), (3)").Fingerprint)
+	assert.NotEqual(t, fingerprint, NormalizeSql("SELECT * FROM orders WHERE id IN (1, 2) AND code = 'a'").Fingerprint)
+}
@@ -13,7 +13,14 @@ func newUnknownParser() *unknownParser {
 	return &unknownParser{}
 }
 
+// Parse is the last parser of the client spans, the spans with db.system are not parsed as they are parsed by dbParser.
 func (unknown *unknownParser) Parse(span *model.OtelSpan) *External {
+	if span.Kind != model.SpanKindClient {
+		return nil
+	}
+	if _, dbFound := span.Attributes[model.AttributeDBSystem]; dbFound {
+		return nil
+	}
 	return newExternal(span).
 		WithGroup(GroupExternal).
 		WithType(Unknown).
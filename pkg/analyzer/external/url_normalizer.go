@@ -0,0 +1,251 @@
+package external
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+const (
+	defaultMaxTemplates      = 200
+	defaultVariableThreshold = 20
+	// maxNormalizerPeers bounds the peers with learned templates, the urls of other peers are named by the first segment.
+	maxNormalizerPeers = 1000
+	// maxValueKeysRatio bounds the segments tracked for learning the variables of a peer to the ratio of max templates.
+	maxValueKeysRatio = 4
+
+	placeholderId   = "{id}"
+	placeholderUuid = "{uuid}"
+	placeholderHash = "{hash}"
+	placeholderVar  = "{var}"
+	placeholderAny  = "{*}"
+)
+
+var (
+	UrlTemplateOverflowsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_url_template_overflows_total",
+			Help: "The total number of urls named by the first segment as the templates of the peer are full",
+		},
+	)
+
+	uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+func init() {
+	prometheus.MustRegister(UrlTemplateOverflowsTotal)
+}
+
+// UrlNormalizer names the urls by the path templates learned per peer, the number of templates is bounded.
+type UrlNormalizer struct {
+	patterns          []*urlPattern
+	maxTemplates      int
+	variableThreshold int
+	mutex             sync.Mutex
+	peers             map[string]*peerTemplates
+}
+
+type urlPattern struct {
+	regex       *regexp.Regexp
+	placeholder string
+}
+
+type peerTemplates struct {
+	templates map[string]bool
+	values    map[string]map[string]struct{} // <template with the segment as {var}, distinct values of the segment>
+	variables map[string]bool                // <template with the segment as {var}, learned>
+}
+
+func NewUrlNormalizer(cfg *config.UrlNormalizerConfig) *UrlNormalizer {
+	normalizer := &UrlNormalizer{
+		maxTemplates:      defaultMaxTemplates,
+		variableThreshold: defaultVariableThreshold,
+		peers:             make(map[string]*peerTemplates),
+	}
+	if cfg == nil {
+		return normalizer
+	}
+	if cfg.MaxTemplates > 0 {
+		normalizer.maxTemplates = cfg.MaxTemplates
+	}
+	if cfg.VariableThreshold > 0 {
+		normalizer.variableThreshold = cfg.VariableThreshold
+	}
+	for _, pattern := range cfg.Patterns {
+		regex, err := regexp.Compile(pattern.Regex)
+		if err != nil {
+			log.Printf("[x Add Url Pattern] Regex: %s, Error: %s", pattern.Regex, err.Error())
+			continue
+		}
+		normalizer.patterns = append(normalizer.patterns, &urlPattern{regex: regex, placeholder: pattern.Placeholder})
+	}
+	return normalizer
+}
+
+// Normalize returns the path template of the url called to the peer, eg. /orders/{id}/items.
+func (normalizer *UrlNormalizer) Normalize(peer string, url string) string {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(urlPath(url), "/") {
+		if segment != "" {
+			segments = append(segments, normalizer.normalizeSegment(segment))
+		}
+	}
+	if len(segments) == 0 {
+		return "/"
+	}
+
+	normalizer.mutex.Lock()
+	defer normalizer.mutex.Unlock()
+	templates, found := normalizer.peers[peer]
+	if !found {
+		if len(normalizer.peers) >= maxNormalizerPeers {
+			UrlTemplateOverflowsTotal.Inc()
+			return coarseTemplate(segments)
+		}
+		templates = &peerTemplates{
+			templates: make(map[string]bool),
+			values:    make(map[string]map[string]struct{}),
+			variables: make(map[string]bool),
+		}
+		normalizer.peers[peer] = templates
+	}
+	return templates.match(segments, normalizer.maxTemplates, normalizer.variableThreshold)
+}
+
+func (normalizer *UrlNormalizer) normalizeSegment(segment string) string {
+	for _, pattern := range normalizer.patterns {
+		if pattern.regex.MatchString(segment) {
+			return pattern.placeholder
+		}
+	}
+	if isDigits(segment) {
+		return placeholderId
+	}
+	if uuidRegex.MatchString(segment) {
+		return placeholderUuid
+	}
+	if len(segment) >= 16 && isHex(segment) {
+		return placeholderHash
+	}
+	return segment
+}
+
+// match returns the known template of the segments, or adds the template if the templates are not full.
+// A segment is learned as {var} when more than variableThreshold values are seen in the same template,
+// the paths seen before are named by their values until then and their templates are removed when it is learned.
+func (templates *peerTemplates) match(segments []string, maxTemplates int, variableThreshold int) string {
+	for i := range segments {
+		if !isPlaceholder(segments[i]) && templates.variables[variableKey(segments, i)] {
+			segments[i] = placeholderVar
+		}
+	}
+	template := joinSegments(segments)
+	if templates.templates[template] {
+		return template
+	}
+
+	for i := range segments {
+		if isPlaceholder(segments[i]) {
+			continue
+		}
+		key := variableKey(segments, i)
+		values, found := templates.values[key]
+		if !found {
+			if len(templates.values) >= maxTemplates*maxValueKeysRatio {
+				continue
+			}
+			values = make(map[string]struct{})
+			templates.values[key] = values
+		}
+		values[segments[i]] = struct{}{}
+		if len(values) > variableThreshold {
+			templates.variables[key] = true
+			delete(templates.values, key)
+			templates.removeLiterals(segments, i, values)
+			segments[i] = placeholderVar
+		}
+	}
+	template = joinSegments(segments)
+	if templates.templates[template] {
+		return template
+	}
+	if len(templates.templates) >= maxTemplates {
+		UrlTemplateOverflowsTotal.Inc()
+		return coarseTemplate(segments)
+	}
+	templates.templates[template] = true
+	return template
+}
+
+// removeLiterals removes the templates added with the values of the segment learned as {var},
+// so they are not kept in the bounded templates.
+func (templates *peerTemplates) removeLiterals(segments []string, index int, values map[string]struct{}) {
+	literal := make([]string, len(segments))
+	copy(literal, segments)
+	for value := range values {
+		literal[index] = value
+		delete(templates.templates, joinSegments(literal))
+	}
+}
+
+// urlPath returns the path of the url without the schema, host, query and fragment.
+func urlPath(url string) string {
+	if index := strings.IndexAny(url, "?#"); index >= 0 {
+		url = url[:index]
+	}
+	if index := strings.Index(url, "://"); index >= 0 {
+		url = url[index+3:]
+		index = strings.IndexByte(url, '/')
+		if index < 0 {
+			return "/"
+		}
+		url = url[index:]
+	}
+	return url
+}
+
+func variableKey(segments []string, index int) string {
+	key := make([]string, len(segments))
+	copy(key, segments)
+	key[index] = placeholderVar
+	return joinSegments(key)
+}
+
+func coarseTemplate(segments []string) string {
+	if len(segments) == 1 {
+		return "/" + segments[0]
+	}
+	return "/" + segments[0] + "/" + placeholderAny
+}
+
+func joinSegments(segments []string) string {
+	return "/" + strings.Join(segments, "/")
+}
+
+func isPlaceholder(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func isDigits(segment string) bool {
+	for i := 0; i < len(segment); i++ {
+		if segment[i] < '0' || segment[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(segment string) bool {
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+	return true
+}
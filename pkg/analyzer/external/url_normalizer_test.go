@@ -0,0 +1,81 @@
+package external
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/CloudDetail/apo-module/apm/model/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+func TestNormalizeUrl(t *testing.T) {
+	normalizer := NewUrlNormalizer(&config.UrlNormalizerConfig{
+		Patterns: []config.UrlPattern{{Regex: "^v[0-9]+$", Placeholder: "{version}"}},
+	})
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "http://localhost:9999", want: "/"},
+		{url: "http://localhost:9999/?a=1", want: "/"},
+		{url: "http://localhost:9999/orders/1234/items?page=2", want: "/orders/{id}/items"},
+		{url: "/orders/1234/items/", want: "/orders/{id}/items"},
+		{url: "http://localhost:9999/users/0af76519-16cd-43dd-8448-eb211c80319c#profile", want: "/users/{uuid}"},
+		{url: "http://localhost:9999/blobs/0af7651916cd43dd8448eb211c80319c", want: "/blobs/{hash}"},
+		{url: "http://localhost:9999/v2/orders", want: "/{version}/orders"},
+		// Short hex words are not hashes.
+		{url: "http://localhost:9999/cafe/beef", want: "/cafe/beef"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("Test-%d", i+1), func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizer.Normalize("localhost:9999", tt.url))
+		})
+	}
+}
+
+func TestNormalizeUrlLearnVariables(t *testing.T) {
+	normalizer := NewUrlNormalizer(&config.UrlNormalizerConfig{VariableThreshold: 3})
+	for _, name := range []string{"alice", "bob", "carol"} {
+		assert.Equal(t, "/users/"+name+"/profile", normalizer.Normalize("user:80", "/users/"+name+"/profile"))
+	}
+	// The 4th distinct name is learned as a variable, and the names seen are also named by the variable.
+	assert.Equal(t, "/users/{var}/profile", normalizer.Normalize("user:80", "/users/dave/profile"))
+	assert.Equal(t, "/users/{var}/profile", normalizer.Normalize("user:80", "/users/alice/profile"))
+	// The templates are learned per peer.
+	assert.Equal(t, "/users/dave/profile", normalizer.Normalize("admin:80", "/users/dave/profile"))
+}
+
+func TestNormalizeUrlRemoveLearnedLiterals(t *testing.T) {
+	overflows := testutil.ToFloat64(UrlTemplateOverflowsTotal)
+	normalizer := NewUrlNormalizer(&config.UrlNormalizerConfig{MaxTemplates: 3, VariableThreshold: 2})
+	assert.Equal(t, "/users/alice", normalizer.Normalize("user:80", "/users/alice"))
+	assert.Equal(t, "/users/bob", normalizer.Normalize("user:80", "/users/bob"))
+	assert.Equal(t, "/users/{var}", normalizer.Normalize("user:80", "/users/carol"))
+	// The templates of alice and bob are removed, so the new paths are not overflowed.
+	assert.Equal(t, "/orders", normalizer.Normalize("user:80", "/orders"))
+	assert.Equal(t, "/carts", normalizer.Normalize("user:80", "/carts"))
+	assert.Equal(t, "/users/{var}", normalizer.Normalize("user:80", "/users/bob"))
+	assert.Equal(t, overflows, testutil.ToFloat64(UrlTemplateOverflowsTotal))
+}
+
+func TestNormalizeUrlMaxTemplates(t *testing.T) {
+	overflows := testutil.ToFloat64(UrlTemplateOverflowsTotal)
+	normalizer := NewUrlNormalizer(&config.UrlNormalizerConfig{MaxTemplates: 2})
+	assert.Equal(t, "/orders", normalizer.Normalize("order:80", "/orders"))
+	assert.Equal(t, "/orders/{id}/items", normalizer.Normalize("order:80", "/orders/1/items"))
+	assert.Equal(t, "/carts/{*}", normalizer.Normalize("order:80", "/carts/1/items"))
+	assert.Equal(t, "/orders/{id}/items", normalizer.Normalize("order:80", "/orders/2/items"))
+	assert.Equal(t, overflows+1, testutil.ToFloat64(UrlTemplateOverflowsTotal))
+}
+
+func TestHttpParserNormalizedUrl(t *testing.T) {
+	parser := newHttpParser("normalizedUrl", nil, nil)
+	span := model.NewOtelSpan()
+	span.SetKind(model.SpanKindClient)
+	span.AddAttribute(model.AttributeHttpMethod, "GET")
+	span.AddAttribute(model.AttributeURLFULL, "http://localhost:9999/orders/42/items")
+	assert.Equal(t, "GET /orders/{id}/items", parser.Parse(span).Name)
+}
@@ -0,0 +1,43 @@
+package analyzer
+
+import (
+	"github.com/CloudDetail/apo-module/model/v1"
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	"github.com/CloudDetail/apo-receiver/pkg/componment/redis"
+)
+
+// traceIdentities are the agent identities of the traces analyzed together, read with the traces from the cache,
+// so the spans received by other receivers sharing Redis keep their identity.
+type traceIdentities map[string]*auth.Identity // <apmSpanId, identity>
+
+func (identities traceIdentities) add(cachedTrace *redis.CachedTrace) {
+	if cachedTrace.Identity != nil {
+		identities[cachedTrace.Trace.Labels.ApmSpanId] = cachedTrace.Identity
+	}
+}
+
+// merge returns the identities of both, the identities are not changed as they are shared by the tasks of the trace.
+func (identities traceIdentities) merge(newIdentities traceIdentities) traceIdentities {
+	merged := make(traceIdentities, len(identities)+len(newIdentities))
+	for apmSpanId, identity := range identities {
+		merged[apmSpanId] = identity
+	}
+	for apmSpanId, identity := range newIdentities {
+		merged[apmSpanId] = identity
+	}
+	return merged
+}
+
+// get returns the identity of trace, only the tenant is kept for the traces cached without the identity,
+// eg. auth is disabled or cached by the old receivers, so that they are still stored to the database of the tenant.
+func (identities traceIdentities) get(tenantName string, trace *model.Trace) *auth.Identity {
+	if trace != nil {
+		if identity := identities[trace.Labels.ApmSpanId]; identity != nil {
+			return identity
+		}
+	}
+	if tenantName == "" {
+		return nil
+	}
+	return &auth.Identity{Tenant: tenantName}
+}
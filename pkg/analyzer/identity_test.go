@@ -0,0 +1,38 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/apo-module/model/v1"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	"github.com/CloudDetail/apo-receiver/pkg/componment/redis"
+	"github.com/CloudDetail/apo-receiver/pkg/global"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
+)
+
+func newIdentityTestTrace(apmSpanId string) *model.Trace {
+	return &model.Trace{Labels: &model.TraceLabels{TraceId: "trace-1", ApmSpanId: apmSpanId}}
+}
+
+func TestGetTracesFromCacheIdentities(t *testing.T) {
+	global.CACHE = redis.NewLocalCache(60)
+	defer func() { global.CACHE = nil }()
+	identity := &auth.Identity{Cluster: "c1", Tenant: "t1", Node: "node-1"}
+	// The spans are cached by the receivers of the agents, the identity is carried with the cached span.
+	global.CACHE.StoreTrace(tenant.Key("t1", "trace-1"), newIdentityTestTrace("span-1"), identity)
+	global.CACHE.StoreTrace(tenant.Key("t1", "trace-1"), newIdentityTestTrace("span-2"), nil)
+
+	traces, identities := getTracesFromCache("t1", "trace-1")
+	assert.Len(t, traces.Traces, 2)
+	assert.Equal(t, identity, identities.get("t1", traces.FindTrace("span-1")))
+	// Only the tenant is kept for the span cached without the identity.
+	assert.Equal(t, &auth.Identity{Tenant: "t1"}, identities.get("t1", traces.FindTrace("span-2")))
+	assert.Nil(t, identities.get("", traces.FindTrace("span-2")))
+
+	// The merged identities are new, the identities shared by the tasks are not changed.
+	merged := identities.merge(traceIdentities{"span-2": identity})
+	assert.Equal(t, identity, merged.get("t1", traces.FindTrace("span-2")))
+	assert.Equal(t, &auth.Identity{Tenant: "t1"}, identities.get("t1", traces.FindTrace("span-2")))
+}
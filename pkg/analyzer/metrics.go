@@ -0,0 +1,162 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
+	"github.com/CloudDetail/apo-receiver/pkg/global"
+
+	apmmodel "github.com/CloudDetail/apo-module/apm/model/v1"
+)
+
+var (
+	TaskPoolTasks = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "originx_receiver_task_pool_tasks",
+			Help: "The number of tasks waiting in the task pool, queue is todo or retry",
+		},
+		[]string{"queue"},
+	)
+	WorkerBacklog = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "originx_receiver_worker_backlog",
+			Help: "The number of tasks dispatched to the worker channel and not finished yet",
+		},
+		[]string{"worker"},
+	)
+	PendingTraces = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "originx_receiver_pending_traces",
+			Help: "The number of traces waiting to be analyzed, map is wait or check_miss",
+		},
+		[]string{"map"},
+	)
+	ReportRetriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_report_retries_total",
+			Help: "The total number of retried report tasks",
+		},
+		[]string{"type", "reason"},
+	)
+	ReportDropsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_report_drops_total",
+			Help: "The total number of dropped report tasks",
+		},
+		[]string{"type", "reason"},
+	)
+	ApmQueryDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "originx_receiver_apm_query_duration_seconds",
+			Help:    "The duration of querying the services of a trace from the APM trace backend",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+		},
+		[]string{"apm_type"},
+	)
+	ApmQueryErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_apm_query_errors_total",
+			Help: "The total number of failed queries to the APM trace backend",
+		},
+		[]string{"apm_type"},
+	)
+	CacheLookupsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_cache_lookups_total",
+			Help: "The total number of cache lookups, cache is trace or relation and result is hit or miss",
+		},
+		[]string{"cache", "result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(TaskPoolTasks, WorkerBacklog, PendingTraces, ReportRetriesTotal, ReportDropsTotal,
+		ApmQueryDuration, ApmQueryErrorsTotal, CacheLookupsTotal)
+}
+
+// The reasons of the retried and dropped reports, they are kept few to bound the series.
+const (
+	reasonApmQuery       = "apm_query"
+	reasonNotFound       = "not_found"
+	reasonBelowThreshold = "below_threshold"
+	reasonNotSampled     = "not_sampled"
+	reasonNotProfiled    = "not_profiled"
+	reasonNotMonitored   = "not_monitored"
+	reasonNoRootCause    = "no_root_cause"
+	reasonShutdown       = "shutdown"
+	reasonUnknown        = "unknown"
+)
+
+// reportError is an error of building report labeled with the reason for metrics.
+type reportError struct {
+	reason string
+	err    error
+}
+
+func (e *reportError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reportError) Unwrap() error {
+	return e.err
+}
+
+func newReportError(reason string, format string, args ...interface{}) error {
+	return &reportError{reason: reason, err: fmt.Errorf(format, args...)}
+}
+
+func withReason(reason string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &reportError{reason: reason, err: err}
+}
+
+func errorReason(err error) string {
+	var reportErr *reportError
+	if errors.As(err, &reportErr) {
+		return reportErr.reason
+	}
+	if errors.Is(err, ErrNoSampledTrace) {
+		return reasonNotSampled
+	}
+	return reasonUnknown
+}
+
+func reportTypeLabel(reportType report.ReportType) string {
+	return strings.ToLower(reportType.String())
+}
+
+func workerLabel(index int) string {
+	return strconv.Itoa(index + 1)
+}
+
+func recordCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheLookupsTotal.WithLabelValues(cache, result).Inc()
+}
+
+// queryServices builds the services of trace from the pushed spans, the APM trace backend is queried
+// if no span is received or the trace is not complete yet, and the latency and errors of the remote query are recorded.
+func queryServices(tenantName string, apmType string, traceId string, startTimeMs uint64) ([]*apmmodel.OtelServiceNode, error) {
+	if serviceNodes := global.TRACE_CLIENT.QueryLocalServices(tenantName, traceId); serviceNodes != nil {
+		return serviceNodes, nil
+	}
+	startTime := time.Now()
+	serviceNodes, err := global.TRACE_CLIENT.QueryRemoteServices(apmType, traceId, startTimeMs)
+	ApmQueryDuration.WithLabelValues(apmType).Observe(time.Since(startTime).Seconds())
+	if err != nil {
+		ApmQueryErrorsTotal.WithLabelValues(apmType).Inc()
+		return nil, withReason(reasonApmQuery, err)
+	}
+	return serviceNodes, nil
+}
@@ -0,0 +1,134 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-module/model/v1"
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
+	"github.com/CloudDetail/apo-receiver/pkg/componment/redis"
+	"github.com/CloudDetail/apo-receiver/pkg/componment/spanstore"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+	"github.com/CloudDetail/apo-receiver/pkg/global"
+
+	apmmodel "github.com/CloudDetail/apo-module/apm/model/v1"
+)
+
+func TestErrorReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		reason string
+	}{
+		{name: "report error", err: newReportError(reasonNotProfiled, "instance(%s) is not profiled", "a"), reason: reasonNotProfiled},
+		{name: "apm query", err: withReason(reasonApmQuery, errors.New("timeout")), reason: reasonApmQuery},
+		{name: "wrapped", err: fmt.Errorf("build: %w", newReportError(reasonNotFound, "not found")), reason: reasonNotFound},
+		{name: "no sampled trace", err: ErrNoSampledTrace, reason: reasonNotSampled},
+		{name: "unknown", err: errors.New("other"), reason: reasonUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.reason, errorReason(tt.err))
+		})
+	}
+}
+
+func TestTaskPoolGauges(t *testing.T) {
+	pool := newTaskPool(5)
+	pool.addTask(newSlowTraceTask("", model.NewTraces("1"), nil))
+	pool.addTask(newErrorTraceTask("", model.NewTraces("2"), nil))
+	assert.Equal(t, float64(2), testutil.ToFloat64(TaskPoolTasks.WithLabelValues("todo")))
+
+	tasks := pool.getToProcessTasks(0)
+	pool.retryTask(tasks[0])
+	assert.Equal(t, float64(0), testutil.ToFloat64(TaskPoolTasks.WithLabelValues("todo")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(TaskPoolTasks.WithLabelValues("retry")))
+	assert.Equal(t, "slow", reportTypeLabel(report.SlowReportType))
+}
+
+func TestQueryServicesOffline(t *testing.T) {
+	store := spanstore.NewStore(&config.OtlpConfig{Enable: true})
+	span := apmmodel.NewOtelSpan()
+	span.SetServiceName("order")
+	span.SetSpanId("01")
+	span.SetKind(apmmodel.SpanKindServer)
+	store.AddSpans("t1", "trace1", []*apmmodel.OtelSpan{span})
+	global.TRACE_CLIENT = spanstore.NewTraceClient(store, nil)
+	defer func() { global.TRACE_CLIENT = nil }()
+
+	serviceNodes, err := queryServices("t1", "skywalking", "trace1", 0)
+	assert.NoError(t, err)
+	assert.Len(t, serviceNodes, 1)
+
+	failures := testutil.ToFloat64(ApmQueryErrorsTotal.WithLabelValues("skywalking"))
+	_, err = queryServices("t1", "skywalking", "trace2", 0)
+	assert.Equal(t, reasonApmQuery, errorReason(err))
+	assert.Equal(t, failures+1, testutil.ToFloat64(ApmQueryErrorsTotal.WithLabelValues("skywalking")))
+}
+
+func newObserveTestSpan(serviceName string, spanId string, parentSpanId string, kind apmmodel.OtelSpanKind) *apmmodel.OtelSpan {
+	span := apmmodel.NewOtelSpan()
+	span.SetServiceName(serviceName)
+	span.SetSpanId(spanId)
+	span.SetParentSpanId(parentSpanId)
+	span.SetKind(kind)
+	span.SetStartTime(1000)
+	span.SetDuration(100)
+	return span
+}
+
+func TestObserveTraceOnce(t *testing.T) {
+	global.CACHE = redis.NewLocalCache(60)
+	store := spanstore.NewStore(&config.OtlpConfig{Enable: true})
+	store.AddSpans("t1", "trace1", []*apmmodel.OtelSpan{
+		newObserveTestSpan("order", "01", "", apmmodel.SpanKindServer),
+		newObserveTestSpan("order", "02", "01", apmmodel.SpanKindClient),
+		newObserveTestSpan("stock", "03", "02", apmmodel.SpanKindServer),
+	})
+	global.TRACE_CLIENT = spanstore.NewTraceClient(store, nil)
+	defer func() {
+		global.CACHE = nil
+		global.TRACE_CLIENT = nil
+	}()
+
+	var dependencies []*report.ServiceDependency
+	analyzer := NewReportAnalyzer(&config.AnalyzerConfig{MqCorrelation: config.MqCorrelationConfig{Enable: true}}, nil)
+	unlinked := testutil.ToFloat64(report.MqCorrelationTracesTotal.WithLabelValues("unlinked"))
+	analyzer.dependencies = report.NewDependencyAggregator(&config.DependencyAggregationConfig{Enable: true}, func(tenantName string, flushed []*report.ServiceDependency) {
+		dependencies = append(dependencies, flushed...)
+	})
+	traces := model.NewTraces("trace1")
+	traces.AddTrace(&model.Trace{IsSent: true, Labels: &model.TraceLabels{
+		TraceId: "trace1", ApmType: "skywalking", ApmSpanId: "01", ServiceName: "order", Url: "GET /order", StartTime: 1000, TopSpan: true,
+	}})
+
+	// The relations of the topology are written by another trace, so no relation and trace is stored.
+	serviceNodes, err := queryServices("t1", "skywalking", "trace1", 0)
+	assert.NoError(t, err)
+	topology := report.NewTopology("skywalking", serviceNodes, traces.GetSpanIdTraceMap(), analyzer.settings.Load().externalFactory)
+	for _, node := range topology.Nodes {
+		global.CACHE.StoreRelationTraceId(analyzer.getRelationKey("t1", node.ServiceName, node.Url, node.StartTime, node.TopNode), "trace0")
+	}
+
+	// The slow and error tasks of the trace query the topology, then the retry finds the relation of the entry.
+	for i := 0; i < 2; i++ {
+		_, err = analyzer.buildRelations("t1", traces, nil)
+		assert.NoError(t, err)
+	}
+	global.CACHE.StoreRelationTraceId(analyzer.getRelationKey("t1", "order", "GET /order", 1000, false), "trace0")
+	_, err = analyzer.buildRelations("t1", traces, nil)
+	assert.NoError(t, err)
+
+	// The trace without mq is counted once.
+	assert.Equal(t, unlinked+1, testutil.ToFloat64(report.MqCorrelationTracesTotal.WithLabelValues("unlinked")))
+	analyzer.dependencies.Flush()
+	if assert.Len(t, dependencies, 1) {
+		assert.Equal(t, "order", dependencies[0].ParentService)
+		assert.Equal(t, "stock", dependencies[0].Service)
+		assert.Equal(t, uint64(1), dependencies[0].Calls)
+	}
+}
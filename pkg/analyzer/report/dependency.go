@@ -0,0 +1,278 @@
+package report
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+const (
+	defaultDependencyFlushDelay = 2 * time.Minute
+	defaultMaxDependencyEdges   = 100000
+
+	// latencySketchAccuracy is the relative accuracy of the durations estimated from the latency sketches.
+	latencySketchAccuracy = 0.02
+)
+
+var (
+	DependencyDroppedEdgesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_dependency_dropped_edges_total",
+			Help: "The total number of dependency edges not aggregated as the open minutes are full",
+		},
+	)
+	DependencySkippedTracesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_dependency_skipped_traces_total",
+			Help: "The total number of analyzed traces not aggregated as their relation is written and their spans are not pushed",
+		},
+	)
+
+	latencySketchGamma    = (1 + latencySketchAccuracy) / (1 - latencySketchAccuracy)
+	latencySketchLogGamma = math.Log(latencySketchGamma)
+)
+
+func init() {
+	prometheus.MustRegister(DependencyDroppedEdgesTotal, DependencySkippedTracesTotal)
+}
+
+// ServiceDependency is the parent -> client -> child edge aggregated in a minute.
+// The edges to the db, external and producer clients have no child service.
+// Calls and errors count the analyzed traces rather than all the requests, as the topology is only queried for
+// the first trace of a root url in the topology period unless the spans are pushed by OTLP, see DependencySkippedTracesTotal.
+type ServiceDependency struct {
+	Tenant string `json:",omitempty"`
+	// Timestamp is the start of the minute.
+	Timestamp     uint64
+	ParentService string
+	ParentUrl     string
+	ClientGroup   string
+	ClientType    string
+	ClientPeer    string
+	Service       string
+	Url           string
+	IsAsync       bool
+
+	Calls       uint64
+	Errors      uint64
+	DurationSum uint64
+	DurationMin uint64
+	DurationMax uint64
+	// Latency is the sketch of the durations, <bucket, count>, see LatencyBucket.
+	Latency map[int16]uint64
+}
+
+func (dependency *ServiceDependency) add(duration uint64, isError bool) {
+	if dependency.Calls == 0 || duration < dependency.DurationMin {
+		dependency.DurationMin = duration
+	}
+	if duration > dependency.DurationMax {
+		dependency.DurationMax = duration
+	}
+	dependency.Calls++
+	if isError {
+		dependency.Errors++
+	}
+	dependency.DurationSum += duration
+	dependency.Latency[LatencyBucket(duration)]++
+}
+
+// LatencyBucket returns the bucket of the duration in nanoseconds, bucket i holds the durations in (gamma^(i-1), gamma^i].
+// The durations estimated by the buckets are within 2% of the real ones, so the sketches of the rows can be merged by sumMap.
+func LatencyBucket(duration uint64) int16 {
+	if duration <= 1 {
+		return 0
+	}
+	return int16(math.Ceil(math.Log(float64(duration)) / latencySketchLogGamma))
+}
+
+// LatencyQuantile estimates the q quantile of the durations in the sketch, 0 is returned for an empty sketch.
+func LatencyQuantile(sketch map[int16]uint64, q float64) uint64 {
+	var total uint64
+	buckets := make([]int16, 0, len(sketch))
+	for bucket, count := range sketch {
+		buckets = append(buckets, bucket)
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i] < buckets[j]
+	})
+	rank := uint64(q * float64(total-1))
+	var count uint64
+	for _, bucket := range buckets {
+		count += sketch[bucket]
+		if count > rank {
+			return latencyBucketValue(bucket)
+		}
+	}
+	return latencyBucketValue(buckets[len(buckets)-1])
+}
+
+func latencyBucketValue(bucket int16) uint64 {
+	if bucket <= 0 {
+		return 0
+	}
+	return uint64(2 * math.Pow(latencySketchGamma, float64(bucket)) / (latencySketchGamma + 1))
+}
+
+// DependencyAggregator rolls the relationships of the analyzed traces into the dependencies per minute.
+// A minute is flushed after its end and the flush delay, the dependencies of the traces analyzed later are flushed as another row.
+type DependencyAggregator struct {
+	flushDelay uint64
+	maxEdges   int
+	store      func(tenantName string, dependencies []*ServiceDependency)
+	mutex      sync.Mutex
+	windows    map[uint64]map[dependencyKey]*ServiceDependency // <minute, edge>
+	edgeCount  int
+	stopChan   chan struct{}
+	stopOnce   sync.Once
+}
+
+type dependencyKey struct {
+	tenant        string
+	parentService string
+	parentUrl     string
+	clientGroup   string
+	clientType    string
+	clientPeer    string
+	service       string
+	url           string
+	isAsync       bool
+}
+
+// NewDependencyAggregator returns nil if dependency aggregation is not enabled, the flushed dependencies are passed to store.
+func NewDependencyAggregator(cfg *config.DependencyAggregationConfig, store func(tenantName string, dependencies []*ServiceDependency)) *DependencyAggregator {
+	if !cfg.Enable {
+		return nil
+	}
+	flushDelay := cfg.FlushDelay
+	if flushDelay <= 0 {
+		flushDelay = defaultDependencyFlushDelay
+	}
+	maxEdges := cfg.MaxEdges
+	if maxEdges <= 0 {
+		maxEdges = defaultMaxDependencyEdges
+	}
+	return &DependencyAggregator{
+		flushDelay: uint64(flushDelay),
+		maxEdges:   maxEdges,
+		store:      store,
+		windows:    make(map[uint64]map[dependencyKey]*ServiceDependency),
+		stopChan:   make(chan struct{}),
+	}
+}
+
+func (aggregator *DependencyAggregator) Start() {
+	go aggregator.checkFlush()
+}
+
+// Stop stops the periodic flush, the open minutes are kept until Flush.
+func (aggregator *DependencyAggregator) Stop() {
+	aggregator.stopOnce.Do(func() {
+		close(aggregator.stopChan)
+	})
+}
+
+// Add aggregates the relationships of the relation into the minute of its root node.
+// The relationship of the entry without parent and client is skipped.
+func (aggregator *DependencyAggregator) Add(relation *Relation) {
+	relation.CollectRelationships()
+	minute := relation.RootNode.StartTime / uint64(time.Minute) * uint64(time.Minute)
+
+	aggregator.mutex.Lock()
+	defer aggregator.mutex.Unlock()
+	window, found := aggregator.windows[minute]
+	if !found {
+		window = make(map[dependencyKey]*ServiceDependency)
+		aggregator.windows[minute] = window
+	}
+	for _, relationship := range relation.Relationships {
+		if relationship.ParentService == "" && relationship.ClientGroup == "" {
+			continue
+		}
+		key := dependencyKey{
+			tenant:        relation.Tenant,
+			parentService: relationship.ParentService,
+			parentUrl:     relationship.ParentUrl,
+			clientGroup:   relationship.ClientGroup,
+			clientType:    relationship.ClientType,
+			clientPeer:    relationship.ClientPeer,
+			service:       relationship.Service,
+			url:           relationship.Url,
+			isAsync:       relationship.IsAsync,
+		}
+		dependency, exist := window[key]
+		if !exist {
+			if aggregator.edgeCount >= aggregator.maxEdges {
+				DependencyDroppedEdgesTotal.Inc()
+				continue
+			}
+			dependency = &ServiceDependency{
+				Tenant:        key.tenant,
+				Timestamp:     minute,
+				ParentService: key.parentService,
+				ParentUrl:     key.parentUrl,
+				ClientGroup:   key.clientGroup,
+				ClientType:    key.clientType,
+				ClientPeer:    key.clientPeer,
+				Service:       key.service,
+				Url:           key.url,
+				IsAsync:       key.isAsync,
+				Latency:       make(map[int16]uint64),
+			}
+			window[key] = dependency
+			aggregator.edgeCount++
+		}
+		dependency.add(relationship.Duration, relationship.IsError)
+	}
+	if len(window) == 0 {
+		delete(aggregator.windows, minute)
+	}
+}
+
+// Flush stores the dependencies of all the open minutes.
+func (aggregator *DependencyAggregator) Flush() {
+	aggregator.flushClosed(math.MaxUint64)
+}
+
+func (aggregator *DependencyAggregator) checkFlush() {
+	timer := time.NewTicker(1 * time.Second)
+	for {
+		select {
+		case <-timer.C:
+			aggregator.flushClosed(uint64(time.Now().UnixNano()))
+		case <-aggregator.stopChan:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// flushClosed stores the dependencies of the minutes ended before checkTime minus the flush delay, checkTime is in nanoseconds.
+func (aggregator *DependencyAggregator) flushClosed(checkTime uint64) {
+	toStores := make(map[string][]*ServiceDependency)
+	aggregator.mutex.Lock()
+	for minute, window := range aggregator.windows {
+		if checkTime != math.MaxUint64 && minute+uint64(time.Minute)+aggregator.flushDelay > checkTime {
+			continue
+		}
+		for _, dependency := range window {
+			toStores[dependency.Tenant] = append(toStores[dependency.Tenant], dependency)
+		}
+		aggregator.edgeCount -= len(window)
+		delete(aggregator.windows, minute)
+	}
+	aggregator.mutex.Unlock()
+
+	for tenantName, dependencies := range toStores {
+		aggregator.store(tenantName, dependencies)
+	}
+}
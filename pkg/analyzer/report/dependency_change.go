@@ -0,0 +1,283 @@
+package report
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/external"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+const (
+	DependencyAdded   = "added"
+	DependencyRemoved = "removed"
+
+	defaultDependencyBaselineWindow = time.Hour
+	defaultDependencyWarmup         = 10 * time.Minute
+	defaultMaxChangeEdges           = 100000
+	defaultMinRemovedCalls          = 10
+)
+
+var (
+	DependencyChangesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_dependency_changes_total",
+			Help: "The total number of the edges added to or removed from the services, change is added / removed",
+		},
+		[]string{"change"},
+	)
+	DependencyUntrackedEdgesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_dependency_untracked_edges_total",
+			Help: "The total number of the new edges not tracked as the tracked edges are full",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(DependencyChangesTotal, DependencyUntrackedEdgesTotal)
+}
+
+// DependencyChange is an edge added to or removed from the service.
+// Service is the parent of the edge, or the child if there is no parent, eg. the consumer of the messages produced in other traces.
+type DependencyChange struct {
+	Tenant string `json:",omitempty"`
+	// Timestamp is when the change is detected.
+	Timestamp     uint64
+	Change        string
+	Service       string
+	ParentService string
+	ClientGroup   string
+	ClientType    string
+	ClientPeer    string
+	// Destination is the topic or queue of the mq clients.
+	Destination  string
+	ChildService string
+	// TraceId is the trace the added edge is seen, empty for the removed edges.
+	TraceId   string
+	FirstSeen uint64
+	LastSeen  uint64
+}
+
+// DependencyChangeDetector tracks the edges seen per service in the rolling baseline window.
+// An edge not in the baseline is added, an edge not seen in the window is removed if its service is still seen.
+// The edges of a newly seen service are learned during the warmup, so the restarts and new services are not reported.
+// The baseline is in memory and only sees the traces analyzed by this receiver, the removals of the rarely seen edges are not reported
+// as they are more likely sampled out or analyzed by other receivers than removed.
+type DependencyChangeDetector struct {
+	baselineWindow  uint64
+	warmup          uint64
+	maxEdges        int
+	minRemovedCalls uint64
+	store           func(tenantName string, changes []*DependencyChange)
+	mutex           sync.Mutex
+	services        map[dependencyService]*serviceEdges
+	edgeCount       int
+	stopChan        chan struct{}
+	stopOnce        sync.Once
+}
+
+type dependencyService struct {
+	tenant  string
+	service string
+}
+
+// dependencyEdge is keyed on the child service when it is known, so the peer changed with the pod IPs on rollout
+// is not an edge change, the peer is only compared for the calls to the uninstrumented services.
+type dependencyEdge struct {
+	parentService string
+	clientGroup   string
+	clientType    string
+	clientPeer    string
+	destination   string
+	childService  string
+}
+
+type serviceEdges struct {
+	firstSeen uint64
+	lastSeen  uint64
+	edges     map[dependencyEdge]*edgeSeen
+}
+
+type edgeSeen struct {
+	firstSeen uint64
+	lastSeen  uint64
+	count     uint64
+	// peer is the last peer of the edge keyed on the child service.
+	peer string
+}
+
+// NewDependencyChangeDetector returns nil if dependency change is not enabled, the detected changes are passed to store.
+func NewDependencyChangeDetector(cfg *config.DependencyChangeConfig, store func(tenantName string, changes []*DependencyChange)) *DependencyChangeDetector {
+	if !cfg.Enable {
+		return nil
+	}
+	baselineWindow := cfg.BaselineWindow
+	if baselineWindow <= 0 {
+		baselineWindow = defaultDependencyBaselineWindow
+	}
+	warmup := cfg.Warmup
+	if warmup <= 0 {
+		warmup = defaultDependencyWarmup
+	}
+	maxEdges := cfg.MaxEdges
+	if maxEdges <= 0 {
+		maxEdges = defaultMaxChangeEdges
+	}
+	minRemovedCalls := cfg.MinRemovedCalls
+	if minRemovedCalls <= 0 {
+		minRemovedCalls = defaultMinRemovedCalls
+	}
+	return &DependencyChangeDetector{
+		baselineWindow:  uint64(baselineWindow),
+		warmup:          uint64(warmup),
+		maxEdges:        maxEdges,
+		minRemovedCalls: uint64(minRemovedCalls),
+		store:           store,
+		services:        make(map[dependencyService]*serviceEdges),
+		stopChan:        make(chan struct{}),
+	}
+}
+
+func (detector *DependencyChangeDetector) Start() {
+	go detector.checkExpire()
+}
+
+func (detector *DependencyChangeDetector) Stop() {
+	detector.stopOnce.Do(func() {
+		close(detector.stopChan)
+	})
+}
+
+// Add tracks the edges of the relation, the added edges are stored.
+func (detector *DependencyChangeDetector) Add(relation *Relation) {
+	if changes := detector.observe(relation, uint64(time.Now().UnixNano())); len(changes) > 0 {
+		detector.store(relation.Tenant, changes)
+	}
+}
+
+// observe tracks the edges of the relation seen at now in nanoseconds, the added edges are returned.
+func (detector *DependencyChangeDetector) observe(relation *Relation, now uint64) []*DependencyChange {
+	relation.CollectRelationships()
+	var changes []*DependencyChange
+
+	detector.mutex.Lock()
+	defer detector.mutex.Unlock()
+	for _, relationship := range relation.Relationships {
+		serviceName, edge, ok := toDependencyEdge(relationship)
+		if !ok {
+			continue
+		}
+		key := dependencyService{tenant: relation.Tenant, service: serviceName}
+		service, found := detector.services[key]
+		if !found {
+			service = &serviceEdges{firstSeen: now, edges: make(map[dependencyEdge]*edgeSeen)}
+			detector.services[key] = service
+		}
+		service.lastSeen = now
+		seen, exist := service.edges[edge]
+		if !exist {
+			if detector.edgeCount >= detector.maxEdges {
+				DependencyUntrackedEdgesTotal.Inc()
+				continue
+			}
+			seen = &edgeSeen{firstSeen: now}
+			service.edges[edge] = seen
+			detector.edgeCount++
+		}
+		seen.lastSeen = now
+		seen.count++
+		seen.peer = relationship.ClientPeer
+		if !exist && now-service.firstSeen >= detector.warmup {
+			change := newDependencyChange(key, edge, seen, DependencyAdded, now)
+			change.TraceId = relation.TraceId
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// toDependencyEdge returns the service of the relationship and its edge, the entry without parent and client is skipped.
+// The url and the client key are not compared except the destination of the mq clients, as they are changed with the parameters.
+func toDependencyEdge(relationship *Relationship) (string, dependencyEdge, bool) {
+	if relationship.ParentService == "" && relationship.ClientGroup == "" {
+		return "", dependencyEdge{}, false
+	}
+	edge := dependencyEdge{
+		parentService: relationship.ParentService,
+		clientGroup:   relationship.ClientGroup,
+		clientType:    relationship.ClientType,
+		childService:  relationship.Service,
+	}
+	if edge.childService == "" {
+		edge.clientPeer = relationship.ClientPeer
+	}
+	if relationship.ClientGroup == external.GroupMq {
+		edge.destination = relationship.ClientKey
+	}
+	if relationship.ParentService != "" {
+		return relationship.ParentService, edge, true
+	}
+	return relationship.Service, edge, true
+}
+
+func newDependencyChange(key dependencyService, edge dependencyEdge, seen *edgeSeen, change string, timestamp uint64) *DependencyChange {
+	DependencyChangesTotal.WithLabelValues(change).Inc()
+	return &DependencyChange{
+		Tenant:        key.tenant,
+		Timestamp:     timestamp,
+		Change:        change,
+		Service:       key.service,
+		ParentService: edge.parentService,
+		ClientGroup:   edge.clientGroup,
+		ClientType:    edge.clientType,
+		ClientPeer:    seen.peer,
+		Destination:   edge.destination,
+		ChildService:  edge.childService,
+		FirstSeen:     seen.firstSeen,
+		LastSeen:      seen.lastSeen,
+	}
+}
+
+func (detector *DependencyChangeDetector) checkExpire() {
+	timer := time.NewTicker(10 * time.Second)
+	for {
+		select {
+		case <-timer.C:
+			detector.removeExpired(uint64(time.Now().UnixNano()))
+		case <-detector.stopChan:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// removeExpired stores the edges not seen in the baseline window as removed, checkTime is in nanoseconds.
+// The services not seen in the window and the edges seen less than minRemovedCalls are forgotten without events.
+func (detector *DependencyChangeDetector) removeExpired(checkTime uint64) {
+	toStores := make(map[string][]*DependencyChange)
+	detector.mutex.Lock()
+	for key, service := range detector.services {
+		if service.lastSeen+detector.baselineWindow < checkTime {
+			detector.edgeCount -= len(service.edges)
+			delete(detector.services, key)
+			continue
+		}
+		for edge, seen := range service.edges {
+			if seen.lastSeen+detector.baselineWindow < checkTime {
+				if seen.count >= detector.minRemovedCalls {
+					toStores[key.tenant] = append(toStores[key.tenant], newDependencyChange(key, edge, seen, DependencyRemoved, checkTime))
+				}
+				detector.edgeCount--
+				delete(service.edges, edge)
+			}
+		}
+	}
+	detector.mutex.Unlock()
+
+	for tenantName, changes := range toStores {
+		detector.store(tenantName, changes)
+	}
+}
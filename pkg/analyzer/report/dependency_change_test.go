@@ -0,0 +1,116 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	apmmodel "github.com/CloudDetail/apo-module/apm/model/v1"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/external"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+// newChangeRelation returns gateway -http-> order with the clients of order.
+func newChangeRelation(tenantName string, traceId string, clients ...*external.External) *Relation {
+	gateway := &TopologyNode{ServiceName: "gateway", Url: "GET /order", SpanId: "s1", TopNode: true, IsTraced: true,
+		Externals: []*external.External{
+			external.NewExternal(0, 300, "s2", "e1", external.GroupExternal, "http", apmmodel.SpanKindClient, "GET /order", "order:8080", false, ""),
+		},
+	}
+	order := &TopologyNode{ServiceName: "order", Url: "GET /order", SpanId: "s2", SideSpanId: "e1", IsTraced: true, Externals: clients}
+	gateway.AddChild(order)
+	return NewRelation(tenantName, traceId, gateway)
+}
+
+func newDbClient(peer string, statement string) *external.External {
+	return external.NewExternal(0, 100, "", "e2", external.GroupDb, "mysql", apmmodel.SpanKindClient, statement, peer, false, "")
+}
+
+func newProducerClient(topic string) *external.External {
+	return external.NewExternal(0, 100, "", "e3", external.GroupMq, "kafka", apmmodel.SpanKindProducer, topic, "kafka:9092", false, "")
+}
+
+func TestDependencyChangeAdded(t *testing.T) {
+	detector := NewDependencyChangeDetector(&config.DependencyChangeConfig{Enable: true, Warmup: time.Minute}, nil)
+	start := uint64(time.Hour)
+
+	// The edges seen during the warmup are the baseline.
+	assert.Empty(t, detector.observe(newChangeRelation("", "trace-1", newDbClient("mysql:3306", "SELECT shop.orders")), start))
+	assert.Empty(t, detector.observe(newChangeRelation("", "trace-2", newProducerClient("orders")), start+uint64(30*time.Second)))
+
+	// The statement and the url are not compared.
+	changes := detector.observe(newChangeRelation("", "trace-3",
+		newDbClient("mysql:3306", "UPDATE shop.orders"),
+		newDbClient("mysql-new:3306", "SELECT shop.orders"),
+		newProducerClient("orders"),
+		newProducerClient("payments")), start+uint64(time.Minute))
+	if assert.Len(t, changes, 2) {
+		assert.Equal(t, DependencyAdded, changes[0].Change)
+		assert.Equal(t, "order", changes[0].Service)
+		assert.Equal(t, "order", changes[0].ParentService)
+		assert.Equal(t, external.GroupDb, changes[0].ClientGroup)
+		assert.Equal(t, "mysql-new:3306", changes[0].ClientPeer)
+		assert.Equal(t, "", changes[0].ChildService)
+		assert.Equal(t, "trace-3", changes[0].TraceId)
+
+		assert.Equal(t, external.GroupMq, changes[1].ClientGroup)
+		assert.Equal(t, "payments", changes[1].Destination)
+	}
+
+	// The services are isolated by tenant, the new service is in warmup.
+	assert.Empty(t, detector.observe(newChangeRelation("tenant-a", "trace-4", newDbClient("mysql-new:3306", "")), start+uint64(time.Minute)))
+}
+
+func TestDependencyChangeChildPeer(t *testing.T) {
+	detector := NewDependencyChangeDetector(&config.DependencyChangeConfig{Enable: true, Warmup: time.Minute}, nil)
+	start := uint64(time.Hour)
+	detector.observe(newChangeRelation("", "trace-1"), start)
+
+	// The pod IP of order is changed on rollout, the edge is keyed on the child service.
+	relation := newChangeRelation("", "trace-2")
+	relation.RootNode.Externals[0].Peer = "10.0.0.2:8080"
+	assert.Empty(t, detector.observe(relation, start+uint64(time.Minute)))
+	assert.Equal(t, 1, detector.edgeCount)
+	for _, seen := range detector.services[dependencyService{service: "gateway"}].edges {
+		assert.Equal(t, "10.0.0.2:8080", seen.peer)
+	}
+}
+
+func TestDependencyChangeRemoved(t *testing.T) {
+	stored := make([]*DependencyChange, 0)
+	detector := NewDependencyChangeDetector(&config.DependencyChangeConfig{Enable: true, BaselineWindow: time.Hour, MinRemovedCalls: 2}, func(tenantName string, changes []*DependencyChange) {
+		stored = append(stored, changes...)
+	})
+	start := uint64(time.Hour)
+	detector.observe(newChangeRelation("", "trace-1", newDbClient("mysql:3306", ""), newDbClient("redis:6379", ""), newDbClient("mongo:27017", "")), start)
+	detector.observe(newChangeRelation("", "trace-2", newDbClient("redis:6379", "")), start)
+	detector.observe(newChangeRelation("", "trace-3", newDbClient("mysql:3306", "")), start+uint64(30*time.Minute))
+
+	detector.removeExpired(start + uint64(time.Hour))
+	assert.Empty(t, stored)
+
+	// The redis is not called while order is still seen, the mongo seen only once is forgotten silently.
+	detector.removeExpired(start + uint64(time.Hour) + 1)
+	if assert.Len(t, stored, 1) {
+		assert.Equal(t, DependencyRemoved, stored[0].Change)
+		assert.Equal(t, "order", stored[0].Service)
+		assert.Equal(t, "redis:6379", stored[0].ClientPeer)
+		assert.Equal(t, start, stored[0].LastSeen)
+		assert.Equal(t, "", stored[0].TraceId)
+	}
+
+	// The services not seen in the window are forgotten without events.
+	detector.removeExpired(start + uint64(90*time.Minute) + 1)
+	assert.Len(t, stored, 1)
+	assert.Empty(t, detector.services)
+	assert.Equal(t, 0, detector.edgeCount)
+}
+
+func TestDependencyChangeMaxEdges(t *testing.T) {
+	detector := NewDependencyChangeDetector(&config.DependencyChangeConfig{Enable: true, MaxEdges: 2}, nil)
+	detector.observe(newChangeRelation("", "trace-1", newDbClient("mysql:3306", ""), newDbClient("redis:6379", "")), 0)
+	assert.Equal(t, 2, detector.edgeCount)
+
+	assert.Nil(t, NewDependencyChangeDetector(&config.DependencyChangeConfig{}, nil))
+}
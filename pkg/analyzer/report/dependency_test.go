@@ -0,0 +1,116 @@
+package report
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	apmmodel "github.com/CloudDetail/apo-module/apm/model/v1"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/external"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+// newDependencyRelation returns gateway -http-> order -db-> mysql.
+func newDependencyRelation(tenantName string, startTime uint64, httpDuration uint64, dbDuration uint64, dbError bool) *Relation {
+	gateway := &TopologyNode{StartTime: startTime, ServiceName: "gateway", Url: "GET /order", SpanId: "s1", TopNode: true, IsTraced: true,
+		Externals: []*external.External{
+			external.NewExternal(startTime, httpDuration, "s2", "e1", external.GroupExternal, "http", apmmodel.SpanKindClient, "GET /order", "order:8080", false, ""),
+		},
+	}
+	order := &TopologyNode{StartTime: startTime, ServiceName: "order", Url: "GET /order", SpanId: "s2", SideSpanId: "e1", IsTraced: true,
+		Externals: []*external.External{
+			external.NewExternal(startTime, dbDuration, "", "e2", external.GroupDb, "mysql", apmmodel.SpanKindClient, "SELECT shop.orders", "mysql:3306", dbError, ""),
+		},
+	}
+	gateway.AddChild(order)
+	return NewRelation(tenantName, "trace", gateway)
+}
+
+func TestDependencyAggregate(t *testing.T) {
+	stored := make(map[string][]*ServiceDependency)
+	aggregator := NewDependencyAggregator(&config.DependencyAggregationConfig{Enable: true, FlushDelay: time.Minute}, func(tenantName string, dependencies []*ServiceDependency) {
+		stored[tenantName] = append(stored[tenantName], dependencies...)
+	})
+	minute := uint64(10 * time.Minute)
+	aggregator.Add(newDependencyRelation("", minute+uint64(time.Second), 300, 100, false))
+	aggregator.Add(newDependencyRelation("", minute+uint64(30*time.Second), 500, 200, true))
+	aggregator.Add(newDependencyRelation("tenant-a", minute, 400, 100, false))
+	aggregator.Add(newDependencyRelation("", minute+uint64(time.Minute), 400, 100, false))
+
+	// The minute is kept open during the flush delay.
+	aggregator.flushClosed(minute + uint64(2*time.Minute) - 1)
+	assert.Empty(t, stored)
+
+	aggregator.flushClosed(minute + uint64(2*time.Minute))
+	assert.Len(t, stored["tenant-a"], 2)
+	dependencies := stored[""]
+	if assert.Len(t, dependencies, 2) {
+		var http, db *ServiceDependency
+		for _, dependency := range dependencies {
+			assert.Equal(t, minute, dependency.Timestamp)
+			if dependency.ClientGroup == external.GroupExternal {
+				http = dependency
+			} else {
+				db = dependency
+			}
+		}
+		assert.Equal(t, "gateway", http.ParentService)
+		assert.Equal(t, "order:8080", http.ClientPeer)
+		assert.Equal(t, "order", http.Service)
+		assert.Equal(t, uint64(2), http.Calls)
+		assert.Equal(t, uint64(0), http.Errors)
+		assert.Equal(t, uint64(800), http.DurationSum)
+		assert.Equal(t, uint64(300), http.DurationMin)
+		assert.Equal(t, uint64(500), http.DurationMax)
+
+		assert.Equal(t, "order", db.ParentService)
+		assert.Equal(t, "mysql", db.ClientType)
+		assert.Equal(t, "", db.Service)
+		assert.Equal(t, uint64(2), db.Calls)
+		assert.Equal(t, uint64(1), db.Errors)
+		assert.Equal(t, uint64(2), db.Latency[LatencyBucket(100)]+db.Latency[LatencyBucket(200)])
+	}
+
+	// The next minute is flushed at last.
+	aggregator.Flush()
+	assert.Len(t, stored[""], 4)
+	assert.Equal(t, 0, aggregator.edgeCount)
+}
+
+func TestDependencyMaxEdges(t *testing.T) {
+	count := 0
+	aggregator := NewDependencyAggregator(&config.DependencyAggregationConfig{Enable: true, MaxEdges: 3}, func(tenantName string, dependencies []*ServiceDependency) {
+		count += len(dependencies)
+	})
+	aggregator.Add(newDependencyRelation("", 0, 300, 100, false))
+	aggregator.Add(newDependencyRelation("", uint64(time.Minute), 300, 100, false))
+	// The known edges are still aggregated when it is full.
+	aggregator.Add(newDependencyRelation("", 0, 300, 100, false))
+	aggregator.Flush()
+	assert.Equal(t, 3, count)
+
+	assert.Nil(t, NewDependencyAggregator(&config.DependencyAggregationConfig{}, nil))
+}
+
+func TestLatencyQuantile(t *testing.T) {
+	sketch := make(map[int16]uint64)
+	for i := 1; i <= 1000; i++ {
+		sketch[LatencyBucket(uint64(i)*uint64(time.Millisecond))]++
+	}
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		expect := q * 1000 * float64(time.Millisecond)
+		got := float64(LatencyQuantile(sketch, q))
+		assert.LessOrEqual(t, math.Abs(got-expect)/expect, latencySketchAccuracy+0.002, q)
+	}
+	assert.Equal(t, uint64(0), LatencyQuantile(map[int16]uint64{}, 0.5))
+	assert.Equal(t, int16(0), LatencyBucket(0))
+}
+
+func TestDependencyStopTwice(t *testing.T) {
+	aggregator := NewDependencyAggregator(&config.DependencyAggregationConfig{Enable: true}, func(tenantName string, dependencies []*ServiceDependency) {})
+	aggregator.Start()
+	aggregator.Stop()
+	assert.NotPanics(t, aggregator.Stop)
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/CloudDetail/apo-module/model/v1"
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
 )
 
 type ErrorReport struct {
@@ -14,6 +15,8 @@ type ErrorReport struct {
 	IsDrop    bool             `json:"is_drop"`
 	Duration  uint64           `json:"duration"`
 	Data      *ErrorReportData `json:"data"`
+	// Identity is the agent who sent the entry trace.
+	Identity *auth.Identity `json:"identity,omitempty"`
 }
 
 type ErrorReportData struct {
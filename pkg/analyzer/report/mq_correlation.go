@@ -0,0 +1,423 @@
+package report
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/CloudDetail/apo-module/apm/model/v1"
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/external"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
+)
+
+const (
+	MqMatchLink        = "link"
+	MqMatchMessageId   = "message_id"
+	MqMatchDestination = "destination"
+	mqMatchNone        = "none"
+
+	defaultMqCacheTime   = 5 * time.Minute
+	defaultMaxMqMessages = 100000
+	// maxDestinationProducers bounds the producer endpoints kept per destination.
+	maxDestinationProducers = 100
+)
+
+var (
+	MqCorrelationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_mq_correlations_total",
+			Help: "The total number of mq consumers correlated to the producers in other traces, match is link / message_id / destination / none",
+		},
+		[]string{"match"},
+	)
+	MqCorrelationTracesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_mq_correlation_traces_total",
+			Help: "The total number of the analyzed traces correlated with or without the mq links, or skipped as their topology is not known, result is linked / unlinked / skipped",
+		},
+		[]string{"result"},
+	)
+	MqDroppedMessagesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_mq_dropped_messages_total",
+			Help: "The total number of producers and waiting consumers not kept as the mq correlation cache is full",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(MqCorrelationsTotal, MqCorrelationTracesTotal, MqDroppedMessagesTotal)
+}
+
+// MqLink is the producer -> destination -> consumer relationship of the messages sent and received in different traces.
+type MqLink struct {
+	Tenant string `json:",omitempty"`
+	// Timestamp is the start time of the consumer.
+	Timestamp    uint64
+	TraceId      string
+	EntryService string
+	EntryUrl     string
+	MissTop      bool
+
+	Match       string
+	System      string
+	Destination string
+	Peer        string
+	// QueueLatency is the consumer start time minus the producer end time, 0 if the producer is matched by destination.
+	QueueLatency uint64
+
+	ProducerTraceId string
+	ProducerSpanId  string
+	ProducerService string
+	ProducerUrl     string
+	ProducerTraced  bool
+	ConsumerSpanId  string
+	ConsumerService string
+	ConsumerUrl     string
+	ConsumerTraced  bool
+}
+
+// Path is different from the paths of the relationships in a trace.
+func (link *MqLink) Path() string {
+	return fmt.Sprintf("%s_%s.", link.ProducerSpanId, link.ConsumerSpanId)
+}
+
+// MqCorrelator relates the mq consumers to the producers recorded from the other traces.
+// The consumers with span links or message ids wait for their producers, others are related to the producers of the destination.
+// A relationship is linked once per topology period.
+// The producers and the waiting consumers are kept in the memory of this receiver, so the producers and the consumers
+// analyzed by different receivers are not matched, and the traces whose topology is not known are skipped,
+// eg. the traces of a written relation without the spans pushed by OTLP, see originx_receiver_mq_correlation_traces_total.
+type MqCorrelator struct {
+	cacheTime   int64
+	maxMessages int
+	period      uint64
+	mutex       sync.Mutex
+	producers   map[string]*mqProducer          // <tenant, span id / destination with message id>
+	pendings    map[string]*mqConsumer          // <tenant, span id / destination with message id>
+	endpoints   map[string]map[mqEndpoint]int64 // <tenant, destination> -> <producer endpoint, expire time>
+	edges       map[string]uint64               // <edge, period>
+	stopChan    chan struct{}
+	stopOnce    sync.Once
+}
+
+type mqEndpoint struct {
+	traceId string
+	spanId  string
+	service string
+	url     string
+	traced  bool
+}
+
+type mqProducer struct {
+	mqEndpoint
+	endTime    uint64
+	expireTime int64
+}
+
+type mqConsumer struct {
+	link       *MqLink
+	startTime  uint64
+	expireTime int64
+	// matched is shared by the keys of the consumer, it is not counted as none when any key is matched.
+	matched bool
+}
+
+// NewMqCorrelator returns nil if mq correlation is not enabled, period is the topology period in nanoseconds.
+func NewMqCorrelator(cfg *config.MqCorrelationConfig, period uint64) *MqCorrelator {
+	if !cfg.Enable {
+		return nil
+	}
+	cacheTime := cfg.CacheTime
+	if cacheTime <= 0 {
+		cacheTime = defaultMqCacheTime
+	}
+	maxMessages := cfg.MaxMessages
+	if maxMessages <= 0 {
+		maxMessages = defaultMaxMqMessages
+	}
+	return &MqCorrelator{
+		cacheTime:   int64(cacheTime.Seconds()),
+		maxMessages: maxMessages,
+		period:      period,
+		producers:   make(map[string]*mqProducer),
+		pendings:    make(map[string]*mqConsumer),
+		endpoints:   make(map[string]map[mqEndpoint]int64),
+		edges:       make(map[string]uint64),
+		stopChan:    make(chan struct{}),
+	}
+}
+
+func (correlator *MqCorrelator) Start() {
+	go correlator.checkExpire()
+}
+
+// Stop stops the expiration check, it can be called more than once.
+func (correlator *MqCorrelator) Stop() {
+	correlator.stopOnce.Do(func() {
+		close(correlator.stopChan)
+	})
+}
+
+// Correlate records the producers of the trace and relates the consumers not linked in the trace,
+// the links of the consumers waiting for the producers of the trace are also returned.
+func (correlator *MqCorrelator) Correlate(tenantName string, traceId string, nodes []*TopologyNode) []*MqLink {
+	producers := make([]*mqNodeExternal, 0)
+	consumers := make([]*mqNodeExternal, 0)
+	for _, node := range nodes {
+		collectMqExternals(node, &producers, &consumers)
+	}
+	if len(producers) == 0 && len(consumers) == 0 {
+		return nil
+	}
+	linkedInTrace := make(map[string]bool)
+	for _, producer := range producers {
+		linkedInTrace[producer.external.SpanId] = true
+		if producer.external.NextSpanId != "" {
+			linkedInTrace[producer.external.NextSpanId] = true
+		}
+	}
+
+	expireTime := time.Now().Unix() + correlator.cacheTime
+	links := make([]*MqLink, 0)
+	correlator.mutex.Lock()
+	defer correlator.mutex.Unlock()
+	for _, producer := range producers {
+		links = correlator.addProducer(tenantName, traceId, producer, expireTime, links)
+	}
+	for _, consumer := range consumers {
+		if linkedInTrace[consumer.external.SpanId] || linkedInTrace[consumer.external.PSpanId] {
+			continue
+		}
+		links = correlator.matchConsumer(tenantName, newMqLink(tenantName, traceId, consumer), consumer.external, expireTime, links)
+	}
+	return links
+}
+
+type mqNodeExternal struct {
+	node     *TopologyNode
+	external *external.External
+}
+
+func collectMqExternals(node *TopologyNode, producers *[]*mqNodeExternal, consumers *[]*mqNodeExternal) {
+	for _, externalData := range node.Externals {
+		if externalData.Group != external.GroupMq {
+			continue
+		}
+		if externalData.Kind == model.SpanKindProducer {
+			*producers = append(*producers, &mqNodeExternal{node: node, external: externalData})
+		} else if externalData.Kind == model.SpanKindConsumer {
+			*consumers = append(*consumers, &mqNodeExternal{node: node, external: externalData})
+		}
+	}
+	for _, child := range node.Children {
+		collectMqExternals(child, producers, consumers)
+	}
+}
+
+func newMqLink(tenantName string, traceId string, consumer *mqNodeExternal) *MqLink {
+	root := consumer.node
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	return &MqLink{
+		Tenant:          tenantName,
+		Timestamp:       consumer.external.StartTime,
+		TraceId:         traceId,
+		EntryService:    root.ServiceName,
+		EntryUrl:        root.Url,
+		MissTop:         !root.TopNode,
+		System:          consumer.external.Type,
+		Destination:     consumer.external.Name,
+		Peer:            consumer.external.Peer,
+		ConsumerSpanId:  consumer.external.SpanId,
+		ConsumerService: consumer.node.ServiceName,
+		ConsumerUrl:     consumer.node.Url,
+		ConsumerTraced:  consumer.node.IsTraced,
+	}
+}
+
+func (correlator *MqCorrelator) addProducer(tenantName string, traceId string, producer *mqNodeExternal, expireTime int64, links []*MqLink) []*MqLink {
+	externalData := producer.external
+	record := &mqProducer{
+		mqEndpoint: mqEndpoint{
+			traceId: traceId,
+			spanId:  externalData.SpanId,
+			service: producer.node.ServiceName,
+			url:     producer.node.Url,
+			traced:  producer.node.IsTraced,
+		},
+		endTime:    externalData.StartTime + externalData.Duration,
+		expireTime: expireTime,
+	}
+	destinationKey := mqDestinationKey(tenantName, externalData.Type, externalData.Name)
+	endpoints, found := correlator.endpoints[destinationKey]
+	if !found {
+		endpoints = make(map[mqEndpoint]int64)
+		correlator.endpoints[destinationKey] = endpoints
+	}
+	// The span ids are not compared for the destinations.
+	endpoint := mqEndpoint{service: record.service, url: record.url, traced: record.traced}
+	if _, exist := endpoints[endpoint]; exist || len(endpoints) < maxDestinationProducers {
+		endpoints[endpoint] = expireTime
+	}
+
+	keys := []string{mqSpanKey(tenantName, externalData.SpanId)}
+	if externalData.MessageId != "" {
+		keys = append(keys, mqMessageKey(tenantName, externalData.Type, externalData.Name, externalData.MessageId))
+	}
+	for i, key := range keys {
+		if pending, waiting := correlator.pendings[key]; waiting {
+			delete(correlator.pendings, key)
+			pending.matched = true
+			match := MqMatchLink
+			if i > 0 {
+				match = MqMatchMessageId
+			}
+			links = correlator.link(pending.link, record, match, pending.startTime, links)
+		}
+		if _, exist := correlator.producers[key]; !exist && len(correlator.producers) >= correlator.maxMessages {
+			MqDroppedMessagesTotal.Inc()
+			continue
+		}
+		correlator.producers[key] = record
+	}
+	return links
+}
+
+func (correlator *MqCorrelator) matchConsumer(tenantName string, link *MqLink, consumer *external.External, expireTime int64, links []*MqLink) []*MqLink {
+	keys := make([]string, 0)
+	matches := make([]string, 0)
+	for _, spanId := range consumer.LinkedSpanIds {
+		keys = append(keys, mqSpanKey(tenantName, spanId))
+		matches = append(matches, MqMatchLink)
+	}
+	if consumer.MessageId != "" {
+		keys = append(keys, mqMessageKey(tenantName, consumer.Type, consumer.Name, consumer.MessageId))
+		matches = append(matches, MqMatchMessageId)
+	}
+	if len(keys) > 0 {
+		matched := false
+		for i, key := range keys {
+			if producer, found := correlator.producers[key]; found {
+				links = correlator.link(link, producer, matches[i], consumer.StartTime, links)
+				matched = true
+				// The message ids are only compared if there is no link.
+				if matches[i] == MqMatchMessageId {
+					break
+				}
+			}
+		}
+		if !matched {
+			// The producer may be analyzed later.
+			pending := &mqConsumer{link: link, startTime: consumer.StartTime, expireTime: expireTime}
+			for _, key := range keys {
+				if _, exist := correlator.pendings[key]; !exist && len(correlator.pendings) >= correlator.maxMessages {
+					MqDroppedMessagesTotal.Inc()
+					continue
+				}
+				correlator.pendings[key] = pending
+			}
+		}
+		return links
+	}
+
+	endpoints := correlator.endpoints[mqDestinationKey(tenantName, consumer.Type, consumer.Name)]
+	if len(endpoints) == 0 {
+		MqCorrelationsTotal.WithLabelValues(mqMatchNone).Inc()
+		return links
+	}
+	for endpoint := range endpoints {
+		links = correlator.link(link, &mqProducer{mqEndpoint: endpoint}, MqMatchDestination, consumer.StartTime, links)
+	}
+	return links
+}
+
+// link appends the relationship of the producer and the consumer if it is not linked in the topology period.
+func (correlator *MqCorrelator) link(consumerLink *MqLink, producer *mqProducer, match string, consumerStartTime uint64, links []*MqLink) []*MqLink {
+	MqCorrelationsTotal.WithLabelValues(match).Inc()
+	edge := tenant.Key(consumerLink.Tenant, fmt.Sprintf("%s-%s-%s-%s-%s-%s", producer.service, producer.url,
+		consumerLink.System, consumerLink.Destination, consumerLink.ConsumerService, consumerLink.ConsumerUrl))
+	period := consumerStartTime / correlator.period
+	if linkedPeriod, found := correlator.edges[edge]; found && linkedPeriod == period {
+		return links
+	}
+	correlator.edges[edge] = period
+
+	link := *consumerLink
+	link.Match = match
+	link.ProducerTraceId = producer.traceId
+	link.ProducerSpanId = producer.spanId
+	link.ProducerService = producer.service
+	link.ProducerUrl = producer.url
+	link.ProducerTraced = producer.traced
+	if match != MqMatchDestination && consumerStartTime > producer.endTime {
+		link.QueueLatency = consumerStartTime - producer.endTime
+	}
+	return append(links, &link)
+}
+
+func mqSpanKey(tenantName string, spanId string) string {
+	return tenant.Key(tenantName, "span-"+spanId)
+}
+
+func mqMessageKey(tenantName string, system string, destination string, messageId string) string {
+	return tenant.Key(tenantName, fmt.Sprintf("message-%s-%s-%s", system, destination, messageId))
+}
+
+func mqDestinationKey(tenantName string, system string, destination string) string {
+	return tenant.Key(tenantName, fmt.Sprintf("%s-%s", system, destination))
+}
+
+func (correlator *MqCorrelator) checkExpire() {
+	timer := time.NewTicker(1 * time.Second)
+	for {
+		select {
+		case <-timer.C:
+			correlator.removeExpired(time.Now().Unix())
+		case <-correlator.stopChan:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// removeExpired removes the expired producers, the consumers not matched and the edges linked before the last period.
+func (correlator *MqCorrelator) removeExpired(checkTime int64) {
+	correlator.mutex.Lock()
+	defer correlator.mutex.Unlock()
+	for key, producer := range correlator.producers {
+		if producer.expireTime < checkTime {
+			delete(correlator.producers, key)
+		}
+	}
+	for key, pending := range correlator.pendings {
+		if pending.expireTime < checkTime {
+			if !pending.matched {
+				// Counted once for the keys of the consumer.
+				pending.matched = true
+				MqCorrelationsTotal.WithLabelValues(mqMatchNone).Inc()
+			}
+			delete(correlator.pendings, key)
+		}
+	}
+	for key, endpoints := range correlator.endpoints {
+		for endpoint, expireTime := range endpoints {
+			if expireTime < checkTime {
+				delete(endpoints, endpoint)
+			}
+		}
+		if len(endpoints) == 0 {
+			delete(correlator.endpoints, key)
+		}
+	}
+	currentPeriod := uint64(checkTime) * uint64(time.Second) / correlator.period
+	for edge, period := range correlator.edges {
+		if period+1 < currentPeriod {
+			delete(correlator.edges, edge)
+		}
+	}
+}
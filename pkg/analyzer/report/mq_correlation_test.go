@@ -0,0 +1,110 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	apmmodel "github.com/CloudDetail/apo-module/apm/model/v1"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/external"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+func newMqNode(service string, url string, externals ...*external.External) *TopologyNode {
+	return &TopologyNode{ServiceName: service, Url: url, TopNode: true, IsTraced: true, Externals: externals}
+}
+
+func newMqExternal(kind apmmodel.OtelSpanKind, spanId string, startTime uint64, duration uint64) *external.External {
+	return external.NewExternal(startTime, duration, "", spanId, external.GroupMq, "kafka", kind, "orders", "", false, "").
+		WithMessage("", nil)
+}
+
+func TestMqCorrelateByLinkAndMessageId(t *testing.T) {
+	correlator := NewMqCorrelator(&config.MqCorrelationConfig{Enable: true}, uint64(time.Minute))
+
+	producer := newMqExternal(apmmodel.SpanKindProducer, "p1", 1000, 500).WithMessage("2:10", nil)
+	assert.Empty(t, correlator.Correlate("", "trace-1", []*TopologyNode{newMqNode("order", "POST /order", producer)}))
+
+	consumer := newMqExternal(apmmodel.SpanKindConsumer, "c1", 2000, 100).WithMessage("", []string{"p1"})
+	links := correlator.Correlate("", "trace-2", []*TopologyNode{newMqNode("stock", "orders process", consumer)})
+	if assert.Len(t, links, 1) {
+		assert.Equal(t, MqMatchLink, links[0].Match)
+		assert.Equal(t, "order", links[0].ProducerService)
+		assert.Equal(t, "POST /order", links[0].ProducerUrl)
+		assert.Equal(t, "trace-1", links[0].ProducerTraceId)
+		assert.Equal(t, "stock", links[0].ConsumerService)
+		assert.Equal(t, "trace-2", links[0].TraceId)
+		assert.Equal(t, "orders", links[0].Destination)
+		assert.Equal(t, uint64(500), links[0].QueueLatency)
+		assert.Equal(t, "p1_c1.", links[0].Path())
+	}
+
+	// The consumer arrives before the producer, it is linked when the producer is correlated.
+	consumer = newMqExternal(apmmodel.SpanKindConsumer, "c2", 5000, 100).WithMessage("2:11", nil)
+	assert.Empty(t, correlator.Correlate("", "trace-4", []*TopologyNode{newMqNode("billing", "orders process", consumer)}))
+	producer = newMqExternal(apmmodel.SpanKindProducer, "p2", 3000, 500).WithMessage("2:11", nil)
+	links = correlator.Correlate("", "trace-3", []*TopologyNode{newMqNode("order", "POST /order", producer)})
+	if assert.Len(t, links, 1) {
+		assert.Equal(t, MqMatchMessageId, links[0].Match)
+		assert.Equal(t, "billing", links[0].ConsumerService)
+		assert.Equal(t, "trace-4", links[0].TraceId)
+		assert.Equal(t, uint64(1500), links[0].QueueLatency)
+	}
+
+	// The producers are isolated by tenant.
+	consumer = newMqExternal(apmmodel.SpanKindConsumer, "c3", 2000, 100).WithMessage("", []string{"p1"})
+	assert.Empty(t, correlator.Correlate("tenant-a", "trace-5", []*TopologyNode{newMqNode("stock", "orders process", consumer)}))
+}
+
+func TestMqCorrelateInTrace(t *testing.T) {
+	correlator := NewMqCorrelator(&config.MqCorrelationConfig{Enable: true}, uint64(time.Minute))
+	producer := newMqExternal(apmmodel.SpanKindProducer, "p1", 1000, 500)
+	producer.NextSpanId = "c1"
+	producerNode := newMqNode("order", "POST /order", producer)
+	producerNode.AddChild(newMqNode("stock", "orders process", newMqExternal(apmmodel.SpanKindConsumer, "c1", 2000, 100)))
+	// The consumer is related to the producer in the relation of the trace.
+	assert.Empty(t, correlator.Correlate("", "trace-1", []*TopologyNode{producerNode}))
+}
+
+func TestMqCorrelateByDestination(t *testing.T) {
+	correlator := NewMqCorrelator(&config.MqCorrelationConfig{Enable: true}, uint64(time.Minute))
+	consumer := newMqExternal(apmmodel.SpanKindConsumer, "c1", 2000, 100)
+	assert.Empty(t, correlator.Correlate("", "trace-1", []*TopologyNode{newMqNode("stock", "orders process", consumer)}))
+
+	correlator.Correlate("", "trace-2", []*TopologyNode{newMqNode("order", "POST /order", newMqExternal(apmmodel.SpanKindProducer, "p1", 1000, 500))})
+	links := correlator.Correlate("", "trace-3", []*TopologyNode{newMqNode("stock", "orders process", newMqExternal(apmmodel.SpanKindConsumer, "c2", 3000, 100))})
+	if assert.Len(t, links, 1) {
+		assert.Equal(t, MqMatchDestination, links[0].Match)
+		assert.Equal(t, "order", links[0].ProducerService)
+		assert.Equal(t, uint64(0), links[0].QueueLatency)
+	}
+	// The relationship is linked once in the topology period.
+	assert.Empty(t, correlator.Correlate("", "trace-4", []*TopologyNode{newMqNode("stock", "orders process", newMqExternal(apmmodel.SpanKindConsumer, "c3", 4000, 100))}))
+	links = correlator.Correlate("", "trace-5", []*TopologyNode{newMqNode("stock", "orders process", newMqExternal(apmmodel.SpanKindConsumer, "c4", uint64(2*time.Minute), 100))})
+	assert.Len(t, links, 1)
+}
+
+func TestMqCorrelatorRemoveExpired(t *testing.T) {
+	correlator := NewMqCorrelator(&config.MqCorrelationConfig{Enable: true, CacheTime: time.Minute}, uint64(time.Minute))
+	correlator.Correlate("", "trace-1", []*TopologyNode{newMqNode("order", "POST /order", newMqExternal(apmmodel.SpanKindProducer, "p1", 1000, 500).WithMessage("2:10", nil))})
+	correlator.Correlate("", "trace-2", []*TopologyNode{newMqNode("stock", "orders process", newMqExternal(apmmodel.SpanKindConsumer, "c1", 2000, 100).WithMessage("", []string{"p9"}))})
+	assert.Len(t, correlator.producers, 2)
+	assert.Len(t, correlator.pendings, 1)
+
+	correlator.removeExpired(time.Now().Unix())
+	assert.Len(t, correlator.producers, 2)
+	correlator.removeExpired(time.Now().Add(2 * time.Minute).Unix())
+	assert.Empty(t, correlator.producers)
+	assert.Empty(t, correlator.pendings)
+	assert.Empty(t, correlator.endpoints)
+	assert.Empty(t, correlator.edges)
+	assert.Nil(t, NewMqCorrelator(&config.MqCorrelationConfig{}, uint64(time.Minute)))
+}
+
+func TestMqCorrelatorStopTwice(t *testing.T) {
+	correlator := NewMqCorrelator(&config.MqCorrelationConfig{Enable: true}, uint64(time.Minute))
+	correlator.Start()
+	correlator.Stop()
+	assert.NotPanics(t, correlator.Stop)
+}
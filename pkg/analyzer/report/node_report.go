@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/CloudDetail/apo-module/model/v1"
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
 )
 
 type NodeReport struct {
@@ -17,6 +18,8 @@ type NodeReport struct {
 	Duration  uint64 `json:"duration"`
 	// overwrite Data struct
 	Data *ReportData `json:"data"`
+	// Identity is the agent who sent the entry trace.
+	Identity *auth.Identity `json:"identity,omitempty"`
 }
 
 type ReportData struct {
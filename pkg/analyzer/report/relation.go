@@ -1,6 +1,7 @@
 package report
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 
@@ -9,19 +10,33 @@ import (
 )
 
 type Relation struct {
+	// Tenant is the tenant of the trace, empty for the default tenant.
+	Tenant        string `json:",omitempty"`
 	TraceId       string
 	RootNode      *TopologyNode
 	Relationships []*Relationship
 }
 
-func NewRelation(traceId string, node *TopologyNode) *Relation {
+func NewRelation(tenant string, traceId string, node *TopologyNode) *Relation {
 	return &Relation{
+		Tenant:        tenant,
 		TraceId:       traceId,
 		RootNode:      node,
 		Relationships: make([]*Relationship, 0),
 	}
 }
 
+func (relation *Relation) UnmarshalJSON(data []byte) error {
+	type relationAlias Relation
+	if err := json.Unmarshal(data, (*relationAlias)(relation)); err != nil {
+		return err
+	}
+	if relation.RootNode != nil {
+		relation.RootNode.linkChildren()
+	}
+	return nil
+}
+
 func (relation *Relation) CollectRelationships() {
 	if len(relation.Relationships) == 0 {
 		relation.collectRelationship(relation.RootNode, fmt.Sprintf("%s_", relation.RootNode.SpanId), 0)
@@ -93,6 +108,9 @@ type Relationship struct {
 	Url           string
 	IsTraced      bool
 	IsAsync       bool
+	// Duration and IsError are of the client side, they are aggregated into the dependencies but not written into service_relationship.
+	Duration uint64
+	IsError  bool
 }
 
 func NewClientRelationship(path string, client *external.External, node *TopologyNode) *Relationship {
@@ -108,6 +126,8 @@ func NewClientRelationship(path string, client *external.External, node *Topolog
 		Url:           "",
 		IsTraced:      false,
 		IsAsync:       false,
+		Duration:      client.Duration,
+		IsError:       client.Error,
 	}
 }
 
@@ -121,6 +141,8 @@ func NewServerRelationship(path string, client *external.External, node *Topolog
 		clientPeer    string
 		clientKey     string
 		isAsync       bool
+		duration      uint64
+		isError       bool
 	)
 
 	if node.Parent != nil {
@@ -134,6 +156,8 @@ func NewServerRelationship(path string, client *external.External, node *Topolog
 		clientPeer = client.Peer
 		clientKey = client.Name
 		isAsync = client.Group == "mq"
+		duration = client.Duration
+		isError = client.Error
 	}
 	return &Relationship{
 		Path:          path,
@@ -148,6 +172,8 @@ func NewServerRelationship(path string, client *external.External, node *Topolog
 		Url:           node.Url,
 		IsTraced:      node.IsTraced,
 		IsAsync:       isAsync,
+		Duration:      duration,
+		IsError:       isError,
 	}
 }
 
@@ -400,6 +400,37 @@ func TestUnknownRelation(t *testing.T) {
 	})
 }
 
+func TestRelationJsonRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("../external/testdata/otel-1.32.0/http.json")
+	if err != nil {
+		t.Fatalf("Fail to read testCase: %v", err)
+	}
+	testTraceCase := &TestTraceCase{}
+	if err = json.Unmarshal(data, testTraceCase); err != nil {
+		t.Fatalf("Read json Failed, Error%v", err)
+	}
+	topology := NewTopology("otel-1.32.0", testTraceCase.Services, map[string]*model.Trace{}, external.NewExternalFactory(&external.ParserOptions{UrlParser: "topUrl"}))
+	expect := NewRelation("", testTraceCase.TraceId, topology.Nodes[0])
+	expect.CollectRelationships()
+
+	relationJson, err := json.Marshal(NewRelation("", testTraceCase.TraceId, topology.Nodes[0]))
+	if err != nil {
+		t.Fatalf("Marshal relation Failed, Error%v", err)
+	}
+	got := &Relation{}
+	if err = json.Unmarshal(relationJson, got); err != nil {
+		t.Fatalf("Unmarshal relation Failed, Error%v", err)
+	}
+	got.CollectRelationships()
+
+	checkIntEqual(t, "roundTrip", "Datas Size", len(expect.Relationships), len(got.Relationships))
+	for i, relationship := range expect.Relationships {
+		checkStringEqual(t, "roundTrip", i, "path", relationship.Path, got.Relationships[i].Path)
+		checkStringEqual(t, "roundTrip", i, "parentService", relationship.ParentService, got.Relationships[i].ParentService)
+		checkStringEqual(t, "roundTrip", i, "clientKey", relationship.ClientKey, got.Relationships[i].ClientKey)
+	}
+}
+
 func testRelations(t *testing.T, apmType string, data map[string][]*Relationship) {
 	for testCase, expects := range data {
 		testClientCase := buildRelationDatas(t, apmType, testCase)
@@ -442,10 +473,10 @@ func buildRelationDatas(t *testing.T, apmType string, testCase string) []*Relati
 		return nil
 	}
 
-	topology := NewTopology(apmType, testTraceCase.Services, map[string]*model.Trace{}, external.NewExternalFactory("topUrl"))
+	topology := NewTopology(apmType, testTraceCase.Services, map[string]*model.Trace{}, external.NewExternalFactory(&external.ParserOptions{UrlParser: "topUrl"}))
 	relationships := make([]*Relationship, 0)
 	for _, node := range topology.Nodes {
-		relation := NewRelation(testTraceCase.TraceId, node)
+		relation := NewRelation("", testTraceCase.TraceId, node)
 		relation.CollectRelationships()
 		relationships = append(relationships, relation.Relationships...)
 	}
@@ -0,0 +1,19 @@
+package report
+
+import (
+	"github.com/CloudDetail/apo-module/model/v1"
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+)
+
+// SpanTrace is the trace stored into span_trace with the identity of the agent who sent it.
+type SpanTrace struct {
+	*model.Trace
+	Identity *auth.Identity `json:"identity,omitempty"`
+}
+
+func NewSpanTrace(trace *model.Trace, identity *auth.Identity) *SpanTrace {
+	return &SpanTrace{
+		Trace:    trace,
+		Identity: identity,
+	}
+}
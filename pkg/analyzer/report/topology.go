@@ -44,7 +44,7 @@ type TopologyNode struct {
 	IsTraced    bool
 	Children    []*TopologyNode
 	Externals   []*external.External
-	Parent      *TopologyNode
+	Parent      *TopologyNode `json:"-"`
 }
 
 func newServerTopologyNode(apmType string, parent *TopologyNode, parentService *apmmodel.OtelServiceNode, service *apmmodel.OtelServiceNode, sampledTraces map[string]*model.Trace, factory *external.ExternalFactory) *TopologyNode {
@@ -110,6 +110,14 @@ func (node *TopologyNode) AddChild(child *TopologyNode) {
 	child.Parent = node
 }
 
+// linkChildren restores the Parent of children, which is not serialized to avoid cycles.
+func (node *TopologyNode) linkChildren() {
+	for _, child := range node.Children {
+		child.Parent = node
+		child.linkChildren()
+	}
+}
+
 func (node *TopologyNode) GetParentSideExternal() *external.External {
 	if node.Parent == nil || node.SideSpanId == "" {
 		return nil
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+var b64 = base64.RawURLEncoding.EncodeToString
+
+func signToken(t *testing.T, alg string, kid string, key interface{}, claims map[string]interface{}) string {
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(alg), jwt.MapClaims(claims))
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return signed
+}
+
+func writeKeySet(t *testing.T, file string, keys ...map[string]string) {
+	keySet, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	assert.NoError(t, os.WriteFile(file, keySet, 0o600))
+}
+
+func newTestAuthenticator(t *testing.T) (*Authenticator, map[string]interface{}) {
+	dir := t.TempDir()
+	secret := []byte("hmac-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	writeKeySet(t, filepath.Join(dir, "jwks.json"),
+		map[string]string{"kty": "oct", "kid": "hs", "alg": "HS256", "k": b64(secret)},
+		map[string]string{"kty": "RSA", "kid": "rs", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		map[string]string{"kty": "EC", "kid": "es", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+	)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("file-token\n"), 0o600))
+
+	authenticator, err := NewAuthenticator(&config.AuthConfig{
+		Enable: true,
+		Tokens: []*config.AuthTokenConfig{
+			{Token: "static-token", Cluster: "c1", Tenant: "t1", Node: "n1"},
+			{TokenFile: filepath.Join(dir, "token"), Cluster: "c2", Tenant: "t2"},
+		},
+		JWT: config.JWTConfig{
+			KeySetFile: filepath.Join(dir, "jwks.json"),
+			Issuer:     "apo",
+			Audience:   "apo-receiver",
+		},
+	})
+	assert.NoError(t, err)
+	return authenticator, map[string]interface{}{"hs": secret, "rs": rsaKey, "es": ecKey}
+}
+
+func incoming(pairs ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+}
+
+func TestAuthenticate(t *testing.T) {
+	authenticator, keys := newTestAuthenticator(t)
+	now := time.Now().Unix()
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		result := map[string]interface{}{
+			"iss": "apo", "aud": []string{"apo-receiver"}, "exp": now + 60,
+			"cluster": "c3", "tenant": "t3", "node": "n3",
+		}
+		for k, v := range extra {
+			result[k] = v
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected *Identity
+	}{
+		{"static token", incoming("authorization", "Bearer static-token"), &Identity{Cluster: "c1", Tenant: "t1", Node: "n1"}},
+		{"token file with node header", incoming("authorization", "bearer file-token", "x-apo-node", "n2"), &Identity{Cluster: "c2", Tenant: "t2", Node: "n2"}},
+		{"HS256", incoming("authorization", "Bearer "+signToken(t, "HS256", "hs", keys["hs"], claims(nil))), &Identity{Cluster: "c3", Tenant: "t3", Node: "n3"}},
+		{"RS256", incoming("authorization", "Bearer "+signToken(t, "RS256", "rs", keys["rs"], claims(nil))), &Identity{Cluster: "c3", Tenant: "t3", Node: "n3"}},
+		{"ES256", incoming("authorization", "Bearer "+signToken(t, "ES256", "es", keys["es"], claims(nil))), &Identity{Cluster: "c3", Tenant: "t3", Node: "n3"}},
+		{"missing authorization", context.Background(), nil},
+		{"not bearer", incoming("authorization", "Basic static-token"), nil},
+		{"unknown token", incoming("authorization", "Bearer unknown"), nil},
+		{"wrong kid", incoming("authorization", "Bearer "+signToken(t, "RS256", "es", keys["rs"], claims(nil))), nil},
+		{"alg is not allowed by key", incoming("authorization", "Bearer "+signToken(t, "HS512", "hs", keys["hs"], claims(nil))), nil},
+		{"expired", incoming("authorization", "Bearer "+signToken(t, "HS256", "hs", keys["hs"], claims(map[string]interface{}{"exp": now - 120}))), nil},
+		{"without exp", incoming("authorization", "Bearer "+signToken(t, "HS256", "hs", keys["hs"], claims(map[string]interface{}{"exp": nil}))), nil},
+		{"alg none", incoming("authorization", "Bearer "+signToken(t, "none", "hs", jwt.UnsafeAllowNoneSignatureType, claims(nil))), nil},
+		{"not valid yet", incoming("authorization", "Bearer "+signToken(t, "HS256", "hs", keys["hs"], claims(map[string]interface{}{"nbf": now + 120}))), nil},
+		{"wrong issuer", incoming("authorization", "Bearer "+signToken(t, "HS256", "hs", keys["hs"], claims(map[string]interface{}{"iss": "other"}))), nil},
+		{"wrong audience", incoming("authorization", "Bearer "+signToken(t, "HS256", "hs", keys["hs"], claims(map[string]interface{}{"aud": "other"}))), nil},
+		{"invalid tenant", incoming("authorization", "Bearer "+signToken(t, "HS256", "hs", keys["hs"], claims(map[string]interface{}{"tenant": "a/b"}))), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := authenticator.Authenticate(tt.ctx)
+			if tt.expected == nil {
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, identity)
+		})
+	}
+}
+
+func TestJwtKeySetReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "jwks.json")
+	writeKeySet(t, file, map[string]string{"kty": "oct", "kid": "old", "k": b64([]byte("old-secret"))})
+	authenticator, err := NewAuthenticator(&config.AuthConfig{Enable: true, JWT: config.JWTConfig{KeySetFile: file}})
+	assert.NoError(t, err)
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	go authenticator.Watch(stopChan)
+
+	claims := map[string]interface{}{"exp": time.Now().Unix() + 60, "tenant": "t1"}
+	token := signToken(t, "HS256", "new", []byte("new-secret"), claims)
+	_, err = authenticator.jwt.verify(token)
+	assert.ErrorIs(t, err, errNoVerifyKey)
+
+	// The rotated key is accepted after the file is changed.
+	time.Sleep(100 * time.Millisecond)
+	writeKeySet(t, file, map[string]string{"kty": "oct", "kid": "new", "k": b64([]byte("new-secret"))})
+	assert.Eventually(t, func() bool {
+		_, err := authenticator.jwt.verify(token)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// The previous keys are kept if the new file is invalid.
+	assert.NoError(t, os.WriteFile(file, []byte("{"), 0o600))
+	time.Sleep(reloadDebounce + 500*time.Millisecond)
+	identity, err := authenticator.jwt.verify(token)
+	assert.NoError(t, err)
+	assert.Equal(t, &Identity{Tenant: "t1"}, identity)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	authenticator, _ := newTestAuthenticator(t)
+	interceptor := authenticator.UnaryServerInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return FromContext(ctx), nil
+	}
+
+	resp, err := interceptor(incoming("authorization", "Bearer static-token"), nil,
+		&grpc.UnaryServerInfo{FullMethod: "/kindling.TraceService/StoreDataGroups"}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, &Identity{Cluster: "c1", Tenant: "t1", Node: "n1"}, resp)
+
+	_, err = interceptor(context.Background(), nil,
+		&grpc.UnaryServerInfo{FullMethod: "/kindling.TraceService/StoreDataGroups"}, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// The health checks of Kubernetes do not carry the token.
+	resp, err = interceptor(context.Background(), nil,
+		&grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, handler)
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+}
+
+func TestAuthenticateHttp(t *testing.T) {
+	authenticator, _ := newTestAuthenticator(t)
+	header := http.Header{}
+	header.Set("Authorization", "Bearer file-token")
+	header.Set("X-Apo-Node", "n2")
+	identity, err := authenticator.AuthenticateHttp(context.Background(), header)
+	assert.NoError(t, err)
+	assert.Equal(t, &Identity{Cluster: "c2", Tenant: "t2", Node: "n2"}, identity)
+
+	_, err = authenticator.AuthenticateHttp(context.Background(), http.Header{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestNewAuthenticatorDisabled(t *testing.T) {
+	authenticator, err := NewAuthenticator(&config.AuthConfig{Enable: false})
+	assert.NoError(t, err)
+	assert.Nil(t, authenticator)
+
+	_, err = NewAuthenticator(&config.AuthConfig{Enable: true, JWT: config.JWTConfig{KeySetFile: filepath.Join(t.TempDir(), "missing")}})
+	assert.Error(t, err)
+}
+
+func TestAppendLabels(t *testing.T) {
+	labels := map[string]string{"service_name": "a"}
+	var nilIdentity *Identity
+	nilIdentity.AppendLabels(labels)
+	assert.Equal(t, map[string]string{"service_name": "a"}, labels)
+
+	(&Identity{Cluster: "c", Tenant: "t", Node: "n"}).AppendLabels(labels)
+	assert.Equal(t, map[string]string{"service_name": "a", "cluster": "c", "tenant": "t", "agent_node": "n"}, labels)
+}
@@ -0,0 +1,46 @@
+package auth
+
+import "context"
+
+// Identity is the source of the data sent by an agent.
+type Identity struct {
+	Cluster string `json:"cluster,omitempty"`
+	Tenant  string `json:"tenant,omitempty"`
+	Node    string `json:"node,omitempty"`
+}
+
+// AppendLabels stamps the identity into the labels written to ClickHouse, nothing is stamped for nil.
+func (id *Identity) AppendLabels(labels map[string]string) {
+	if id == nil {
+		return
+	}
+	if id.Cluster != "" {
+		labels["cluster"] = id.Cluster
+	}
+	if id.Tenant != "" {
+		labels["tenant"] = id.Tenant
+	}
+	if id.Node != "" {
+		labels["agent_node"] = id.Node
+	}
+}
+
+// GetTenant returns the default tenant for nil.
+func (id *Identity) GetTenant() string {
+	if id == nil {
+		return ""
+	}
+	return id.Tenant
+}
+
+type identityKey struct{}
+
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity of the authenticated agent, nil if auth is disabled.
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
+)
+
+const (
+	authorizationKey = "authorization"
+	// nodeKey is the metadata of the agent node, it is used when the token does not specify the node.
+	nodeKey      = "x-apo-node"
+	bearerPrefix = "bearer "
+)
+
+// Authenticator authenticates the agents by the static tokens or JWTs in the authorization metadata.
+type Authenticator struct {
+	// tokens is keyed by the SHA-256 of the token to avoid comparing the secrets byte by byte.
+	tokens map[[sha256.Size]byte]*Identity
+	jwt    *jwtVerifier
+}
+
+// NewAuthenticator loads the tokens and the key set, nil is returned if auth is not enabled.
+func NewAuthenticator(cfg *config.AuthConfig) (*Authenticator, error) {
+	if !cfg.Enable {
+		return nil, nil
+	}
+	authenticator := &Authenticator{
+		tokens: make(map[[sha256.Size]byte]*Identity),
+	}
+	for i, tokenCfg := range cfg.Tokens {
+		token := tokenCfg.Token
+		if tokenCfg.TokenFile != "" {
+			content, err := os.ReadFile(tokenCfg.TokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("read token %d: %w", i, err)
+			}
+			token = strings.TrimRight(string(content), "\r\n")
+		}
+		if !tenant.ValidName(tokenCfg.Tenant) {
+			return nil, fmt.Errorf("invalid tenant %q of token %d", tokenCfg.Tenant, i)
+		}
+		authenticator.tokens[sha256.Sum256([]byte(token))] = &Identity{
+			Cluster: tokenCfg.Cluster,
+			Tenant:  tokenCfg.Tenant,
+			Node:    tokenCfg.Node,
+		}
+	}
+	if cfg.JWT.KeySetFile != "" {
+		verifier, err := newJwtVerifier(&cfg.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("load jwt key set: %w", err)
+		}
+		authenticator.jwt = verifier
+	}
+	return authenticator, nil
+}
+
+// Watch reloads the JWKS file when it is changed until stopChan is closed, nothing is watched without JWT.
+func (authenticator *Authenticator) Watch(stopChan <-chan struct{}) {
+	if authenticator.jwt != nil {
+		authenticator.jwt.watch(stopChan)
+	}
+}
+
+// Authenticate returns the identity of the agent calling with ctx.
+func (authenticator *Authenticator) Authenticate(ctx context.Context) (*Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(authorizationKey)
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "authorization is required")
+	}
+	if len(values[0]) < len(bearerPrefix) || !strings.EqualFold(values[0][:len(bearerPrefix)], bearerPrefix) {
+		return nil, status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+	}
+	token := strings.TrimSpace(values[0][len(bearerPrefix):])
+
+	identity, found := authenticator.tokens[sha256.Sum256([]byte(token))]
+	if !found {
+		if authenticator.jwt == nil {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		var err error
+		if identity, err = authenticator.jwt.verify(token); err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token: %s", err.Error())
+		}
+	}
+	if identity.Node == "" {
+		if nodes := md.Get(nodeKey); len(nodes) > 0 && nodes[0] != "" {
+			identity = &Identity{Cluster: identity.Cluster, Tenant: identity.Tenant, Node: nodes[0]}
+		}
+	}
+	return identity, nil
+}
+
+// AuthenticateHttp authenticates the requests to the HTTP APIs by the same headers with the gRPC metadata.
+func (authenticator *Authenticator) AuthenticateHttp(ctx context.Context, header http.Header) (*Identity, error) {
+	md := metadata.MD{}
+	for _, key := range []string{authorizationKey, nodeKey} {
+		if value := header.Get(key); value != "" {
+			md.Set(key, value)
+		}
+	}
+	return authenticator.Authenticate(metadata.NewIncomingContext(ctx, md))
+}
+
+// skipAuth returns whether method is called by the probes rather than the agents.
+func skipAuth(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
+
+func (authenticator *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if skipAuth(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		identity, err := authenticator.Authenticate(ctx)
+		if err != nil {
+			log.Printf("[x Authenticate] Method: %s, Error: %s", info.FullMethod, err.Error())
+			return nil, err
+		}
+		return handler(NewContext(ctx, identity), req)
+	}
+}
+
+func (authenticator *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if skipAuth(info.FullMethod) {
+			return handler(srv, stream)
+		}
+		identity, err := authenticator.Authenticate(stream.Context())
+		if err != nil {
+			log.Printf("[x Authenticate] Method: %s, Error: %s", info.FullMethod, err.Error())
+			return err
+		}
+		return handler(srv, &identityStream{ServerStream: stream, ctx: NewContext(stream.Context(), identity)})
+	}
+}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *identityStream) Context() context.Context {
+	return stream.ctx
+}
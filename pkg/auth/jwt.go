@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
+)
+
+const (
+	// clockSkew is tolerated when checking exp and nbf.
+	clockSkew      = time.Minute
+	reloadDebounce = time.Second
+)
+
+var (
+	errInvalidBase64 = errors.New("invalid base64url")
+	errNoVerifyKey   = errors.New("no key is found for kid and alg")
+)
+
+// validMethods are the algs verified by the keys of the JWKS file, none is never accepted.
+var validMethods = []string{"HS256", "HS384", "HS512", "RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// HMAC
+	K string `json:"k"`
+}
+
+type verifyKey struct {
+	kid string
+	alg string
+	// *rsa.PublicKey, *ecdsa.PublicKey or []byte
+	key jwt.VerificationKey
+}
+
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Cluster string `json:"cluster"`
+	Tenant  string `json:"tenant"`
+	Node    string `json:"node"`
+}
+
+// jwtVerifier verifies the JWTs signed by the keys of a JWKS file, exp is required.
+// The keys are reloaded when the file is changed, so the rotated keys are accepted without restarting.
+type jwtVerifier struct {
+	keySetFile string
+	keys       atomic.Pointer[[]*verifyKey]
+	parser     *jwt.Parser
+}
+
+func newJwtVerifier(cfg *config.JWTConfig) (*jwtVerifier, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(validMethods),
+		jwt.WithLeeway(clockSkew),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	verifier := &jwtVerifier{
+		keySetFile: cfg.KeySetFile,
+		parser:     jwt.NewParser(options...),
+	}
+	if err := verifier.load(); err != nil {
+		return nil, err
+	}
+	return verifier, nil
+}
+
+func (verifier *jwtVerifier) load() error {
+	content, err := os.ReadFile(verifier.keySetFile)
+	if err != nil {
+		return err
+	}
+	keySet := struct {
+		Keys []*jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(content, &keySet); err != nil {
+		return fmt.Errorf("parse %s: %w", verifier.keySetFile, err)
+	}
+	keys := make([]*verifyKey, 0, len(keySet.Keys))
+	for i, key := range keySet.Keys {
+		verifyKey, err := key.toVerifyKey()
+		if err != nil {
+			return fmt.Errorf("parse key %d of %s: %w", i, verifier.keySetFile, err)
+		}
+		keys = append(keys, verifyKey)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no key is found in %s", verifier.keySetFile)
+	}
+	verifier.keys.Store(&keys)
+	return nil
+}
+
+func (key *jwk) toVerifyKey() (*verifyKey, error) {
+	result := &verifyKey{kid: key.Kid, alg: key.Alg}
+	switch key.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(key.K)
+		if err != nil || len(secret) == 0 {
+			return nil, fmt.Errorf("invalid k")
+		}
+		result.key = secret
+	case "RSA":
+		n, err := decodeBigInt(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n")
+		}
+		e, err := decodeBigInt(key.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid e")
+		}
+		result.key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported crv %q", key.Crv)
+		}
+		x, err := decodeBigInt(key.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x")
+		}
+		y, err := decodeBigInt(key.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y")
+		}
+		result.key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	default:
+		return nil, fmt.Errorf("unsupported kty %q", key.Kty)
+	}
+	return result, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(bytes) == 0 {
+		return nil, errInvalidBase64
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+// verify checks the signature, time and audience of token and returns the identity in the claims.
+func (verifier *jwtVerifier) verify(token string) (*Identity, error) {
+	claims := &jwtClaims{}
+	if _, err := verifier.parser.ParseWithClaims(token, claims, verifier.keyFunc); err != nil {
+		return nil, err
+	}
+	if !tenant.ValidName(claims.Tenant) {
+		return nil, fmt.Errorf("invalid tenant %q", claims.Tenant)
+	}
+	return &Identity{Cluster: claims.Cluster, Tenant: claims.Tenant, Node: claims.Node}, nil
+}
+
+// keyFunc returns the keys matching the kid and alg of token, the key type must be the one of alg.
+func (verifier *jwtVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	alg := token.Method.Alg()
+	keySet := jwt.VerificationKeySet{}
+	for _, key := range *verifier.keys.Load() {
+		if (kid != "" && key.kid != kid) || (key.alg != "" && key.alg != alg) {
+			continue
+		}
+		switch key.key.(type) {
+		case []byte:
+			if !strings.HasPrefix(alg, "HS") {
+				continue
+			}
+		case *rsa.PublicKey:
+			if !strings.HasPrefix(alg, "RS") {
+				continue
+			}
+		case *ecdsa.PublicKey:
+			if !strings.HasPrefix(alg, "ES") {
+				continue
+			}
+		}
+		keySet.Keys = append(keySet.Keys, key.key)
+	}
+	if len(keySet.Keys) == 0 {
+		return nil, errNoVerifyKey
+	}
+	return keySet, nil
+}
+
+// watch reloads the JWKS file when it is changed until stopChan is closed,
+// the previous keys are kept if the new file is invalid.
+func (verifier *jwtVerifier) watch(stopChan <-chan struct{}) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("[x Watch JWKS] %s, the keys will not be reloaded", err.Error())
+		return
+	}
+	defer watcher.Close()
+
+	// Watch the directory as the file is replaced by Kubernetes Secrets.
+	if err := watcher.Add(filepath.Dir(verifier.keySetFile)); err != nil {
+		log.Printf("[x Watch JWKS] %s, the keys will not be reloaded", err.Error())
+		return
+	}
+	fileName := filepath.Base(verifier.keySetFile)
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case <-stopChan:
+			return
+		case event := <-watcher.Events:
+			name := filepath.Base(event.Name)
+			if name == fileName || name == "..data" {
+				debounce.Reset(reloadDebounce)
+			}
+		case err := <-watcher.Errors:
+			log.Printf("[x Watch JWKS] %s", err.Error())
+		case <-debounce.C:
+			if err := verifier.load(); err != nil {
+				log.Printf("[x Reload JWKS] %s, keep the previous keys", err.Error())
+			} else {
+				log.Printf("Reload JWKS %s", verifier.keySetFile)
+			}
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"log"
 	"sync"
 
-	"github.com/CloudDetail/apo-module/model/v1"
 	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
 	profile_model "github.com/CloudDetail/apo-receiver/pkg/componment/profile/model"
 
@@ -17,11 +16,16 @@ type cache struct {
 	flameGraphs         []string
 	jvmGcs              []string
 	onoffMetrics        []string
-	spanTraces          []*model.Trace
+	spanTraces          []*report.SpanTrace
 	cameraNodeReports   []*report.NodeReport
 	cameraErrorReports  []*report.ErrorReport
 	cameraReportMetrics []*profile_model.SlowReportCountMetric
 	relations           []*report.Relation
+	mqLinks             []*report.MqLink
+	dependencies        []*report.ServiceDependency
+	dependencyChanges   []*report.DependencyChange
+	// bytes is the estimated size of the data cached since the last flush.
+	bytes int64
 }
 
 func newCache() *cache {
@@ -30,15 +34,20 @@ func newCache() *cache {
 		flameGraphs:         make([]string, 0),
 		jvmGcs:              make([]string, 0),
 		onoffMetrics:        make([]string, 0),
-		spanTraces:          make([]*model.Trace, 0),
+		spanTraces:          make([]*report.SpanTrace, 0),
 		cameraNodeReports:   make([]*report.NodeReport, 0),
 		cameraErrorReports:  make([]*report.ErrorReport, 0),
 		cameraReportMetrics: make([]*profile_model.SlowReportCountMetric, 0),
 		relations:           make([]*report.Relation, 0),
+		mqLinks:             make([]*report.MqLink, 0),
+		dependencies:        make([]*report.ServiceDependency, 0),
+		dependencyChanges:   make([]*report.DependencyChange, 0),
 	}
 }
 
-func (c *cache) batchStore(name string, datas []string) {
+// batchStore returns the bytes cached, 0 if the data group is unknown.
+func (c *cache) batchStore(name string, datas []string) int64 {
+	size := estimateSize(datas)
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -53,42 +62,101 @@ func (c *cache) batchStore(name string, datas []string) {
 		c.onoffMetrics = append(c.onoffMetrics, datas...)
 	default:
 		log.Printf("[x Unknown Data] %s, Skip.", name)
+		return 0
 	}
+	c.bytes += size
+	return size
 }
 
-func (c *cache) cacheSpanTrace(trace *model.Trace) {
+func (c *cache) cacheSpanTrace(trace *report.SpanTrace) int64 {
+	size := estimateSize(trace)
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
 	c.spanTraces = append(c.spanTraces, trace)
+	c.bytes += size
+	return size
 }
 
-func (c *cache) cacheNodeReport(nodeReport *report.NodeReport) {
+func (c *cache) cacheNodeReport(nodeReport *report.NodeReport) int64 {
+	size := estimateSize(nodeReport)
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
 	c.cameraNodeReports = append(c.cameraNodeReports, nodeReport)
+	c.bytes += size
+	return size
 }
 
-func (c *cache) cacheErrorReport(errorReport *report.ErrorReport) {
+func (c *cache) cacheErrorReport(errorReport *report.ErrorReport) int64 {
+	size := estimateSize(errorReport)
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
 	c.cameraErrorReports = append(c.cameraErrorReports, errorReport)
+	c.bytes += size
+	return size
 }
 
-func (c *cache) cacheReportMetric(reportMetric *profile_model.SlowReportCountMetric) {
+func (c *cache) cacheReportMetric(reportMetric *profile_model.SlowReportCountMetric) int64 {
+	size := estimateSize(reportMetric)
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
 	c.cameraReportMetrics = append(c.cameraReportMetrics, reportMetric)
+	c.bytes += size
+	return size
 }
 
-func (c *cache) cacheRelations(relation *report.Relation) {
+func (c *cache) cacheRelations(relation *report.Relation) int64 {
+	size := estimateSize(relation)
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
 	c.relations = append(c.relations, relation)
+	c.bytes += size
+	return size
+}
+
+func (c *cache) cacheMqLinks(links []*report.MqLink) int64 {
+	size := estimateSize(links)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.mqLinks = append(c.mqLinks, links...)
+	c.bytes += size
+	return size
+}
+
+func (c *cache) cacheDependencies(dependencies []*report.ServiceDependency) int64 {
+	size := estimateSize(dependencies)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.dependencies = append(c.dependencies, dependencies...)
+	c.bytes += size
+	return size
+}
+
+func (c *cache) cacheDependencyChanges(changes []*report.DependencyChange) int64 {
+	size := estimateSize(changes)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.dependencyChanges = append(c.dependencyChanges, changes...)
+	c.bytes += size
+	return size
+}
+
+// takeBytes returns the bytes cached and resets it, it is called before the data are taken to send.
+// The data cached after it and taken by the same flush are released by the next flush.
+func (c *cache) takeBytes() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	bytes := c.bytes
+	c.bytes = 0
+	return bytes
 }
 
 func (c *cache) getToSendEventGroups() []string {
@@ -147,7 +215,7 @@ func (c *cache) getToSendOnOffMetrics() []string {
 	return toSends
 }
 
-func (c *cache) getToSendSpanTraces() []*model.Trace {
+func (c *cache) getToSendSpanTraces() []*report.SpanTrace {
 	size := len(c.spanTraces)
 	if size == 0 {
 		return nil
@@ -216,3 +284,45 @@ func (c *cache) getToSendRelations() []*report.Relation {
 	c.relations = c.relations[size:]
 	return toSends
 }
+
+func (c *cache) getToSendMqLinks() []*report.MqLink {
+	size := len(c.mqLinks)
+	if size == 0 {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	toSends := c.mqLinks[0:size]
+	c.mqLinks = c.mqLinks[size:]
+	return toSends
+}
+
+func (c *cache) getToSendDependencies() []*report.ServiceDependency {
+	size := len(c.dependencies)
+	if size == 0 {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	toSends := c.dependencies[0:size]
+	c.dependencies = c.dependencies[size:]
+	return toSends
+}
+
+func (c *cache) getToSendDependencyChanges() []*report.DependencyChange {
+	size := len(c.dependencyChanges)
+	if size == 0 {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	toSends := c.dependencyChanges[0:size]
+	c.dependencyChanges = c.dependencyChanges[size:]
+	return toSends
+}
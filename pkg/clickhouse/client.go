@@ -3,151 +3,372 @@ package clickhouse
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/CloudDetail/apo-module/model/v1"
 
 	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
 	"github.com/CloudDetail/apo-receiver/pkg/clickhouse/tables"
 	profile_model "github.com/CloudDetail/apo-receiver/pkg/componment/profile/model"
 	"github.com/CloudDetail/apo-receiver/pkg/config"
 )
 
 var (
-	errConfigNoEndpoint      = errors.New("endpoint must be specified")
-	errConfigInvalidEndpoint = errors.New("endpoint must be url format")
+	errConfigNoEndpoint       = errors.New("endpoint must be specified")
+	errConfigInvalidEndpoint  = errors.New("endpoint must be url format")
+	errConfigInvalidWriteMode = errors.New("write_mode must be sql or native")
+)
+
+const (
+	WriteModeSql    = "sql"
+	WriteModeNative = "native"
+
+	defaultSpoolRetryMinSeconds = 5
+	defaultSpoolRetryMaxSeconds = 300
 )
 
 type ClickHouseClient struct {
-	Conn                 *sql.DB
-	cache                *cache
-	flushPeriod          uint
+	Conn         *sql.DB
+	cfg          *config.ClickHouseConfig
+	defaultStore *tenantStore
+	tenantStores sync.Map // <tenant, *tenantStore>
+	// queryConns are the connections to the existing databases of the tenants queried but not written.
+	queryConns  sync.Map // <tenant, *sql.DB>
+	flushPeriod uint
+	// flushStarted and flushDone count the flushes, the data cached before a flush starts are written or spooled when it is done.
+	flushStarted atomic.Uint64
+	flushDone    atomic.Uint64
+	// cacheSize is the estimated bytes of the data cached by all the stores.
+	cacheSize            atomic.Int64
+	cacheMaxSize         int64
 	stopChan             chan bool
+	stopOnce             sync.Once
+	routines             sync.WaitGroup
 	exportServiceClient  bool
 	generateClientMetric bool
 	clientMetricWithUrl  bool
+	spool                *spool
+	spoolRetryMin        time.Duration
+	spoolRetryMax        time.Duration
+	// replayCtx is canceled when the shutdown ctx passed to Stop is done, so a running replay does not delay the exit.
+	replayCtx    context.Context
+	cancelReplay context.CancelFunc
 }
 
 func NewClickHouseClient(ctx context.Context, cfg *config.ClickHouseConfig, generateClientMetric bool, clientMetricWithUrl bool) (*ClickHouseClient, error) {
-	if cfg.Endpoint == "" {
-		return nil, errConfigNoEndpoint
-	}
-
-	tableTTLs := make(map[string]uint)
-	tableHash := make(map[string]string)
-	for _, ttl := range cfg.TTLConfig {
-		for _, tableName := range ttl.Tables {
-			tableTTLs[tableName] = ttl.TTL
-		}
-	}
-	for _, hash := range cfg.HashConfig {
-		for _, tableName := range hash.Tables {
-			tableHash[tableName] = hash.Hash
-		}
-	}
-
-	init := NewClickHouseInit(cfg.Endpoint, cfg.Database, cfg.Replication, cfg.Cluster,
-		cfg.Username, cfg.Password, true, cfg.TTLDays, tableTTLs, tableHash)
-	if err := init.Start(); err != nil {
+	init, writer, err := connect(cfg, cfg.Database)
+	if err != nil {
 		return nil, err
 	}
+	log.Printf("Use the ClickHouse write mode: %s", getWriteMode(cfg))
 
+	defaultStore := newTenantStore("")
+	defaultStore.conn = init.GetConn()
+	defaultStore.writer = writer
 	client := &ClickHouseClient{
 		Conn:                 init.GetConn(),
-		cache:                newCache(),
+		cfg:                  cfg,
+		defaultStore:         defaultStore,
 		flushPeriod:          cfg.FlushSeconds,
+		cacheMaxSize:         cfg.CacheMaxSizeMB * 1024 * 1024,
 		stopChan:             make(chan bool),
 		exportServiceClient:  cfg.ExportServiceClient,
 		generateClientMetric: generateClientMetric,
 		clientMetricWithUrl:  clientMetricWithUrl,
 	}
+	client.replayCtx, client.cancelReplay = context.WithCancel(context.Background())
+	if cfg.Spool.Enable {
+		spool, err := newSpool(cfg.Spool.Path, cfg.Spool.MaxSizeMB, cfg.Spool.SegmentSizeMB)
+		if err != nil {
+			return nil, err
+		}
+		client.spool = spool
+		client.spoolRetryMin = time.Duration(cfg.Spool.RetryMinSeconds) * time.Second
+		if client.spoolRetryMin == 0 {
+			client.spoolRetryMin = defaultSpoolRetryMinSeconds * time.Second
+		}
+		client.spoolRetryMax = time.Duration(cfg.Spool.RetryMaxSeconds) * time.Second
+		if client.spoolRetryMax < client.spoolRetryMin {
+			client.spoolRetryMax = defaultSpoolRetryMaxSeconds * time.Second
+		}
+	}
 	return client, nil
 }
 
-func (client *ClickHouseClient) BatchStore(table string, datas []string) {
-	client.cache.batchStore(table, datas)
+func getWriteMode(cfg *config.ClickHouseConfig) string {
+	if cfg.WriteMode == "" {
+		return WriteModeSql
+	}
+	return cfg.WriteMode
+}
+
+// connect creates database and its tables, then builds the writer of the write mode.
+func connect(cfg *config.ClickHouseConfig, database string) (*ClickHouseInit, tables.Writer, error) {
+	init, err := newClickHouseInitFromConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	init.database = database
+	if err := init.Start(); err != nil {
+		init.Close()
+		return nil, nil, err
+	}
+
+	var writer tables.Writer
+	switch getWriteMode(cfg) {
+	case WriteModeSql:
+		writer = tables.NewSqlWriter(init.GetConn())
+	case WriteModeNative:
+		nativeConn, err := buildNativeConn(cfg.Endpoint, database, cfg.Username, cfg.Password, init.tlsConfig)
+		if err != nil {
+			init.Close()
+			return nil, nil, err
+		}
+		writer = tables.NewNativeWriter(nativeConn, cfg.Native.BatchSize, cfg.Native.TableBatchSizes,
+			cfg.Native.AsyncInsert, cfg.Native.WaitAsyncInsert)
+	default:
+		init.Close()
+		return nil, nil, errConfigInvalidWriteMode
+	}
+	return init, writer, nil
+}
+
+// BatchStore caches the datas of the agents, tenantName is empty for the default tenant.
+func (client *ClickHouseClient) BatchStore(tenantName string, table string, datas []string) {
+	client.addCacheSize(client.getStore(tenantName).cache.batchStore(table, datas))
+}
+
+// CacheFull returns whether the data waiting to be written exceed cache_max_size_mb.
+func (client *ClickHouseClient) CacheFull() bool {
+	return client.cacheMaxSize > 0 && client.cacheSize.Load() >= client.cacheMaxSize
+}
+
+// FlushPeriod is the period to write the cached data, the memory of the cache is released after it.
+func (client *ClickHouseClient) FlushPeriod() time.Duration {
+	if client.flushPeriod == 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(client.flushPeriod) * time.Second
+}
+
+// FlushGeneration returns the flush which writes the data cached before it is called.
+func (client *ClickHouseClient) FlushGeneration() uint64 {
+	return client.flushStarted.Load() + 1
 }
 
-func (client *ClickHouseClient) StoreTraceGroup(trace *model.Trace) {
-	client.cache.cacheSpanTrace(trace)
+// Flushed returns whether the flush of generation is done, its data are written or spooled.
+// The data failed to be written are dropped as before if the spool is disabled.
+func (client *ClickHouseClient) Flushed(generation uint64) bool {
+	return client.flushDone.Load() >= generation
+}
+
+func (client *ClickHouseClient) addCacheSize(size int64) {
+	if size != 0 {
+		CacheBytes.Set(float64(client.cacheSize.Add(size)))
+	}
+}
+
+// StoreTraceGroup caches the trace to write into span_trace, identity is nil if auth is disabled.
+func (client *ClickHouseClient) StoreTraceGroup(trace *model.Trace, identity *auth.Identity) {
+	client.addCacheSize(client.getStore(identity.GetTenant()).cache.cacheSpanTrace(report.NewSpanTrace(trace, identity)))
 }
 
 func (client *ClickHouseClient) StoreNodeReport(nodeReport *report.NodeReport) {
-	client.cache.cacheNodeReport(nodeReport)
+	client.addCacheSize(client.getStore(nodeReport.Identity.GetTenant()).cache.cacheNodeReport(nodeReport))
 }
 
 func (client *ClickHouseClient) StoreErrorReport(errorReport *report.ErrorReport) {
-	client.cache.cacheErrorReport(errorReport)
+	client.addCacheSize(client.getStore(errorReport.Identity.GetTenant()).cache.cacheErrorReport(errorReport))
 }
 
-func (client *ClickHouseClient) StoreReportMetric(reportMetric *profile_model.SlowReportCountMetric) {
-	client.cache.cacheReportMetric(reportMetric)
+func (client *ClickHouseClient) StoreReportMetric(tenantName string, reportMetric *profile_model.SlowReportCountMetric) {
+	client.addCacheSize(client.getStore(tenantName).cache.cacheReportMetric(reportMetric))
 }
 
 func (client *ClickHouseClient) StoreRelation(relation *report.Relation) {
-	client.cache.cacheRelations(relation)
+	client.addCacheSize(client.getStore(relation.Tenant).cache.cacheRelations(relation))
+}
+
+// StoreMqLinks caches the producer -> consumer relationships of the messages in different traces to write into service_relationship.
+func (client *ClickHouseClient) StoreMqLinks(tenantName string, links []*report.MqLink) {
+	client.addCacheSize(client.getStore(tenantName).cache.cacheMqLinks(links))
 }
 
-func (client *ClickHouseClient) QueryTraces(ctx context.Context, traceId string) (*model.Traces, error) {
-	return tables.QueryTraces(ctx, client.Conn, traceId)
+// StoreServiceDependencies caches the dependencies aggregated per minute to write into service_dependency_1m.
+func (client *ClickHouseClient) StoreServiceDependencies(tenantName string, dependencies []*report.ServiceDependency) {
+	client.addCacheSize(client.getStore(tenantName).cache.cacheDependencies(dependencies))
+}
+
+// StoreDependencyChanges caches the edges added to or removed from the services to write into service_dependency_change.
+func (client *ClickHouseClient) StoreDependencyChanges(tenantName string, changes []*report.DependencyChange) {
+	client.addCacheSize(client.getStore(tenantName).cache.cacheDependencyChanges(changes))
+}
+
+// QueryTraces queries the spans of traceId from the database of tenantName.
+func (client *ClickHouseClient) QueryTraces(ctx context.Context, tenantName string, traceId string) (*model.Traces, error) {
+	conn, err := client.queryConn(ctx, tenantName)
+	if err != nil {
+		return nil, err
+	}
+	return tables.QueryTraces(ctx, conn, traceId)
+}
+
+// QueryDependencyChanges queries the edges added to or removed from the services from the database of tenantName.
+func (client *ClickHouseClient) QueryDependencyChanges(ctx context.Context, tenantName string, query *tables.DependencyChangeQuery) ([]*report.DependencyChange, error) {
+	conn, err := client.queryConn(ctx, tenantName)
+	if err != nil {
+		return nil, err
+	}
+	return tables.QueryDependencyChanges(ctx, conn, query)
 }
 
 func (client *ClickHouseClient) Start() {
+	if client.spool != nil {
+		// Drain the batches left by the last run before accepting new ones.
+		if err := client.drainSpool(client.replayCtx); err != nil {
+			log.Printf("[x Drain Spool] %s, Left: %d bytes, will retry later", err.Error(), client.spool.pendingSize())
+		}
+		client.routines.Add(1)
+		go client.replaySpool()
+	}
+	client.routines.Add(1)
 	go client.batchSendToServer()
 }
 
 func (client *ClickHouseClient) batchSendToServer() {
-	ctx := context.Background()
-	waitSecond := client.flushPeriod
-	if waitSecond == 0 {
-		waitSecond = 5
+	defer client.routines.Done()
+	timer := time.NewTicker(client.FlushPeriod())
+	for {
+		select {
+		case <-timer.C:
+			client.flush(context.Background())
+		case <-client.stopChan:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// flush writes all the cached data of the tenants, the failed batches are spooled if spool is enabled.
+func (client *ClickHouseClient) flush(ctx context.Context) {
+	startTime := time.Now()
+	generation := client.flushStarted.Add(1)
+	defer func() {
+		client.flushDone.Store(generation)
+		FlushDuration.Observe(time.Since(startTime).Seconds())
+	}()
+	client.rangeStores(func(store *tenantStore) {
+		client.flushStore(ctx, store)
+	})
+}
+
+func (client *ClickHouseClient) flushStore(ctx context.Context, store *tenantStore) {
+	cache := store.cache
+	// The bytes are taken before the data, and the failed batches are spooled on disk, so the memory is released either way.
+	defer client.addCacheSize(-cache.takeBytes())
+	eventGroups, flameGraphs, jvmGcs, onoffMetrics := cache.getToSendEventGroups(), cache.getToSendFlameGraphs(), cache.getToSendJvmGcs(), cache.getToSendOnOffMetrics()
+	writeBatch(ctx, client, store, tables.TableProfilingEvent, eventGroups, tables.WriteProfilingEvents)
+	writeBatch(ctx, client, store, tables.TableFlameGraph, flameGraphs, tables.WriteFlameGraph)
+	writeBatch(ctx, client, store, tables.TableJvmGc, jvmGcs, tables.WriteJvmGcs)
+	writeBatch(ctx, client, store, tables.TableSpanTrace, cache.getToSendSpanTraces(), tables.WriteSpanTraces)
+	writeBatch(ctx, client, store, tables.TableSlowReport, cache.getToSendNodeReports(), tables.WriteSlowReports)
+	errorReports := cache.getToSendErrorReports()
+	writeBatch(ctx, client, store, tables.TableErrorReport, errorReports, tables.WriteErrorReports)
+	writeBatch(ctx, client, store, tables.TableErrorPropagation, errorReports, tables.WriteErrorPropagations)
+	writeBatch(ctx, client, store, tables.TableReportMetric, cache.getToSendReportMetrics(), tables.WriteReportMetrics)
+	writeBatch(ctx, client, store, tables.TableOnOffMetric, onoffMetrics, tables.WriteOnOffMetrics)
+	relations := cache.getToSendRelations()
+	writeBatch(ctx, client, store, tables.TableServiceRelationship, relations, tables.WriteServiceRelationships)
+	writeBatch(ctx, client, store, tables.TableMqRelationship, cache.getToSendMqLinks(), tables.WriteMqRelationships)
+	writeBatch(ctx, client, store, tables.TableServiceDependency, cache.getToSendDependencies(), tables.WriteServiceDependencies)
+	writeBatch(ctx, client, store, tables.TableDependencyChange, cache.getToSendDependencyChanges(), tables.WriteServiceDependencyChanges)
+	if client.exportServiceClient {
+		writeBatch(ctx, client, store, tables.TableServiceClient, relations, tables.WriteServiceClients)
 	}
-	timer := time.NewTicker(time.Duration(waitSecond) * time.Second)
+	if client.generateClientMetric {
+		tables.WriteClientMetric(relations, client.clientMetricWithUrl)
+	}
+}
+
+// writeBatch writes rows into table of the tenant, the rows not written are stored into spool when it is failed.
+// Each chunk is spooled as a record, so a replayed record is written by one Write and never written partly.
+func writeBatch[T any](ctx context.Context, client *ClickHouseClient, store *tenantStore, table string, rows []T, write func(context.Context, tables.Writer, []T) error) {
+	if len(rows) == 0 {
+		return
+	}
+	written, batchSize := 0, 0
+	_, writer, err := store.connect(client.cfg)
+	if err == nil {
+		batchSize = writer.BatchSize(table)
+		written, err = writeChunks(ctx, writer, batchSize, rows, write)
+	}
+	if written > 0 {
+		RowsWrittenTotal.WithLabelValues(table).Add(float64(written))
+	}
+	if err == nil {
+		return
+	}
+	WriteFailuresTotal.WithLabelValues(table).Inc()
+	log.Printf("[x Add %s] %s", table, err.Error())
+	if client.spool == nil {
+		return
+	}
+	for _, chunk := range splitChunks(rows[written:], batchSize) {
+		if err := client.spool.append(store.tenant, table, chunk); err != nil {
+			log.Printf("[x Spool %s] Drop %d rows, Error: %s", table, len(chunk), err.Error())
+		}
+	}
+}
+
+// writeChunks writes rows per batchSize and stops at the first failed chunk,
+// the count of the rows written before it is returned so they are not spooled and replayed again.
+func writeChunks[T any](ctx context.Context, writer tables.Writer, batchSize int, rows []T, write func(context.Context, tables.Writer, []T) error) (int, error) {
+	written := 0
+	for _, chunk := range splitChunks(rows, batchSize) {
+		if err := write(ctx, writer, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+	}
+	return written, nil
+}
+
+// splitChunks splits rows per batchSize, rows is not split if batchSize is 0.
+func splitChunks[T any](rows []T, batchSize int) [][]T {
+	if batchSize <= 0 {
+		batchSize = len(rows)
+	}
+	chunks := make([][]T, 0)
+	for start := 0; start < len(rows); start += batchSize {
+		chunks = append(chunks, rows[start:min(start+batchSize, len(rows))])
+	}
+	return chunks
+}
+
+// replaySpool retries the spooled batches with exponential backoff.
+func (client *ClickHouseClient) replaySpool() {
+	defer client.routines.Done()
+	backoff := client.spoolRetryMin
+	timer := time.NewTimer(backoff)
 	for {
 		select {
 		case <-timer.C:
-			if err := tables.WriteProfilingEvents(ctx, client.Conn, client.cache.getToSendEventGroups()); err != nil {
-				log.Printf("[x Add ProfilingEvent] %s", err.Error())
-			}
-			if err := tables.WriteFlameGraph(ctx, client.Conn, client.cache.getToSendFlameGraphs()); err != nil {
-				log.Printf("[x Add FlameGraph] %s", err.Error())
-			}
-			if err := tables.WriteJvmGcs(ctx, client.Conn, client.cache.getToSendJvmGcs()); err != nil {
-				log.Printf("[x Add JvmGc] %s", err.Error())
-			}
-			if err := tables.WriteSpanTraces(ctx, client.Conn, client.cache.getToSendSpanTraces()); err != nil {
-				log.Printf("[x Add SpanTrace] %s", err.Error())
-			}
-			if err := tables.WriteSlowReports(ctx, client.Conn, client.cache.getToSendNodeReports()); err != nil {
-				log.Printf("[x Add SlowReport] %s", err.Error())
-			}
-			errorReports := client.cache.getToSendErrorReports()
-			if err := tables.WriteErrorReports(ctx, client.Conn, errorReports); err != nil {
-				log.Printf("[x Add ErrorReport] %s", err.Error())
-			}
-			if err := tables.WriteErrorPropagations(ctx, client.Conn, errorReports); err != nil {
-				log.Printf("[x Add ErrorPropagation] %s", err.Error())
-			}
-			if err := tables.WriteReportMetrics(ctx, client.Conn, client.cache.getToSendReportMetrics()); err != nil {
-				log.Printf("[x Add ReportMetric] %s", err.Error())
-			}
-			if err := tables.WriteOnOffMetrics(ctx, client.Conn, client.cache.getToSendOnOffMetrics()); err != nil {
-				log.Printf("[x Add OnOffMetric] %s", err.Error())
-			}
-			relations := client.cache.getToSendRelations()
-			if err := tables.WriteServiceRelationships(ctx, client.Conn, relations); err != nil {
-				log.Printf("[x Add ServiceRelationship] %s", err.Error())
-			}
-			if client.exportServiceClient {
-				if err := tables.WriteServiceClients(ctx, client.Conn, relations); err != nil {
-					log.Printf("[x Add ServiceClient] %s", err.Error())
+			if err := client.drainSpool(client.replayCtx); err != nil {
+				backoff *= 2
+				if backoff > client.spoolRetryMax {
+					backoff = client.spoolRetryMax
 				}
+				log.Printf("[x Replay Spool] %s, Left: %d bytes, retry after %s", err.Error(), client.spool.pendingSize(), backoff)
+			} else {
+				backoff = client.spoolRetryMin
 			}
-			if client.generateClientMetric {
-				tables.WriteClientMetric(relations, client.clientMetricWithUrl)
-			}
+			timer.Reset(backoff)
 		case <-client.stopChan:
 			timer.Stop()
 			return
@@ -155,6 +376,111 @@ func (client *ClickHouseClient) batchSendToServer() {
 	}
 }
 
-func (client *ClickHouseClient) Stop() {
-	close(client.stopChan)
+// drainSpool replays the spooled segments from the oldest one and stops at the first failed batch.
+func (client *ClickHouseClient) drainSpool(ctx context.Context) error {
+	for {
+		segment := client.spool.oldest()
+		if segment == nil {
+			return nil
+		}
+		records, err := readSegment(segment)
+		if err != nil {
+			log.Printf("[x Read Spool Segment] %s, Error: %s, replay %d records", segment.path, err.Error(), len(records))
+		}
+		for ; segment.replayed < len(records); segment.replayed++ {
+			if err := client.replayRecord(ctx, records[segment.replayed]); err != nil {
+				client.spool.release(segment)
+				return err
+			}
+		}
+		client.spool.remove(segment)
+		if len(records) > 0 {
+			log.Printf("[Replay Spool Segment] %s, Records: %d", segment.path, len(records))
+		}
+	}
+}
+
+func (client *ClickHouseClient) replayRecord(ctx context.Context, record *spoolRecord) error {
+	switch record.Table {
+	case tables.TableProfilingEvent:
+		return replayRows(ctx, client, record, tables.WriteProfilingEvents)
+	case tables.TableFlameGraph:
+		return replayRows(ctx, client, record, tables.WriteFlameGraph)
+	case tables.TableJvmGc:
+		return replayRows(ctx, client, record, tables.WriteJvmGcs)
+	case tables.TableSpanTrace:
+		return replayRows(ctx, client, record, tables.WriteSpanTraces)
+	case tables.TableSlowReport:
+		return replayRows(ctx, client, record, tables.WriteSlowReports)
+	case tables.TableErrorReport:
+		return replayRows(ctx, client, record, tables.WriteErrorReports)
+	case tables.TableErrorPropagation:
+		return replayRows(ctx, client, record, tables.WriteErrorPropagations)
+	case tables.TableReportMetric:
+		return replayRows(ctx, client, record, tables.WriteReportMetrics)
+	case tables.TableOnOffMetric:
+		return replayRows(ctx, client, record, tables.WriteOnOffMetrics)
+	case tables.TableServiceRelationship:
+		return replayRows(ctx, client, record, tables.WriteServiceRelationships)
+	case tables.TableServiceClient:
+		return replayRows(ctx, client, record, tables.WriteServiceClients)
+	case tables.TableMqRelationship:
+		return replayRows(ctx, client, record, tables.WriteMqRelationships)
+	case tables.TableServiceDependency:
+		return replayRows(ctx, client, record, tables.WriteServiceDependencies)
+	case tables.TableDependencyChange:
+		return replayRows(ctx, client, record, tables.WriteServiceDependencyChanges)
+	default:
+		log.Printf("[x Replay Spool] Unknown table %s, Skip.", record.Table)
+		return nil
+	}
+}
+
+func replayRows[T any](ctx context.Context, client *ClickHouseClient, record *spoolRecord, write func(context.Context, tables.Writer, []T) error) error {
+	rows := make([]T, 0)
+	if err := json.Unmarshal(record.Rows, &rows); err != nil {
+		// Can not be recovered by retry, skip it.
+		log.Printf("[x Replay Spool] Table: %s, Error: %s, Skip.", record.Table, err.Error())
+		return nil
+	}
+	_, writer, err := client.getStore(record.Tenant).connect(client.cfg)
+	if err == nil {
+		err = write(ctx, writer, rows)
+	}
+	if err != nil {
+		WriteFailuresTotal.WithLabelValues(record.Table).Inc()
+		return err
+	}
+	RowsWrittenTotal.WithLabelValues(record.Table).Add(float64(len(rows)))
+	return nil
+}
+
+// Stop stops the periodic flush and writes the cached data before ctx is done,
+// the data failed to be written is left in the spool for the next run. It is only run once.
+func (client *ClickHouseClient) Stop(ctx context.Context) {
+	client.stopOnce.Do(func() {
+		close(client.stopChan)
+		// The replay in progress is kept until ctx is done, the records not written are replayed by the next run.
+		stopReplay := context.AfterFunc(ctx, client.cancelReplay)
+		client.routines.Wait()
+		stopReplay()
+		client.cancelReplay()
+		client.flush(ctx)
+		if client.spool != nil {
+			_ = client.spool.close()
+		}
+		client.tenantStores.Range(func(_, v interface{}) bool {
+			v.(*tenantStore).close()
+			return true
+		})
+		client.queryConns.Range(func(_, v interface{}) bool {
+			_ = v.(*sql.DB).Close()
+			return true
+		})
+	})
+}
+
+// Ping checks ClickHouse is reachable, it is used by the health checks.
+func (client *ClickHouseClient) Ping(ctx context.Context) error {
+	return client.Conn.PingContext(ctx)
 }
@@ -0,0 +1,93 @@
+package clickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/clickhouse/tables"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+type fakeWriter struct {
+	batchSize int
+}
+
+func (writer *fakeWriter) Write(ctx context.Context, query string, fn func(appendRow tables.AppendRow) error) error {
+	return nil
+}
+
+func (writer *fakeWriter) BatchSize(table string) int {
+	return writer.batchSize
+}
+
+func TestWriteBatchSpoolUnsentRows(t *testing.T) {
+	spool, err := newSpool(t.TempDir(), 1, 1)
+	assert.NoError(t, err)
+	client := &ClickHouseClient{cfg: &config.ClickHouseConfig{}, spool: spool}
+	store := &tenantStore{tenant: "t1", writer: &fakeWriter{batchSize: 2}}
+
+	// The second chunk is failed.
+	writes := 0
+	written := make([]string, 0)
+	write := func(ctx context.Context, writer tables.Writer, rows []string) error {
+		writes++
+		if writes > 1 {
+			return errors.New("timeout")
+		}
+		written = append(written, rows...)
+		return nil
+	}
+	writeBatch(context.Background(), client, store, tables.TableJvmGc, []string{"a", "b", "c", "d", "e"}, write)
+	assert.Equal(t, []string{"a", "b"}, written)
+
+	// Only the rows not written are spooled, per batch size.
+	records, err := readSegment(spool.oldest())
+	assert.NoError(t, err)
+	spooled := make([][]string, 0)
+	for _, record := range records {
+		assert.Equal(t, "t1", record.Tenant)
+		assert.Equal(t, tables.TableJvmGc, record.Table)
+		rows := make([]string, 0)
+		assert.NoError(t, json.Unmarshal(record.Rows, &rows))
+		spooled = append(spooled, rows)
+	}
+	assert.Equal(t, [][]string{{"c", "d"}, {"e"}}, spooled)
+}
+
+func TestSplitChunks(t *testing.T) {
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, splitChunks([]int{1, 2, 3, 4, 5}, 2))
+	assert.Equal(t, [][]int{{1, 2, 3}}, splitChunks([]int{1, 2, 3}, 0))
+	assert.Empty(t, splitChunks([]int{}, 0))
+}
+
+func TestFlushGeneration(t *testing.T) {
+	client := &ClickHouseClient{cfg: &config.ClickHouseConfig{}, defaultStore: newTenantStore("")}
+	generation := client.FlushGeneration()
+	assert.False(t, client.Flushed(generation))
+	client.flush(context.Background())
+	assert.True(t, client.Flushed(generation))
+	assert.False(t, client.Flushed(client.FlushGeneration()))
+}
+
+func TestStopCancelReplay(t *testing.T) {
+	client := &ClickHouseClient{cfg: &config.ClickHouseConfig{}, defaultStore: newTenantStore(""), stopChan: make(chan bool)}
+	client.replayCtx, client.cancelReplay = context.WithCancel(context.Background())
+	// A replay blocked by ClickHouse returns when the shutdown ctx is done.
+	client.routines.Add(1)
+	go func() {
+		defer client.routines.Done()
+		<-client.replayCtx.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client.Stop(ctx)
+	assert.Error(t, client.replayCtx.Err())
+	// Stop is only run once.
+	client.Stop(context.Background())
+}
@@ -3,9 +3,10 @@ package clickhouse
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"fmt"
-	"log"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -13,14 +14,17 @@ import (
 	"strings"
 	"text/template"
 
-	_ "github.com/ClickHouse/clickhouse-go/v2" // For register database driver.
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+	"github.com/CloudDetail/apo-receiver/pkg/tlsconfig"
 )
 
 const (
 	defaultDatabase = "default"
 	sqlCreateFolder = "sqlscript/create_table"
 	distributeSql   = "sqlscript/distributed-table.tmpl.sql"
-	migrateTableSql = "sqlscript/migrate.tmpl.sql"
 
 	templateCreateDb            = "CREATE DATABASE IF NOT EXISTS %s"
 	templateCreateDbWithCluster = "CREATE DATABASE IF NOT EXISTS %s ON CLUSTER %s"
@@ -37,6 +41,7 @@ type ClickHouseInit struct {
 	defaultTTLDay uint
 	tableTTLs     map[string]uint
 	tableHashKeys map[string]string
+	tlsConfig     *tls.Config
 	conn          *sql.DB
 }
 
@@ -65,18 +70,99 @@ func NewClickHouseInit(
 	}
 }
 
+func newClickHouseInitFromConfig(cfg *config.ClickHouseConfig) (*ClickHouseInit, error) {
+	if cfg.Endpoint == "" {
+		return nil, errConfigNoEndpoint
+	}
+
+	tableTTLs := make(map[string]uint)
+	tableHash := make(map[string]string)
+	for _, ttl := range cfg.TTLConfig {
+		for _, tableName := range ttl.Tables {
+			tableTTLs[tableName] = ttl.TTL
+		}
+	}
+	for _, hash := range cfg.HashConfig {
+		for _, tableName := range hash.Tables {
+			tableHash[tableName] = hash.Hash
+		}
+	}
+
+	tlsConfig, err := tlsconfig.NewClientTLS(&cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	init := NewClickHouseInit(cfg.Endpoint, cfg.Database, cfg.Replication, cfg.Cluster,
+		cfg.Username, cfg.Password, true, cfg.TTLDays, tableTTLs, tableHash)
+	init.tlsConfig = tlsConfig
+	return init, nil
+}
+
+// Migrate creates the database and tables, then runs the pending schema migrations.
+func Migrate(cfg *config.ClickHouseConfig) error {
+	init, err := newClickHouseInitFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	defer init.Close()
+	return init.Start()
+}
+
+// PrintMigrateSql prints the statements Migrate may run without connecting to ClickHouse.
+// All statements are idempotent, the migrations already recorded in schema_migrations are skipped by Migrate.
+func PrintMigrateSql(cfg *config.ClickHouseConfig, out io.Writer) error {
+	init, err := newClickHouseInitFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if createDbSql := renderCreateDatabase(init.database, init.cluster); createDbSql != "" {
+		fmt.Fprintf(out, "%s;\n\n", createDbSql)
+	}
+	sqlStatements, err := init.renderInitScripts()
+	if err != nil {
+		return err
+	}
+	for _, sqlStatement := range sqlStatements {
+		fmt.Fprintf(out, "%s;\n\n", strings.TrimSpace(sqlStatement))
+	}
+
+	for _, tableTemplate := range []string{templateCreateMigrationTable, templateCreateMigrationLockTable} {
+		migrationTableSql, err := renderMigrationTemplate(tableTemplate, init.migrationArgs())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s;\n\n", migrationTableSql)
+	}
+	migrations, err := loadMigrations(migrationFolder)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		statements, err := m.render(init.migrationArgs())
+		if err != nil {
+			return fmt.Errorf("render migration %s: %w", m.name, err)
+		}
+		fmt.Fprintf(out, "-- migration %s\n", m.name)
+		for _, statement := range statements {
+			fmt.Fprintf(out, "%s;\n", statement)
+		}
+		fmt.Fprintln(out)
+	}
+	return nil
+}
+
 func (ch *ClickHouseInit) GetConn() *sql.DB {
 	return ch.conn
 }
 
 func (ch *ClickHouseInit) Start() (err error) {
 	if ch.createTable {
-		if err = createDatabase(context.Background(), ch.endpoint, ch.database, ch.cluster, ch.userName, ch.password); err != nil {
+		if err = createDatabase(context.Background(), ch.endpoint, ch.database, ch.cluster, ch.userName, ch.password, ch.tlsConfig); err != nil {
 			return
 		}
 	}
 
-	if ch.conn, err = buildDB(ch.endpoint, ch.database, ch.userName, ch.password); err != nil {
+	if ch.conn, err = buildDB(ch.endpoint, ch.database, ch.userName, ch.password, ch.tlsConfig); err != nil {
 		return err
 	}
 
@@ -86,19 +172,35 @@ func (ch *ClickHouseInit) Start() (err error) {
 			return err
 		}
 	}
-	err = ch.runMigrateScripts()
+	return ch.runMigrations()
+}
+
+func (ch *ClickHouseInit) Close() {
+	if ch.conn != nil {
+		_ = ch.conn.Close()
+	}
+}
+
+func (ch *ClickHouseInit) runInitScripts() error {
+	sqlStatements, err := ch.renderInitScripts()
 	if err != nil {
-		// Failed to run migrate scripts, maybe no need to migrate/upgrade.
-		// This is not an error case, just ignore and print the message.
-		log.Println(err)
+		return err
+	}
+	for _, sqlStatement := range sqlStatements {
+		_, err := ch.conn.ExecContext(context.Background(), sqlStatement)
+		if err != nil {
+			return fmt.Errorf("could not run sql %q: %q", sqlStatement, err)
+		}
 	}
+
 	return nil
 }
 
-func (ch *ClickHouseInit) runInitScripts() error {
+// renderInitScripts renders the create table scripts, with the distributed tables if cluster is set.
+func (ch *ClickHouseInit) renderInitScripts() ([]string, error) {
 	filePaths, err := walkMatch(sqlCreateFolder, "*.tmp.sql")
 	if err != nil {
-		return fmt.Errorf("could not list sql files: %q", err)
+		return nil, fmt.Errorf("could not list sql files: %q", err)
 	}
 	sort.Strings(filePaths)
 
@@ -117,7 +219,7 @@ func (ch *ClickHouseInit) runInitScripts() error {
 		_, fileName := filepath.Split(f)
 		tmpl, err := template.ParseFiles(filepath.Clean(f))
 		if err != nil {
-			return err
+			return nil, err
 		}
 		tableName := fileName[0 : len(fileName)-8]
 		if ttlDay, found := ch.tableTTLs[tableName]; found {
@@ -127,14 +229,14 @@ func (ch *ClickHouseInit) runInitScripts() error {
 		}
 		var rendered bytes.Buffer
 		if err := tmpl.Execute(&rendered, args); err != nil {
-			return err
+			return nil, err
 		}
 		sqlStatements = append(sqlStatements, rendered.String())
 
 		if ch.cluster != "" {
 			disttmpl, err := template.ParseFiles(distributeSql)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			distargs.Table = tableName
 			if hashKey, exist := ch.tableHashKeys[tableName]; exist {
@@ -144,95 +246,45 @@ func (ch *ClickHouseInit) runInitScripts() error {
 			}
 			var distRendered bytes.Buffer
 			if err := disttmpl.Execute(&distRendered, distargs); err != nil {
-				return err
+				return nil, err
 			}
 			sqlStatements = append(sqlStatements, distRendered.String())
 		}
 	}
-
-	for _, sqlStatement := range sqlStatements {
-		_, err := ch.conn.ExecContext(context.Background(), sqlStatement)
-		if err != nil {
-			return fmt.Errorf("could not run sql %q: %q", sqlStatement, err)
-		}
-	}
-
-	return nil
-}
-
-// runMigrateScripts Run scripts to upgrade the table schema
-func (ch *ClickHouseInit) runMigrateScripts() error {
-	fs, err := os.Stat(migrateTableSql)
-	if os.IsNotExist(err) {
-		return nil
-	}
-	if fs.Size() < 100 {
-		return nil
-	}
-
-	args := distributedTableArgs{
-		Cluster:  ch.cluster,
-		Database: ch.database,
-	}
-	migrateTemplate, err := template.ParseFiles(migrateTableSql)
-	if err != nil {
-		return err
-	}
-	var rendered bytes.Buffer
-	if err := migrateTemplate.Execute(&rendered, args); err != nil {
-		return err
-	}
-	sqlStatements := rendered.String()
-	log.Println("Try to run migrate scripts: " + sqlStatements)
-	err = executeMultiStatements(ch.conn, sqlStatements)
-	if err != nil {
-		return fmt.Errorf("failed to run migrate sql, maybe no need to migrate/upgrade %q: %q", sqlStatements, err)
-	}
-	return nil
-}
-
-func executeMultiStatements(conn *sql.DB, sqlStatements string) error {
-	statements := strings.Split(sqlStatements, ";")
-	for _, stmt := range statements {
-		trimmedStmt := strings.TrimSpace(stmt)
-		if trimmedStmt != "" {
-			_, err := conn.ExecContext(context.Background(), trimmedStmt)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
+	return sqlStatements, nil
 }
 
-func createDatabase(ctx context.Context, endpoint string, database string, cluster string, userName string, password string) error {
+func createDatabase(ctx context.Context, endpoint string, database string, cluster string, userName string, password string, tlsConfig *tls.Config) error {
 	// use default database to create new database
 	if database == defaultDatabase {
 		return nil
 	}
 
-	db, err := buildDB(endpoint, defaultDatabase, userName, password)
+	db, err := buildDB(endpoint, defaultDatabase, userName, password, tlsConfig)
 	if err != nil {
 		return err
 	}
 	defer func() {
 		_ = db.Close()
 	}()
-	var query string
-	if cluster == "" {
-		query = fmt.Sprintf(templateCreateDb, database)
-	} else {
-		query = fmt.Sprintf(templateCreateDbWithCluster, database, cluster)
-	}
-
-	_, err = db.ExecContext(ctx, query)
+	_, err = db.ExecContext(ctx, renderCreateDatabase(database, cluster))
 	if err != nil {
 		return fmt.Errorf("create database:%w", err)
 	}
 	return nil
 }
 
+// renderCreateDatabase returns empty if the default database is used.
+func renderCreateDatabase(database string, cluster string) string {
+	if database == defaultDatabase {
+		return ""
+	}
+	if cluster == "" {
+		return fmt.Sprintf(templateCreateDb, database)
+	}
+	return fmt.Sprintf(templateCreateDbWithCluster, database, cluster)
+}
+
 func buildDSN(endpoint string, database string, userName string, password string) (string, error) {
 	dsnURL, err := url.Parse(endpoint)
 	if err != nil {
@@ -260,11 +312,20 @@ func buildDSN(endpoint string, database string, userName string, password string
 	return dsnURL.String(), nil
 }
 
-func buildDB(endpoint string, database string, userName string, password string) (*sql.DB, error) {
+func buildDB(endpoint string, database string, userName string, password string, tlsConfig *tls.Config) (*sql.DB, error) {
 	dsn, err := buildDSN(endpoint, database, userName, password)
 	if err != nil {
 		return nil, err
 	}
+	if tlsConfig != nil {
+		// The certificates can not be set by the DSN.
+		options, err := clickhouse.ParseDSN(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errConfigInvalidEndpoint, err.Error())
+		}
+		options.TLS = tlsConfig
+		return clickhouse.OpenDB(options), nil
+	}
 
 	// ClickHouse sql driver will read clickhouse settings from the DSN string.
 	// It also ensures defaults.
@@ -277,6 +338,22 @@ func buildDB(endpoint string, database string, userName string, password string)
 	return conn, nil
 }
 
+// buildNativeConn opens a native protocol connection for columnar batch inserts.
+func buildNativeConn(endpoint string, database string, userName string, password string, tlsConfig *tls.Config) (driver.Conn, error) {
+	dsn, err := buildDSN(endpoint, database, userName, password)
+	if err != nil {
+		return nil, err
+	}
+	options, err := clickhouse.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errConfigInvalidEndpoint, err.Error())
+	}
+	if tlsConfig != nil {
+		options.TLS = tlsConfig
+	}
+	return clickhouse.Open(options)
+}
+
 func walkMatch(root, pattern string) ([]string, error) {
 	var matches []string
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
@@ -0,0 +1,39 @@
+package clickhouse
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	FlushDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "originx_receiver_clickhouse_flush_duration_seconds",
+			Help:    "The duration of writing the cached data into ClickHouse",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+		},
+	)
+	RowsWrittenTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_clickhouse_rows_written_total",
+			Help: "The total number of rows written into ClickHouse, including the replayed rows",
+		},
+		[]string{"table"},
+	)
+	WriteFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_clickhouse_write_failures_total",
+			Help: "The total number of failed batch writes into ClickHouse",
+		},
+		[]string{"table"},
+	)
+	CacheBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "originx_receiver_clickhouse_cache_bytes",
+			Help: "The bytes of the data groups waiting to be written into ClickHouse",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(FlushDuration, RowsWrittenTotal, WriteFailuresTotal, CacheBytes)
+}
@@ -0,0 +1,298 @@
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	migrationFolder = "sqlscript/migrations"
+	migrationSuffix = ".tmpl.sql"
+
+	// The migration tables are shared by all the shards, as the migrations run ON CLUSTER once for the cluster.
+	templateCreateMigrationTable = `CREATE TABLE IF NOT EXISTS schema_migrations{{if .Cluster}} ON CLUSTER {{.Cluster}}{{end}}
+(
+    version UInt32,
+    name String,
+    applied_at DateTime
+) ENGINE {{if .Replication}}ReplicatedReplacingMergeTree('/clickhouse/tables/{{if .Cluster}}{{.Cluster}}/{{end}}{{.Database}}/schema_migrations', '{shard}-{replica}'){{else}}ReplacingMergeTree(){{end}}
+ORDER BY version`
+	templateCreateMigrationLockTable = `CREATE TABLE IF NOT EXISTS schema_migrations_lock{{if .Cluster}} ON CLUSTER {{.Cluster}}{{end}}
+(
+    owner String,
+    acquired_at DateTime64(3),
+    released UInt8,
+    updated_at DateTime64(3)
+) ENGINE {{if .Replication}}ReplicatedReplacingMergeTree('/clickhouse/tables/{{if .Cluster}}{{.Cluster}}/{{end}}{{.Database}}/schema_migrations_lock', '{shard}-{replica}', updated_at){{else}}ReplacingMergeTree(updated_at){{end}}
+ORDER BY owner
+TTL toDateTime(updated_at) + INTERVAL 1 DAY`
+	sqlQueryMigrationVersions = "SELECT DISTINCT version FROM schema_migrations"
+	sqlInsertMigration        = "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"
+
+	sqlAcquireMigrationLock     = "INSERT INTO schema_migrations_lock SELECT ?, now64(3), 0, now64(3)"
+	sqlQueryMigrationLockHolder = "SELECT owner FROM schema_migrations_lock FINAL WHERE released = 0 AND acquired_at > now64(3) - INTERVAL ? SECOND ORDER BY acquired_at, owner LIMIT 1"
+	sqlReleaseMigrationLock     = "INSERT INTO schema_migrations_lock SELECT owner, acquired_at, 1, now64(3) FROM schema_migrations_lock FINAL WHERE owner = ?"
+
+	// migrationLockLease is how long a lock is held at most, the lock of a crashed receiver is taken over after it.
+	migrationLockLease = 10 * time.Minute
+	migrationLockRetry = 2 * time.Second
+)
+
+var (
+	errSchemaAhead          = errors.New("schema is ahead of the receiver")
+	errMigrationLockTimeout = errors.New("timeout waiting for the migration lock")
+)
+
+type migrationArgs struct {
+	Cluster     string
+	Database    string
+	Replication bool
+}
+
+// migration is one numbered up-step, file name is <version>_<name>.tmpl.sql.
+// The statements must be idempotent, a failed step is rerun from the start on the next boot.
+type migration struct {
+	version uint32
+	name    string
+	path    string
+}
+
+// render returns the statements of the migration, a statement is split by `;`.
+func (m *migration) render(args migrationArgs) ([]string, error) {
+	tmpl, err := template.ParseFiles(filepath.Clean(m.path))
+	if err != nil {
+		return nil, err
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, args); err != nil {
+		return nil, err
+	}
+	return splitStatements(rendered.String()), nil
+}
+
+// loadMigrations lists the migrations in dir sorted by version.
+func loadMigrations(dir string) ([]*migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*migration{}, nil
+		}
+		return nil, fmt.Errorf("could not list migrations: %w", err)
+	}
+	migrations := make([]*migration, 0)
+	versions := make(map[uint32]string)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(fileName, migrationSuffix) {
+			continue
+		}
+		name := strings.TrimSuffix(fileName, migrationSuffix)
+		versionStr, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseUint(versionStr, 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid migration file name %s, expect <version>_<name>%s", fileName, migrationSuffix)
+		}
+		if exist, found := versions[uint32(version)]; found {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, exist, fileName)
+		}
+		versions[uint32(version)] = fileName
+		migrations = append(migrations, &migration{
+			version: uint32(version),
+			name:    name,
+			path:    filepath.Join(dir, fileName),
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// runMigrations applies the migrations which are not recorded in schema_migrations in order.
+// The receivers started together take the migration lock in turn, so a migration is not run concurrently.
+func (ch *ClickHouseInit) runMigrations() error {
+	migrations, err := loadMigrations(migrationFolder)
+	if err != nil {
+		return err
+	}
+	args := ch.migrationArgs()
+	if err := ch.createMigrationTables(args); err != nil {
+		return err
+	}
+	release, err := ch.acquireMigrationLock(context.Background())
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	applied, err := ch.appliedMigrations()
+	if err != nil {
+		return err
+	}
+	pending, err := pendingMigrations(migrations, applied)
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		statements, err := m.render(args)
+		if err != nil {
+			return fmt.Errorf("render migration %s: %w", m.name, err)
+		}
+		log.Printf("Run migration %s", m.name)
+		for _, statement := range statements {
+			if _, err := ch.conn.ExecContext(context.Background(), statement); err != nil {
+				return fmt.Errorf("migration %s failed at %q: %w", m.name, statement, err)
+			}
+		}
+		if _, err := ch.conn.ExecContext(context.Background(), sqlInsertMigration, m.version, m.name, time.Now()); err != nil {
+			return fmt.Errorf("record migration %s: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+func (ch *ClickHouseInit) migrationArgs() migrationArgs {
+	return migrationArgs{
+		Cluster:     ch.cluster,
+		Database:    ch.database,
+		Replication: ch.replication,
+	}
+}
+
+// createMigrationTables creates schema_migrations and schema_migrations_lock if not exist.
+func (ch *ClickHouseInit) createMigrationTables(args migrationArgs) error {
+	for _, tableTemplate := range []string{templateCreateMigrationTable, templateCreateMigrationLockTable} {
+		createSql, err := renderMigrationTemplate(tableTemplate, args)
+		if err != nil {
+			return err
+		}
+		if _, err := ch.conn.ExecContext(context.Background(), createSql); err != nil {
+			return fmt.Errorf("create migration table: %w", err)
+		}
+	}
+	return nil
+}
+
+// acquireMigrationLock waits until the lock is held by this receiver, the earliest unreleased owner in the lease holds the lock.
+// It is best effort as the inserts may not be replicated at once, the migrations are still idempotent.
+func (ch *ClickHouseInit) acquireMigrationLock(ctx context.Context) (func(), error) {
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano())
+	release := func() {
+		if _, err := ch.conn.ExecContext(context.Background(), sqlReleaseMigrationLock, owner); err != nil {
+			log.Printf("[x Release Migration Lock] %s", err.Error())
+		}
+	}
+	deadline := time.Now().Add(migrationLockLease)
+	for {
+		if _, err := ch.conn.ExecContext(ctx, sqlAcquireMigrationLock, owner); err != nil {
+			return nil, fmt.Errorf("acquire migration lock: %w", err)
+		}
+		var holder string
+		if err := ch.conn.QueryRowContext(ctx, sqlQueryMigrationLockHolder, int64(migrationLockLease.Seconds())).Scan(&holder); err != nil {
+			release()
+			return nil, fmt.Errorf("query migration lock: %w", err)
+		}
+		if holder == owner {
+			return release, nil
+		}
+		// Withdraw so the lock is not taken by this receiver after the holder releases it, it is acquired again in the next round.
+		release()
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w, held by %s", errMigrationLockTimeout, holder)
+		}
+		log.Printf("Wait migration lock held by %s", holder)
+		select {
+		case <-time.After(migrationLockRetry):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// appliedMigrations returns the versions recorded in schema_migrations.
+func (ch *ClickHouseInit) appliedMigrations() (map[uint32]bool, error) {
+	rows, err := ch.conn.QueryContext(context.Background(), sqlQueryMigrationVersions)
+	if err != nil {
+		return nil, fmt.Errorf("query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	applied := make(map[uint32]bool)
+	for rows.Next() {
+		var version uint32
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("query schema_migrations: %w", err)
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+func renderMigrationTemplate(tableTemplate string, args migrationArgs) (string, error) {
+	tmpl, err := template.New("schema_migrations").Parse(tableTemplate)
+	if err != nil {
+		return "", err
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, args); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+// pendingMigrations returns the migrations not applied yet.
+// The receiver must not run against a schema migrated by a newer receiver, which may have changed tables it writes.
+func pendingMigrations(migrations []*migration, applied map[uint32]bool) ([]*migration, error) {
+	var latest uint32
+	known := make(map[uint32]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.version] = true
+		latest = m.version
+	}
+	for version := range applied {
+		if !known[version] && version > latest {
+			return nil, fmt.Errorf("%w: schema version is %d, but the receiver supports up to %d, please upgrade the receiver",
+				errSchemaAhead, version, latest)
+		}
+	}
+	pending := make([]*migration, 0)
+	for _, m := range migrations {
+		if !applied[m.version] {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+func splitStatements(sqlStatements string) []string {
+	statements := make([]string, 0)
+	for _, stmt := range strings.Split(sqlStatements, ";") {
+		if trimmedStmt := trimComments(stmt); trimmedStmt != "" {
+			statements = append(statements, trimmedStmt)
+		}
+	}
+	return statements
+}
+
+// trimComments removes the leading comment lines of a statement.
+func trimComments(stmt string) string {
+	lines := strings.Split(strings.TrimSpace(stmt), "\n")
+	for len(lines) > 0 {
+		line := strings.TrimSpace(lines[0])
+		if line != "" && !strings.HasPrefix(line, "--") {
+			break
+		}
+		lines = lines[1:]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
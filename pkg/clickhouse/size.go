@@ -0,0 +1,66 @@
+package clickhouse
+
+import (
+	"reflect"
+)
+
+// estimateSize returns the approximate bytes held by value, which is counted into cache_max_size_mb.
+// The strings, slices and maps are counted by their contents, each pointer is followed once.
+func estimateSize(value interface{}) int64 {
+	return estimateValueSize(reflect.ValueOf(value), make(map[uintptr]bool))
+}
+
+func estimateValueSize(value reflect.Value, visited map[uintptr]bool) int64 {
+	switch value.Kind() {
+	case reflect.Invalid:
+		return 0
+	case reflect.Pointer:
+		if value.IsNil() || visited[value.Pointer()] {
+			return 8
+		}
+		visited[value.Pointer()] = true
+		return 8 + estimateValueSize(value.Elem(), visited)
+	case reflect.Interface:
+		if value.IsNil() {
+			return 16
+		}
+		return 16 + estimateValueSize(value.Elem(), visited)
+	case reflect.String:
+		return 16 + int64(value.Len())
+	case reflect.Slice:
+		if value.IsNil() {
+			return 24
+		}
+		return 24 + estimateElemsSize(value, visited)
+	case reflect.Array:
+		return estimateElemsSize(value, visited)
+	case reflect.Map:
+		size := int64(48)
+		iter := value.MapRange()
+		for iter.Next() {
+			size += estimateValueSize(iter.Key(), visited) + estimateValueSize(iter.Value(), visited)
+		}
+		return size
+	case reflect.Struct:
+		var size int64
+		for i := 0; i < value.NumField(); i++ {
+			size += estimateValueSize(value.Field(i), visited)
+		}
+		return size
+	default:
+		return int64(value.Type().Size())
+	}
+}
+
+func estimateElemsSize(value reflect.Value, visited map[uintptr]bool) int64 {
+	switch value.Type().Elem().Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return int64(value.Len()) * int64(value.Type().Elem().Size())
+	}
+	var size int64
+	for i := 0; i < value.Len(); i++ {
+		size += estimateValueSize(value.Index(i), visited)
+	}
+	return size
+}
@@ -0,0 +1,41 @@
+package clickhouse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
+)
+
+type sizeNode struct {
+	Name     string
+	Values   []uint64
+	Parent   *sizeNode
+	Children []*sizeNode
+}
+
+func TestEstimateSize(t *testing.T) {
+	assert.Equal(t, int64(16+5), estimateSize("hello"))
+	assert.Equal(t, int64(24+2*(16+3)), estimateSize([]string{"abc", "def"}))
+	assert.Equal(t, int64(24+4*8), estimateSize([]uint64{1, 2, 3, 4}))
+
+	// The cycles are counted once.
+	parent := &sizeNode{Name: "parent"}
+	child := &sizeNode{Name: "child", Parent: parent}
+	parent.Children = []*sizeNode{child}
+	assert.Less(t, estimateSize(parent), int64(1024))
+	assert.Greater(t, estimateSize(parent), estimateSize(child.Name)+estimateSize(parent.Name))
+}
+
+func TestCacheBytes(t *testing.T) {
+	c := newCache()
+	assert.Equal(t, int64(0), c.batchStore("unknown", []string{"a"}))
+	size := c.batchStore(report.FlameGraph, []string{"a", "b"})
+	assert.Greater(t, size, int64(0))
+	size += c.cacheMqLinks([]*report.MqLink{{ProducerService: "order", ConsumerService: "payment"}})
+	size += c.cacheDependencyChanges([]*report.DependencyChange{{Service: "order", ClientPeer: "mysql:3306"}})
+
+	assert.Equal(t, size, c.takeBytes())
+	assert.Equal(t, int64(0), c.takeBytes())
+}
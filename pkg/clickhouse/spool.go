@@ -0,0 +1,327 @@
+package clickhouse
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	spoolSegmentSuffix = ".seg"
+	spoolHeaderSize    = 8 // 4 bytes length + 4 bytes crc32
+
+	defaultSpoolMaxSizeMB     = 1024
+	defaultSpoolSegmentSizeMB = 16
+)
+
+var errSpoolCorruptRecord = errors.New("corrupt spool record")
+
+// spoolRecord is one failed batch of a table, Rows is the json encoded slice of rows.
+type spoolRecord struct {
+	// Tenant is empty for the default tenant.
+	Tenant string          `json:"tenant,omitempty"`
+	Table  string          `json:"table"`
+	Rows   json.RawMessage `json:"rows"`
+}
+
+type spoolSegment struct {
+	id   uint64
+	path string
+	size int64
+	// replayed is the count of records which are already written to ClickHouse.
+	replayed int
+}
+
+// spool is a disk-backed write-ahead log for batches which failed to be written to ClickHouse.
+//
+// Records are appended into the newest segment file, segments are rotated when they reach segmentSize
+// and the oldest segments are dropped when the total size exceeds maxSize.
+// Each record is stored as [length uint32][crc32 uint32][json spoolRecord].
+// The segment being replayed is not dropped, so its records are not lost while they are read.
+type spool struct {
+	lock        sync.Mutex
+	dir         string
+	maxSize     int64
+	segmentSize int64
+	segments    []*spoolSegment // Sorted by id, the last one may be the active segment.
+	active      *os.File
+	nextId      uint64
+	size        int64
+	// replaying is the segment returned by oldest, it is not dropped by enforceMaxSize while it is read.
+	replaying *spoolSegment
+}
+
+func newSpool(dir string, maxSizeMB int64, segmentSizeMB int64) (*spool, error) {
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultSpoolMaxSizeMB
+	}
+	if segmentSizeMB <= 0 {
+		segmentSizeMB = defaultSpoolSegmentSizeMB
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spool dir %s: %w", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spool dir %s: %w", dir, err)
+	}
+
+	s := &spool{
+		dir:         dir,
+		maxSize:     maxSizeMB * 1024 * 1024,
+		segmentSize: segmentSizeMB * 1024 * 1024,
+		segments:    make([]*spoolSegment, 0),
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, &spoolSegment{
+			id:   id,
+			path: filepath.Join(dir, name),
+			size: info.Size(),
+		})
+		s.size += info.Size()
+		if id >= s.nextId {
+			s.nextId = id + 1
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].id < s.segments[j].id
+	})
+	return s, nil
+}
+
+// append writes the rows of table into the spool and fsyncs the active segment.
+func (s *spool) append(tenantName string, table string, rows interface{}) error {
+	rowsJson, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&spoolRecord{Tenant: tenantName, Table: table, Rows: rowsJson})
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.active == nil || s.segments[len(s.segments)-1].size >= s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	segment := s.segments[len(s.segments)-1]
+
+	record := make([]byte, spoolHeaderSize+len(data))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+	copy(record[spoolHeaderSize:], data)
+	if _, err := s.active.Write(record); err != nil {
+		return err
+	}
+	if err := s.active.Sync(); err != nil {
+		return err
+	}
+	segment.size += int64(len(record))
+	s.size += int64(len(record))
+
+	s.enforceMaxSize()
+	return nil
+}
+
+// rotate seals the active segment and opens a new one.
+func (s *spool) rotate() error {
+	if err := s.closeActive(); err != nil {
+		return err
+	}
+	segment := &spoolSegment{
+		id:   s.nextId,
+		path: filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.nextId, spoolSegmentSuffix)),
+	}
+	file, err := os.OpenFile(segment.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("create spool segment: %w", err)
+	}
+	s.nextId++
+	s.active = file
+	s.segments = append(s.segments, segment)
+	return nil
+}
+
+func (s *spool) closeActive() error {
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+// enforceMaxSize drops the oldest sealed segments until the spool fits maxSize, the segment being replayed is kept.
+func (s *spool) enforceMaxSize() {
+	for s.size > s.maxSize {
+		index := 0
+		if len(s.segments) > 0 && s.segments[0] == s.replaying {
+			index = 1
+		}
+		if index >= len(s.segments)-1 {
+			return
+		}
+		oldest := s.segments[index]
+		s.segments = append(s.segments[:index], s.segments[index+1:]...)
+		s.size -= oldest.size
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+			log.Printf("[x Drop Spool Segment] %s, Error: %s", oldest.path, err.Error())
+		} else {
+			log.Printf("[x Drop Spool Segment] %s, Size: %d, spool exceeds max size %d", oldest.path, oldest.size, s.maxSize)
+		}
+	}
+}
+
+// oldest returns the oldest segment to replay, the active segment is sealed if it is the only one left.
+// The segment is kept until it is removed or released.
+func (s *spool) oldest() *spoolSegment {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.segments) == 0 {
+		return nil
+	}
+	if len(s.segments) == 1 && s.active != nil {
+		if s.segments[0].size == 0 {
+			return nil
+		}
+		if err := s.closeActive(); err != nil {
+			log.Printf("[x Seal Spool Segment] %s", err.Error())
+		}
+	}
+	s.replaying = s.segments[0]
+	return s.replaying
+}
+
+// release allows the segment not replayed to be dropped when the spool exceeds maxSize.
+func (s *spool) release(segment *spoolSegment) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.replaying == segment {
+		s.replaying = nil
+	}
+}
+
+// remove deletes a replayed segment.
+func (s *spool) remove(segment *spoolSegment) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.replaying == segment {
+		s.replaying = nil
+	}
+	for i, exist := range s.segments {
+		if exist == segment {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			s.size -= segment.size
+			break
+		}
+	}
+	if err := os.Remove(segment.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("[x Remove Spool Segment] %s, Error: %s", segment.path, err.Error())
+	}
+}
+
+// pendingSize returns the bytes stored in the spool.
+func (s *spool) pendingSize() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.size
+}
+
+func (s *spool) close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closeActive()
+}
+
+// readSegment reads all the records of segment.
+// A truncated tail, which may be left by a crash while writing, is ignored.
+// A corrupt record is skipped by resyncing to the next valid record, the records after it are still returned with errSpoolCorruptRecord.
+func readSegment(segment *spoolSegment) ([]*spoolRecord, error) {
+	data, err := os.ReadFile(segment.path)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*spoolRecord, 0)
+	skipped := 0
+	for offset := 0; offset+spoolHeaderSize <= len(data); {
+		record, size := parseRecord(data[offset:])
+		if record != nil {
+			records = append(records, record)
+			offset += size
+			continue
+		}
+		next := resyncRecord(data, offset+1)
+		if next < 0 {
+			if size > 0 {
+				skipped += len(data) - offset
+			}
+			break
+		}
+		skipped += next - offset
+		offset = next
+	}
+	if skipped > 0 {
+		return records, fmt.Errorf("%w, %d bytes skipped", errSpoolCorruptRecord, skipped)
+	}
+	return records, nil
+}
+
+// parseRecord returns the record at the start of data and its size, the size is 0 if the record exceeds data.
+func parseRecord(data []byte) (*spoolRecord, int) {
+	size := spoolHeaderSize + int(binary.BigEndian.Uint32(data[0:4]))
+	if size > len(data) {
+		return nil, 0
+	}
+	payload := data[spoolHeaderSize:size]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[4:8]) {
+		return nil, size
+	}
+	record := &spoolRecord{}
+	if err := json.Unmarshal(payload, record); err != nil {
+		return nil, size
+	}
+	return record, size
+}
+
+// resyncRecord returns the offset of the first valid record from start, -1 if there is none.
+func resyncRecord(data []byte, start int) int {
+	for offset := start; offset+spoolHeaderSize < len(data); offset++ {
+		// The records are json objects, the checksum is only checked before a '{'.
+		if data[offset+spoolHeaderSize] != '{' {
+			continue
+		}
+		if record, _ := parseRecord(data[offset:]); record != nil {
+			return offset
+		}
+	}
+	return -1
+}
@@ -0,0 +1,122 @@
+package clickhouse
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/clickhouse/tables"
+)
+
+func TestSpoolReplayAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newSpool(dir, 1, 1)
+	assert.NoError(t, err)
+	assert.NoError(t, s.append("", tables.TableFlameGraph, []string{"a", "b"}))
+	assert.NoError(t, s.append("t1", tables.TableJvmGc, []string{"c"}))
+	assert.NoError(t, s.close())
+
+	reopened, err := newSpool(dir, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, s.pendingSize(), reopened.pendingSize())
+
+	segment := reopened.oldest()
+	assert.NotNil(t, segment)
+	records, err := readSegment(segment)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, tables.TableFlameGraph, records[0].Table)
+	assert.Equal(t, "", records[0].Tenant)
+	assert.Equal(t, "t1", records[1].Tenant)
+
+	rows := make([]string, 0)
+	assert.NoError(t, json.Unmarshal(records[0].Rows, &rows))
+	assert.Equal(t, []string{"a", "b"}, rows)
+
+	reopened.remove(segment)
+	assert.Nil(t, reopened.oldest())
+	assert.Equal(t, int64(0), reopened.pendingSize())
+}
+
+func TestSpoolIgnoreTruncatedTail(t *testing.T) {
+	s, err := newSpool(t.TempDir(), 1, 1)
+	assert.NoError(t, err)
+	assert.NoError(t, s.append("", tables.TableOnOffMetric, []string{"a"}))
+	assert.NoError(t, s.append("", tables.TableOnOffMetric, []string{"b"}))
+	segment := s.oldest()
+
+	// Simulate a crash while writing the last record.
+	assert.NoError(t, os.Truncate(segment.path, segment.size-3))
+	records, err := readSegment(segment)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(records))
+}
+
+func TestSpoolSkipCorruptRecord(t *testing.T) {
+	s, err := newSpool(t.TempDir(), 1, 1)
+	assert.NoError(t, err)
+	for _, row := range []string{"a", "b", "c"} {
+		assert.NoError(t, s.append("", tables.TableOnOffMetric, []string{row}))
+	}
+	segment := s.oldest()
+	data, err := os.ReadFile(segment.path)
+	assert.NoError(t, err)
+	recordSize := len(data) / 3
+
+	// The length of the first record and the payload of the second record are corrupt.
+	corrupt := append([]byte{}, data...)
+	corrupt[0] = 0xff
+	corrupt[recordSize+spoolHeaderSize+2] ^= 0xff
+	assert.NoError(t, os.WriteFile(segment.path, corrupt, 0o644))
+	records, err := readSegment(segment)
+	assert.ErrorIs(t, err, errSpoolCorruptRecord)
+	if assert.Len(t, records, 1) {
+		rows := make([]string, 0)
+		assert.NoError(t, json.Unmarshal(records[0].Rows, &rows))
+		assert.Equal(t, []string{"c"}, rows)
+	}
+}
+
+func TestSpoolKeepReplayingSegment(t *testing.T) {
+	s, err := newSpool(t.TempDir(), 1, 1)
+	assert.NoError(t, err)
+	row := make([]byte, 1100*1024)
+	for i := range row {
+		row[i] = 'a'
+	}
+	assert.NoError(t, s.append("", tables.TableFlameGraph, []string{string(row)}))
+	replaying := s.oldest()
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, s.append("", tables.TableFlameGraph, []string{string(row)}))
+	}
+	// The second segment is dropped instead of the one being replayed.
+	if assert.Equal(t, 2, len(s.segments)) {
+		assert.Equal(t, replaying, s.segments[0])
+		assert.Equal(t, uint64(2), s.segments[1].id)
+	}
+	_, err = readSegment(replaying)
+	assert.NoError(t, err)
+
+	// The released segment is dropped.
+	s.release(replaying)
+	assert.NoError(t, s.append("", tables.TableFlameGraph, []string{string(row)}))
+	assert.Equal(t, 1, len(s.segments))
+	assert.Equal(t, uint64(3), s.segments[0].id)
+}
+
+func TestSpoolDropOldestSegments(t *testing.T) {
+	s, err := newSpool(t.TempDir(), 1, 1)
+	assert.NoError(t, err)
+	// Each record is larger than a segment, so every append rotates.
+	row := make([]byte, 1100*1024)
+	for i := range row {
+		row[i] = 'a'
+	}
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.append("", tables.TableFlameGraph, []string{string(row)}))
+	}
+	assert.Equal(t, 1, len(s.segments))
+	assert.Equal(t, uint64(2), s.segments[0].id)
+}
@@ -2,8 +2,6 @@ package tables
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
 
 	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
 )
@@ -42,19 +40,12 @@ const (
 	)`
 )
 
-func WriteErrorPropagations(ctx context.Context, conn *sql.DB, toSends []*report.ErrorReport) error {
+func WriteErrorPropagations(ctx context.Context, writer Writer, toSends []*report.ErrorReport) error {
 	if len(toSends) == 0 {
 		return nil
 	}
 
-	err := doWithTx(ctx, conn, func(tx *sql.Tx) error {
-		statement, err := tx.PrepareContext(ctx, insertErrorPropagationSQL)
-		if err != nil {
-			return fmt.Errorf("PrepareContext:%w", err)
-		}
-		defer func() {
-			_ = statement.Close()
-		}()
+	return writer.Write(ctx, insertErrorPropagationSQL, func(appendRow AppendRow) error {
 		for _, errorReport := range toSends {
 			if errorReport.IsDrop || errorReport.Data.RelationTree == nil {
 				continue
@@ -62,7 +53,7 @@ func WriteErrorPropagations(ctx context.Context, conn *sql.DB, toSends []*report
 
 			rootNode := errorReport.Data.RelationTree
 			errorPropagation := report.NewErrorPropagation(rootNode)
-			if _, err = statement.ExecContext(ctx,
+			if err := appendRow(
 				asTime(int64(errorReport.Timestamp)), // NanoTime
 				rootNode.ServiceName,
 				rootNode.Url,
@@ -78,10 +69,9 @@ func WriteErrorPropagations(ctx context.Context, conn *sql.DB, toSends []*report
 				errorPropagation.GetDepthList(),
 				errorPropagation.GetPathList()); err != nil {
 
-				return fmt.Errorf("ExecContext:%w", err)
+				return err
 			}
 		}
 		return nil
 	})
-	return err
 }
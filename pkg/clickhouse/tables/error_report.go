@@ -2,9 +2,7 @@ package tables
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
-	"fmt"
 
 	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
 )
@@ -42,19 +40,12 @@ const (
 	)`
 )
 
-func WriteErrorReports(ctx context.Context, conn *sql.DB, toSends []*report.ErrorReport) error {
+func WriteErrorReports(ctx context.Context, writer Writer, toSends []*report.ErrorReport) error {
 	if len(toSends) == 0 {
 		return nil
 	}
 
-	err := doWithTx(ctx, conn, func(tx *sql.Tx) error {
-		statement, err := tx.PrepareContext(ctx, insertErrorReportSQL)
-		if err != nil {
-			return fmt.Errorf("PrepareContext:%w", err)
-		}
-		defer func() {
-			_ = statement.Close()
-		}()
+	return writer.Write(ctx, insertErrorReportSQL, func(appendRow AppendRow) error {
 		for _, errorReport := range toSends {
 			relationTrees := ""
 			if errorReport.Data.RelationTree != nil {
@@ -75,7 +66,8 @@ func WriteErrorReports(ctx context.Context, conn *sql.DB, toSends []*report.Erro
 				"mutated_workload_type": errorReport.Data.MutatedWorkloadType,
 				"content_key":           errorReport.Data.ContentKey,
 			}
-			if _, err = statement.ExecContext(ctx,
+			errorReport.Identity.AppendLabels(labels)
+			if err := appendRow(
 				asTime(int64(errorReport.Timestamp)), // NanoTime
 				errorReport.IsDrop,
 				errorReport.TraceId,
@@ -91,10 +83,9 @@ func WriteErrorReports(ctx context.Context, conn *sql.DB, toSends []*report.Erro
 				errorReport.Data.ThresholdValue,
 				errorReport.Data.ThresholdMultiple); err != nil {
 
-				return fmt.Errorf("ExecContext:%w", err)
+				return err
 			}
 		}
 		return nil
 	})
-	return err
 }
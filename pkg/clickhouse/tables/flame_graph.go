@@ -2,9 +2,7 @@ package tables
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
-	"fmt"
 	"log"
 	"strconv"
 )
@@ -47,19 +45,12 @@ type FlameGraphEvent struct {
 	EndTime     uint64 `json:"end_time"`
 }
 
-func WriteFlameGraph(ctx context.Context, conn *sql.DB, toSends []string) error {
+func WriteFlameGraph(ctx context.Context, writer Writer, toSends []string) error {
 	if len(toSends) == 0 {
 		return nil
 	}
 
-	err := doWithTx(ctx, conn, func(tx *sql.Tx) error {
-		statement, err := tx.PrepareContext(ctx, insertFlameGraphSQL)
-		if err != nil {
-			return fmt.Errorf("PrepareContext:%w", err)
-		}
-		defer func() {
-			_ = statement.Close()
-		}()
+	return writer.Write(ctx, insertFlameGraphSQL, func(appendRow AppendRow) error {
 		for _, flameGraphJson := range toSends {
 			flameGraphEvent := &FlameGraphEvent{}
 			if err := json.Unmarshal([]byte(flameGraphJson), flameGraphEvent); err != nil {
@@ -78,7 +69,7 @@ func WriteFlameGraph(ctx context.Context, conn *sql.DB, toSends []string) error
 			if len(flameGraphEvent.SpanId) > 0 {
 				labels["span_id"] = flameGraphEvent.SpanId
 			}
-			if _, err = statement.ExecContext(ctx,
+			if err := appendRow(
 				asTime(int64(flameGraphEvent.StartTime)),
 				asTime(int64(flameGraphEvent.EndTime)),
 				flameGraphEvent.Pid,
@@ -88,10 +79,9 @@ func WriteFlameGraph(ctx context.Context, conn *sql.DB, toSends []string) error
 				labels,
 				flameGraphEvent.Flamebearer); err != nil {
 
-				return fmt.Errorf("ExecContext:%w", err)
+				return err
 			}
 		}
 		return nil
 	})
-	return err
 }
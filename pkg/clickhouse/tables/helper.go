@@ -4,9 +4,135 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 )
 
+const defaultNativeBatchSize = 10000
+
+// AppendRow adds one row, the values are in the order of the columns in the insert query.
+type AppendRow func(values ...interface{}) error
+
+// Writer writes rows of an insert query into ClickHouse.
+type Writer interface {
+	// Write writes all the rows appended by fn, nothing is written if an error is returned.
+	Write(ctx context.Context, query string, fn func(appendRow AppendRow) error) error
+	// BatchSize returns the max records of table passed to one Write, 0 means unlimited.
+	BatchSize(table string) int
+}
+
+// SqlWriter inserts rows one by one with a prepared statement in a database/sql transaction.
+type SqlWriter struct {
+	conn *sql.DB
+}
+
+func NewSqlWriter(conn *sql.DB) *SqlWriter {
+	return &SqlWriter{conn: conn}
+}
+
+func (writer *SqlWriter) Write(ctx context.Context, query string, fn func(appendRow AppendRow) error) error {
+	return doWithTx(ctx, writer.conn, func(tx *sql.Tx) error {
+		statement, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("PrepareContext:%w", err)
+		}
+		defer func() {
+			_ = statement.Close()
+		}()
+		return fn(func(values ...interface{}) error {
+			if _, err := statement.ExecContext(ctx, values...); err != nil {
+				return fmt.Errorf("ExecContext:%w", err)
+			}
+			return nil
+		})
+	})
+}
+
+// BatchSize is unlimited as the rows are committed in one transaction.
+func (writer *SqlWriter) BatchSize(table string) int {
+	return 0
+}
+
+// NativeWriter appends rows into a columnar block with the native protocol and sends it once,
+// the records are split per batch size by the caller so a failed send never leaves part of them written.
+type NativeWriter struct {
+	conn            driver.Conn
+	batchSize       int
+	tableBatchSizes map[string]int
+	settings        clickhouse.Settings
+}
+
+func NewNativeWriter(conn driver.Conn, batchSize int, tableBatchSizes map[string]int, asyncInsert bool, waitAsyncInsert bool) *NativeWriter {
+	if batchSize <= 0 {
+		batchSize = defaultNativeBatchSize
+	}
+	settings := clickhouse.Settings{}
+	if asyncInsert {
+		settings["async_insert"] = 1
+		if waitAsyncInsert {
+			settings["wait_for_async_insert"] = 1
+		} else {
+			settings["wait_for_async_insert"] = 0
+		}
+	}
+	return &NativeWriter{
+		conn:            conn,
+		batchSize:       batchSize,
+		tableBatchSizes: tableBatchSizes,
+		settings:        settings,
+	}
+}
+
+func (writer *NativeWriter) Write(ctx context.Context, query string, fn func(appendRow AppendRow) error) error {
+	// The native driver extracts the columns by a single-line regexp.
+	query = strings.Join(strings.Fields(query), " ")
+	if len(writer.settings) > 0 {
+		ctx = clickhouse.Context(ctx, clickhouse.WithSettings(writer.settings))
+	}
+
+	var (
+		batch driver.Batch
+		err   error
+	)
+	defer func() {
+		if batch != nil && !batch.IsSent() {
+			_ = batch.Abort()
+		}
+	}()
+	err = fn(func(values ...interface{}) error {
+		if batch == nil {
+			if batch, err = writer.conn.PrepareBatch(ctx, query); err != nil {
+				batch = nil
+				return fmt.Errorf("PrepareBatch:%w", err)
+			}
+		}
+		if err := batch.Append(values...); err != nil {
+			return fmt.Errorf("Append:%w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if batch != nil {
+		if err := batch.Send(); err != nil {
+			return fmt.Errorf("Send:%w", err)
+		}
+	}
+	return nil
+}
+
+// BatchSize returns the batch size of table if it is set, otherwise the default one.
+func (writer *NativeWriter) BatchSize(table string) int {
+	if batchSize, found := writer.tableBatchSizes[table]; found && batchSize > 0 {
+		return batchSize
+	}
+	return writer.batchSize
+}
+
 func doWithTx(_ context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
 	tx, err := db.Begin()
 	if err != nil {
@@ -0,0 +1,95 @@
+package tables
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeConn struct {
+	driver.Conn
+	batches []*fakeBatch
+	sendErr error
+}
+
+func (conn *fakeConn) PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
+	batch := &fakeBatch{sendErr: conn.sendErr}
+	conn.batches = append(conn.batches, batch)
+	return batch, nil
+}
+
+type fakeBatch struct {
+	driver.Batch
+	rows    [][]interface{}
+	sent    bool
+	aborted bool
+	sendErr error
+}
+
+func (batch *fakeBatch) Append(values ...interface{}) error {
+	batch.rows = append(batch.rows, values)
+	return nil
+}
+
+func (batch *fakeBatch) Send() error {
+	if batch.sendErr != nil {
+		return batch.sendErr
+	}
+	batch.sent = true
+	return nil
+}
+
+func (batch *fakeBatch) IsSent() bool {
+	return batch.sent
+}
+
+func (batch *fakeBatch) Abort() error {
+	batch.aborted = true
+	return nil
+}
+
+func TestNativeWriterSendOnce(t *testing.T) {
+	conn := &fakeConn{}
+	writer := NewNativeWriter(conn, 2, nil, false, false)
+	err := writer.Write(context.Background(), "INSERT INTO jvm_gc\n (a) VALUES (?)", func(appendRow AppendRow) error {
+		for i := 0; i < 5; i++ {
+			if err := appendRow(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	// The records are split by the caller, the rows of a Write are sent in one block.
+	if assert.Len(t, conn.batches, 1) {
+		assert.Len(t, conn.batches[0].rows, 5)
+		assert.True(t, conn.batches[0].sent)
+	}
+
+	conn = &fakeConn{sendErr: errors.New("timeout")}
+	writer = NewNativeWriter(conn, 2, nil, false, false)
+	err = writer.Write(context.Background(), insertJvmGcSQL, func(appendRow AppendRow) error {
+		return appendRow(1)
+	})
+	assert.ErrorContains(t, err, "timeout")
+	assert.True(t, conn.batches[0].aborted)
+
+	// Nothing is prepared without rows.
+	conn = &fakeConn{}
+	assert.NoError(t, NewNativeWriter(conn, 0, nil, false, false).Write(context.Background(), insertJvmGcSQL, func(appendRow AppendRow) error {
+		return nil
+	}))
+	assert.Empty(t, conn.batches)
+}
+
+func TestNativeWriterBatchSize(t *testing.T) {
+	writer := NewNativeWriter(&fakeConn{}, 0, map[string]int{TableSpanTrace: 20000, TableJvmGc: 0}, false, false)
+	assert.Equal(t, 20000, writer.BatchSize(TableSpanTrace))
+	assert.Equal(t, defaultNativeBatchSize, writer.BatchSize(TableJvmGc))
+	assert.Equal(t, defaultNativeBatchSize, writer.BatchSize(TableFlameGraph))
+
+	assert.Equal(t, 0, NewSqlWriter(nil).BatchSize(TableSpanTrace))
+}
@@ -2,9 +2,7 @@ package tables
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
-	"fmt"
 	"log"
 )
 
@@ -51,19 +49,12 @@ type JvmGcInfo struct {
 	Timestamp        uint64 `json:"timestamp"`
 }
 
-func WriteJvmGcs(ctx context.Context, conn *sql.DB, toSends []string) error {
+func WriteJvmGcs(ctx context.Context, writer Writer, toSends []string) error {
 	if len(toSends) == 0 {
 		return nil
 	}
 
-	err := doWithTx(ctx, conn, func(tx *sql.Tx) error {
-		statement, err := tx.PrepareContext(ctx, insertJvmGcSQL)
-		if err != nil {
-			return fmt.Errorf("PrepareContext:%w", err)
-		}
-		defer func() {
-			_ = statement.Close()
-		}()
+	return writer.Write(ctx, insertJvmGcSQL, func(appendRow AppendRow) error {
 		for _, jvmGcJson := range toSends {
 			jvmGc := &JvmGcInfo{}
 			if err := json.Unmarshal([]byte(jvmGcJson), jvmGc); err != nil {
@@ -74,7 +65,7 @@ func WriteJvmGcs(ctx context.Context, conn *sql.DB, toSends []string) error {
 				"node_name": jvmGc.NodeName,
 				"node_ip":   jvmGc.NodeIp,
 			}
-			_, err = statement.ExecContext(ctx,
+			err := appendRow(
 				asTime(int64(jvmGc.Timestamp)), // NanoTime
 				jvmGc.Pid,
 				labels,
@@ -88,10 +79,9 @@ func WriteJvmGcs(ctx context.Context, conn *sql.DB, toSends []string) error {
 				jvmGc.FgcSpan,
 			)
 			if err != nil {
-				return fmt.Errorf("ExecContext:%w", err)
+				return err
 			}
 		}
 		return nil
 	})
-	return err
 }
@@ -0,0 +1,19 @@
+package tables
+
+const (
+	TableProfilingEvent      = "profiling_event"
+	TableFlameGraph          = "flame_graph"
+	TableJvmGc               = "jvm_gc"
+	TableSpanTrace           = "span_trace"
+	TableSlowReport          = "slow_report"
+	TableErrorReport         = "error_report"
+	TableErrorPropagation    = "error_propagation"
+	TableReportMetric        = "report_metric"
+	TableOnOffMetric         = "onoff_metric"
+	TableServiceRelationship = "service_relationship"
+	TableServiceClient       = "service_client"
+	TableServiceDependency   = "service_dependency_1m"
+	TableDependencyChange    = "service_dependency_change"
+	// TableMqRelationship names the mq links written into service_relationship, so the spooled rows are replayed by their writer.
+	TableMqRelationship = "mq_relationship"
+)
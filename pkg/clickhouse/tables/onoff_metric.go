@@ -2,9 +2,7 @@ package tables
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
-	"fmt"
 	"log"
 )
 
@@ -38,25 +36,18 @@ type OnOffMetric struct {
 	Metrics     string `json:"metrics"`
 }
 
-func WriteOnOffMetrics(ctx context.Context, conn *sql.DB, toSends []string) error {
+func WriteOnOffMetrics(ctx context.Context, writer Writer, toSends []string) error {
 	if len(toSends) == 0 {
 		return nil
 	}
-	err := doWithTx(ctx, conn, func(tx *sql.Tx) error {
-		statement, err := tx.PrepareContext(ctx, insertOnoffMetricSQL)
-		if err != nil {
-			return fmt.Errorf("PrepareContext:%w", err)
-		}
-		defer func() {
-			_ = statement.Close()
-		}()
+	return writer.Write(ctx, insertOnoffMetricSQL, func(appendRow AppendRow) error {
 		for _, onoffJson := range toSends {
 			onOffMetric := &OnOffMetric{}
 			if err := json.Unmarshal([]byte(onoffJson), onOffMetric); err != nil {
 				log.Printf("[x Parse Onoff Metric] Error: %s", err.Error())
 				continue
 			}
-			_, err = statement.ExecContext(ctx,
+			err := appendRow(
 				asTime(int64(onOffMetric.Timestamp)), // NanoTime
 				onOffMetric.Pid,
 				onOffMetric.Tid,
@@ -66,10 +57,9 @@ func WriteOnOffMetrics(ctx context.Context, conn *sql.DB, toSends []string) erro
 				onOffMetric.Metrics,
 			)
 			if err != nil {
-				return fmt.Errorf("ExecContext:%w", err)
+				return err
 			}
 		}
 		return nil
 	})
-	return err
 }
@@ -2,9 +2,7 @@ package tables
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
-	"fmt"
 	"log"
 )
 
@@ -65,19 +63,12 @@ type CameraProfileEvent struct {
 	OffsetTs        int64  `json:"offset_ts"`
 }
 
-func WriteProfilingEvents(ctx context.Context, conn *sql.DB, toSends []string) error {
+func WriteProfilingEvents(ctx context.Context, writer Writer, toSends []string) error {
 	if len(toSends) == 0 {
 		return nil
 	}
 
-	err := doWithTx(ctx, conn, func(tx *sql.Tx) error {
-		statement, err := tx.PrepareContext(ctx, insertProfilingEventSQL)
-		if err != nil {
-			return fmt.Errorf("PrepareContext:%w", err)
-		}
-		defer func() {
-			_ = statement.Close()
-		}()
+	return writer.Write(ctx, insertProfilingEventSQL, func(appendRow AppendRow) error {
 		for _, eventGroupJson := range toSends {
 			eventGroup := &CameraEventGroup{}
 			if err := json.Unmarshal([]byte(eventGroupJson), eventGroup); err != nil {
@@ -91,7 +82,7 @@ func WriteProfilingEvents(ctx context.Context, conn *sql.DB, toSends []string) e
 				"protocol":     eventGroup.Labels.Protocol,
 				"threadName":   eventGroup.Labels.ThreadName,
 			}
-			_, err = statement.ExecContext(ctx,
+			err := appendRow(
 				asTime(int64(eventGroup.Timestamp)), // Second
 				eventGroup.DataVersion,
 				eventGroup.Labels.Pid,
@@ -107,10 +98,9 @@ func WriteProfilingEvents(ctx context.Context, conn *sql.DB, toSends []string) e
 				eventGroup.Labels.OffsetTs,
 			)
 			if err != nil {
-				return fmt.Errorf("ExecContext:%w", err)
+				return err
 			}
 		}
 		return nil
 	})
-	return err
 }
@@ -2,8 +2,6 @@ package tables
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
 
 	profile_model "github.com/CloudDetail/apo-receiver/pkg/componment/profile/model"
 )
@@ -28,21 +26,14 @@ const (
 	)`
 )
 
-func WriteReportMetrics(ctx context.Context, conn *sql.DB, toSends []*profile_model.SlowReportCountMetric) error {
+func WriteReportMetrics(ctx context.Context, writer Writer, toSends []*profile_model.SlowReportCountMetric) error {
 	if len(toSends) == 0 {
 		return nil
 	}
 
-	err := doWithTx(ctx, conn, func(tx *sql.Tx) error {
-		statement, err := tx.PrepareContext(ctx, insertReportMetricSQL)
-		if err != nil {
-			return fmt.Errorf("PrepareContext:%w", err)
-		}
-		defer func() {
-			_ = statement.Close()
-		}()
+	return writer.Write(ctx, insertReportMetricSQL, func(appendRow AppendRow) error {
 		for _, reportMetric := range toSends {
-			_, err = statement.ExecContext(ctx,
+			err := appendRow(
 				asTime(reportMetric.Timestamp), // NanoTime
 				reportMetric.EntryService,
 				reportMetric.EntryService,
@@ -52,10 +43,9 @@ func WriteReportMetrics(ctx context.Context, conn *sql.DB, toSends []*profile_mo
 				reportMetric.Success,
 			)
 			if err != nil {
-				return fmt.Errorf("ExecContext:%w", err)
+				return err
 			}
 		}
 		return nil
 	})
-	return err
 }
@@ -2,8 +2,6 @@ package tables
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
 	"strconv"
 	"strings"
 
@@ -47,19 +45,12 @@ const (
 	sourceAdapter = "adapter"
 )
 
-func WriteServiceClients(ctx context.Context, conn *sql.DB, toSends []*report.Relation) error {
+func WriteServiceClients(ctx context.Context, writer Writer, toSends []*report.Relation) error {
 	if len(toSends) == 0 {
 		return nil
 	}
 
-	err := doWithTx(ctx, conn, func(tx *sql.Tx) error {
-		statement, err := tx.PrepareContext(ctx, insertServiceClientSQL)
-		if err != nil {
-			return fmt.Errorf("PrepareContext:%w", err)
-		}
-		defer func() {
-			_ = statement.Close()
-		}()
+	return writer.Write(ctx, insertServiceClientSQL, func(appendRow AppendRow) error {
 		for _, toSend := range toSends {
 			timestamp := asTime(int64(toSend.RootNode.StartTime))
 			for _, externalNode := range toSend.CollectExternalNodes() {
@@ -72,7 +63,10 @@ func WriteServiceClients(ctx context.Context, conn *sql.DB, toSends []*report.Re
 						"client_peer":   external.Peer,
 						"client_detail": external.Detail,
 					}
-					_, err = statement.ExecContext(ctx,
+					if external.Fingerprint != "" {
+						labels["client_fingerprint"] = external.Fingerprint
+					}
+					err := appendRow(
 						timestamp,
 						toSend.RootNode.ServiceName,
 						toSend.RootNode.Url,
@@ -88,14 +82,13 @@ func WriteServiceClients(ctx context.Context, conn *sql.DB, toSends []*report.Re
 						labels,
 					)
 					if err != nil {
-						return fmt.Errorf("ExecContext:%w", err)
+						return err
 					}
 				}
 			}
 		}
 		return nil
 	})
-	return err
 }
 
 func WriteClientMetric(toSends []*report.Relation, meitricWithUrl bool) error {
@@ -124,6 +117,7 @@ func WriteClientMetric(toSends []*report.Relation, meitricWithUrl bool) error {
 						externalRecord.Peer,
 						strconv.FormatBool(externalRecord.Error),
 						sourceAdapter,
+						toSend.Tenant,
 					}, float64(externalRecord.Duration)); err != nil {
 						return err
 					}
@@ -139,8 +133,10 @@ func WriteClientMetric(toSends []*report.Relation, meitricWithUrl bool) error {
 						externalRecord.Type,
 						getDbName(externalRecord.Name),
 						externalRecord.Peer,
+						externalRecord.Fingerprint,
 						strconv.FormatBool(externalRecord.Error),
 						sourceAdapter,
+						toSend.Tenant,
 					}, float64(externalRecord.Duration)); err != nil {
 						return err
 					}
@@ -158,6 +154,7 @@ func WriteClientMetric(toSends []*report.Relation, meitricWithUrl bool) error {
 						externalRecord.Peer,
 						strconv.FormatBool(externalRecord.Error),
 						sourceAdapter,
+						toSend.Tenant,
 					}, float64(externalRecord.Duration)); err != nil {
 						return err
 					}
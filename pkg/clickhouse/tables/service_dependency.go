@@ -0,0 +1,76 @@
+package tables
+
+import (
+	"context"
+
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
+)
+
+const (
+	insertServiceDependencySQL = `INSERT INTO service_dependency_1m (
+		timestamp,
+		parent_service,
+		parent_url,
+		client_group,
+		client_type,
+		client_peer,
+		service,
+		url,
+		is_async,
+		calls,
+		errors,
+		duration_sum,
+		duration_min,
+		duration_max,
+		latency
+	) VALUES (
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?
+	)`
+)
+
+// WriteServiceDependencies writes the dependencies aggregated per minute, an edge may have several rows in a minute
+// when its traces are analyzed after the flush, so the rows are merged by sum / min / max / sumMap in the queries.
+func WriteServiceDependencies(ctx context.Context, writer Writer, toSends []*report.ServiceDependency) error {
+	if len(toSends) == 0 {
+		return nil
+	}
+	return writer.Write(ctx, insertServiceDependencySQL, func(appendRow AppendRow) error {
+		for _, dependency := range toSends {
+			err := appendRow(
+				asTime(int64(dependency.Timestamp)),
+				dependency.ParentService,
+				dependency.ParentUrl,
+				dependency.ClientGroup,
+				dependency.ClientType,
+				dependency.ClientPeer,
+				dependency.Service,
+				dependency.Url,
+				dependency.IsAsync,
+				dependency.Calls,
+				dependency.Errors,
+				dependency.DurationSum,
+				dependency.DurationMin,
+				dependency.DurationMax,
+				dependency.Latency,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
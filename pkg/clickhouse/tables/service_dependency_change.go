@@ -0,0 +1,143 @@
+package tables
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
+)
+
+const (
+	insertServiceDependencyChangeSQL = `INSERT INTO service_dependency_change (
+		timestamp,
+		service,
+		change,
+		parent_service,
+		client_group,
+		client_type,
+		client_peer,
+		destination,
+		child_service,
+		trace_id,
+		first_seen,
+		last_seen
+	) VALUES (
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?
+	)`
+
+	queryServiceDependencyChangeSQL = `SELECT
+		timestamp,
+		service,
+		change,
+		parent_service,
+		client_group,
+		client_type,
+		client_peer,
+		destination,
+		child_service,
+		trace_id,
+		first_seen,
+		last_seen
+	FROM service_dependency_change
+	WHERE %s
+	ORDER BY timestamp DESC
+	LIMIT ?`
+)
+
+func WriteServiceDependencyChanges(ctx context.Context, writer Writer, toSends []*report.DependencyChange) error {
+	if len(toSends) == 0 {
+		return nil
+	}
+	return writer.Write(ctx, insertServiceDependencyChangeSQL, func(appendRow AppendRow) error {
+		for _, change := range toSends {
+			err := appendRow(
+				asTime(int64(change.Timestamp)),
+				change.Service,
+				change.Change,
+				change.ParentService,
+				change.ClientGroup,
+				change.ClientType,
+				change.ClientPeer,
+				change.Destination,
+				change.ChildService,
+				change.TraceId,
+				asTime(int64(change.FirstSeen)),
+				asTime(int64(change.LastSeen)),
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DependencyChangeQuery filters the changes detected in [StartTime, EndTime], Service and Change are not filtered if empty.
+type DependencyChangeQuery struct {
+	StartTime time.Time
+	EndTime   time.Time
+	Service   string
+	Change    string
+	Limit     int
+}
+
+// QueryDependencyChanges returns the latest changes first.
+func QueryDependencyChanges(ctx context.Context, conn *sql.DB, query *DependencyChangeQuery) ([]*report.DependencyChange, error) {
+	conditions := []string{"timestamp >= ?", "timestamp <= ?"}
+	args := []interface{}{query.StartTime, query.EndTime}
+	if query.Service != "" {
+		conditions = append(conditions, "service = ?")
+		args = append(args, query.Service)
+	}
+	if query.Change != "" {
+		conditions = append(conditions, "change = ?")
+		args = append(args, query.Change)
+	}
+	args = append(args, query.Limit)
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf(queryServiceDependencyChangeSQL, strings.Join(conditions, " AND ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make([]*report.DependencyChange, 0)
+	for rows.Next() {
+		var timestamp, firstSeen, lastSeen time.Time
+		change := &report.DependencyChange{}
+		if err = rows.Scan(
+			&timestamp,
+			&change.Service,
+			&change.Change,
+			&change.ParentService,
+			&change.ClientGroup,
+			&change.ClientType,
+			&change.ClientPeer,
+			&change.Destination,
+			&change.ChildService,
+			&change.TraceId,
+			&firstSeen,
+			&lastSeen); err != nil {
+			return nil, err
+		}
+		change.Timestamp = uint64(timestamp.UnixNano())
+		change.FirstSeen = uint64(firstSeen.UnixNano())
+		change.LastSeen = uint64(lastSeen.UnixNano())
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
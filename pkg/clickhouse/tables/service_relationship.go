@@ -2,9 +2,9 @@ package tables
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
+	"strconv"
 
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/external"
 	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
 )
 
@@ -38,18 +38,11 @@ const (
 	)`
 )
 
-func WriteServiceRelationships(ctx context.Context, conn *sql.DB, toSends []*report.Relation) error {
+func WriteServiceRelationships(ctx context.Context, writer Writer, toSends []*report.Relation) error {
 	if len(toSends) == 0 {
 		return nil
 	}
-	err := doWithTx(ctx, conn, func(tx *sql.Tx) error {
-		statement, err := tx.PrepareContext(ctx, insertServiceRelationShipSQL)
-		if err != nil {
-			return fmt.Errorf("PrepareContext:%w", err)
-		}
-		defer func() {
-			_ = statement.Close()
-		}()
+	return writer.Write(ctx, insertServiceRelationShipSQL, func(appendRow AppendRow) error {
 		for _, toSend := range toSends {
 			toSend.CollectRelationships()
 			timestamp := asTime(int64(toSend.RootNode.StartTime))
@@ -66,7 +59,7 @@ func WriteServiceRelationships(ctx context.Context, conn *sql.DB, toSends []*rep
 					"is_traced":     relationship.IsTraced,
 				}
 
-				_, err = statement.ExecContext(ctx,
+				err := appendRow(
 					timestamp,
 					toSend.RootNode.ServiceName,
 					toSend.RootNode.Url,
@@ -80,13 +73,61 @@ func WriteServiceRelationships(ctx context.Context, conn *sql.DB, toSends []*rep
 					labels,
 					flags,
 				)
+				if err != nil {
+					return err
+				}
 			}
+		}
+
+		return nil
+	})
+}
+
+// WriteMqRelationships writes the producer -> consumer relationships of the messages in different traces,
+// the rows are in the trace of the consumer and queue_latency is only labeled when the producer is matched by link or message id.
+func WriteMqRelationships(ctx context.Context, writer Writer, toSends []*report.MqLink) error {
+	if len(toSends) == 0 {
+		return nil
+	}
+	return writer.Write(ctx, insertServiceRelationShipSQL, func(appendRow AppendRow) error {
+		for _, link := range toSends {
+			labels := map[string]string{
+				"client_group": external.GroupMq,
+				"client_type":  link.System,
+				"client_peer":  link.Peer,
+				"client_key":   link.Destination,
+				"mq_match":     link.Match,
+			}
+			if link.ProducerTraceId != "" {
+				labels["producer_trace_id"] = link.ProducerTraceId
+			}
+			if link.Match != report.MqMatchDestination {
+				labels["queue_latency"] = strconv.FormatUint(link.QueueLatency, 10)
+			}
+			flags := map[string]bool{
+				"parent_traced": link.ProducerTraced,
+				"is_async":      true,
+				"is_traced":     link.ConsumerTraced,
+			}
+
+			err := appendRow(
+				asTime(int64(link.Timestamp)),
+				link.EntryService,
+				link.EntryUrl,
+				link.MissTop,
+				link.TraceId,
+				link.ProducerService,
+				link.ProducerUrl,
+				link.ConsumerService,
+				link.ConsumerUrl,
+				link.Path(),
+				labels,
+				flags,
+			)
 			if err != nil {
-				return fmt.Errorf("ExecContext:%w", err)
+				return err
 			}
 		}
-
 		return nil
 	})
-	return err
 }
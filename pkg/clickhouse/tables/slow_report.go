@@ -2,9 +2,7 @@ package tables
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
-	"fmt"
 
 	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
 )
@@ -43,19 +41,12 @@ const (
 	)`
 )
 
-func WriteSlowReports(ctx context.Context, conn *sql.DB, toSends []*report.NodeReport) error {
+func WriteSlowReports(ctx context.Context, writer Writer, toSends []*report.NodeReport) error {
 	if len(toSends) == 0 {
 		return nil
 	}
 
-	err := doWithTx(ctx, conn, func(tx *sql.Tx) error {
-		statement, err := tx.PrepareContext(ctx, insertSlowReportSQL)
-		if err != nil {
-			return fmt.Errorf("PrepareContext:%w", err)
-		}
-		defer func() {
-			_ = statement.Close()
-		}()
+	return writer.Write(ctx, insertSlowReportSQL, func(appendRow AppendRow) error {
 		for _, nodeReport := range toSends {
 			relationTrees := ""
 			if nodeReport.Data.RelationTree != nil {
@@ -81,7 +72,8 @@ func WriteSlowReports(ctx context.Context, conn *sql.DB, toSends []*report.NodeR
 				"mutated_workload_type": nodeReport.Data.MutatedWorkloadType,
 				"content_key":           nodeReport.Data.ContentKey,
 			}
-			_, err = statement.ExecContext(ctx,
+			nodeReport.Identity.AppendLabels(labels)
+			err := appendRow(
 				asTime(int64(nodeReport.Timestamp)), // NanoTime
 				nodeReport.IsDrop,
 				nodeReport.TraceId,
@@ -98,10 +90,9 @@ func WriteSlowReports(ctx context.Context, conn *sql.DB, toSends []*report.NodeR
 				nodeReport.Data.ThresholdMultiple,
 			)
 			if err != nil {
-				return fmt.Errorf("ExecContext:%w", err)
+				return err
 			}
 		}
 		return nil
 	})
-	return err
 }
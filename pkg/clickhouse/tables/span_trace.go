@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/CloudDetail/apo-module/model/v1"
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
 )
 
 const (
@@ -64,19 +65,12 @@ var cpuTypes = []string{
 	"runq",
 }
 
-func WriteSpanTraces(ctx context.Context, conn *sql.DB, toSends []*model.Trace) error {
+func WriteSpanTraces(ctx context.Context, writer Writer, toSends []*report.SpanTrace) error {
 	if len(toSends) == 0 {
 		return nil
 	}
 
-	err := doWithTx(ctx, conn, func(tx *sql.Tx) error {
-		statement, err := tx.PrepareContext(ctx, insertSpanTraceSQL)
-		if err != nil {
-			return fmt.Errorf("PrepareContext:%w", err)
-		}
-		defer func() {
-			_ = statement.Close()
-		}()
+	return writer.Write(ctx, insertSpanTraceSQL, func(appendRow AppendRow) error {
 		for _, trace := range toSends {
 			traceLabel := trace.Labels
 			flags := map[string]bool{
@@ -113,7 +107,8 @@ func WriteSpanTraces(ctx context.Context, conn *sql.DB, toSends []*model.Trace)
 				"data_source":        trace.Source,
 				"mutated_type":       trace.MutatedType,
 			}
-			_, err = statement.ExecContext(ctx,
+			trace.Identity.AppendLabels(labels)
+			err := appendRow(
 				asTime(int64(trace.Timestamp)), // NanoTime
 				trace.Version,
 				traceLabel.Pid,
@@ -134,12 +129,11 @@ func WriteSpanTraces(ctx context.Context, conn *sql.DB, toSends []*model.Trace)
 				traceLabel.OffsetTs,
 			)
 			if err != nil {
-				return fmt.Errorf("ExecContext:%w", err)
+				return err
 			}
 		}
 		return nil
 	})
-	return err
 }
 
 func QueryTraces(ctx context.Context, conn *sql.DB, traceId string) (*model.Traces, error) {
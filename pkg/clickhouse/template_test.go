@@ -2,25 +2,137 @@ package clickhouse
 
 import (
 	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
-	"text/template"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
 )
 
-func TestTemplate(t *testing.T) {
-	args := distributedTableArgs{
-		Cluster:  "apocluster",
-		Database: "apo",
+func TestMigrationTemplate(t *testing.T) {
+	migrations, err := loadMigrations("../../sqlscript/migrations")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+
+	tests := []struct {
+		name string
+		args migrationArgs
+	}{
+		{name: "single", args: migrationArgs{Database: "apo"}},
+		{name: "cluster", args: migrationArgs{Cluster: "apocluster", Database: "apo", Replication: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, m := range migrations {
+				statements, err := m.render(tt.args)
+				assert.NoError(t, err, m.name)
+				assert.NotEmpty(t, statements, m.name)
+				for _, statement := range statements {
+					assert.False(t, strings.HasPrefix(statement, "--"), statement)
+					if tt.args.Cluster == "" {
+						assert.NotContains(t, statement, "_local", statement)
+						assert.NotContains(t, statement, "ON CLUSTER", statement)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"0002_b.tmpl.sql", "0001_a.tmpl.sql", "README.md"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1"), 0o644))
+	}
+	migrations, err := loadMigrations(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(migrations))
+	assert.Equal(t, "0001_a", migrations[0].name)
+	assert.Equal(t, uint32(2), migrations[1].version)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "2_c.tmpl.sql"), []byte("SELECT 1"), 0o644))
+	_, err = loadMigrations(dir)
+	assert.Error(t, err)
+}
+
+func TestPendingMigrations(t *testing.T) {
+	migrations := []*migration{
+		{version: 1, name: "0001_a"},
+		{version: 2, name: "0002_b"},
 	}
-	migrateTemplate, err := template.ParseFiles("../../sqlscript/migrate.tmpl.sql")
-	if err != nil {
-		t.Failed()
-		return
+	tests := []struct {
+		name    string
+		applied map[uint32]bool
+		pending int
+		ahead   bool
+	}{
+		{name: "fresh", applied: map[uint32]bool{}, pending: 2},
+		{name: "partial", applied: map[uint32]bool{1: true}, pending: 1},
+		{name: "latest", applied: map[uint32]bool{1: true, 2: true}, pending: 0},
+		{name: "ahead", applied: map[uint32]bool{1: true, 2: true, 3: true}, ahead: true},
 	}
-	var rendered bytes.Buffer
-	if err := migrateTemplate.Execute(&rendered, args); err != nil {
-		t.Failed()
-		return
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending, err := pendingMigrations(migrations, tt.applied)
+			if tt.ahead {
+				assert.True(t, errors.Is(err, errSchemaAhead))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.pending, len(pending))
+		})
+	}
+}
+
+func TestMigrationTableTemplate(t *testing.T) {
+	for _, tableTemplate := range []string{templateCreateMigrationTable, templateCreateMigrationLockTable} {
+		single, err := renderMigrationTemplate(tableTemplate, migrationArgs{Database: "apo"})
+		assert.NoError(t, err)
+		assert.NotContains(t, single, "Replicated")
+		assert.NotContains(t, single, "ON CLUSTER")
+
+		// The replicated tables are shared by the shards of the cluster.
+		cluster, err := renderMigrationTemplate(tableTemplate, migrationArgs{Cluster: "apocluster", Database: "apo", Replication: true})
+		assert.NoError(t, err)
+		assert.Contains(t, cluster, "ON CLUSTER apocluster")
+		assert.Contains(t, cluster, "('/clickhouse/tables/apocluster/apo/schema_migrations")
+		assert.Contains(t, cluster, "'{shard}-{replica}'")
+
+		replicated, err := renderMigrationTemplate(tableTemplate, migrationArgs{Database: "apo", Replication: true})
+		assert.NoError(t, err)
+		assert.Contains(t, replicated, "('/clickhouse/tables/apo/schema_migrations")
+	}
+}
+
+func TestPrintMigrateSql(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	// The sql scripts are read from the working directory.
+	assert.NoError(t, os.Chdir("../.."))
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	var single bytes.Buffer
+	assert.NoError(t, PrintMigrateSql(&config.ClickHouseConfig{Endpoint: "localhost:9000", Database: "apo"}, &single))
+	assert.Contains(t, single.String(), "CREATE DATABASE IF NOT EXISTS apo;")
+	assert.Contains(t, single.String(), "CREATE TABLE IF NOT EXISTS schema_migrations\n")
+	assert.Contains(t, single.String(), "CREATE TABLE IF NOT EXISTS schema_migrations_lock\n")
+	assert.Contains(t, single.String(), "-- migration 0001_alert_event_1_3_0")
+	assert.NotContains(t, single.String(), "ON CLUSTER")
+	assert.NotContains(t, single.String(), "Distributed(")
+
+	var cluster bytes.Buffer
+	assert.NoError(t, PrintMigrateSql(&config.ClickHouseConfig{Endpoint: "localhost:9000", Database: "apo", Cluster: "apocluster", Replication: true}, &cluster))
+	assert.Contains(t, cluster.String(), "CREATE DATABASE IF NOT EXISTS apo ON CLUSTER apocluster;")
+	assert.Contains(t, cluster.String(), "Distributed(apocluster, apo, ")
+	assert.Contains(t, cluster.String(), "'/clickhouse/tables/apocluster/apo/schema_migrations_lock'")
+	// Each statement ends with ';'.
+	for _, statement := range strings.Split(cluster.String(), ";\n") {
+		assert.NotContains(t, statement, ";", statement)
 	}
-	sqlStatement := rendered.String()
-	t.Logf("%s", sqlStatement)
 }
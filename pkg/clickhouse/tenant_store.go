@@ -0,0 +1,130 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/CloudDetail/apo-receiver/pkg/clickhouse/tables"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
+)
+
+// ErrUnknownTenant is returned when the database of the queried tenant does not exist.
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// tenantStore caches and writes the data of one tenant.
+// The default tenant is written into the configured database, the others are written into their own databases
+// when database_per_tenant is enabled.
+type tenantStore struct {
+	tenant string
+	cache  *cache
+
+	// lock guards the lazy connection of the tenant database.
+	lock   sync.Mutex
+	init   *ClickHouseInit
+	conn   *sql.DB
+	writer tables.Writer
+}
+
+func newTenantStore(tenantName string) *tenantStore {
+	return &tenantStore{
+		tenant: tenantName,
+		cache:  newCache(),
+	}
+}
+
+// getStore returns the store of tenantName, the default store is returned if the tenants share the database.
+func (client *ClickHouseClient) getStore(tenantName string) *tenantStore {
+	if tenantName == "" || !client.cfg.DatabasePerTenant {
+		return client.defaultStore
+	}
+	if store, found := client.tenantStores.Load(tenantName); found {
+		return store.(*tenantStore)
+	}
+	store, _ := client.tenantStores.LoadOrStore(tenantName, newTenantStore(tenantName))
+	return store.(*tenantStore)
+}
+
+// rangeStores calls f with the default store and the stores of the tenants.
+func (client *ClickHouseClient) rangeStores(f func(store *tenantStore)) {
+	f(client.defaultStore)
+	client.tenantStores.Range(func(_, v interface{}) bool {
+		f(v.(*tenantStore))
+		return true
+	})
+}
+
+// connect creates the database and tables of the tenant on first use, it is retried on the next write if failed.
+func (store *tenantStore) connect(cfg *config.ClickHouseConfig) (*sql.DB, tables.Writer, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.writer != nil {
+		return store.conn, store.writer, nil
+	}
+
+	database := tenant.Database(cfg.Database, store.tenant)
+	init, writer, err := connect(cfg, database)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("[Connect Tenant Database] Tenant: %s, Database: %s", store.tenant, database)
+	store.init = init
+	store.conn = init.GetConn()
+	store.writer = writer
+	return store.conn, store.writer, nil
+}
+
+// queryConn returns the connection to read the data of tenantName.
+// The database is never created for the queries, ErrUnknownTenant is returned if it does not exist.
+func (client *ClickHouseClient) queryConn(ctx context.Context, tenantName string) (*sql.DB, error) {
+	if tenantName == "" || !client.cfg.DatabasePerTenant {
+		return client.defaultStore.conn, nil
+	}
+	if store, found := client.tenantStores.Load(tenantName); found {
+		if conn := store.(*tenantStore).getConn(); conn != nil {
+			return conn, nil
+		}
+	}
+	if conn, found := client.queryConns.Load(tenantName); found {
+		return conn.(*sql.DB), nil
+	}
+
+	database := tenant.Database(client.cfg.Database, tenantName)
+	var count uint64
+	if err := client.Conn.QueryRowContext(ctx, "SELECT count() FROM system.databases WHERE name = ?", database).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrUnknownTenant
+	}
+	init, err := newClickHouseInitFromConfig(client.cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := buildDB(init.endpoint, database, init.userName, init.password, init.tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	if existing, loaded := client.queryConns.LoadOrStore(tenantName, conn); loaded {
+		_ = conn.Close()
+		return existing.(*sql.DB), nil
+	}
+	return conn, nil
+}
+
+func (store *tenantStore) getConn() *sql.DB {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.conn
+}
+
+func (store *tenantStore) close() {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.init != nil {
+		store.init.Close()
+	}
+}
@@ -0,0 +1,126 @@
+package otlp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+
+	apmmodel "github.com/CloudDetail/apo-module/apm/model/v1"
+
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/external"
+)
+
+const (
+	attributeServiceName = "service.name"
+	exceptionEventName   = "exception"
+)
+
+// convertResourceSpans groups the spans by trace id.
+func convertResourceSpans(resourceSpans []*tracepb.ResourceSpans) map[string][]*apmmodel.OtelSpan {
+	traces := make(map[string][]*apmmodel.OtelSpan)
+	for _, resourceSpan := range resourceSpans {
+		serviceName := ""
+		for _, attribute := range resourceSpan.GetResource().GetAttributes() {
+			if attribute.Key == attributeServiceName {
+				serviceName = anyValueString(attribute.Value)
+			}
+		}
+		for _, scopeSpan := range resourceSpan.GetScopeSpans() {
+			for _, span := range scopeSpan.GetSpans() {
+				if len(span.TraceId) == 0 || len(span.SpanId) == 0 {
+					continue
+				}
+				traceId := hex.EncodeToString(span.TraceId)
+				traces[traceId] = append(traces[traceId], convertSpan(serviceName, span))
+			}
+		}
+	}
+	return traces
+}
+
+// convertSpan converts the span to the structure returned by the APM trace backend, the ids are in lower hex.
+func convertSpan(serviceName string, span *tracepb.Span) *apmmodel.OtelSpan {
+	otelSpan := apmmodel.NewOtelSpan()
+	otelSpan.SetServiceName(serviceName)
+	otelSpan.SetName(span.Name)
+	otelSpan.SetSpanId(hex.EncodeToString(span.SpanId))
+	otelSpan.SetParentSpanId(hex.EncodeToString(span.ParentSpanId))
+	otelSpan.SetStartTime(span.StartTimeUnixNano)
+	if span.EndTimeUnixNano > span.StartTimeUnixNano {
+		otelSpan.SetDuration(span.EndTimeUnixNano - span.StartTimeUnixNano)
+	}
+	// The values of the kinds and the status codes are the same with OTLP.
+	otelSpan.SetKind(apmmodel.OtelSpanKind(span.Kind))
+	otelSpan.SetCode(apmmodel.OtelStatusCode(span.GetStatus().GetCode()))
+	for _, attribute := range span.Attributes {
+		otelSpan.AddAttribute(attribute.Key, anyValueString(attribute.Value))
+	}
+	if len(span.Links) > 0 {
+		// The model has no links, they are kept in the attribute to correlate the mq consumers with the producers.
+		links := make([]string, 0, len(span.Links))
+		for _, link := range span.Links {
+			links = append(links, hex.EncodeToString(link.TraceId)+":"+hex.EncodeToString(link.SpanId))
+		}
+		otelSpan.AddAttribute(external.AttributeSpanLinks, strings.Join(links, ","))
+	}
+	for _, event := range span.Events {
+		if event.Name != exceptionEventName {
+			continue
+		}
+		var exceptionType, message, stack string
+		for _, attribute := range event.Attributes {
+			switch attribute.Key {
+			case apmmodel.AttributeExceptionType:
+				exceptionType = anyValueString(attribute.Value)
+			case apmmodel.AttributeExceptionMessage:
+				message = anyValueString(attribute.Value)
+			case apmmodel.AttributeExceptionStacktrace:
+				stack = anyValueString(attribute.Value)
+			}
+		}
+		otelSpan.AddException(event.TimeUnixNano, exceptionType, message, stack)
+	}
+	return otelSpan
+}
+
+// anyValueString converts the attribute value to string, the arrays and maps are converted to json.
+func anyValueString(value *commonpb.AnyValue) string {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'f', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return hex.EncodeToString(v.BytesValue)
+	case *commonpb.AnyValue_ArrayValue, *commonpb.AnyValue_KvlistValue:
+		data, _ := json.Marshal(anyValueInterface(value))
+		return string(data)
+	}
+	return ""
+}
+
+func anyValueInterface(value *commonpb.AnyValue) interface{} {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]interface{}, 0, len(v.ArrayValue.GetValues()))
+		for _, item := range v.ArrayValue.GetValues() {
+			values = append(values, anyValueInterface(item))
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		values := make(map[string]interface{}, len(v.KvlistValue.GetValues()))
+		for _, item := range v.KvlistValue.GetValues() {
+			values[item.Key] = anyValueInterface(item.Value)
+		}
+		return values
+	}
+	return anyValueString(value)
+}
@@ -0,0 +1,219 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	"github.com/prometheus/client_golang/prometheus"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	"github.com/CloudDetail/apo-receiver/pkg/componment/spanstore"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
+)
+
+const (
+	// SpanDataGroup is the data group of the spans in the tenant quotas.
+	SpanDataGroup = "otlp_span"
+
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJson     = "application/json"
+
+	defaultMaxRequestSizeMB = 20
+	// quotaRetryDelay is the retry hint when the quota of the tenant is exceeded, the quotas are refilled per second.
+	quotaRetryDelay = time.Second
+)
+
+var errRequestTooLarge = errors.New("request is too large")
+
+var (
+	ReceiveSpanTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_otlp_spans_total",
+			Help: "The total number of spans received by OTLP, protocol is grpc or http",
+		},
+		[]string{"protocol"},
+	)
+	RejectSpanTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_otlp_rejected_spans_total",
+			Help: "The total number of spans received by OTLP but not kept as the span store is full, they are reported by partial_success",
+		},
+		[]string{"protocol"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(ReceiveSpanTotal, RejectSpanTotal)
+}
+
+// Receiver receives the traces in OTLP and keeps the spans in the span store for the analyzer.
+type Receiver struct {
+	coltracepb.UnimplementedTraceServiceServer
+	store          *spanstore.Store
+	authenticator  *auth.Authenticator
+	quotas         *tenant.Quotas
+	maxRequestSize int64
+}
+
+// NewReceiver returns nil if OTLP is not enabled.
+func NewReceiver(cfg *config.OtlpConfig, store *spanstore.Store, authenticator *auth.Authenticator, quotas *tenant.Quotas) *Receiver {
+	if !cfg.Enable {
+		return nil
+	}
+	maxRequestSizeMB := cfg.MaxRequestSizeMB
+	if maxRequestSizeMB <= 0 {
+		maxRequestSizeMB = defaultMaxRequestSizeMB
+	}
+	return &Receiver{
+		store:          store,
+		authenticator:  authenticator,
+		quotas:         quotas,
+		maxRequestSize: maxRequestSizeMB * 1024 * 1024,
+	}
+}
+
+// Export is the OTLP/gRPC API, the agents are authenticated by the interceptors of the gRPC server.
+func (receiver *Receiver) Export(ctx context.Context, request *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	return receiver.export(auth.FromContext(ctx).GetTenant(), request, "grpc")
+}
+
+// export keeps the spans of request, the spans dropped by the span store are returned as the partial success.
+func (receiver *Receiver) export(tenantName string, request *coltracepb.ExportTraceServiceRequest, protocol string) (*coltracepb.ExportTraceServiceResponse, error) {
+	traces := convertResourceSpans(request.GetResourceSpans())
+	count := 0
+	for _, spans := range traces {
+		count += len(spans)
+	}
+	if !receiver.quotas.Allow(tenantName, SpanDataGroup, count) {
+		st := status.Newf(codes.ResourceExhausted, "quota of tenant %q is exceeded", tenantName)
+		if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(quotaRetryDelay)}); err == nil {
+			st = detailed
+		}
+		return nil, st.Err()
+	}
+	rejected := 0
+	for traceId, spans := range traces {
+		rejected += receiver.store.AddSpans(tenantName, traceId, spans)
+	}
+	ReceiveSpanTotal.WithLabelValues(protocol).Add(float64(count))
+	response := &coltracepb.ExportTraceServiceResponse{}
+	if rejected > 0 {
+		RejectSpanTotal.WithLabelValues(protocol).Add(float64(rejected))
+		response.PartialSuccess = &coltracepb.ExportTracePartialSuccess{
+			RejectedSpans: int64(rejected),
+			ErrorMessage:  "span store of the receiver is full",
+		}
+	}
+	return response, nil
+}
+
+// HandleHttp is the OTLP/HTTP API of /v1/traces, the request is encoded in protobuf or json and may be gzipped.
+func (receiver *Receiver) HandleHttp(ctx iris.Context) {
+	contentType := contentTypeProtobuf
+	if ctx.GetContentTypeRequested() == contentTypeJson {
+		contentType = contentTypeJson
+	}
+
+	tenantName := ""
+	if receiver.authenticator != nil {
+		identity, err := receiver.authenticator.AuthenticateHttp(ctx.Request().Context(), ctx.Request().Header)
+		if err != nil {
+			writeHttpError(ctx, contentType, http.StatusUnauthorized, err)
+			return
+		}
+		tenantName = identity.GetTenant()
+	}
+
+	body, err := readBody(ctx, receiver.maxRequestSize)
+	if errors.Is(err, errRequestTooLarge) {
+		writeHttpError(ctx, contentType, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	if err != nil {
+		writeHttpError(ctx, contentType, http.StatusBadRequest, err)
+		return
+	}
+	request := &coltracepb.ExportTraceServiceRequest{}
+	if contentType == contentTypeJson {
+		err = protojson.Unmarshal(body, request)
+	} else {
+		err = proto.Unmarshal(body, request)
+	}
+	if err != nil {
+		writeHttpError(ctx, contentType, http.StatusBadRequest, err)
+		return
+	}
+
+	response, err := receiver.export(tenantName, request, "http")
+	if err != nil {
+		ctx.Header("Retry-After", strconv.Itoa(int(quotaRetryDelay.Seconds())))
+		writeHttpError(ctx, contentType, http.StatusTooManyRequests, err)
+		return
+	}
+	writeHttpMessage(ctx, contentType, http.StatusOK, response)
+}
+
+// readBody reads the body decompressed, errRequestTooLarge is returned if it is larger than maxSize before or after the decompression.
+func readBody(ctx iris.Context, maxSize int64) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.ResponseWriter(), ctx.Request().Body, maxSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, fmt.Errorf("%w, max %d bytes", errRequestTooLarge, maxSize)
+		}
+		return nil, err
+	}
+	if ctx.GetHeader("Content-Encoding") != "gzip" {
+		return body, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	decompressed, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decompressed)) > maxSize {
+		return nil, fmt.Errorf("%w, max %d bytes decompressed", errRequestTooLarge, maxSize)
+	}
+	return decompressed, nil
+}
+
+// writeHttpError responds the google.rpc.Status as the OTLP/HTTP specification.
+func writeHttpError(ctx iris.Context, contentType string, statusCode int, err error) {
+	log.Printf("[x Receive OTLP] Status: %d, Error: %s", statusCode, err.Error())
+	st, _ := status.FromError(err)
+	writeHttpMessage(ctx, contentType, statusCode, &spb.Status{Code: int32(st.Code()), Message: st.Message()})
+}
+
+func writeHttpMessage(ctx iris.Context, contentType string, statusCode int, message proto.Message) {
+	var data []byte
+	if contentType == contentTypeJson {
+		data, _ = protojson.Marshal(message)
+	} else {
+		data, _ = proto.Marshal(message)
+	}
+	ctx.ContentType(contentType)
+	ctx.StatusCode(statusCode)
+	_, _ = ctx.Write(data)
+}
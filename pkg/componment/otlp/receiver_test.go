@@ -0,0 +1,232 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/external"
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	"github.com/CloudDetail/apo-receiver/pkg/componment/spanstore"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
+
+	apmmodel "github.com/CloudDetail/apo-module/apm/model/v1"
+)
+
+var traceId = []byte{0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c}
+
+func stringAttribute(key string, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func newResourceSpans(serviceName string, spans ...*tracepb.Span) *tracepb.ResourceSpans {
+	return &tracepb.ResourceSpans{
+		Resource:   &resourcepb.Resource{Attributes: []*commonpb.KeyValue{stringAttribute(attributeServiceName, serviceName)}},
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: spans}},
+	}
+}
+
+func newExportRequest() *coltracepb.ExportTraceServiceRequest {
+	return &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{
+			newResourceSpans("order",
+				&tracepb.Span{
+					TraceId: traceId, SpanId: []byte{1}, Name: "POST /order", Kind: tracepb.Span_SPAN_KIND_SERVER,
+					StartTimeUnixNano: 1000, EndTimeUnixNano: 5000,
+					Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR},
+				},
+				&tracepb.Span{
+					TraceId: traceId, SpanId: []byte{2}, ParentSpanId: []byte{1}, Name: "GET", Kind: tracepb.Span_SPAN_KIND_CLIENT,
+					StartTimeUnixNano: 1500, EndTimeUnixNano: 4500,
+					Attributes: []*commonpb.KeyValue{
+						stringAttribute(apmmodel.AttributeHttpMethod, "GET"),
+						{Key: apmmodel.AttributeHTTPStatusCode, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 500}}},
+					},
+				},
+			),
+			newResourceSpans("stock",
+				&tracepb.Span{
+					TraceId: traceId, SpanId: []byte{3}, ParentSpanId: []byte{2}, Name: "GET /stock", Kind: tracepb.Span_SPAN_KIND_SERVER,
+					StartTimeUnixNano: 2000, EndTimeUnixNano: 4000,
+					Links:  []*tracepb.Span_Link{{TraceId: traceId, SpanId: []byte{9}}},
+					Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR},
+					Events: []*tracepb.Span_Event{{
+						TimeUnixNano: 3000,
+						Name:         exceptionEventName,
+						Attributes: []*commonpb.KeyValue{
+							stringAttribute(apmmodel.AttributeExceptionType, "java.lang.IllegalStateException"),
+							stringAttribute(apmmodel.AttributeExceptionMessage, "out of stock"),
+						},
+					}},
+				},
+			),
+		},
+	}
+}
+
+func TestConvertSpan(t *testing.T) {
+	traces := convertResourceSpans(newExportRequest().ResourceSpans)
+	spans := traces["0af7651916cd43dd8448eb211c80319c"]
+	assert.Len(t, spans, 3)
+
+	client := spans[1]
+	assert.Equal(t, "order", client.ServiceName)
+	assert.Equal(t, "02", client.SpanId)
+	assert.Equal(t, "01", client.PSpanId)
+	assert.Equal(t, apmmodel.SpanKindClient, client.Kind)
+	assert.Equal(t, uint64(3000), client.Duration)
+	assert.Equal(t, "GET", client.GetHttpMethod())
+	assert.Equal(t, "500", client.Attributes[apmmodel.AttributeHTTPStatusCode])
+
+	server := spans[2]
+	assert.Equal(t, "stock", server.ServiceName)
+	assert.True(t, server.IsError())
+	assert.Len(t, server.Exceptions, 1)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c:09", server.Attributes[external.AttributeSpanLinks])
+	assert.Empty(t, client.Attributes[external.AttributeSpanLinks])
+}
+
+func TestAnyValueString(t *testing.T) {
+	value := &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{
+		Values: []*commonpb.AnyValue{
+			{Value: &commonpb.AnyValue_StringValue{StringValue: "a"}},
+			{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 1.5}},
+		},
+	}}}
+	assert.Equal(t, `["a","1.5"]`, anyValueString(value))
+	assert.Equal(t, "", anyValueString(nil))
+}
+
+func TestExport(t *testing.T) {
+	cfg := &config.OtlpConfig{Enable: true, SpanCacheTime: time.Minute}
+	store := spanstore.NewStore(cfg)
+	receiver := NewReceiver(cfg, store, nil, nil)
+	ctx := auth.NewContext(context.Background(), &auth.Identity{Tenant: "t1"})
+	_, err := receiver.Export(ctx, newExportRequest())
+	assert.NoError(t, err)
+
+	// The spans are isolated by tenant.
+	serviceNodes, _, err := store.QueryServices("", "0af7651916cd43dd8448eb211c80319c")
+	assert.NoError(t, err)
+	assert.Nil(t, serviceNodes)
+
+	serviceNodes, ready, err := store.QueryServices("t1", "0af7651916cd43dd8448eb211c80319c")
+	assert.NoError(t, err)
+	assert.True(t, ready)
+	if assert.Len(t, serviceNodes, 1) {
+		root := serviceNodes[0]
+		assert.Equal(t, "01", root.EntrySpans[0].SpanId)
+		assert.Len(t, root.ExitSpans, 1)
+		assert.Equal(t, "03", root.ExitSpans[0].NextSpanId)
+		if assert.Len(t, root.Children, 1) {
+			assert.Equal(t, "stock", root.Children[0].EntrySpans[0].ServiceName)
+			assert.True(t, root.Children[0].HasException)
+		}
+	}
+	// The stored spans are not changed by building the service nodes.
+	assert.Equal(t, "", store.GetSpans("t1", "0af7651916cd43dd8448eb211c80319c")[1].NextSpanId)
+
+	assert.Nil(t, NewReceiver(&config.OtlpConfig{}, nil, nil, nil))
+}
+
+func postTraces(t *testing.T, receiver *Receiver, body []byte, gzipped bool) *httptest.ResponseRecorder {
+	app := iris.New()
+	app.Post("/v1/traces", receiver.HandleHttp)
+	assert.NoError(t, app.Build())
+	if gzipped {
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		_, _ = writer.Write(body)
+		assert.NoError(t, writer.Close())
+		body = buffer.Bytes()
+	}
+	request := httptest.NewRequest(http.MethodPost, "/v1/traces", bytes.NewReader(body))
+	request.Header.Set("Content-Type", contentTypeProtobuf)
+	if gzipped {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestHandleHttp(t *testing.T) {
+	cfg := &config.OtlpConfig{Enable: true, MaxRequestSizeMB: 1}
+	store := spanstore.NewStore(cfg)
+	receiver := NewReceiver(cfg, store, nil, nil)
+	body, err := proto.Marshal(newExportRequest())
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, postTraces(t, receiver, body, false).Code)
+	assert.Equal(t, http.StatusOK, postTraces(t, receiver, body, true).Code)
+	// The spans of both requests are kept.
+	assert.Len(t, store.GetSpans("", "0af7651916cd43dd8448eb211c80319c"), 6)
+
+	// The bodies are bounded before and after they are decompressed.
+	large := make([]byte, 1024*1024+1)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, postTraces(t, receiver, large, false).Code)
+	response := postTraces(t, receiver, large, true)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+	assert.Less(t, response.Body.Len(), 1024)
+	assert.Equal(t, http.StatusBadRequest, postTraces(t, receiver, []byte("not protobuf"), false).Code)
+}
+
+func TestExportPartialSuccess(t *testing.T) {
+	cfg := &config.OtlpConfig{Enable: true, MaxSpansPerTrace: 2}
+	receiver := NewReceiver(cfg, spanstore.NewStore(cfg), nil, nil)
+	rejected := testutil.ToFloat64(RejectSpanTotal.WithLabelValues("grpc"))
+
+	// The span over max_spans_per_trace is rejected.
+	response, err := receiver.Export(context.Background(), newExportRequest())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), response.GetPartialSuccess().GetRejectedSpans())
+	assert.Equal(t, rejected+1, testutil.ToFloat64(RejectSpanTotal.WithLabelValues("grpc")))
+
+	body, err := proto.Marshal(newExportRequest())
+	assert.NoError(t, err)
+	recorder := postTraces(t, receiver, body, false)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	httpResponse := &coltracepb.ExportTraceServiceResponse{}
+	assert.NoError(t, proto.Unmarshal(recorder.Body.Bytes(), httpResponse))
+	assert.Equal(t, int64(3), httpResponse.GetPartialSuccess().GetRejectedSpans())
+}
+
+func TestHandleHttpQuota(t *testing.T) {
+	quotas, err := tenant.NewQuotas(&config.TenantConfig{DefaultQuota: config.TenantQuotaConfig{DataPerSecond: 1, Burst: 1}})
+	assert.NoError(t, err)
+	cfg := &config.OtlpConfig{Enable: true}
+	receiver := NewReceiver(cfg, spanstore.NewStore(cfg), nil, quotas)
+	body, err := proto.Marshal(newExportRequest())
+	assert.NoError(t, err)
+
+	// The burst is taken by the first request.
+	_, err = receiver.Export(context.Background(), newExportRequest())
+	assert.NoError(t, err)
+	response := postTraces(t, receiver, body, false)
+	assert.Equal(t, http.StatusTooManyRequests, response.Code)
+	assert.Equal(t, "1", response.Header().Get("Retry-After"))
+
+	_, err = receiver.Export(context.Background(), newExportRequest())
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		assert.Equal(t, time.Second, st.Details()[0].(*errdetails.RetryInfo).RetryDelay.AsDuration())
+	}
+}
@@ -3,10 +3,13 @@ package profile
 import (
 	"context"
 	"encoding/json"
+	"sync/atomic"
 	"time"
 
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
 	"github.com/CloudDetail/apo-receiver/pkg/global"
 	"github.com/CloudDetail/apo-receiver/pkg/model"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
 )
 
 type ProfileServer struct {
@@ -15,19 +18,25 @@ type ProfileServer struct {
 	slowTraceIdCache   *traceIdCache
 	errorTraceIdCache  *traceIdCache
 	SignalsCache       *SingalsCache
-	openWindowSample   bool
-	windowSampleNum    uint32
+	openWindowSample   atomic.Bool
+	windowSampleNum    atomic.Uint32
 }
 
 func NewProfileServer(cacheTime int, openWindowSample bool, windowSampleNum int) *ProfileServer {
-	return &ProfileServer{
+	server := &ProfileServer{
 		normalTraceIdCache: NewTraceIdCache("Normal", cacheTime),
 		slowTraceIdCache:   NewTraceIdCache("Slow", cacheTime),
 		errorTraceIdCache:  NewTraceIdCache("Error", cacheTime),
 		SignalsCache:       newSignalsCache(),
-		openWindowSample:   openWindowSample,
-		windowSampleNum:    uint32(windowSampleNum),
 	}
+	server.UpdateWindowSample(openWindowSample, windowSampleNum)
+	return server
+}
+
+// UpdateWindowSample applies the reloaded window sample settings.
+func (server *ProfileServer) UpdateWindowSample(openWindowSample bool, windowSampleNum int) {
+	server.openWindowSample.Store(openWindowSample)
+	server.windowSampleNum.Store(uint32(windowSampleNum))
 }
 
 func (server *ProfileServer) Start() {
@@ -59,13 +68,14 @@ func (server *ProfileServer) QueryProfiles(ctx context.Context, request *model.P
 		recoverPidUrls []string
 	)
 
-	if server.openWindowSample {
-		closePidUrls, recoverPidUrls = server.SignalsCache.QuerySilentSwitches(request.NodeIp)
+	tenantName := auth.FromContext(ctx).GetTenant()
+	if server.openWindowSample.Load() {
+		closePidUrls, recoverPidUrls = server.SignalsCache.QuerySilentSwitches(tenantName, request.NodeIp)
 	}
-	signals := convertToSignals(global.CACHE.GetAndCleanSignals(request.NodeIp))
+	signals := convertToSignals(global.CACHE.GetAndCleanSignals(tenant.Key(tenantName, request.NodeIp)))
 	return &model.ProfileResult{
 		QueryTime:      endIndex,
-		SampleCount:    server.windowSampleNum,
+		SampleCount:    server.windowSampleNum.Load(),
 		NormalTraceIds: server.normalTraceIdCache.getTraceIds(normalIgnoreTraceIds, request.QueryTime, endIndex),
 		SlowTraceIds:   server.slowTraceIdCache.getTraceIds(slowIgnoreTraceIds, request.QueryTime, endIndex),
 		ErrorTraceIds:  server.errorTraceIdCache.getTraceIds(errorIgnoreTraceIds, request.QueryTime, endIndex),
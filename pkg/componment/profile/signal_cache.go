@@ -11,6 +11,7 @@ import (
 	profile_model "github.com/CloudDetail/apo-receiver/pkg/componment/profile/model"
 	"github.com/CloudDetail/apo-receiver/pkg/global"
 	grpc_model "github.com/CloudDetail/apo-receiver/pkg/model"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
 )
 
 const (
@@ -18,26 +19,27 @@ const (
 )
 
 type SingalsCache struct {
-	cache sync.Map // <nodeIp, SignalCache>
+	cache sync.Map // <nodeKey, SignalCache>, nodeKey is the nodeIp namespaced by tenant.Key
 }
 
 func newSignalsCache() *SingalsCache {
 	return &SingalsCache{}
 }
 
-func (signals *SingalsCache) AddSignal(entryService string, entryUrl string, trace *model.Trace, needProfile bool) {
+func (signals *SingalsCache) AddSignal(tenantName string, entryService string, entryUrl string, trace *model.Trace, needProfile bool) {
+	nodeKey := tenant.Key(tenantName, trace.Labels.NodeIp)
 	var signal *SignalCache
-	if signalInterface, ok := signals.cache.Load(trace.Labels.NodeIp); ok {
+	if signalInterface, ok := signals.cache.Load(nodeKey); ok {
 		signal = signalInterface.(*SignalCache)
 	} else {
-		signal = newSignalCache()
-		signals.cache.Store(trace.Labels.NodeIp, signal)
+		signal = newSignalCache(nodeKey)
+		signals.cache.Store(nodeKey, signal)
 	}
 	signal.addSignal(entryService, entryUrl, trace, needProfile)
 }
 
-func (signals *SingalsCache) QuerySilentSwitches(nodeIp string) ([]string, []string) {
-	if signalInterface, ok := signals.cache.Load(nodeIp); ok {
+func (signals *SingalsCache) QuerySilentSwitches(tenantName string, nodeIp string) ([]string, []string) {
+	if signalInterface, ok := signals.cache.Load(tenant.Key(tenantName, nodeIp)); ok {
 		signal := signalInterface.(*SignalCache)
 		return signal.querySilentSwitches()
 	}
@@ -53,8 +55,9 @@ func (signals *SingalsCache) CollectMetrics() {
 				countMetrics := v.(*SignalCache).collectCountMetrics()
 				if len(countMetrics) > 0 {
 					log.Printf("[Write Slow Report Metics] Count: %d", len(countMetrics))
+					tenantName, _ := tenant.SplitKey(k.(string))
 					for _, countMetric := range countMetrics {
-						global.CLICK_HOUSE.StoreReportMetric(countMetric)
+						global.CLICK_HOUSE.StoreReportMetric(tenantName, countMetric)
 					}
 				}
 				return true
@@ -64,13 +67,15 @@ func (signals *SingalsCache) CollectMetrics() {
 }
 
 type SignalCache struct {
+	nodeKey string
 	mutex   sync.RWMutex
 	metrics sync.Map // <slowReportTuple, *slowReportMetric>
 }
 
-func newSignalCache() *SignalCache {
+func newSignalCache(nodeKey string) *SignalCache {
 	return &SignalCache{
-		mutex: sync.RWMutex{},
+		nodeKey: nodeKey,
+		mutex:   sync.RWMutex{},
 	}
 }
 
@@ -102,7 +107,7 @@ func (cache *SignalCache) addSignal(entryService string, entryUrl string, trace
 			StartTime: trace.Labels.StartTime,
 			EndTime:   trace.Labels.EndTime,
 		})
-		global.CACHE.StoreSignal(trace.Labels.NodeIp, string(signalJson))
+		global.CACHE.StoreSignal(cache.nodeKey, string(signalJson))
 	}
 }
 
@@ -8,7 +8,7 @@ import (
 )
 
 func TestQuerySilentSwitches(t *testing.T) {
-	cache := newSignalCache()
+	cache := newSignalCache("")
 
 	// Prepare Data
 	trace_one_profiled := &model.Trace{
@@ -1,23 +1,30 @@
 package redis
 
-import "github.com/CloudDetail/apo-module/model/v1"
+import (
+	"context"
+
+	"github.com/CloudDetail/apo-module/model/v1"
+
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+)
 
 type ExpirableCache interface {
 	Start()
 
 	IsLocal() bool
 
-	// Cacher
-	StoreMetric(metric *model.OnOffMetricGroup, json string)
-	GetMetricSize(traceId string) int
-	GetMetrics(traceId string) []*model.OnOffMetricGroup
+	// Cacher, traceKey is the traceId namespaced by tenant.Key.
+	StoreMetric(traceKey string, metric *model.OnOffMetricGroup)
+	GetMetricSize(traceKey string) int
+	GetMetrics(traceKey string) []*model.OnOffMetricGroup
 
-	StoreTrace(trace *model.Trace, json string)
-	GetTraceSize(traceId string) int
-	GetTraces(traceId string) []*model.Trace
+	// StoreTrace caches the trace with the identity of the agent who sent it, so the identity is shared with the other receivers.
+	StoreTrace(traceKey string, trace *model.Trace, identity *auth.Identity)
+	GetTraceSize(traceKey string) int
+	GetTraces(traceKey string) []*CachedTrace
 
-	RecordTraceTime(traceId string, time int64)
-	GetTraceTime(traceId string) int64
+	RecordTraceTime(traceKey string, time int64)
+	GetTraceTime(traceKey string) int64
 
 	// Keep Receiver TraceId index unique.
 	IncrTraceIndex() int64
@@ -30,15 +37,19 @@ type ExpirableCache interface {
 	SubscribeTraceIds(normalSubscriber Subscriber, slowSubscriber Subscriber, errorSubscriber Subscriber)
 
 	// Stream + ConsumeGroup
-	NotifyReportTraceId(traceId string)
-	SubscribeReportTraceId(subscriber Subscriber)
+	NotifyReportTraceId(traceKey string)
+	// SubscribeReportTraceId consumes the report trace ids until ctx is done.
+	SubscribeReportTraceId(ctx context.Context, subscriber Subscriber)
 
-	// Signal
-	StoreSignal(nodeIp string, json string)
-	GetAndCleanSignals(nodeIp string) []string
+	// Signal, nodeKey is the nodeIp namespaced by tenant.Key.
+	StoreSignal(nodeKey string, json string)
+	GetAndCleanSignals(nodeKey string) []string
 
 	StoreRelationTraceId(key string, traceId string)
 	GetRelationTraceId(key string) string
+	// MarkTraceObserved returns true for the first mark of the trace, so the trace analyzed by more than one task
+	// and by the retries is only observed once.
+	MarkTraceObserved(traceKey string) bool
 
 	// Sampler
 	GetSampleValue() int64
@@ -48,6 +59,12 @@ type ExpirableCache interface {
 	LockAndCheckSampleTime() bool
 }
 
+// CachedTrace is the trace with the identity of the agent who sent it, Identity is nil if auth is disabled.
+type CachedTrace struct {
+	Trace    *model.Trace
+	Identity *auth.Identity
+}
+
 type Subscriber interface {
 	Consume(traceId string)
 }
@@ -1,19 +1,23 @@
 package redis
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/CloudDetail/apo-module/model/v1"
+
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
 )
 
 type LocalCache struct {
 	expireTime   int64
-	traceMap     sync.Map // <traceId, ExpirableList>
-	checkMissMap sync.Map // <traceId, ExpireData>
-	signalMap    sync.Map
+	traceMap     sync.Map // <traceKey, ExpirableList>
+	checkMissMap sync.Map // <traceKey, ExpireData>
+	signalMap    sync.Map // <nodeKey, SignalList>
 	relationMap  sync.Map
+	observedMap  sync.Map // <traceKey, ExpirableData>
 	sampleValue  *atomic.Int64
 	sampleTime   *atomic.Int64
 
@@ -49,19 +53,19 @@ func (cache *LocalCache) IsLocal() bool {
 	return true
 }
 
-func (cache *LocalCache) StoreMetric(metric *model.OnOffMetricGroup, json string) {
+func (cache *LocalCache) StoreMetric(traceKey string, metric *model.OnOffMetricGroup) {
 	var expirableList *ExpirableList
-	if listInterface, ok := cache.traceMap.Load(metric.TraceId); ok {
+	if listInterface, ok := cache.traceMap.Load(traceKey); ok {
 		expirableList = listInterface.(*ExpirableList)
 	} else {
 		expirableList = newExpirableList()
-		cache.traceMap.Store(metric.TraceId, expirableList)
+		cache.traceMap.Store(traceKey, expirableList)
 	}
 	expirableList.addMetric(cache.expireTime, metric)
 }
 
-func (cache *LocalCache) GetMetricSize(traceId string) int {
-	if listInterface, ok := cache.traceMap.Load(traceId); ok {
+func (cache *LocalCache) GetMetricSize(traceKey string) int {
+	if listInterface, ok := cache.traceMap.Load(traceKey); ok {
 		expirableList := listInterface.(*ExpirableList)
 		return len(expirableList.metrics)
 	} else {
@@ -69,8 +73,8 @@ func (cache *LocalCache) GetMetricSize(traceId string) int {
 	}
 }
 
-func (cache *LocalCache) GetMetrics(traceId string) []*model.OnOffMetricGroup {
-	if listInterface, ok := cache.traceMap.Load(traceId); ok {
+func (cache *LocalCache) GetMetrics(traceKey string) []*model.OnOffMetricGroup {
+	if listInterface, ok := cache.traceMap.Load(traceKey); ok {
 		expirableList := listInterface.(*ExpirableList)
 		return expirableList.metrics
 	} else {
@@ -78,19 +82,19 @@ func (cache *LocalCache) GetMetrics(traceId string) []*model.OnOffMetricGroup {
 	}
 }
 
-func (cache *LocalCache) StoreTrace(trace *model.Trace, _json string) {
+func (cache *LocalCache) StoreTrace(traceKey string, trace *model.Trace, identity *auth.Identity) {
 	var expirableList *ExpirableList
-	if listInterface, ok := cache.traceMap.Load(trace.Labels.TraceId); ok {
+	if listInterface, ok := cache.traceMap.Load(traceKey); ok {
 		expirableList = listInterface.(*ExpirableList)
 	} else {
 		expirableList = newExpirableList()
-		cache.traceMap.Store(trace.Labels.TraceId, expirableList)
+		cache.traceMap.Store(traceKey, expirableList)
 	}
-	expirableList.addTrace(cache.expireTime, trace)
+	expirableList.addTrace(cache.expireTime, &CachedTrace{Trace: trace, Identity: identity})
 }
 
-func (cache *LocalCache) GetTraceSize(traceId string) int {
-	if listInterface, ok := cache.traceMap.Load(traceId); ok {
+func (cache *LocalCache) GetTraceSize(traceKey string) int {
+	if listInterface, ok := cache.traceMap.Load(traceKey); ok {
 		expirableList := listInterface.(*ExpirableList)
 		return len(expirableList.traces)
 	} else {
@@ -98,8 +102,8 @@ func (cache *LocalCache) GetTraceSize(traceId string) int {
 	}
 }
 
-func (cache *LocalCache) GetTraces(traceId string) []*model.Trace {
-	if listInterface, ok := cache.traceMap.Load(traceId); ok {
+func (cache *LocalCache) GetTraces(traceKey string) []*CachedTrace {
+	if listInterface, ok := cache.traceMap.Load(traceKey); ok {
 		expirableList := listInterface.(*ExpirableList)
 		return expirableList.traces
 	} else {
@@ -107,12 +111,12 @@ func (cache *LocalCache) GetTraces(traceId string) []*model.Trace {
 	}
 }
 
-func (cache *LocalCache) RecordTraceTime(traceId string, data int64) {
-	cache.checkMissMap.Store(traceId, newExpirableData(cache.expireTime, data))
+func (cache *LocalCache) RecordTraceTime(traceKey string, data int64) {
+	cache.checkMissMap.Store(traceKey, newExpirableData(cache.expireTime, data))
 }
 
-func (cache *LocalCache) GetTraceTime(traceId string) int64 {
-	if expirableData, ok := cache.checkMissMap.Load(traceId); ok {
+func (cache *LocalCache) GetTraceTime(traceKey string) int64 {
+	if expirableData, ok := cache.checkMissMap.Load(traceKey); ok {
 		value := expirableData.(*ExpirableData[int64])
 		return value.data
 	}
@@ -127,9 +131,9 @@ func (cache *LocalCache) IncrTraceIndex() int64 {
 	return time.Now().UnixNano()
 }
 
-func (cache *LocalCache) NotifyReportTraceId(traceId string) {
+func (cache *LocalCache) NotifyReportTraceId(traceKey string) {
 	cache.mutex.Lock()
-	cache.reportTraceIds = append(cache.reportTraceIds, traceId)
+	cache.reportTraceIds = append(cache.reportTraceIds, traceKey)
 	cache.mutex.Unlock()
 }
 
@@ -148,7 +152,7 @@ func (cache *LocalCache) NotifySampledTraceIds(normalTraceIds []string, slowTrac
 	}
 }
 
-func (cache *LocalCache) SubscribeReportTraceId(subscriber Subscriber) {
+func (cache *LocalCache) SubscribeReportTraceId(ctx context.Context, subscriber Subscriber) {
 	timer := time.NewTicker(1 * time.Second)
 	for {
 		select {
@@ -161,6 +165,9 @@ func (cache *LocalCache) SubscribeReportTraceId(subscriber Subscriber) {
 				cache.reportTraceIds = cache.reportTraceIds[0:0]
 				cache.mutex.Unlock()
 			}
+		case <-ctx.Done():
+			timer.Stop()
+			return
 		case <-cache.stopChan:
 			timer.Stop()
 			return
@@ -243,6 +250,12 @@ func (cache *LocalCache) checkExpire() {
 				}
 				return true
 			})
+			cache.observedMap.Range(func(k, v interface{}) bool {
+				if v.(*ExpirableData[bool]).expireTime < checkTime {
+					cache.observedMap.Delete(k)
+				}
+				return true
+			})
 		case <-cache.stopChan:
 			timer.Stop()
 			return
@@ -250,19 +263,19 @@ func (cache *LocalCache) checkExpire() {
 	}
 }
 
-func (cache *LocalCache) StoreSignal(nodeIp string, json string) {
+func (cache *LocalCache) StoreSignal(nodeKey string, json string) {
 	var signal *SignalList
-	if signalInterface, ok := cache.signalMap.Load(nodeIp); ok {
+	if signalInterface, ok := cache.signalMap.Load(nodeKey); ok {
 		signal = signalInterface.(*SignalList)
 	} else {
 		signal = newSignalList()
-		cache.signalMap.Store(nodeIp, signal)
+		cache.signalMap.Store(nodeKey, signal)
 	}
 	signal.addSignal(json)
 }
 
-func (cache *LocalCache) GetAndCleanSignals(nodeIp string) []string {
-	if signalInterface, ok := cache.signalMap.Load(nodeIp); ok {
+func (cache *LocalCache) GetAndCleanSignals(nodeKey string) []string {
+	if signalInterface, ok := cache.signalMap.Load(nodeKey); ok {
 		signal := signalInterface.(*SignalList)
 		return signal.getAndCleanSignals()
 	}
@@ -283,6 +296,11 @@ func (cache *LocalCache) GetRelationTraceId(key string) string {
 	return ""
 }
 
+func (cache *LocalCache) MarkTraceObserved(traceKey string) bool {
+	_, loaded := cache.observedMap.LoadOrStore(traceKey, newExpirableData(3600, true))
+	return !loaded
+}
+
 // SampleValue
 func (cache *LocalCache) GetSampleValue() int64 {
 	return cache.sampleValue.Load()
@@ -306,18 +324,18 @@ func (cache *LocalCache) LockAndCheckSampleTime() bool {
 type ExpirableList struct {
 	lock       sync.Mutex
 	expireTime int64
-	traces     []*model.Trace
+	traces     []*CachedTrace
 	metrics    []*model.OnOffMetricGroup
 }
 
 func newExpirableList() *ExpirableList {
 	return &ExpirableList{
-		traces:  make([]*model.Trace, 0),
+		traces:  make([]*CachedTrace, 0),
 		metrics: make([]*model.OnOffMetricGroup, 0),
 	}
 }
 
-func (list *ExpirableList) addTrace(expireTime int64, trace *model.Trace) {
+func (list *ExpirableList) addTrace(expireTime int64, trace *CachedTrace) {
 	list.lock.Lock()
 	defer list.lock.Unlock()
 	list.expireTime = time.Now().Unix() + expireTime
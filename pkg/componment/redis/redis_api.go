@@ -6,9 +6,14 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/CloudDetail/apo-module/model/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	grpc_model "github.com/CloudDetail/apo-receiver/pkg/model"
 )
 
 const (
@@ -20,6 +25,8 @@ const (
 
 	REDIS_KEY_SENT_RELATION = "kd-sent-relation-%s"
 
+	REDIS_KEY_OBSERVED_TRACE = "kd-observed-trace-%s"
+
 	REDIS_KEY_TRACE_INDEX = "kd-traceIndex"
 
 	REDIS_CHANNEL_NORMAL = "kd-normalChannel"
@@ -32,6 +39,10 @@ const (
 	REDIS_KEY_SAMPLE      = "kd-sample-value"
 	REDIS_KEY_SAMPLE_TIME = "kd-sample-time"
 	REDIS_KEY_SAMPLE_LOCK = "kd-sample-lock"
+
+	// WriteFormatJson is read by all the receivers, WriteFormatProtobuf is smaller but only read by the upgraded receivers.
+	WriteFormatJson     = "json"
+	WriteFormatProtobuf = "protobuf"
 )
 
 var (
@@ -51,28 +62,32 @@ func (cache *RedisClient) IsLocal() bool {
 
 // ========== Metric ==========
 /*
-	kd-onoff-metric-<traceId>, ExpireTime: 60s
+	kd-onoff-metric-<traceKey>, ExpireTime: 60s
 */
-func (client *RedisClient) StoreMetric(metric *model.OnOffMetricGroup, json string) {
-	client.storeList(fmt.Sprintf(REDIS_KEY_METRIC, metric.TraceId), json)
+func (client *RedisClient) StoreMetric(traceKey string, metric *model.OnOffMetricGroup) {
+	data, err := encodeMetric(metric, client.writeFormat)
+	if err != nil {
+		log.Printf("[x Encode OnOff Metric] Error: %s", err.Error())
+		return
+	}
+	client.storeList(fmt.Sprintf(REDIS_KEY_METRIC, traceKey), data)
 }
 
 /*
-kd-onoff-metric-<traceId>
+kd-onoff-metric-<traceKey>
 */
-func (client *RedisClient) GetMetricSize(traceId string) int {
-	return int(client.getListSize(fmt.Sprintf(REDIS_KEY_METRIC, traceId)))
+func (client *RedisClient) GetMetricSize(traceKey string) int {
+	return int(client.getListSize(fmt.Sprintf(REDIS_KEY_METRIC, traceKey)))
 }
 
 /*
-kd-onoff-metric-<traceId>
+kd-onoff-metric-<traceKey>
 */
-func (client *RedisClient) GetMetrics(traceId string) []*model.OnOffMetricGroup {
+func (client *RedisClient) GetMetrics(traceKey string) []*model.OnOffMetricGroup {
 	metrics := make([]*model.OnOffMetricGroup, 0)
-	metricJsons := client.getList(fmt.Sprintf(REDIS_KEY_METRIC, traceId), -1)
-	for _, metricJson := range metricJsons {
-		onOffMetricGroup := &model.OnOffMetricGroup{}
-		if err := json.Unmarshal([]byte(metricJson), onOffMetricGroup); err == nil {
+	metricDatas := client.getList(fmt.Sprintf(REDIS_KEY_METRIC, traceKey), -1)
+	for _, metricData := range metricDatas {
+		if onOffMetricGroup, err := decodeMetric(metricData); err == nil {
 			metrics = append(metrics, onOffMetricGroup)
 		}
 	}
@@ -81,39 +96,43 @@ func (client *RedisClient) GetMetrics(traceId string) []*model.OnOffMetricGroup
 
 // ========== Trace ==========
 /*
-	kd-span-trace-<traceId>, ExpireTime: 60s
+	kd-span-trace-<traceKey>, ExpireTime: 60s
 */
-func (client *RedisClient) StoreTrace(trace *model.Trace, json string) {
-	client.storeList(fmt.Sprintf(REDIS_KEY_TRACE, trace.Labels.TraceId), json)
+func (client *RedisClient) StoreTrace(traceKey string, trace *model.Trace, identity *auth.Identity) {
+	data, err := encodeTrace(trace, identity, client.writeFormat)
+	if err != nil {
+		log.Printf("[x Encode Trace] Error: %s", err.Error())
+		return
+	}
+	client.storeList(fmt.Sprintf(REDIS_KEY_TRACE, traceKey), data)
 }
 
 /*
-kd-last-trace-<traceId>
+kd-last-trace-<traceKey>
 */
-func (client *RedisClient) RecordTraceTime(traceId string, data int64) {
-	client.setInt(fmt.Sprintf(REDIS_KEY_LAST_TRACE, traceId), data)
+func (client *RedisClient) RecordTraceTime(traceKey string, data int64) {
+	client.setInt(fmt.Sprintf(REDIS_KEY_LAST_TRACE, traceKey), data)
 }
 
-func (cache *RedisClient) GetTraceTime(traceId string) int64 {
-	return cache.getInt(fmt.Sprintf(REDIS_KEY_LAST_TRACE, traceId))
+func (cache *RedisClient) GetTraceTime(traceKey string) int64 {
+	return cache.getInt(fmt.Sprintf(REDIS_KEY_LAST_TRACE, traceKey))
 }
 
 /*
-kd-span-trace-<traceId>
+kd-span-trace-<traceKey>
 */
-func (client *RedisClient) GetTraceSize(traceId string) int {
-	return int(client.getListSize(fmt.Sprintf(REDIS_KEY_TRACE, traceId)))
+func (client *RedisClient) GetTraceSize(traceKey string) int {
+	return int(client.getListSize(fmt.Sprintf(REDIS_KEY_TRACE, traceKey)))
 }
 
 /*
-kd-span-trace-<traceId>
+kd-span-trace-<traceKey>
 */
-func (client *RedisClient) GetTraces(traceId string) []*model.Trace {
-	traces := make([]*model.Trace, 0)
-	traceJsons := client.getList(fmt.Sprintf(REDIS_KEY_TRACE, traceId), -1)
-	for _, traceJson := range traceJsons {
-		trace := &model.Trace{Labels: &model.TraceLabels{ThresholdMultiple: 1.0}}
-		if err := json.Unmarshal([]byte(traceJson), trace); err == nil {
+func (client *RedisClient) GetTraces(traceKey string) []*CachedTrace {
+	traces := make([]*CachedTrace, 0)
+	traceDatas := client.getList(fmt.Sprintf(REDIS_KEY_TRACE, traceKey), -1)
+	for _, traceData := range traceDatas {
+		if trace, err := decodeTrace(traceData); err == nil {
 			traces = append(traces, trace)
 		}
 	}
@@ -123,13 +142,13 @@ func (client *RedisClient) GetTraces(traceId string) []*model.Trace {
 /*
 kd-reportStream
 */
-func (client *RedisClient) NotifyReportTraceId(traceId string) {
-	client.xAddChannel(REDIS_STREAM_REPORT, traceId)
+func (client *RedisClient) NotifyReportTraceId(traceKey string) {
+	client.xAddChannel(REDIS_STREAM_REPORT, traceKey)
 }
 
-func (client *RedisClient) SubscribeReportTraceId(subscriber Subscriber) {
-	for {
-		client.xReadGroup(REDIS_STREAM_GROUP, consumerName, REDIS_STREAM_REPORT, subscriber)
+func (client *RedisClient) SubscribeReportTraceId(ctx context.Context, subscriber Subscriber) {
+	for ctx.Err() == nil {
+		client.xReadGroup(ctx, REDIS_STREAM_GROUP, consumerName, REDIS_STREAM_REPORT, subscriber)
 	}
 }
 
@@ -163,14 +182,14 @@ func (client *RedisClient) SubscribeTraceIds(normalSubscriber Subscriber, slowSu
 }
 
 /*
-kd-signal-<traceId>
+kd-signal-<nodeKey>
 */
-func (client *RedisClient) StoreSignal(nodeIp string, json string) {
-	client.storeList(fmt.Sprintf(REDIS_KEY_SIGNAL, nodeIp), json)
+func (client *RedisClient) StoreSignal(nodeKey string, json string) {
+	client.storeList(fmt.Sprintf(REDIS_KEY_SIGNAL, nodeKey), json)
 }
 
-func (client *RedisClient) GetAndCleanSignals(nodeIp string) []string {
-	key := fmt.Sprintf(REDIS_KEY_SIGNAL, nodeIp)
+func (client *RedisClient) GetAndCleanSignals(nodeKey string) []string {
+	key := fmt.Sprintf(REDIS_KEY_SIGNAL, nodeKey)
 	size := client.getListSize(key)
 	if size > 0 {
 		result := client.getList(key, size)
@@ -189,6 +208,13 @@ func (client *RedisClient) GetRelationTraceId(key string) string {
 	return client.get(fmt.Sprintf(REDIS_KEY_SENT_RELATION, key))
 }
 
+/*
+kd-observed-trace-<traceKey>, ExpireTime: 3600s
+*/
+func (client *RedisClient) MarkTraceObserved(traceKey string) bool {
+	return client.setNxIntWithExpireTime(fmt.Sprintf(REDIS_KEY_OBSERVED_TRACE, traceKey), 1, 3600)
+}
+
 // SampleValue
 func (client *RedisClient) GetSampleValue() int64 {
 	return client.getInt(REDIS_KEY_SAMPLE)
@@ -211,3 +237,76 @@ func (client *RedisClient) LockAndCheckSampleTime() bool {
 	}
 	return false
 }
+
+// The traces and metrics are stored in redis.write_format, both json and protobuf are decoded,
+// so protobuf is only written after all the receivers sharing Redis are upgraded.
+// The protobuf never starts with '{', which is the tag of a group.
+func isJson(data string) bool {
+	return strings.HasPrefix(data, "{")
+}
+
+// jsonTrace is the trace in json with the identity, the old receivers read it as model.Trace without the identity.
+type jsonTrace struct {
+	*model.Trace
+	Identity *auth.Identity `json:"identity,omitempty"`
+}
+
+func encodeTrace(trace *model.Trace, identity *auth.Identity, format string) (string, error) {
+	var data []byte
+	var err error
+	if format == WriteFormatProtobuf {
+		message := grpc_model.NewTrace(trace)
+		if identity != nil {
+			message.Identity = &grpc_model.Identity{Cluster: identity.Cluster, Tenant: identity.Tenant, Node: identity.Node}
+		}
+		data, err = proto.Marshal(message)
+	} else {
+		data, err = json.Marshal(&jsonTrace{Trace: trace, Identity: identity})
+	}
+	return string(data), err
+}
+
+func decodeTrace(data string) (*CachedTrace, error) {
+	if isJson(data) {
+		trace := &jsonTrace{Trace: &model.Trace{Labels: &model.TraceLabels{ThresholdMultiple: 1.0}}}
+		if err := json.Unmarshal([]byte(data), trace); err != nil {
+			return nil, err
+		}
+		return &CachedTrace{Trace: trace.Trace, Identity: trace.Identity}, nil
+	}
+	trace := &grpc_model.Trace{}
+	if err := proto.Unmarshal([]byte(data), trace); err != nil {
+		return nil, err
+	}
+	cachedTrace := &CachedTrace{Trace: trace.ToTrace()}
+	if identity := trace.GetIdentity(); identity != nil {
+		cachedTrace.Identity = &auth.Identity{Cluster: identity.GetCluster(), Tenant: identity.GetTenant(), Node: identity.GetNode()}
+	}
+	return cachedTrace, nil
+}
+
+func encodeMetric(metric *model.OnOffMetricGroup, format string) (string, error) {
+	var data []byte
+	var err error
+	if format == WriteFormatProtobuf {
+		data, err = proto.Marshal(grpc_model.NewOnOffMetric(metric))
+	} else {
+		data, err = json.Marshal(metric)
+	}
+	return string(data), err
+}
+
+func decodeMetric(data string) (*model.OnOffMetricGroup, error) {
+	if isJson(data) {
+		onOffMetricGroup := &model.OnOffMetricGroup{}
+		if err := json.Unmarshal([]byte(data), onOffMetricGroup); err != nil {
+			return nil, err
+		}
+		return onOffMetricGroup, nil
+	}
+	metric := &grpc_model.OnOffMetric{}
+	if err := proto.Unmarshal([]byte(data), metric); err != nil {
+		return nil, err
+	}
+	return metric.ToOnOffMetricGroup(), nil
+}
@@ -0,0 +1,150 @@
+package redis
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/CloudDetail/apo-module/model/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	grpc_model "github.com/CloudDetail/apo-receiver/pkg/model"
+)
+
+func newTestTrace() *model.Trace {
+	return &model.Trace{
+		Timestamp: 1700000000000000000,
+		Version:   "1.0",
+		Source:    "ebpf",
+		Labels: &model.TraceLabels{
+			Pid:               1234,
+			Tid:               1235,
+			TopSpan:           true,
+			Protocol:          "http",
+			ServiceName:       "order-service",
+			Url:               "POST /api/order",
+			HttpUrl:           "http://order-service:8080/api/order",
+			IsSampled:         true,
+			IsServer:          true,
+			IsSlow:            true,
+			SampleValue:       3,
+			ReportType:        1,
+			ThresholdType:     model.P90ThresholdType,
+			ThresholdValue:    120.5,
+			ThresholdRange:    model.RangeLast1h,
+			ThresholdMultiple: 1.0,
+			TraceId:           "a1b2c3d4e5f60718293a4b5c6d7e8f90",
+			ApmType:           "skywalking",
+			ApmSpanId:         "a1b2c3d4e5f60718293a4b5c6d7e8f90-1",
+			ContainerId:       "0123456789ab",
+			ContainerName:     "order",
+			StartTime:         1700000000000000000,
+			Duration:          250000000,
+			EndTime:           1700000000250000000,
+			NodeName:          "node-1",
+			NodeIp:            "10.0.0.1",
+			OffsetTs:          -12,
+		},
+		WorkloadName: "order",
+		WorkloadKind: "Deployment",
+		PodIp:        "172.16.0.10",
+		PodName:      "order-5d8f7c9b4-abcde",
+		Namespace:    "shop",
+		OnOffMetrics: "1,2,3,4,5,6,7,8",
+	}
+}
+
+func TestDecodeTrace(t *testing.T) {
+	trace := newTestTrace()
+	jsonData, _ := json.Marshal(trace)
+	protoData, _ := proto.Marshal(grpc_model.NewTrace(trace))
+	assert.Less(t, len(protoData), len(jsonData))
+
+	for name, data := range map[string][]byte{"json": jsonData, "proto": protoData} {
+		t.Run(name, func(t *testing.T) {
+			decoded, err := decodeTrace(string(data))
+			assert.NoError(t, err)
+			assert.Equal(t, &CachedTrace{Trace: trace}, decoded)
+		})
+	}
+
+	// The threshold multiple is 1 when not set, same with the json.
+	decoded, err := decodeTrace("")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, decoded.Trace.Labels.ThresholdMultiple)
+	_, err = decodeTrace("{")
+	assert.Error(t, err)
+}
+
+func TestDecodeTraceOfOldReceiver(t *testing.T) {
+	trace := newTestTrace()
+	data, err := encodeTrace(trace, &auth.Identity{Tenant: "t1"}, WriteFormatJson)
+	assert.NoError(t, err)
+	// The old receivers read the trace without the identity.
+	oldTrace := &model.Trace{}
+	assert.NoError(t, json.Unmarshal([]byte(data), oldTrace))
+	assert.Equal(t, trace, oldTrace)
+}
+
+func TestDecodeMetric(t *testing.T) {
+	metric := &model.OnOffMetricGroup{TraceId: "t1", SpanId: "s1", Metrics: "1,2,3"}
+	jsonData, _ := json.Marshal(metric)
+	protoData, _ := proto.Marshal(grpc_model.NewOnOffMetric(metric))
+	for name, data := range map[string][]byte{"json": jsonData, "proto": protoData} {
+		t.Run(name, func(t *testing.T) {
+			decoded, err := decodeMetric(string(data))
+			assert.NoError(t, err)
+			assert.Equal(t, metric, decoded)
+		})
+	}
+}
+
+func TestEncodeWriteFormat(t *testing.T) {
+	trace := newTestTrace()
+	identity := &auth.Identity{Cluster: "c1", Tenant: "t1", Node: "node-1"}
+	metric := &model.OnOffMetricGroup{TraceId: "t1", SpanId: "s1", Metrics: "1,2,3"}
+	for _, format := range []string{WriteFormatJson, WriteFormatProtobuf} {
+		t.Run(format, func(t *testing.T) {
+			traceData, err := encodeTrace(trace, identity, format)
+			assert.NoError(t, err)
+			// The old receivers only read json.
+			assert.Equal(t, format == WriteFormatJson, isJson(traceData))
+			decodedTrace, err := decodeTrace(traceData)
+			assert.NoError(t, err)
+			// The identity is shared with the receivers reading the trace.
+			assert.Equal(t, &CachedTrace{Trace: trace, Identity: identity}, decodedTrace)
+
+			traceData, err = encodeTrace(trace, nil, format)
+			assert.NoError(t, err)
+			decodedTrace, err = decodeTrace(traceData)
+			assert.NoError(t, err)
+			assert.Nil(t, decodedTrace.Identity)
+
+			metricData, err := encodeMetric(metric, format)
+			assert.NoError(t, err)
+			assert.Equal(t, format == WriteFormatJson, isJson(metricData))
+			decodedMetric, err := decodeMetric(metricData)
+			assert.NoError(t, err)
+			assert.Equal(t, metric, decodedMetric)
+		})
+	}
+}
+
+func BenchmarkEncodeDecodeTraceJson(b *testing.B) {
+	trace := newTestTrace()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, _ := json.Marshal(trace)
+		_, _ = decodeTrace(string(data))
+	}
+}
+
+func BenchmarkEncodeDecodeTraceProto(b *testing.B) {
+	trace := newTestTrace()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, _ := proto.Marshal(grpc_model.NewTrace(trace))
+		_, _ = decodeTrace(string(data))
+	}
+}
@@ -2,6 +2,7 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
 	"log"
 	"strconv"
 	"strings"
@@ -11,15 +12,19 @@ import (
 )
 
 type RedisClient struct {
-	rdb        *redis.Client
-	expireTime time.Duration
+	rdb         *redis.Client
+	expireTime  time.Duration
+	writeFormat string
 }
 
-func NewRedisClient(address string, password string, expireTime int64) (*RedisClient, error) {
+// NewRedisClient connects Redis, TLS is used if tlsConfig is not nil.
+// The traces and metrics are written in writeFormat, json if it is not set.
+func NewRedisClient(address string, password string, expireTime int64, writeFormat string, tlsConfig *tls.Config) (*RedisClient, error) {
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     address,
-		Password: password,
-		DB:       0,
+		Addr:      address,
+		Password:  password,
+		DB:        0,
+		TLSConfig: tlsConfig,
 	})
 	_, err := rdb.Ping(rdb.Context()).Result()
 	if err != nil {
@@ -28,12 +33,21 @@ func NewRedisClient(address string, password string, expireTime int64) (*RedisCl
 	if expireTime <= 0 {
 		expireTime = 60
 	}
+	if writeFormat == "" {
+		writeFormat = WriteFormatJson
+	}
 	return &RedisClient{
-		rdb:        rdb,
-		expireTime: time.Duration(expireTime * 1000000000),
+		rdb:         rdb,
+		expireTime:  time.Duration(expireTime * 1000000000),
+		writeFormat: writeFormat,
 	}, nil
 }
 
+// Ping checks Redis is reachable, it is used by the health checks.
+func (client *RedisClient) Ping(ctx context.Context) error {
+	return client.rdb.Ping(ctx).Err()
+}
+
 func (client *RedisClient) pubChannel(channelName string, message string) error {
 	return client.rdb.Publish(context.Background(), channelName, message).Err()
 }
@@ -155,8 +169,9 @@ func (client *RedisClient) xAddChannel(streamName string, message string) error
 	}).Err()
 }
 
-func (client *RedisClient) xReadGroup(groupName string, consumerName string, streamName string, subscriber Subscriber) error {
-	messages, err := client.rdb.XReadGroup(context.Background(), &redis.XReadGroupArgs{
+// xReadGroup blocks until a message is read or ctx is done.
+func (client *RedisClient) xReadGroup(ctx context.Context, groupName string, consumerName string, streamName string, subscriber Subscriber) error {
+	messages, err := client.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
 		Group:    groupName,
 		Consumer: consumerName,
 		Streams:  []string{streamName, ">"},
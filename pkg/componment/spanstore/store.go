@@ -0,0 +1,235 @@
+package spanstore
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
+
+	apmmodel "github.com/CloudDetail/apo-module/apm/model/v1"
+)
+
+const (
+	defaultSpanCacheTime    = 5 * time.Minute
+	defaultMaxTraces        = 100000
+	defaultSpanQuietTime    = 10 * time.Second
+	defaultMaxSpansPerTrace = 10000
+)
+
+var (
+	StoredTraces = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "originx_receiver_span_store_traces",
+			Help: "The number of traces kept in the span store",
+		},
+	)
+	DroppedSpansTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_span_store_dropped_spans_total",
+			Help: "The total number of spans dropped as the span store or the trace is full",
+		},
+	)
+	StoreLookupsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_span_store_lookups_total",
+			Help: "The total number of traces looked up in the span store, result is hit, miss or incomplete",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(StoredTraces, DroppedSpansTotal, StoreLookupsTotal)
+}
+
+// Store keeps the pushed spans in memory by trace until they are expired, the number of traces is bounded by max_traces
+// and the spans of a trace are bounded by max_spans_per_trace.
+type Store struct {
+	cacheTime  time.Duration
+	quietTime  int64
+	maxTraces  int64
+	maxSpans   int
+	traceCount atomic.Int64
+	traces     sync.Map // <traceKey, *traceSpans>
+	stopChan   chan struct{}
+}
+
+type traceSpans struct {
+	mutex sync.Mutex
+	spans []*apmmodel.OtelSpan
+	// lastSeen is when the last span is received in nanoseconds.
+	lastSeen   int64
+	expireTime int64
+}
+
+// NewStore returns nil if OTLP is not enabled, as no span is pushed.
+func NewStore(cfg *config.OtlpConfig) *Store {
+	if !cfg.Enable {
+		return nil
+	}
+	cacheTime := cfg.SpanCacheTime
+	if cacheTime <= 0 {
+		cacheTime = defaultSpanCacheTime
+	}
+	maxTraces := cfg.MaxTraces
+	if maxTraces <= 0 {
+		maxTraces = defaultMaxTraces
+	}
+	quietTime := cfg.SpanQuietTime
+	if quietTime <= 0 {
+		quietTime = defaultSpanQuietTime
+	}
+	maxSpans := cfg.MaxSpansPerTrace
+	if maxSpans <= 0 {
+		maxSpans = defaultMaxSpansPerTrace
+	}
+	return &Store{
+		cacheTime: cacheTime,
+		quietTime: int64(quietTime),
+		maxTraces: int64(maxTraces),
+		maxSpans:  maxSpans,
+		stopChan:  make(chan struct{}),
+	}
+}
+
+func (store *Store) Start() {
+	go store.checkExpire()
+}
+
+func (store *Store) Stop() {
+	close(store.stopChan)
+}
+
+// AddSpans appends the spans of the trace and renews the expire time of the trace, the number of the dropped spans is returned.
+// The spans of a new trace are dropped if the store is full and the spans over max_spans_per_trace are dropped.
+func (store *Store) AddSpans(tenantName string, traceId string, spans []*apmmodel.OtelSpan) int {
+	traceKey := tenant.Key(tenantName, traceId)
+	value, found := store.traces.Load(traceKey)
+	if !found {
+		if store.traceCount.Load() >= store.maxTraces {
+			DroppedSpansTotal.Add(float64(len(spans)))
+			return len(spans)
+		}
+		var loaded bool
+		value, loaded = store.traces.LoadOrStore(traceKey, &traceSpans{})
+		if !loaded {
+			StoredTraces.Set(float64(store.traceCount.Add(1)))
+		}
+	}
+	trace := value.(*traceSpans)
+	now := time.Now()
+	trace.mutex.Lock()
+	defer trace.mutex.Unlock()
+	trace.lastSeen = now.UnixNano()
+	trace.expireTime = now.Add(store.cacheTime).Unix()
+	if room := store.maxSpans - len(trace.spans); room < len(spans) {
+		dropped := len(spans) - max(room, 0)
+		DroppedSpansTotal.Add(float64(dropped))
+		trace.spans = append(trace.spans, spans[:max(room, 0)]...)
+		return dropped
+	}
+	trace.spans = append(trace.spans, spans...)
+	return 0
+}
+
+// GetSpans returns the copies of the spans, so the service nodes built by the callers do not share the spans.
+func (store *Store) GetSpans(tenantName string, traceId string) []*apmmodel.OtelSpan {
+	spans, _ := store.getSpans(tenantName, traceId, time.Now().UnixNano())
+	return spans
+}
+
+// getSpans returns the copies of the spans and whether the trace is ready at checkTime in nanoseconds,
+// the trace is ready if it is complete or no span is received in the quiet time.
+func (store *Store) getSpans(tenantName string, traceId string, checkTime int64) ([]*apmmodel.OtelSpan, bool) {
+	if store == nil {
+		return nil, false
+	}
+	value, found := store.traces.Load(tenant.Key(tenantName, traceId))
+	if !found {
+		return nil, false
+	}
+	trace := value.(*traceSpans)
+	trace.mutex.Lock()
+	defer trace.mutex.Unlock()
+	spans := make([]*apmmodel.OtelSpan, 0, len(trace.spans))
+	for _, span := range trace.spans {
+		spanCopy := *span
+		spans = append(spans, &spanCopy)
+	}
+	return spans, trace.lastSeen+store.quietTime <= checkTime || isComplete(spans)
+}
+
+// isComplete checks the trace has a root span and the parents of all the spans are received.
+func isComplete(spans []*apmmodel.OtelSpan) bool {
+	spanIds := make(map[string]bool, len(spans))
+	for _, span := range spans {
+		spanIds[span.SpanId] = true
+	}
+	foundRoot := false
+	for _, span := range spans {
+		if span.PSpanId == "" {
+			foundRoot = true
+		} else if !spanIds[span.PSpanId] {
+			return false
+		}
+	}
+	return foundRoot
+}
+
+// QueryServices builds the service nodes of the trace from the pushed spans, nil is returned if no span is received.
+// The partial trace is also returned, ready is false until the trace is complete or no span is received in the quiet time.
+func (store *Store) QueryServices(tenantName string, traceId string) (serviceNodes []*apmmodel.OtelServiceNode, ready bool, err error) {
+	spans, ready := store.getSpans(tenantName, traceId, time.Now().UnixNano())
+	if len(spans) == 0 {
+		return nil, false, nil
+	}
+	serviceNodes, err = BuildServiceNodes(spans)
+	return serviceNodes, ready, err
+}
+
+// BuildServiceNodes relates the spans to the service nodes in the same way as the APM trace backend.
+func BuildServiceNodes(spans []*apmmodel.OtelSpan) ([]*apmmodel.OtelServiceNode, error) {
+	tree := apmmodel.NewOtelTree()
+	for _, span := range spans {
+		if err := tree.AddSpan(span); err != nil {
+			return nil, err
+		}
+	}
+	trace := apmmodel.NewOTelTrace("otel")
+	if err := tree.BuildRelation4Spans(trace); err != nil {
+		return nil, err
+	}
+	return trace.GetServiceNodes(), nil
+}
+
+func (store *Store) checkExpire() {
+	timer := time.NewTicker(1 * time.Second)
+	for {
+		select {
+		case <-timer.C:
+			store.removeExpired(time.Now().Unix())
+		case <-store.stopChan:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (store *Store) removeExpired(checkTime int64) {
+	store.traces.Range(func(k, v interface{}) bool {
+		trace := v.(*traceSpans)
+		trace.mutex.Lock()
+		expired := trace.expireTime < checkTime
+		trace.mutex.Unlock()
+		if expired {
+			if _, loaded := store.traces.LoadAndDelete(k); loaded {
+				StoredTraces.Set(float64(store.traceCount.Add(-1)))
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,94 @@
+package spanstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+
+	apmmodel "github.com/CloudDetail/apo-module/apm/model/v1"
+)
+
+func newSpan(serviceName string, spanId string, parentSpanId string, kind apmmodel.OtelSpanKind) *apmmodel.OtelSpan {
+	span := apmmodel.NewOtelSpan()
+	span.SetServiceName(serviceName)
+	span.SetSpanId(spanId)
+	span.SetParentSpanId(parentSpanId)
+	span.SetKind(kind)
+	span.SetStartTime(1000)
+	span.SetDuration(100)
+	return span
+}
+
+func newTraceSpans() []*apmmodel.OtelSpan {
+	return []*apmmodel.OtelSpan{
+		newSpan("order", "01", "", apmmodel.SpanKindServer),
+		newSpan("order", "02", "01", apmmodel.SpanKindClient),
+		newSpan("stock", "03", "02", apmmodel.SpanKindServer),
+	}
+}
+
+func TestStoreMaxTraces(t *testing.T) {
+	store := NewStore(&config.OtlpConfig{Enable: true, MaxTraces: 1})
+	dropped := testutil.ToFloat64(DroppedSpansTotal)
+
+	assert.Zero(t, store.AddSpans("t1", "trace1", newTraceSpans()[:1]))
+	// The spans of the kept traces are still appended when the store is full.
+	assert.Zero(t, store.AddSpans("t1", "trace1", newTraceSpans()[1:]))
+	assert.Equal(t, 3, store.AddSpans("t1", "trace2", newTraceSpans()))
+	assert.Len(t, store.GetSpans("t1", "trace1"), 3)
+	assert.Nil(t, store.GetSpans("t1", "trace2"))
+	assert.Equal(t, dropped+3, testutil.ToFloat64(DroppedSpansTotal))
+
+	// The expired traces are removed and new traces are accepted again.
+	store.removeExpired(time.Now().Add(time.Hour).Unix())
+	assert.Nil(t, store.GetSpans("t1", "trace1"))
+	assert.Zero(t, store.AddSpans("t1", "trace2", newTraceSpans()))
+}
+
+func TestStoreDisabled(t *testing.T) {
+	var store *Store = NewStore(&config.OtlpConfig{})
+	assert.Nil(t, store)
+	serviceNodes, ready, err := store.QueryServices("t1", "trace1")
+	assert.NoError(t, err)
+	assert.False(t, ready)
+	assert.Nil(t, serviceNodes)
+}
+
+func TestStoreReady(t *testing.T) {
+	store := NewStore(&config.OtlpConfig{Enable: true, SpanQuietTime: time.Minute})
+	spans := newTraceSpans()
+	// The parent of stock is not received yet.
+	store.AddSpans("t1", "trace1", []*apmmodel.OtelSpan{spans[0], spans[2]})
+	now := time.Now().UnixNano()
+	got, ready := store.getSpans("t1", "trace1", now)
+	assert.Len(t, got, 2)
+	assert.False(t, ready)
+
+	// The partial trace is ready after the quiet time.
+	_, ready = store.getSpans("t1", "trace1", now+int64(time.Minute)+1)
+	assert.True(t, ready)
+
+	store.AddSpans("t1", "trace1", spans[1:2])
+	_, ready = store.getSpans("t1", "trace1", now)
+	assert.True(t, ready)
+
+	// The trace without the root span is not complete.
+	store.AddSpans("t1", "trace2", spans[1:])
+	_, ready = store.getSpans("t1", "trace2", now)
+	assert.False(t, ready)
+}
+
+func TestStoreMaxSpans(t *testing.T) {
+	store := NewStore(&config.OtlpConfig{Enable: true, MaxSpansPerTrace: 2})
+	dropped := testutil.ToFloat64(DroppedSpansTotal)
+
+	assert.Zero(t, store.AddSpans("t1", "trace1", newTraceSpans()[:1]))
+	assert.Equal(t, 1, store.AddSpans("t1", "trace1", newTraceSpans()[1:]))
+	assert.Equal(t, 3, store.AddSpans("t1", "trace1", newTraceSpans()))
+	assert.Len(t, store.GetSpans("t1", "trace1"), 2)
+	assert.Equal(t, dropped+4, testutil.ToFloat64(DroppedSpansTotal))
+}
@@ -0,0 +1,133 @@
+package spanstore
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/CloudDetail/apo-module/apm/client/v1/api"
+	"github.com/CloudDetail/apo-module/model/v1"
+
+	apmmodel "github.com/CloudDetail/apo-module/apm/model/v1"
+)
+
+var ErrNoTraceBackend = errors.New("the trace is not found in the span store and analyzer.trace_address is not set")
+
+// TraceClient reads the services of a trace from the span store first and falls back to the APM trace backend,
+// so the traces with pushed spans are analyzed without a remote query.
+type TraceClient struct {
+	store      *Store
+	remoteLock sync.RWMutex
+	remote     api.ApmTraceAPI
+}
+
+// NewTraceClient creates the client, store is nil if OTLP is not enabled and remote is nil if analyzer.trace_address is not set.
+func NewTraceClient(store *Store, remote api.ApmTraceAPI) *TraceClient {
+	return &TraceClient{
+		store:  store,
+		remote: remote,
+	}
+}
+
+// UpdateRemote replaces the client of the APM trace backend, eg. when analyzer.ratio_threshold is reloaded.
+// It is ignored if analyzer.trace_address is not set as the backend can not be added live.
+func (client *TraceClient) UpdateRemote(remote api.ApmTraceAPI) {
+	client.remoteLock.Lock()
+	defer client.remoteLock.Unlock()
+	if client.remote == nil {
+		return
+	}
+	client.remote = remote
+}
+
+func (client *TraceClient) getRemote() api.ApmTraceAPI {
+	client.remoteLock.RLock()
+	defer client.remoteLock.RUnlock()
+	return client.remote
+}
+
+// QueryServices queries the services of the traces pushed without tenant.
+func (client *TraceClient) QueryServices(apmType string, traceId string, startTimeMs uint64) ([]*apmmodel.OtelServiceNode, error) {
+	return client.QueryTenantServices("", apmType, traceId, startTimeMs)
+}
+
+// QueryTenantServices builds the services from the spans pushed by the tenant, the APM trace backend is queried if no span is received.
+func (client *TraceClient) QueryTenantServices(tenantName string, apmType string, traceId string, startTimeMs uint64) ([]*apmmodel.OtelServiceNode, error) {
+	if serviceNodes := client.QueryLocalServices(tenantName, traceId); serviceNodes != nil {
+		return serviceNodes, nil
+	}
+	return client.QueryRemoteServices(apmType, traceId, startTimeMs)
+}
+
+// QueryLocalServices builds the services from the span store, nil is returned if no span of the trace is kept.
+// The trace still receiving spans and not complete is also not returned, so the caller queries the APM trace backend,
+// it is only returned without the APM trace backend as the pushed spans are all the spans known.
+func (client *TraceClient) QueryLocalServices(tenantName string, traceId string) []*apmmodel.OtelServiceNode {
+	if client.store == nil {
+		return nil
+	}
+	serviceNodes, ready, err := client.store.QueryServices(tenantName, traceId)
+	if err != nil {
+		log.Printf("[x Build Local Services] TraceId: %s, Error: %s", traceId, err.Error())
+	}
+	if len(serviceNodes) == 0 {
+		StoreLookupsTotal.WithLabelValues("miss").Inc()
+		return nil
+	}
+	if !ready && client.getRemote() != nil {
+		StoreLookupsTotal.WithLabelValues("incomplete").Inc()
+		return nil
+	}
+	StoreLookupsTotal.WithLabelValues("hit").Inc()
+	return serviceNodes
+}
+
+// QueryRemoteServices queries the services from the APM trace backend only.
+func (client *TraceClient) QueryRemoteServices(apmType string, traceId string, startTimeMs uint64) ([]*apmmodel.OtelServiceNode, error) {
+	remote := client.getRemote()
+	if remote == nil {
+		return nil, ErrNoTraceBackend
+	}
+	return remote.QueryServices(apmType, traceId, startTimeMs)
+}
+
+func (client *TraceClient) QueryTrace(apmType string, traceId string, rootTrace *model.TraceLabels) (*apmmodel.OTelTrace, error) {
+	remote := client.getRemote()
+	if remote == nil {
+		return nil, ErrNoTraceBackend
+	}
+	return remote.QueryTrace(apmType, traceId, rootTrace)
+}
+
+func (client *TraceClient) FillMutatedSpan(apmType string, traceId string, serviceNode *apmmodel.OtelServiceNode) error {
+	remote := client.getRemote()
+	if remote == nil {
+		return ErrNoTraceBackend
+	}
+	return remote.FillMutatedSpan(apmType, traceId, serviceNode)
+}
+
+func (client *TraceClient) QueryMutatedSlowTraceTree(traceId string, traces *model.Traces) (*model.TraceTreeNode, []*model.ApmClientCall, error) {
+	remote := client.getRemote()
+	if remote == nil {
+		return nil, nil, ErrNoTraceBackend
+	}
+	return remote.QueryMutatedSlowTraceTree(traceId, traces)
+}
+
+func (client *TraceClient) QueryErrorTraceTree(traceId string, traces *model.Traces) (*model.ErrorTreeNode, error) {
+	remote := client.getRemote()
+	if remote == nil {
+		return nil, ErrNoTraceBackend
+	}
+	return remote.QueryErrorTraceTree(traceId, traces)
+}
+
+// NeedGetDetailSpan is false without the APM trace backend, the pushed spans are complete.
+func (client *TraceClient) NeedGetDetailSpan(apmType string) bool {
+	remote := client.getRemote()
+	if remote == nil {
+		return false
+	}
+	return remote.NeedGetDetailSpan(apmType)
+}
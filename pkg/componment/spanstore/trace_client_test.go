@@ -0,0 +1,82 @@
+package spanstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-module/apm/client/v1/api"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+
+	apmmodel "github.com/CloudDetail/apo-module/apm/model/v1"
+)
+
+// fakeRemote records the queries sent to the APM trace backend.
+type fakeRemote struct {
+	api.ApmTraceAPI
+	queries []string
+}
+
+func (remote *fakeRemote) QueryServices(apmType string, traceId string, startTimeMs uint64) ([]*apmmodel.OtelServiceNode, error) {
+	remote.queries = append(remote.queries, traceId)
+	return nil, errors.New("apm is down")
+}
+
+func (remote *fakeRemote) NeedGetDetailSpan(apmType string) bool {
+	return apmType == "arms"
+}
+
+func TestTraceClient(t *testing.T) {
+	store := NewStore(&config.OtlpConfig{Enable: true})
+	store.AddSpans("t1", "trace1", newTraceSpans())
+	remote := &fakeRemote{}
+	client := NewTraceClient(store, remote)
+
+	serviceNodes, err := client.QueryTenantServices("t1", "skywalking", "trace1", 0)
+	assert.NoError(t, err)
+	if assert.Len(t, serviceNodes, 1) {
+		assert.Equal(t, "order", serviceNodes[0].EntrySpans[0].ServiceName)
+		assert.Len(t, serviceNodes[0].Children, 1)
+	}
+	assert.Empty(t, remote.queries)
+
+	// The spans of other tenants are not read, the backend is queried.
+	_, err = client.QueryServices("skywalking", "trace1", 0)
+	assert.EqualError(t, err, "apm is down")
+	assert.Equal(t, []string{"trace1"}, remote.queries)
+	assert.True(t, client.NeedGetDetailSpan("arms"))
+
+	// The trace still receiving spans and not complete is queried from the backend.
+	store.AddSpans("t1", "trace2", newTraceSpans()[1:])
+	assert.Nil(t, client.QueryLocalServices("t1", "trace2"))
+	_, err = client.QueryTenantServices("t1", "skywalking", "trace2", 0)
+	assert.EqualError(t, err, "apm is down")
+	assert.Equal(t, []string{"trace1", "trace2"}, remote.queries)
+
+	// The partial trace is used without the backend.
+	assert.NotNil(t, NewTraceClient(store, nil).QueryLocalServices("t1", "trace2"))
+}
+
+func TestTraceClientWithoutRemote(t *testing.T) {
+	client := NewTraceClient(nil, nil)
+	_, err := client.QueryTenantServices("t1", "skywalking", "trace1", 0)
+	assert.ErrorIs(t, err, ErrNoTraceBackend)
+	_, err = client.QueryErrorTraceTree("trace1", nil)
+	assert.ErrorIs(t, err, ErrNoTraceBackend)
+	assert.False(t, client.NeedGetDetailSpan("arms"))
+}
+
+func TestTraceClientUpdateRemote(t *testing.T) {
+	client := NewTraceClient(nil, &fakeRemote{})
+	updated := &fakeRemote{}
+	client.UpdateRemote(updated)
+	_, err := client.QueryRemoteServices("skywalking", "trace1", 0)
+	assert.EqualError(t, err, "apm is down")
+	assert.Equal(t, []string{"trace1"}, updated.queries)
+
+	// The backend is not added live without analyzer.trace_address.
+	client = NewTraceClient(nil, nil)
+	client.UpdateRemote(updated)
+	assert.False(t, client.NeedGetDetailSpan("arms"))
+}
@@ -0,0 +1,176 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/peer"
+
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+const (
+	RejectByNode      = "node"
+	RejectByDataGroup = "data_group"
+	RejectByTenant    = "tenant"
+	RejectByMemory    = "memory"
+
+	// minNodeIdleTime is the min time a node limiter is kept after it is last used.
+	minNodeIdleTime = time.Minute
+)
+
+// ingestLimiter limits the data sent by each agent node and of each data group with token buckets.
+// The limiters of the nodes not seen for nodeIdleTime are removed, as their buckets are refilled to a new one.
+type ingestLimiter struct {
+	nodeQuota     config.RateQuotaConfig
+	nodeLimiters  sync.Map // <node, *nodeLimiter>
+	nodeIdleTime  time.Duration
+	nextExpire    atomic.Int64
+	groupLimiters map[string]*rate.Limiter
+}
+
+type nodeLimiter struct {
+	*rate.Limiter
+	// lastSeen is the unix nanoseconds the limiter is last used.
+	lastSeen atomic.Int64
+}
+
+// ingestReservation gives the tokens back if the data are rejected by the later checks.
+type ingestReservation struct {
+	time         time.Time
+	reservations []*rate.Reservation
+}
+
+func (reservation *ingestReservation) cancel() {
+	if reservation == nil {
+		return
+	}
+	for _, r := range reservation.reservations {
+		r.CancelAt(reservation.time)
+	}
+}
+
+// newIngestLimiter returns nil if no quota is set.
+func newIngestLimiter(cfg *config.RateLimitConfig) *ingestLimiter {
+	limiter := &ingestLimiter{
+		nodeQuota:     cfg.NodeQuota,
+		groupLimiters: make(map[string]*rate.Limiter),
+	}
+	for name, quota := range cfg.DataGroupQuotas {
+		if groupLimiter := newLimiter(quota); groupLimiter != nil {
+			limiter.groupLimiters[name] = groupLimiter
+		}
+	}
+	if cfg.NodeQuota.DataPerSecond <= 0 && len(limiter.groupLimiters) == 0 {
+		return nil
+	}
+	if cfg.NodeQuota.DataPerSecond > 0 {
+		burst := cfg.NodeQuota.Burst
+		if burst <= 0 {
+			burst = max(int(cfg.NodeQuota.DataPerSecond), 1)
+		}
+		limiter.nodeIdleTime = max(time.Duration(float64(burst)/cfg.NodeQuota.DataPerSecond*float64(time.Second)), minNodeIdleTime)
+	}
+	return limiter
+}
+
+func newLimiter(quota config.RateQuotaConfig) *rate.Limiter {
+	if quota.DataPerSecond <= 0 {
+		return nil
+	}
+	burst := quota.Burst
+	if burst <= 0 {
+		burst = max(int(quota.DataPerSecond), 1)
+	}
+	return rate.NewLimiter(rate.Limit(quota.DataPerSecond), burst)
+}
+
+// reserve takes count tokens of node and dataGroup, the reason and the delay to retry are returned if not enough.
+// No token is taken when rejected, the reservation is cancelled if the data are rejected later.
+// The data more than burst take all the tokens, so they are not rejected forever.
+func (limiter *ingestLimiter) reserve(node string, dataGroup string, count int) (*ingestReservation, string, time.Duration) {
+	if limiter == nil || count == 0 {
+		return nil, "", 0
+	}
+	now := time.Now()
+	reservation := &ingestReservation{time: now}
+	if nodeLimiter := limiter.getNodeLimiter(node, now); nodeLimiter != nil {
+		nodeReservation := nodeLimiter.ReserveN(now, min(count, nodeLimiter.Burst()))
+		if delay := nodeReservation.DelayFrom(now); delay > 0 {
+			nodeReservation.CancelAt(now)
+			return nil, RejectByNode, delay
+		}
+		reservation.reservations = append(reservation.reservations, nodeReservation)
+	}
+	if groupLimiter, found := limiter.groupLimiters[dataGroup]; found {
+		groupReservation := groupLimiter.ReserveN(now, min(count, groupLimiter.Burst()))
+		if delay := groupReservation.DelayFrom(now); delay > 0 {
+			groupReservation.CancelAt(now)
+			reservation.cancel()
+			return nil, RejectByDataGroup, delay
+		}
+		reservation.reservations = append(reservation.reservations, groupReservation)
+	}
+	return reservation, "", 0
+}
+
+func (limiter *ingestLimiter) getNodeLimiter(node string, now time.Time) *nodeLimiter {
+	if limiter.nodeQuota.DataPerSecond <= 0 {
+		return nil
+	}
+	limiter.checkExpire(now)
+	found, ok := limiter.nodeLimiters.Load(node)
+	if !ok {
+		found, _ = limiter.nodeLimiters.LoadOrStore(node, &nodeLimiter{Limiter: newLimiter(limiter.nodeQuota)})
+	}
+	nodeLimiter := found.(*nodeLimiter)
+	nodeLimiter.lastSeen.Store(now.UnixNano())
+	return nodeLimiter
+}
+
+// checkExpire removes the idle node limiters at most once per nodeIdleTime.
+func (limiter *ingestLimiter) checkExpire(now time.Time) {
+	next := limiter.nextExpire.Load()
+	if now.UnixNano() < next || !limiter.nextExpire.CompareAndSwap(next, now.Add(limiter.nodeIdleTime).UnixNano()) {
+		return
+	}
+	limiter.removeExpired(now)
+}
+
+// removeExpired removes the node limiters not used for nodeIdleTime before checkTime.
+func (limiter *ingestLimiter) removeExpired(checkTime time.Time) {
+	expireTime := checkTime.Add(-limiter.nodeIdleTime).UnixNano()
+	limiter.nodeLimiters.Range(func(k, v interface{}) bool {
+		if v.(*nodeLimiter).lastSeen.Load() < expireTime {
+			limiter.nodeLimiters.Delete(k)
+		}
+		return true
+	})
+}
+
+// getNode returns the key of the node bucket, which is the peer host of the agent namespaced by the cluster and tenant of its token.
+// The node of the identity is not used, as it is the x-apo-node metadata sent by the agent if the token has no node,
+// so the agent could take a new bucket by changing the metadata.
+func getNode(ctx context.Context) string {
+	host := getPeerHost(ctx)
+	if identity := auth.FromContext(ctx); identity != nil {
+		return fmt.Sprintf("%s/%s/%s", identity.Cluster, identity.Tenant, host)
+	}
+	return host
+}
+
+func getPeerHost(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return ""
+}
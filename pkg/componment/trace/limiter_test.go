@@ -0,0 +1,93 @@
+package trace
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/peer"
+
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+func TestIngestLimiter(t *testing.T) {
+	assert.Nil(t, newIngestLimiter(&config.RateLimitConfig{}))
+	var nilLimiter *ingestLimiter
+	_, reason, _ := nilLimiter.reserve("node1", "flame_graph", 100)
+	assert.Equal(t, "", reason)
+
+	limiter := newIngestLimiter(&config.RateLimitConfig{
+		NodeQuota: config.RateQuotaConfig{DataPerSecond: 0.001, Burst: 10},
+		DataGroupQuotas: map[string]config.RateQuotaConfig{
+			"flame_graph": {DataPerSecond: 0.001, Burst: 15},
+		},
+	})
+
+	_, reason, _ = limiter.reserve("node1", "flame_graph", 8)
+	assert.Equal(t, "", reason)
+	_, reason, delay := limiter.reserve("node1", "flame_graph", 8)
+	assert.Equal(t, RejectByNode, reason)
+	assert.Greater(t, delay.Seconds(), 0.0)
+
+	// The tokens of node2 are given back as the data group is exhausted.
+	_, reason, _ = limiter.reserve("node2", "flame_graph", 8)
+	assert.Equal(t, RejectByDataGroup, reason)
+	_, reason, _ = limiter.reserve("node2", "jvm_gc", 10)
+	assert.Equal(t, "", reason)
+}
+
+func TestIngestReservationCancel(t *testing.T) {
+	limiter := newIngestLimiter(&config.RateLimitConfig{
+		NodeQuota: config.RateQuotaConfig{DataPerSecond: 0.001, Burst: 10},
+		DataGroupQuotas: map[string]config.RateQuotaConfig{
+			"flame_graph": {DataPerSecond: 0.001, Burst: 10},
+		},
+	})
+	reservation, reason, _ := limiter.reserve("node1", "flame_graph", 10)
+	assert.Equal(t, "", reason)
+	reservation.cancel()
+
+	// Both the node and the data group tokens are given back.
+	_, reason, _ = limiter.reserve("node1", "flame_graph", 10)
+	assert.Equal(t, "", reason)
+}
+
+func TestIngestLimiterRemoveExpired(t *testing.T) {
+	limiter := newIngestLimiter(&config.RateLimitConfig{
+		NodeQuota: config.RateQuotaConfig{DataPerSecond: 1, Burst: 300},
+	})
+	// The idle time covers the refill of the burst.
+	assert.Equal(t, 5*time.Minute, limiter.nodeIdleTime)
+
+	now := time.Now()
+	limiter.getNodeLimiter("node1", now)
+	limiter.getNodeLimiter("node2", now.Add(time.Minute))
+	limiter.removeExpired(now.Add(5*time.Minute + time.Second))
+	_, found := limiter.nodeLimiters.Load("node1")
+	assert.False(t, found)
+	_, found = limiter.nodeLimiters.Load("node2")
+	assert.True(t, found)
+
+	limiter = newIngestLimiter(&config.RateLimitConfig{
+		NodeQuota: config.RateQuotaConfig{DataPerSecond: 100},
+	})
+	assert.Equal(t, minNodeIdleTime, limiter.nodeIdleTime)
+}
+
+func TestGetNode(t *testing.T) {
+	peerCtx := func(ip string) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 8080}})
+	}
+	assert.Equal(t, "10.0.0.1", getNode(peerCtx("10.0.0.1")))
+
+	// The node of the identity may be the x-apo-node metadata, changing it does not take a new bucket.
+	node1 := getNode(auth.NewContext(peerCtx("10.0.0.1"), &auth.Identity{Cluster: "c1", Tenant: "t1", Node: "n1"}))
+	node2 := getNode(auth.NewContext(peerCtx("10.0.0.1"), &auth.Identity{Cluster: "c1", Tenant: "t1", Node: "n2"}))
+	assert.Equal(t, "c1/t1/10.0.0.1", node1)
+	assert.Equal(t, node1, node2)
+	assert.NotEqual(t, node1, getNode(auth.NewContext(peerCtx("10.0.0.2"), &auth.Identity{Cluster: "c1", Tenant: "t1", Node: "n1"})))
+	assert.NotEqual(t, node1, getNode(auth.NewContext(peerCtx("10.0.0.1"), &auth.Identity{Cluster: "c1", Tenant: "t2", Node: "n1"})))
+}
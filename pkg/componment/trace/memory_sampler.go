@@ -11,6 +11,7 @@ import (
 )
 
 type MemorySampler struct {
+	rangeLock    sync.RWMutex // Guard the reloadable MinSample, InitSample, MaxSample and ResetPeriod.
 	MinSample    int64
 	InitSample   int64
 	MaxSample    int64
@@ -33,6 +34,33 @@ func NewMemorySampler(minSample int64, initSample int64, maxSample int64, resetP
 	}
 }
 
+// UpdateSampleRange applies the reloaded sample settings, the current sample value is kept in the new range.
+func (sampler *MemorySampler) UpdateSampleRange(minSample int64, initSample int64, maxSample int64, resetPeriod int64) {
+	sampler.rangeLock.Lock()
+	defer sampler.rangeLock.Unlock()
+	sampler.MinSample = minSample
+	sampler.InitSample = initSample
+	sampler.MaxSample = maxSample
+	sampler.ResetPeriod = resetPeriod
+
+	sampleValue := sampler.SampleValue.Load()
+	if sampleValue < minSample || sampleValue > maxSample {
+		newValue := minSample
+		if sampleValue > maxSample {
+			newValue = maxSample
+		}
+		sampler.SampleValue.Store(newValue)
+		global.CACHE.SetSampleValue(newValue, resetPeriod)
+		log.Printf("[Reload SampleValue] %d => %d", sampleValue, newValue)
+	}
+}
+
+func (sampler *MemorySampler) getSampleRange() (minSample int64, initSample int64, maxSample int64, resetPeriod int64) {
+	sampler.rangeLock.RLock()
+	defer sampler.rangeLock.RUnlock()
+	return sampler.MinSample, sampler.InitSample, sampler.MaxSample, sampler.ResetPeriod
+}
+
 func (sampler *MemorySampler) GetSampleValue(metric *model.SampleMetric) *model.SampleResult {
 	var nodeMemories *NodeMemories
 	if cachedMemories, ok := sampler.NodeMemories.Load(metric.NodeIp); ok {
@@ -48,17 +76,22 @@ func (sampler *MemorySampler) GetSampleValue(metric *model.SampleMetric) *model.
 	}
 }
 
-func (sampler *MemorySampler) CalcSampleValue() {
+// CalcSampleValue checks the sample value periodically until stopChan is closed.
+func (sampler *MemorySampler) CalcSampleValue(stopChan <-chan struct{}) {
 	timer := time.NewTicker(2 * time.Second)
 	for {
 		select {
 		case <-timer.C:
 			sampler.CheckSampleValue()
+		case <-stopChan:
+			timer.Stop()
+			return
 		}
 	}
 }
 
 func (sampler *MemorySampler) CheckSampleValue() {
+	minSample, initSample, maxSample, resetPeriod := sampler.getSampleRange()
 	exceedLimit := false
 	sampleChanged := false
 
@@ -68,7 +101,7 @@ func (sampler *MemorySampler) CheckSampleValue() {
 		sampleChanged = true
 		sampler.SampleValue.Store(sampleValue)
 		log.Printf("[Update SampleValue] %d => %d", localSampleValue, sampleValue)
-	} else if sampleValue < sampler.MaxSample {
+	} else if sampleValue < maxSample {
 		sampler.NodeMemories.Range(func(k, v interface{}) bool {
 			exceedMemoryLimit, sampled := v.(*NodeMemories).SetNewSampleValue()
 			if sampled {
@@ -80,29 +113,29 @@ func (sampler *MemorySampler) CheckSampleValue() {
 			return true
 		})
 
-		if exceedLimit && !sampleChanged && sampleValue < sampler.InitSample {
+		if exceedLimit && !sampleChanged && sampleValue < initSample {
 			// 1 / 16
-			sampleValue = sampler.InitSample
+			sampleValue = initSample
 			sampleChanged = true
-		} else if sampleChanged && sampleValue <= sampler.MaxSample {
+		} else if sampleChanged && sampleValue <= maxSample {
 			sampleValue += 1
 		}
 
 		if sampleChanged {
 			sampler.SampleValue.Store(sampleValue)
-			global.CACHE.SetSampleValue(sampleValue, sampler.ResetPeriod)
+			global.CACHE.SetSampleValue(sampleValue, resetPeriod)
 
 			log.Printf("[Set SampleValue] %d => %d", localSampleValue, sampleValue)
 		}
 	}
 
 	if global.CACHE.LockAndCheckSampleTime() {
-		if sampleValue > sampler.MinSample {
+		if sampleValue > minSample {
 			sampleValue -= 1
 			sampleChanged = true
 		}
 		sampler.SampleValue.Store(sampleValue)
-		global.CACHE.SetSampleValue(sampleValue, sampler.ResetPeriod)
+		global.CACHE.SetSampleValue(sampleValue, resetPeriod)
 
 		log.Printf("[Recover SampleValue] %d => %d", localSampleValue, sampleValue)
 	}
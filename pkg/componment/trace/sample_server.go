@@ -2,6 +2,8 @@ package trace
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/CloudDetail/apo-receiver/pkg/model"
@@ -9,19 +11,34 @@ import (
 
 type SampleServer struct {
 	model.UnimplementedSampleServiceServer
-	enable  bool
+	enable  atomic.Bool
 	sampler *MemorySampler
+	lock    sync.Mutex
+	// stopChan stops the running sampler, nil if the sampler is not running.
+	stopChan chan struct{}
 }
 
 func NewSampleServer(enable bool, minSample int64, initSample int64, maxSample int64, resetPeriod time.Duration) *SampleServer {
-	return &SampleServer{
-		enable:  enable,
+	server := &SampleServer{
 		sampler: NewMemorySampler(minSample, initSample, maxSample, int64(resetPeriod.Seconds())),
 	}
+	server.enable.Store(enable)
+	return server
+}
+
+// UpdateConfig applies the reloaded sample settings, the sampler is started when it is enabled and stopped when it is disabled.
+func (server *SampleServer) UpdateConfig(enable bool, minSample int64, initSample int64, maxSample int64, resetPeriod time.Duration) {
+	server.sampler.UpdateSampleRange(minSample, initSample, maxSample, int64(resetPeriod.Seconds()))
+	server.enable.Store(enable)
+	if enable {
+		server.Start()
+	} else {
+		server.Stop()
+	}
 }
 
 func (server *SampleServer) GetSampleValue(ctx context.Context, metric *model.SampleMetric) (*model.SampleResult, error) {
-	if server.enable {
+	if server.enable.Load() {
 		return server.sampler.GetSampleValue(metric), nil
 	}
 	return &model.SampleResult{
@@ -29,8 +46,29 @@ func (server *SampleServer) GetSampleValue(ctx context.Context, metric *model.Sa
 	}, nil
 }
 
+// Start runs the sampler if it is enabled and not running.
 func (server *SampleServer) Start() {
-	if server.enable {
-		go server.sampler.CalcSampleValue()
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if server.enable.Load() && server.stopChan == nil {
+		server.stopChan = make(chan struct{})
+		go server.sampler.CalcSampleValue(server.stopChan)
+	}
+}
+
+// Stop stops the running sampler, it can be started again.
+func (server *SampleServer) Stop() {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if server.stopChan != nil {
+		close(server.stopChan)
+		server.stopChan = nil
 	}
 }
+
+// running returns whether the sampler is running.
+func (server *SampleServer) running() bool {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.stopChan != nil
+}
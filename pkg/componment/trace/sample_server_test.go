@@ -0,0 +1,32 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/componment/redis"
+	"github.com/CloudDetail/apo-receiver/pkg/global"
+)
+
+func TestSampleServerUpdateConfig(t *testing.T) {
+	global.CACHE = redis.NewLocalCache(60)
+	server := NewSampleServer(false, 0, 1, 10, time.Hour)
+	server.Start()
+	assert.False(t, server.running())
+
+	server.UpdateConfig(true, 0, 1, 10, time.Hour)
+	assert.True(t, server.running())
+	// Enabled again, the running sampler is kept.
+	server.UpdateConfig(true, 0, 1, 8, time.Hour)
+	assert.True(t, server.running())
+
+	server.UpdateConfig(false, 0, 1, 8, time.Hour)
+	assert.False(t, server.running())
+	// Disabled sampler can be enabled again by the next reload.
+	server.UpdateConfig(true, 0, 1, 8, time.Hour)
+	assert.True(t, server.running())
+	server.Stop()
+	assert.False(t, server.running())
+}
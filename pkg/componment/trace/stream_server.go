@@ -0,0 +1,172 @@
+package trace
+
+import (
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	grpc_model "github.com/CloudDetail/apo-receiver/pkg/model"
+)
+
+const (
+	defaultStreamWindow      = 100
+	defaultStreamAckInterval = time.Second
+)
+
+var (
+	OpenStreams = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "originx_receiver_data_group_streams",
+			Help: "The number of open StreamDataGroups streams",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(OpenStreams)
+}
+
+type recvResult struct {
+	message *grpc_model.DataGroupsMessage
+	err     error
+}
+
+// streamState is the progress of one stream, it is only accessed by the handler goroutine.
+type streamState struct {
+	lastSeq  uint64
+	ackedSeq uint64
+	// pendings are the messages received but not flushed, in seq order.
+	pendings []pendingMessage
+	// flushed is the messages flushed since the last ack.
+	flushed uint32
+}
+
+// pendingMessage is flushed when the flush of generation is done, 0 means there is nothing to flush.
+type pendingMessage struct {
+	seq        uint64
+	generation uint64
+}
+
+// StreamDataGroups queues the data groups in order and acks them once they are written or spooled by the flush,
+// every ack_interval or when half of the window is flushed. The traces are acked once they are cached for the analyzer.
+// The stream is ended with the final ack followed by the status when the data groups are rejected,
+// so the agent can resend the messages after acked_seq on a new stream, the messages not flushed yet may be received twice.
+func (server *TraceServer) StreamDataGroups(stream grpc_model.TraceService_StreamDataGroupsServer) error {
+	OpenStreams.Inc()
+	defer OpenStreams.Dec()
+
+	ctx := stream.Context()
+	state := &streamState{}
+	// Tell the agent the window before it sends.
+	if err := server.sendAck(stream, state); err != nil {
+		return err
+	}
+
+	// Recv blocks, so it is called in another goroutine to end the stream when the receiver is shutting down.
+	recvChan := make(chan recvResult)
+	go func() {
+		for {
+			message, err := stream.Recv()
+			select {
+			case recvChan <- recvResult{message: message, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(server.streamAckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case result := <-recvChan:
+			if result.err != nil {
+				// io.EOF if the agent closes the stream, or the stream is broken.
+				return server.endStream(stream, state, nil)
+			}
+			if err := server.storeStreamMessage(stream, state, result.message); err != nil {
+				return server.endStream(stream, state, err)
+			}
+			if server.advance(state) >= (server.streamWindow+1)/2 {
+				if err := server.sendAck(stream, state); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if server.advance(state) > 0 {
+				if err := server.sendAck(stream, state); err != nil {
+					return err
+				}
+			}
+		case <-server.closing:
+			return server.endStream(stream, state, status.Error(codes.Unavailable, "receiver is shutting down"))
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (server *TraceServer) storeStreamMessage(stream grpc_model.TraceService_StreamDataGroupsServer, state *streamState, message *grpc_model.DataGroupsMessage) error {
+	if message.Seq == 0 || (state.lastSeq > 0 && message.Seq != state.lastSeq+1) {
+		return status.Errorf(codes.InvalidArgument, "seq must be %d, got %d", state.lastSeq+1, message.Seq)
+	}
+	if uint32(len(state.pendings))+state.flushed >= server.streamWindow {
+		return status.Errorf(codes.FailedPrecondition, "window %d is exceeded", server.streamWindow)
+	}
+	pending := pendingMessage{seq: message.Seq}
+	if message.DataGroups != nil {
+		if err := server.storeDataGroups(stream.Context(), message.DataGroups); err != nil {
+			return err
+		}
+		// Read after the data groups are cached, so the flush of the generation takes them.
+		pending.generation = server.store.FlushGeneration()
+	}
+	state.lastSeq = message.Seq
+	state.pendings = append(state.pendings, pending)
+	return nil
+}
+
+// advance moves ackedSeq to the last message flushed in seq order, the messages flushed since the last ack are returned.
+func (server *TraceServer) advance(state *streamState) uint32 {
+	for len(state.pendings) > 0 {
+		pending := state.pendings[0]
+		if pending.generation > 0 && !server.store.Flushed(pending.generation) {
+			break
+		}
+		state.ackedSeq = pending.seq
+		state.pendings = state.pendings[1:]
+		state.flushed++
+	}
+	return state.flushed
+}
+
+func (server *TraceServer) sendAck(stream grpc_model.TraceService_StreamDataGroupsServer, state *streamState) error {
+	if err := stream.Send(&grpc_model.DataGroupsAck{AckedSeq: state.ackedSeq, Window: server.streamWindow}); err != nil {
+		return err
+	}
+	state.flushed = 0
+	return nil
+}
+
+// endStream acks the flushed messages before returning err.
+func (server *TraceServer) endStream(stream grpc_model.TraceService_StreamDataGroupsServer, state *streamState, err error) error {
+	if server.advance(state) > 0 {
+		if ackErr := server.sendAck(stream, state); ackErr != nil {
+			log.Printf("[x Ack Stream] Seq: %d, Error: %s", state.ackedSeq, ackErr.Error())
+		}
+	}
+	return err
+}
+
+// CloseStreams ends the open streams with UNAVAILABLE, otherwise the graceful stop waits for them until timeout.
+func (server *TraceServer) CloseStreams() {
+	server.closeOnce.Do(func() {
+		close(server.closing)
+	})
+}
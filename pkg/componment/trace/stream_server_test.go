@@ -0,0 +1,182 @@
+package trace
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/CloudDetail/apo-module/model/v1"
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+	grpc_model "github.com/CloudDetail/apo-receiver/pkg/model"
+)
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	messages []*grpc_model.DataGroupsMessage
+	acks     []*grpc_model.DataGroupsAck
+}
+
+func (stream *fakeStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *fakeStream) Send(ack *grpc_model.DataGroupsAck) error {
+	stream.acks = append(stream.acks, ack)
+	return nil
+}
+
+func (stream *fakeStream) Recv() (*grpc_model.DataGroupsMessage, error) {
+	if len(stream.messages) == 0 {
+		return nil, io.EOF
+	}
+	message := stream.messages[0]
+	stream.messages = stream.messages[1:]
+	return message, nil
+}
+
+func newMessages(seqs ...uint64) []*grpc_model.DataGroupsMessage {
+	messages := make([]*grpc_model.DataGroupsMessage, 0, len(seqs))
+	for _, seq := range seqs {
+		messages = append(messages, &grpc_model.DataGroupsMessage{Seq: seq})
+	}
+	return messages
+}
+
+func TestStreamDataGroups(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []*grpc_model.DataGroupsMessage
+		code     codes.Code
+		acked    []uint64
+	}{
+		{"empty stream", nil, codes.OK, []uint64{0}},
+		{"ack by half window", newMessages(5, 6, 7), codes.OK, []uint64{0, 6, 7}},
+		{"zero seq", newMessages(0), codes.InvalidArgument, []uint64{0}},
+		{"seq gap", newMessages(1, 2, 4), codes.InvalidArgument, []uint64{0, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewTraceServer(nil, nil, &config.RateLimitConfig{}, &config.StreamConfig{Window: 4})
+			stream := &fakeStream{ctx: context.Background(), messages: tt.messages}
+			err := server.StreamDataGroups(stream)
+			assert.Equal(t, tt.code, status.Code(err))
+
+			acked := make([]uint64, 0, len(stream.acks))
+			for _, ack := range stream.acks {
+				assert.Equal(t, uint32(4), ack.Window)
+				acked = append(acked, ack.AckedSeq)
+			}
+			assert.Equal(t, tt.acked, acked)
+		})
+	}
+}
+
+// fakeStore caches the datas until flush is called, or flushes flushAt cached datas before caching more.
+// The flush is called by the stream loop, so it is not raced with the stream.
+type fakeStore struct {
+	cached       []string
+	flushed      []string
+	flushStarted uint64
+	flushDone    uint64
+	cacheFull    bool
+	flushAt      int
+}
+
+func (store *fakeStore) BatchStore(tenantName string, table string, datas []string) {
+	if store.flushAt > 0 && len(store.cached) >= store.flushAt {
+		store.flush()
+	}
+	store.cached = append(store.cached, datas...)
+}
+
+func (store *fakeStore) StoreTraceGroup(trace *model.Trace, identity *auth.Identity) {
+}
+
+func (store *fakeStore) CacheFull() bool {
+	return store.cacheFull
+}
+
+func (store *fakeStore) FlushPeriod() time.Duration {
+	return 5 * time.Second
+}
+
+func (store *fakeStore) FlushGeneration() uint64 {
+	return store.flushStarted + 1
+}
+
+func (store *fakeStore) Flushed(generation uint64) bool {
+	return store.flushDone >= generation
+}
+
+func (store *fakeStore) flush() {
+	store.flushStarted++
+	store.flushed = append(store.flushed, store.cached...)
+	store.cached = nil
+	store.flushDone = store.flushStarted
+}
+
+func newDataMessage(seq uint64, data string) *grpc_model.DataGroupsMessage {
+	return &grpc_model.DataGroupsMessage{Seq: seq, DataGroups: &grpc_model.DataGroups{Name: "profile", Datas: []string{data}}}
+}
+
+func TestStreamAckFlushed(t *testing.T) {
+	// 1 ~ 2 are flushed when 3 is received, only the initial ack is sent until then.
+	store := &fakeStore{flushAt: 2}
+	server := NewTraceServer(nil, nil, &config.RateLimitConfig{}, &config.StreamConfig{Window: 4})
+	server.store = store
+	stream := &fakeStream{
+		ctx: context.Background(),
+		messages: []*grpc_model.DataGroupsMessage{
+			newDataMessage(1, "a"), newDataMessage(2, "b"), newDataMessage(3, "c"),
+		},
+	}
+	assert.NoError(t, server.StreamDataGroups(stream))
+
+	acked := make([]uint64, 0, len(stream.acks))
+	for _, ack := range stream.acks {
+		acked = append(acked, ack.AckedSeq)
+	}
+	// 1 ~ 2 are acked after the flush, the final ack is not sent as 3 is not flushed.
+	assert.Equal(t, []uint64{0, 2}, acked)
+	assert.Equal(t, []string{"a", "b"}, store.flushed)
+	assert.Equal(t, []string{"c"}, store.cached)
+}
+
+func TestStreamWindowExceeded(t *testing.T) {
+	server := NewTraceServer(nil, nil, &config.RateLimitConfig{}, &config.StreamConfig{Window: 1})
+	state := &streamState{}
+	stream := &fakeStream{ctx: context.Background()}
+	assert.NoError(t, server.storeStreamMessage(stream, state, &grpc_model.DataGroupsMessage{Seq: 1}))
+	err := server.storeStreamMessage(stream, state, &grpc_model.DataGroupsMessage{Seq: 2})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestCloseStreams(t *testing.T) {
+	server := NewTraceServer(nil, nil, &config.RateLimitConfig{}, &config.StreamConfig{})
+	server.CloseStreams()
+	server.CloseStreams()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &blockingStream{fakeStream: fakeStream{ctx: ctx}}
+	err := server.StreamDataGroups(stream)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+// blockingStream receives nothing until the stream is ended.
+type blockingStream struct {
+	fakeStream
+}
+
+func (stream *blockingStream) Recv() (*grpc_model.DataGroupsMessage, error) {
+	<-stream.ctx.Done()
+	return nil, stream.ctx.Err()
+}
@@ -4,15 +4,24 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/CloudDetail/apo-module/model/v1"
 	"github.com/CloudDetail/apo-receiver/pkg/analyzer"
 	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
 	"github.com/CloudDetail/apo-receiver/pkg/global"
 	grpc_model "github.com/CloudDetail/apo-receiver/pkg/model"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
 )
 
 var (
@@ -23,33 +32,94 @@ var (
 		},
 		[]string{"type"},
 	)
+	RejectMessageTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_rejected_message_total",
+			Help: "The total number of message rejected with RESOURCE_EXHAUSTED",
+		},
+		[]string{"type", "reason"},
+	)
 )
 
 func init() {
-	prometheus.MustRegister(ReceiveMessageTotal)
+	prometheus.MustRegister(ReceiveMessageTotal, RejectMessageTotal)
+}
+
+// tenantRetryDelay is the retry hint when the quota of the tenant is exceeded, the quotas are refilled per second.
+const tenantRetryDelay = time.Second
+
+// dataStore caches the data groups until they are flushed, it is global.CLICK_HOUSE.
+type dataStore interface {
+	BatchStore(tenantName string, table string, datas []string)
+	StoreTraceGroup(trace *model.Trace, identity *auth.Identity)
+	CacheFull() bool
+	FlushPeriod() time.Duration
+	FlushGeneration() uint64
+	Flushed(generation uint64) bool
 }
 
 type TraceServer struct {
 	grpc_model.UnimplementedTraceServiceServer
-	analyzer *analyzer.ReportAnalyzer
+	analyzer          *analyzer.ReportAnalyzer
+	store             dataStore
+	quotas            *tenant.Quotas
+	limiter           *ingestLimiter
+	streamWindow      uint32
+	streamAckInterval time.Duration
+	// closing is closed to end the streams when the receiver is shutting down.
+	closing   chan struct{}
+	closeOnce sync.Once
 }
 
-func NewTraceServer(analyzer *analyzer.ReportAnalyzer) *TraceServer {
-	return &TraceServer{
-		analyzer: analyzer,
+func NewTraceServer(analyzer *analyzer.ReportAnalyzer, quotas *tenant.Quotas, rateLimitCfg *config.RateLimitConfig, streamCfg *config.StreamConfig) *TraceServer {
+	server := &TraceServer{
+		analyzer:          analyzer,
+		store:             global.CLICK_HOUSE,
+		quotas:            quotas,
+		limiter:           newIngestLimiter(rateLimitCfg),
+		streamWindow:      streamCfg.Window,
+		streamAckInterval: streamCfg.AckInterval,
+		closing:           make(chan struct{}),
+	}
+	if server.streamWindow == 0 {
+		server.streamWindow = defaultStreamWindow
+	}
+	if server.streamAckInterval == 0 {
+		server.streamAckInterval = defaultStreamAckInterval
 	}
+	return server
 }
 
-func (server *TraceServer) StoreDataGroups(_ context.Context, dataGroups *grpc_model.DataGroups) (*emptypb.Empty, error) {
+func (server *TraceServer) StoreDataGroups(ctx context.Context, dataGroups *grpc_model.DataGroups) (*emptypb.Empty, error) {
+	if err := server.storeDataGroups(ctx, dataGroups); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// storeDataGroups queues the data groups sent by both StoreDataGroups and StreamDataGroups.
+func (server *TraceServer) storeDataGroups(ctx context.Context, dataGroups *grpc_model.DataGroups) error {
+	identity := auth.FromContext(ctx)
+	tenantName := identity.GetTenant()
+	if err := server.admit(ctx, tenantName, dataGroups); err != nil {
+		return err
+	}
 	if dataGroups.Name == report.OnOffMetricGroup {
 		for _, data := range dataGroups.Datas {
-			server.analyzer.CacheMetric(data)
+			server.analyzer.CacheMetric(data, identity)
+		}
+		for _, metric := range dataGroups.GetOnoffMetrics().GetMetrics() {
+			server.analyzer.CacheOnOffMetric(metric.ToOnOffMetricGroup(), identity)
 		}
 		// OnOffMetric
-		global.CLICK_HOUSE.BatchStore(dataGroups.Name, dataGroups.Datas)
+		server.store.BatchStore(tenantName, dataGroups.Name, dataGroups.Datas)
+		server.store.BatchStore(tenantName, dataGroups.Name, onOffMetricJsons(dataGroups.GetOnoffMetrics().GetMetrics()))
 	} else if dataGroups.Name == report.SpanTraceGroup {
 		for _, data := range dataGroups.Datas {
-			server.analyzer.CacheTrace(data)
+			server.analyzer.CacheTrace(data, identity)
+		}
+		for _, trace := range dataGroups.GetTraces().GetTraces() {
+			server.analyzer.CacheSpanTrace(trace.ToTrace(), identity)
 		}
 	} else if dataGroups.Name == report.DesignatedProfilingSignal {
 		// Same with the structure of SpanTraceGroup but lacked trace labels,
@@ -60,16 +130,58 @@ func (server *TraceServer) StoreDataGroups(_ context.Context, dataGroups *grpc_m
 				log.Printf("[x Parse Profile Signal] Error: %s", err.Error())
 				continue
 			}
-			global.CLICK_HOUSE.StoreTraceGroup(signal)
+			server.store.StoreTraceGroup(signal, identity)
 		}
 	} else {
 		// Profile、Log
-		global.CLICK_HOUSE.BatchStore(dataGroups.Name, dataGroups.Datas)
+		server.store.BatchStore(tenantName, dataGroups.Name, dataGroups.Datas)
 	}
-	if len(dataGroups.Datas) > 0 {
+	if dataGroups.Count() > 0 {
 		ReceiveMessageTotal.WithLabelValues(dataGroups.Name).Inc()
 	}
-	return &emptypb.Empty{}, nil
+	return nil
+}
+
+// admit checks the memory budget, the rate limits and the quota of the tenant in order,
+// the agents are expected to back off by the RetryInfo of the returned RESOURCE_EXHAUSTED.
+func (server *TraceServer) admit(ctx context.Context, tenantName string, dataGroups *grpc_model.DataGroups) error {
+	if server.store.CacheFull() {
+		return reject(dataGroups.Name, RejectByMemory, server.store.FlushPeriod(), "cache of the receiver is full")
+	}
+	node := getNode(ctx)
+	reservation, reason, delay := server.limiter.reserve(node, dataGroups.Name, dataGroups.Count())
+	if reason != "" {
+		return reject(dataGroups.Name, reason, delay, "rate limit of %s is exceeded, node: %s", reason, node)
+	}
+	if !server.quotas.Allow(tenantName, dataGroups.Name, dataGroups.Count()) {
+		// The tokens of the node and the data group are given back, so the rejected data are not counted twice when resent.
+		reservation.cancel()
+		return reject(dataGroups.Name, RejectByTenant, tenantRetryDelay, "quota of tenant %q is exceeded", tenantName)
+	}
+	return nil
+}
+
+// onOffMetricJsons converts the typed metrics to the rows of onoff_metric, the json tags are the same with the proto names.
+func onOffMetricJsons(metrics []*grpc_model.OnOffMetric) []string {
+	if len(metrics) == 0 {
+		return nil
+	}
+	datas := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		if data, err := json.Marshal(metric); err == nil {
+			datas = append(datas, string(data))
+		}
+	}
+	return datas
+}
+
+func reject(dataGroup string, reason string, retryDelay time.Duration, format string, args ...interface{}) error {
+	RejectMessageTotal.WithLabelValues(dataGroup, reason).Inc()
+	st := status.Newf(codes.ResourceExhausted, format, args...)
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
 }
 
 func (server *TraceServer) Start() {
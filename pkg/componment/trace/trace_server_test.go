@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+	grpc_model "github.com/CloudDetail/apo-receiver/pkg/model"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
+)
+
+func newDataGroups(count int) *grpc_model.DataGroups {
+	datas := make([]string, count)
+	for i := range datas {
+		datas[i] = "data"
+	}
+	return &grpc_model.DataGroups{Name: "flame_graph", Datas: datas}
+}
+
+// assertRetryDelay checks err is RESOURCE_EXHAUSTED with the retry delay.
+func assertRetryDelay(t *testing.T, err error, retryDelay time.Duration) {
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		assert.InDelta(t, retryDelay, st.Details()[0].(*errdetails.RetryInfo).RetryDelay.AsDuration(), float64(10*time.Millisecond))
+	}
+}
+
+func TestAdmitCacheFull(t *testing.T) {
+	store := &fakeStore{cacheFull: true}
+	server := NewTraceServer(nil, nil, &config.RateLimitConfig{}, &config.StreamConfig{})
+	server.store = store
+
+	_, err := server.StoreDataGroups(context.Background(), newDataGroups(1))
+	assertRetryDelay(t, err, store.FlushPeriod())
+	assert.Empty(t, store.cached)
+
+	store.cacheFull = false
+	_, err = server.StoreDataGroups(context.Background(), newDataGroups(1))
+	assert.NoError(t, err)
+	assert.Len(t, store.cached, 1)
+}
+
+func TestAdmitRateLimit(t *testing.T) {
+	server := NewTraceServer(nil, nil, &config.RateLimitConfig{
+		NodeQuota: config.RateQuotaConfig{DataPerSecond: 1, Burst: 10},
+	}, &config.StreamConfig{})
+	server.store = &fakeStore{}
+	ctx := auth.NewContext(context.Background(), &auth.Identity{Node: "node1"})
+
+	assert.NoError(t, server.admit(ctx, "", newDataGroups(10)))
+	err := server.admit(ctx, "", newDataGroups(5))
+	assertRetryDelay(t, err, 5*time.Second)
+}
+
+func TestAdmitTenantQuota(t *testing.T) {
+	quotas, err := tenant.NewQuotas(&config.TenantConfig{
+		Quotas: []*config.TenantQuotaConfig{{Tenant: "t1", DataPerSecond: 0.001, Burst: 10}},
+	})
+	assert.NoError(t, err)
+	server := NewTraceServer(nil, quotas, &config.RateLimitConfig{
+		NodeQuota: config.RateQuotaConfig{DataPerSecond: 0.001, Burst: 12},
+	}, &config.StreamConfig{})
+	server.store = &fakeStore{}
+	ctx := auth.NewContext(context.Background(), &auth.Identity{Tenant: "t1", Node: "node1"})
+
+	assert.NoError(t, server.admit(ctx, "t1", newDataGroups(6)))
+	err = server.admit(ctx, "t1", newDataGroups(6))
+	assertRetryDelay(t, err, tenantRetryDelay)
+
+	// The node tokens are given back when the tenant rejects.
+	assert.NoError(t, server.admit(ctx, "", newDataGroups(6)))
+}
@@ -7,13 +7,16 @@ import (
 )
 
 type Config struct {
-	ReceiverCfg   *ReceiverConfig
-	ProfileCfg    *ProfileConfig
-	PrometheusCfg *PrometheusConfig
-	ClickHouseCfg *ClickHouseConfig
-	AnalyzerCfg   *AnalyzerConfig
-	RedisCfg      *RedisConfig
-	K8sCfg        *K8sConfig
+	ReceiverCfg   *ReceiverConfig   `mapstructure:"receiver"`
+	SampleCfg     *SampleConfig     `mapstructure:"sample"`
+	ProfileCfg    *ProfileConfig    `mapstructure:"profile"`
+	PrometheusCfg *PrometheusConfig `mapstructure:"prometheus"`
+	ClickHouseCfg *ClickHouseConfig `mapstructure:"clickhouse"`
+	AnalyzerCfg   *AnalyzerConfig   `mapstructure:"analyzer"`
+	RedisCfg      *RedisConfig      `mapstructure:"redis"`
+	K8sCfg        *K8sConfig        `mapstructure:"k8s"`
+	TenantCfg     *TenantConfig     `mapstructure:"tenant"`
+	OtlpCfg       *OtlpConfig       `mapstructure:"otlp"`
 }
 
 type ReceiverConfig struct {
@@ -21,6 +24,89 @@ type ReceiverConfig struct {
 	HttpPort        int    `mapstructure:"http_port"`
 	CenterApiServer string `mapstructure:"center_api_server"`
 	PortalAddress   string `mapstructure:"portal_address"`
+	// ShutdownTimeout bounds draining the analyzer and flushing the data when shutting down. If Not set will be set to 30s.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// HealthCheckInterval is the period to check the dependencies. If Not set will be set to 10s.
+	HealthCheckInterval time.Duration `mapstructure:"health_check_interval"`
+	// HealthCheckTimeout bounds each dependency check. If Not set will be set to 3s.
+	HealthCheckTimeout time.Duration `mapstructure:"health_check_timeout"`
+	// TLS is served on both the gRPC and HTTP ports.
+	TLS TLSServerConfig `mapstructure:"tls"`
+	// Auth authenticates the agents calling the gRPC services.
+	Auth AuthConfig `mapstructure:"auth"`
+	// RateLimit rejects the data sent by StoreDataGroups with RESOURCE_EXHAUSTED when exceeded.
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	// Stream controls the flow of the data groups sent by StreamDataGroups.
+	Stream StreamConfig `mapstructure:"stream"`
+}
+
+type StreamConfig struct {
+	// Window is the messages can be sent without ack on one stream. If Not set will be set to 100.
+	Window uint32 `mapstructure:"window"`
+	// AckInterval is the period to ack the flushed messages. If Not set will be set to 1s.
+	AckInterval time.Duration `mapstructure:"ack_interval"`
+}
+
+type RateLimitConfig struct {
+	// NodeQuota is the token bucket of each agent node, the node is the peer address namespaced by the cluster and tenant of the token.
+	NodeQuota RateQuotaConfig `mapstructure:"node_quota"`
+	// DataGroupQuotas are the token buckets shared by all the nodes by data group name, e.g. flame_graph.
+	DataGroupQuotas map[string]RateQuotaConfig `mapstructure:"data_group_quotas"`
+}
+
+type RateQuotaConfig struct {
+	// DataPerSecond is the rate of the data in the data groups, 0 means unlimited.
+	DataPerSecond float64 `mapstructure:"data_per_second"`
+	// Burst is the data accepted at once. If Not set will be set to DataPerSecond.
+	Burst int `mapstructure:"burst"`
+}
+
+type AuthConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// Tokens are the static bearer tokens and the identities of the agents using them.
+	Tokens []*AuthTokenConfig `mapstructure:"tokens"`
+	JWT    JWTConfig          `mapstructure:"jwt"`
+}
+
+type AuthTokenConfig struct {
+	Token string `mapstructure:"token"`
+	// TokenFile takes precedence over Token.
+	TokenFile string `mapstructure:"token_file"`
+	Cluster   string `mapstructure:"cluster"`
+	Tenant    string `mapstructure:"tenant"`
+	// Node is the node of the agent, the x-apo-node metadata of the request is used if not set.
+	Node string `mapstructure:"node"`
+}
+
+// JWTConfig verifies the bearer JWTs whose cluster, tenant and node claims are the identities of the agents.
+type JWTConfig struct {
+	// KeySetFile is a JWKS file of the HMAC, RSA and ECDSA keys, JWT is disabled if not set.
+	// The file is reloaded when changed, and the JWTs without exp are rejected.
+	KeySetFile string `mapstructure:"key_set_file"`
+	// Issuer and Audience are checked if set.
+	Issuer   string `mapstructure:"issuer"`
+	Audience string `mapstructure:"audience"`
+}
+
+// TLSServerConfig enables TLS on the listeners, the files are reloaded when changed.
+type TLSServerConfig struct {
+	Enable   bool   `mapstructure:"enable"`
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// ClientCAFile verifies the client certificates, the clients without a valid certificate are rejected if set.
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+// TLSClientConfig enables TLS on the connections to ClickHouse, Redis and Prometheus.
+type TLSClientConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// CAFile verifies the server certificate, the system roots are used if not set.
+	CAFile string `mapstructure:"ca_file"`
+	// CertFile and KeyFile are presented to the servers which require client certificates.
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
 }
 
 type SampleConfig struct {
@@ -47,6 +133,8 @@ type PrometheusConfig struct {
 	GenerateClientMetric    bool            `mapstructure:"generate_client_metric"`
 	ClientMetricWithUrl     bool            `mapstructure:"client_metric_with_url"`
 	OpenApiMetrics          bool            `mapstructure:"open_api_metrics"`
+	// TLS is used to query and send metrics to Prometheus or VictoriaMetrics.
+	TLS TLSClientConfig `mapstructure:"tls"`
 }
 
 func (promqCfg *PrometheusConfig) GetRange() string {
@@ -63,6 +151,8 @@ type ClickHouseConfig struct {
 	Username string `mapstructure:"username"`
 	// Password is the authentication password.
 	Password string `mapstructure:"password"`
+	// PasswordFile is a file to read Password from, e.g. a mounted Secret. It takes precedence over Password.
+	PasswordFile string `mapstructure:"password_file"`
 	// Database is the database name to export.
 	Database string `mapstructure:"database"`
 	// Replication decides whether to create a replicated table.
@@ -77,6 +167,45 @@ type ClickHouseConfig struct {
 	// If Not set will be set to 5.
 	FlushSeconds        uint `mapstructure:"flush_seconds"`
 	ExportServiceClient bool `mapstructure:"export_service_client"`
+	// WriteMode is sql(database/sql transaction) or native(columnar batch). If Not set will be set to sql.
+	WriteMode string            `mapstructure:"write_mode"`
+	Native    NativeWriteConfig `mapstructure:"native"`
+	// Spool stores the failed batches on disk and replays them later.
+	Spool SpoolConfig `mapstructure:"spool"`
+	// TLS is used by both the sql and native connections.
+	TLS TLSClientConfig `mapstructure:"tls"`
+	// DatabasePerTenant writes the data of each tenant into <database>_<tenant>, which is created when the tenant is first seen.
+	// Otherwise all the tenants are written into Database with the tenant label.
+	DatabasePerTenant bool `mapstructure:"database_per_tenant"`
+	// CacheMaxSizeMB is the memory budget of the data waiting to be written, 0 means unlimited.
+	// The data groups, traces, reports, relations and dependencies are counted by their estimated size.
+	// The data groups are rejected until the cached data are flushed when exceeded.
+	CacheMaxSizeMB int64 `mapstructure:"cache_max_size_mb"`
+}
+
+type NativeWriteConfig struct {
+	// BatchSize is the records to send in one block, a record can be written as multiple rows, eg. the propagations of an error report.
+	// If Not set will be set to 10000.
+	BatchSize int `mapstructure:"batch_size"`
+	// TableBatchSizes overrides BatchSize by table name.
+	TableBatchSizes map[string]int `mapstructure:"table_batch_sizes"`
+	// AsyncInsert lets ClickHouse buffer the inserts on server side.
+	AsyncInsert bool `mapstructure:"async_insert"`
+	// WaitAsyncInsert waits for the buffer to be flushed, otherwise the failed inserts can not be spooled.
+	WaitAsyncInsert bool `mapstructure:"wait_async_insert"`
+}
+
+type SpoolConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// Path is the directory to store spool segments.
+	Path string `mapstructure:"path"`
+	// MaxSizeMB is the max disk usage, the oldest segments are dropped when exceeded. If Not set will be set to 1024.
+	MaxSizeMB int64 `mapstructure:"max_size_mb"`
+	// SegmentSizeMB is the size to rotate a segment. If Not set will be set to 16.
+	SegmentSizeMB int64 `mapstructure:"segment_size_mb"`
+	// Backoff between replays of failed batches. If Not set will be set to 5 and 300.
+	RetryMinSeconds uint `mapstructure:"retry_min_seconds"`
+	RetryMaxSeconds uint `mapstructure:"retry_max_seconds"`
 }
 
 type TTLConfig struct {
@@ -99,17 +228,117 @@ type AnalyzerConfig struct {
 	RatioThreshold int      `mapstructure:"ratio_threshold"`
 	SegmentSize    int      `mapstructure:"segment_size"`
 	MuateNodeMode  string   `mapstructure:"mutate_node_mode"`
-	TraceAddress   string   `mapstructure:"trace_adress"`
+	TraceAddress   string   `mapstructure:"trace_address"`
 	Timeout        int64    `mapstructure:"timeout"`
 	GetDetailTypes []string `mapstructure:"get_detail_types"`
 	HttpParser     string   `mapstructure:"http_parser"`
+	// UrlNormalizer is used when http_parser is normalizedUrl.
+	UrlNormalizer UrlNormalizerConfig `mapstructure:"url_normalizer"`
+	// ExternalRules classify the spans of the in-house frameworks and middlewares, they are tried in order before the built-in parsers.
+	ExternalRules []ExternalRule `mapstructure:"external_rules"`
+	// MqCorrelation relates the mq consumers to the producers in other traces.
+	MqCorrelation MqCorrelationConfig `mapstructure:"mq_correlation"`
+	// DependencyAggregation rolls the relationships of the analyzed traces into the per-minute dependencies.
+	DependencyAggregation DependencyAggregationConfig `mapstructure:"dependency_aggregation"`
+	// DependencyChange detects the edges added to or removed from the services.
+	DependencyChange DependencyChangeConfig `mapstructure:"dependency_change"`
+}
+
+// DependencyChangeConfig tracks the edges seen per service in the rolling baseline window,
+// the added and removed edges are written into service_dependency_change.
+// The baseline is kept in the memory of each receiver and only learned from its analyzed traces,
+// so it is expected to be enabled on a single receiver, or the receivers report the edges of the traces they see.
+type DependencyChangeConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// BaselineWindow is how long an edge is kept after it is last seen, the edge not seen in it is removed. If Not set will be set to 1h.
+	BaselineWindow time.Duration `mapstructure:"baseline_window"`
+	// Warmup is how long the edges of a newly seen service are learned as the baseline without events. If Not set will be set to 10m.
+	Warmup time.Duration `mapstructure:"warmup"`
+	// MaxEdges bounds the edges tracked, the new edges are not tracked when it is reached. If Not set will be set to 100000.
+	MaxEdges int `mapstructure:"max_edges"`
+	// MinRemovedCalls is the times an edge must be seen in the baseline before its removal is reported,
+	// the rarely called edges are forgotten silently. If Not set will be set to 10.
+	MinRemovedCalls int `mapstructure:"min_removed_calls"`
+}
+
+// DependencyAggregationConfig aggregates the parent -> client -> child edges into the calls, errors and latency sketches per minute,
+// the closed minutes are written into service_dependency_1m.
+// Without the OTLP span store only the first trace of a root url in the topology period is aggregated, so the calls are the sampled traces.
+type DependencyAggregationConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// FlushDelay is how long a minute is kept open after its end for the traces analyzed later. If Not set will be set to 2m.
+	FlushDelay time.Duration `mapstructure:"flush_delay"`
+	// MaxEdges bounds the edges kept in the open minutes, the new edges are dropped when it is reached. If Not set will be set to 100000.
+	MaxEdges int `mapstructure:"max_edges"`
+}
+
+// MqCorrelationConfig matches the consumers to the producers by span links, message ids or destinations,
+// the matched producer -> consumer relationships are written into service_relationship.
+// The producers are kept in the memory of each receiver, the producers and the consumers analyzed by different receivers are not matched.
+type MqCorrelationConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// CacheTime is how long the producers and the consumers waiting for their producers are kept. If Not set will be set to 5m.
+	CacheTime time.Duration `mapstructure:"cache_time"`
+	// MaxMessages bounds the producers and the waiting consumers kept, the new ones are not kept when it is reached. If Not set will be set to 100000.
+	MaxMessages int `mapstructure:"max_messages"`
+}
+
+// UrlNormalizerConfig names the HTTP client calls by the path templates, the numeric IDs, UUIDs and hex hashes are replaced with {id}, {uuid} and {hash}.
+type UrlNormalizerConfig struct {
+	// Patterns replace the matched path segments with the placeholders, they are tried before the built-in placeholders.
+	Patterns []UrlPattern `mapstructure:"patterns"`
+	// MaxTemplates bounds the templates learned per peer, the new paths are named by their first segment with /{*} when it is reached. If Not set will be set to 200.
+	MaxTemplates int `mapstructure:"max_templates"`
+	// VariableThreshold is the distinct values of a segment in the same template to learn the segment as {var}. If Not set will be set to 20.
+	VariableThreshold int `mapstructure:"variable_threshold"`
+}
+
+type UrlPattern struct {
+	// Regex matches a path segment, use ^ and $ to match the whole segment.
+	Regex       string `mapstructure:"regex"`
+	Placeholder string `mapstructure:"placeholder"`
+}
+
+// ExternalRule derives the external call from the matched span, the fields of External are templates
+// expanded by ${<attribute>} with the span attributes, ${span.name} and ${span.peer}.
+type ExternalRule struct {
+	Name string `mapstructure:"name"`
+	// Kinds of the matched spans, client / producer / consumer / server / internal. If Not set will be set to [client].
+	Kinds []string `mapstructure:"kinds"`
+	// Match are all required to be matched.
+	Match    []ExternalRuleMatch `mapstructure:"match"`
+	External ExternalTemplate    `mapstructure:"external"`
+}
+
+type ExternalRuleMatch struct {
+	Attribute string `mapstructure:"attribute"`
+	// Regex matches the attribute value, the attribute is only required to be present if Not set.
+	Regex string `mapstructure:"regex"`
+}
+
+type ExternalTemplate struct {
+	// Group is external / db / mq. If Not set will be set to external.
+	Group string `mapstructure:"group"`
+	// Type If Not set will be set to the rule name.
+	Type string `mapstructure:"type"`
+	// Name If Not set will be set to ${span.name}.
+	Name string `mapstructure:"name"`
+	// Peer If Not set will be set to ${span.peer}.
+	Peer   string `mapstructure:"peer"`
+	Detail string `mapstructure:"detail"`
 }
 
 type RedisConfig struct {
-	Enable     bool   `mapstructure:"enable"`
-	Address    string `mapstructure:"address"`
-	Password   string `mapstructure:"password"`
-	ExpireTime int64  `mapstructure:"expire_time"`
+	Enable   bool   `mapstructure:"enable"`
+	Address  string `mapstructure:"address"`
+	Password string `mapstructure:"password"`
+	// PasswordFile is a file to read Password from, e.g. a mounted Secret. It takes precedence over Password.
+	PasswordFile string `mapstructure:"password_file"`
+	ExpireTime   int64  `mapstructure:"expire_time"`
+	// WriteFormat is json or protobuf, the traces and metrics in both formats are read.
+	// Switch to protobuf after all the receivers sharing Redis are upgraded. If Not set will be set to json.
+	WriteFormat string          `mapstructure:"write_format"`
+	TLS         TLSClientConfig `mapstructure:"tls"`
 }
 
 type K8sConfig struct {
@@ -118,3 +347,35 @@ type K8sConfig struct {
 
 	MetaServerConfig *metaconfigs.MetaSourceConfig `mapstructure:"meta_server_config"`
 }
+
+// OtlpConfig receives the traces exported by the OTel SDKs and collectors,
+// OTLP/gRPC is served on the gRPC port and OTLP/HTTP is served on /v1/traces of the HTTP port.
+type OtlpConfig struct {
+	Enable bool `mapstructure:"enable"`
+	// SpanCacheTime is how long the spans of a trace are kept after the last span is received. If Not set will be set to 5m.
+	SpanCacheTime time.Duration `mapstructure:"span_cache_time"`
+	// MaxTraces bounds the traces kept, the spans of new traces are dropped when it is reached. If Not set will be set to 100000.
+	MaxTraces int `mapstructure:"max_traces"`
+	// SpanQuietTime is how long no span of a trace is received before the partial trace is analyzed from the pushed spans,
+	// the APM trace backend is queried for the traces not complete and not quiet. If Not set will be set to 10s.
+	SpanQuietTime time.Duration `mapstructure:"span_quiet_time"`
+	// MaxSpansPerTrace bounds the spans kept per trace, the later spans are dropped when it is reached. If Not set will be set to 10000.
+	MaxSpansPerTrace int `mapstructure:"max_spans_per_trace"`
+	// MaxRequestSizeMB bounds the body of an OTLP/HTTP request both before and after it is decompressed. If Not set will be set to 20.
+	MaxRequestSizeMB int64 `mapstructure:"max_request_size_mb"`
+}
+
+// TenantConfig limits the data ingested by the tenants, the tenant of an agent comes from its auth identity.
+type TenantConfig struct {
+	// DefaultQuota is applied to each tenant not listed in Quotas, including the default tenant of the agents without tenant.
+	DefaultQuota TenantQuotaConfig    `mapstructure:"default_quota"`
+	Quotas       []*TenantQuotaConfig `mapstructure:"quotas"`
+}
+
+type TenantQuotaConfig struct {
+	Tenant string `mapstructure:"tenant"`
+	// DataPerSecond is the rate of the data sent by StoreDataGroups, 0 means unlimited.
+	DataPerSecond float64 `mapstructure:"data_per_second"`
+	// Burst is the data accepted at once. If Not set will be set to DataPerSecond.
+	Burst int `mapstructure:"burst"`
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix is the prefix of the environment variables which override the configuration,
+// e.g. APO_RECEIVER_CLICKHOUSE_PASSWORD overrides clickhouse.password.
+const EnvPrefix = "APO_RECEIVER"
+
+// fileConfig is the layout of receiver-config.yml.
+type fileConfig struct {
+	Receiver   *ReceiverConfig   `mapstructure:"receiver"`
+	Sample     *SampleConfig     `mapstructure:"sample"`
+	Profile    *ProfileConfig    `mapstructure:"profile"`
+	Prometheus *PrometheusConfig `mapstructure:"prometheus"`
+	ClickHouse *ClickHouseConfig `mapstructure:"clickhouse"`
+	Analyzer   *AnalyzerConfig   `mapstructure:"analyzer"`
+	Redis      *RedisConfig      `mapstructure:"redis"`
+	K8s        *K8sConfig        `mapstructure:"k8s"`
+	Tenant     *TenantConfig     `mapstructure:"tenant"`
+	Otlp       *OtlpConfig       `mapstructure:"otlp"`
+}
+
+// legacyKeys maps the misspelled keys kept for the existing configurations to the correct ones.
+var legacyKeys = []struct {
+	parent  string
+	legacy  string
+	correct string
+}{
+	{parent: "", legacy: "promethues", correct: "prometheus"},
+	{parent: "analyzer", legacy: "trace_adress", correct: "trace_address"},
+}
+
+// Load reads the configuration file and the APO_RECEIVER_* environment variables,
+// unknown keys and invalid values are reported in one ValidationError.
+func Load(path string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error happened while reading config file: %w", err)
+	}
+	return decode(v, os.LookupEnv)
+}
+
+func decode(fileViper *viper.Viper, lookupEnv func(key string) (string, bool)) (*Config, error) {
+	validationErr := &ValidationError{}
+	settings := fileViper.AllSettings()
+	normalizeLegacyKeys(settings, validationErr)
+
+	v := viper.New()
+	if err := v.MergeConfigMap(settings); err != nil {
+		return nil, err
+	}
+	overrideByEnv(v, "", reflect.TypeOf(fileConfig{}), lookupEnv, validationErr)
+
+	// Decode strictly first to report all the unknown keys and invalid values,
+	// a failed section is left nil by the decoder so the values are decoded again without ErrorUnused.
+	if err := v.Unmarshal(&fileConfig{}, func(decoderCfg *mapstructure.DecoderConfig) {
+		decoderCfg.ErrorUnused = true
+	}); err != nil {
+		var decodeErr *mapstructure.Error
+		if !errors.As(err, &decodeErr) {
+			return nil, err
+		}
+		for _, problem := range decodeErr.Errors {
+			validationErr.add("%s", problem)
+		}
+	}
+	file := &fileConfig{}
+	if err := v.Unmarshal(file); err != nil {
+		// The invalid values are reported already, ranges can not be checked without the values.
+		return nil, validationErr
+	}
+
+	cfg := &Config{
+		ReceiverCfg:   orDefault(file.Receiver),
+		SampleCfg:     orDefault(file.Sample),
+		ProfileCfg:    orDefault(file.Profile),
+		PrometheusCfg: orDefault(file.Prometheus),
+		ClickHouseCfg: orDefault(file.ClickHouse),
+		AnalyzerCfg:   orDefault(file.Analyzer),
+		RedisCfg:      orDefault(file.Redis),
+		K8sCfg:        orDefault(file.K8s),
+		TenantCfg:     orDefault(file.Tenant),
+		OtlpCfg:       orDefault(file.Otlp),
+	}
+	readSecretFile(validationErr, "clickhouse.password_file", cfg.ClickHouseCfg.PasswordFile, &cfg.ClickHouseCfg.Password)
+	readSecretFile(validationErr, "redis.password_file", cfg.RedisCfg.PasswordFile, &cfg.RedisCfg.Password)
+
+	cfg.validate(validationErr)
+	if len(validationErr.Problems) > 0 {
+		return nil, validationErr
+	}
+	return cfg, nil
+}
+
+// normalizeLegacyKeys renames the misspelled keys, it is a problem to set both spellings.
+func normalizeLegacyKeys(settings map[string]interface{}, e *ValidationError) {
+	for _, key := range legacyKeys {
+		parent := settings
+		if key.parent != "" {
+			section, ok := settings[key.parent].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			parent = section
+		}
+		value, found := parent[key.legacy]
+		if !found {
+			continue
+		}
+		// The legacy key is removed either way, so it is not reported again as an unknown key.
+		delete(parent, key.legacy)
+		if _, exist := parent[key.correct]; exist {
+			e.add("%s and %s are both set, remove the misspelled %s",
+				joinKey(key.parent, key.correct), joinKey(key.parent, key.legacy), key.legacy)
+			continue
+		}
+		parent[key.correct] = value
+	}
+}
+
+// overrideByEnv sets the keys of typ whose environment variables are set,
+// the maps and lists of sections are set by JSON values, e.g. APO_RECEIVER_ANALYZER_EXTERNAL_RULES='[{"name":"tars",...}]'.
+func overrideByEnv(v *viper.Viper, prefix string, typ reflect.Type, lookupEnv func(key string) (string, bool), e *ValidationError) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		key := joinKey(prefix, name)
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		switch fieldType.Kind() {
+		case reflect.Struct:
+			overrideByEnv(v, key, fieldType, lookupEnv, e)
+		case reflect.Map:
+			setJsonEnv(v, key, lookupEnv, e)
+		case reflect.Slice:
+			if elemKind := fieldType.Elem().Kind(); elemKind == reflect.Struct || elemKind == reflect.Pointer {
+				setJsonEnv(v, key, lookupEnv, e)
+				continue
+			}
+			fallthrough
+		default:
+			if value, found := lookupEnv(envName(key)); found {
+				v.Set(key, value)
+			}
+		}
+	}
+}
+
+// setJsonEnv sets key by the JSON value of its environment variable, the whole map or list is replaced.
+func setJsonEnv(v *viper.Viper, key string, lookupEnv func(key string) (string, bool), e *ValidationError) {
+	value, found := lookupEnv(envName(key))
+	if !found {
+		return
+	}
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		e.add("%s must be a JSON value of %s: %s", envName(key), key, err.Error())
+		return
+	}
+	v.Set(key, parsed)
+}
+
+// envName returns the environment variable of key, e.g. APO_RECEIVER_CLICKHOUSE_PASSWORD for clickhouse.password.
+func envName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+func readSecretFile(e *ValidationError, key string, path string, value *string) {
+	if path == "" {
+		return
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		e.add("%s can not be read: %s", key, err.Error())
+		return
+	}
+	*value = strings.TrimRight(string(content), "\r\n")
+}
+
+func joinKey(parent string, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+func orDefault[T any](section *T) *T {
+	if section == nil {
+		return new(T)
+	}
+	return section
+}
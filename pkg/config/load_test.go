@@ -0,0 +1,164 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const validConfig = `
+receiver:
+  grpc_port: 29090
+  http_port: 8080
+profile:
+  traceid_cache_time: 6
+%s:
+  address: http://localhost:8428
+  storage: "vm"
+  latency_histogram_buckets: [5ms, 10ms]
+clickhouse:
+  endpoint: "tcp://localhost:9000"
+analyzer:
+  thread_count: 10
+  timeout: 10
+  %s: "localhost:30956"
+redis:
+  expire_time: 300
+`
+
+func decodeYaml(t *testing.T, content string) (*Config, error) {
+	return decodeYamlWithEnv(t, content, map[string]string{})
+}
+
+func decodeYamlWithEnv(t *testing.T, content string, env map[string]string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	assert.NoError(t, v.ReadConfig(strings.NewReader(content)))
+	return decode(v, func(key string) (string, bool) {
+		value, found := env[key]
+		return value, found
+	})
+}
+
+func TestLoadReceiverConfig(t *testing.T) {
+	cfg, err := Load("../../receiver-config.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:30956", cfg.AnalyzerCfg.TraceAddress)
+	assert.Equal(t, "http://localhost:8428", cfg.PrometheusCfg.Address)
+}
+
+func TestDecodeAliases(t *testing.T) {
+	tests := []struct {
+		name         string
+		prometheus   string
+		traceAddress string
+	}{
+		{name: "correct", prometheus: "prometheus", traceAddress: "trace_address"},
+		{name: "legacy", prometheus: "promethues", traceAddress: "trace_adress"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := decodeYaml(t, fmt.Sprintf(validConfig, tt.prometheus, tt.traceAddress))
+			assert.NoError(t, err)
+			assert.Equal(t, "localhost:30956", cfg.AnalyzerCfg.TraceAddress)
+			assert.Equal(t, "http://localhost:8428", cfg.PrometheusCfg.Address)
+		})
+	}
+
+	// Both spellings are reported instead of one silently winning.
+	content := fmt.Sprintf(validConfig, "prometheus", "trace_address") + "promethues:\n  storage: \"prom\"\n"
+	content = strings.Replace(content, `trace_address: "localhost:30956"`, "trace_address: \"localhost:30956\"\n  trace_adress: \"apm:30956\"", 1)
+	_, err := decodeYaml(t, content)
+	var validationErr *ValidationError
+	if assert.True(t, errors.As(err, &validationErr)) {
+		assert.Equal(t, 2, len(validationErr.Problems), validationErr.Error())
+		assert.Contains(t, err.Error(), "prometheus and promethues are both set")
+		assert.Contains(t, err.Error(), "analyzer.trace_address and analyzer.trace_adress are both set")
+	}
+}
+
+func TestDecodeAggregatedErrors(t *testing.T) {
+	content := fmt.Sprintf(validConfig, "prometheus", "trace_address")
+	content = strings.Replace(content, "thread_count: 10", "thread_count: 0\n  thread_cont: 10", 1)
+	content = strings.Replace(content, "[5ms, 10ms]", "[10ms, 5ms]", 1)
+	content = strings.Replace(content, "http_port: 8080", "http_port: 70000", 1)
+
+	_, err := decodeYaml(t, content)
+	var validationErr *ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, 4, len(validationErr.Problems), validationErr.Error())
+	assert.Contains(t, err.Error(), "thread_cont")
+	assert.Contains(t, err.Error(), "analyzer.thread_count")
+	assert.Contains(t, err.Error(), "ascending")
+	assert.Contains(t, err.Error(), "receiver.http_port")
+}
+
+func TestDecodeEnvOverrides(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("secret\n"), 0o600))
+
+	cfg, err := decodeYamlWithEnv(t, fmt.Sprintf(validConfig, "promethues", "trace_adress"), map[string]string{
+		"APO_RECEIVER_ANALYZER_THREAD_COUNT":                            "3",
+		"APO_RECEIVER_ANALYZER_TRACE_ADDRESS":                           "apm:30956",
+		"APO_RECEIVER_PROMETHEUS_LATENCY_HISTOGRAM_BUCKETS":             "1ms,2s",
+		"APO_RECEIVER_CLICKHOUSE_PASSWORD_FILE":                         secretFile,
+		"APO_RECEIVER_CLICKHOUSE_SPOOL_ENABLE":                          "false",
+		"APO_RECEIVER_K8S_META_SERVER_CONFIG_QUERIER_IS_SINGLE_CLUSTER": "true",
+		"APO_RECEIVER_REDIS_PASSWORD":                                   "redis",
+		"APO_RECEIVER_ANALYZER_EXTERNAL_RULES":                          `[{"name":"tars","match":[{"attribute":"tars.servant"}],"external":{"name":"${tars.servant}"}}]`,
+		"APO_RECEIVER_ANALYZER_URL_NORMALIZER_PATTERNS":                 `[{"regex":"^v[0-9]+$","placeholder":"{version}"}]`,
+		"APO_RECEIVER_CLICKHOUSE_NATIVE_TABLE_BATCH_SIZES":              `{"span_trace":500}`,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, cfg.AnalyzerCfg.ThreadCount)
+	assert.Equal(t, "apm:30956", cfg.AnalyzerCfg.TraceAddress)
+	assert.Equal(t, []time.Duration{time.Millisecond, 2 * time.Second}, cfg.PrometheusCfg.LatencyHistogramBuckets)
+	assert.Equal(t, "secret", cfg.ClickHouseCfg.Password)
+	assert.Equal(t, "redis", cfg.RedisCfg.Password)
+	assert.True(t, cfg.K8sCfg.MetaServerConfig.Querier.IsSingleCluster)
+	if assert.Len(t, cfg.AnalyzerCfg.ExternalRules, 1) {
+		assert.Equal(t, "${tars.servant}", cfg.AnalyzerCfg.ExternalRules[0].External.Name)
+	}
+	assert.Equal(t, []UrlPattern{{Regex: "^v[0-9]+$", Placeholder: "{version}"}}, cfg.AnalyzerCfg.UrlNormalizer.Patterns)
+	assert.Equal(t, map[string]int{"span_trace": 500}, cfg.ClickHouseCfg.Native.TableBatchSizes)
+
+	_, err = decodeYamlWithEnv(t, fmt.Sprintf(validConfig, "prometheus", "trace_address"), map[string]string{
+		"APO_RECEIVER_REDIS_PASSWORD_FILE":     filepath.Join(t.TempDir(), "missing"),
+		"APO_RECEIVER_ANALYZER_EXTERNAL_RULES": "tars",
+	})
+	assert.ErrorContains(t, err, "redis.password_file")
+	assert.ErrorContains(t, err, "APO_RECEIVER_ANALYZER_EXTERNAL_RULES must be a JSON value")
+}
+
+func TestDecodeExternalRules(t *testing.T) {
+	rules := `  external_rules:
+    - name: tars
+      match:
+        - attribute: tars.servant
+        - attribute: tars.protocol
+          regex: "^(tars|tup)$"
+      external:
+        name: "${tars.servant}.${tars.func}"
+`
+	content := strings.Replace(fmt.Sprintf(validConfig, "prometheus", "trace_address"), "redis:", rules+"redis:", 1)
+	cfg, err := decodeYaml(t, content)
+	assert.NoError(t, err)
+	if assert.Len(t, cfg.AnalyzerCfg.ExternalRules, 1) {
+		rule := cfg.AnalyzerCfg.ExternalRules[0]
+		assert.Equal(t, []ExternalRuleMatch{{Attribute: "tars.servant"}, {Attribute: "tars.protocol", Regex: "^(tars|tup)$"}}, rule.Match)
+		assert.Equal(t, "${tars.servant}.${tars.func}", rule.External.Name)
+	}
+
+	content = strings.Replace(content, "^(tars|tup)$", "^(tars", 1)
+	content = strings.Replace(content, "- name: tars", "- name: tars\n      kinds: [rpc]", 1)
+	_, err = decodeYaml(t, content)
+	assert.Contains(t, err.Error(), "analyzer.external_rules[0].kinds")
+	assert.Contains(t, err.Error(), "analyzer.external_rules[0].match[1].regex")
+}
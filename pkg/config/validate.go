@@ -0,0 +1,334 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ValidationError reports every problem found in the configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+func (e *ValidationError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+func (e *ValidationError) checkPort(field string, port int) {
+	if port <= 0 || port > 65535 {
+		e.add("%s must be in [1, 65535], got %d", field, port)
+	}
+}
+
+func (e *ValidationError) checkOneOf(field string, value string, allowed ...string) {
+	for _, candidate := range allowed {
+		if value == candidate {
+			return
+		}
+	}
+	e.add("%s must be one of [%s], got %q", field, strings.Join(allowed, ", "), value)
+}
+
+func (e *ValidationError) checkServerTLS(field string, tlsCfg *TLSServerConfig) {
+	if !tlsCfg.Enable {
+		return
+	}
+	if tlsCfg.CertFile == "" || tlsCfg.KeyFile == "" {
+		e.add("%s.cert_file and key_file must be specified when tls is enabled", field)
+	}
+}
+
+func (e *ValidationError) checkClientTLS(field string, tlsCfg *TLSClientConfig) {
+	if !tlsCfg.Enable {
+		return
+	}
+	if (tlsCfg.CertFile == "") != (tlsCfg.KeyFile == "") {
+		e.add("%s.cert_file and key_file must be specified together", field)
+	}
+}
+
+func (e *ValidationError) checkQuota(field string, dataPerSecond float64, burst int) {
+	if dataPerSecond < 0 || burst < 0 {
+		e.add("%s.data_per_second and burst must be >= 0", field)
+	}
+}
+
+func (cfg *Config) validate(e *ValidationError) {
+	receiverCfg := cfg.ReceiverCfg
+	e.checkPort("receiver.grpc_port", receiverCfg.GrpcPort)
+	e.checkPort("receiver.http_port", receiverCfg.HttpPort)
+	if receiverCfg.GrpcPort == receiverCfg.HttpPort && receiverCfg.GrpcPort > 0 {
+		e.add("receiver.grpc_port and receiver.http_port must be different, got %d", receiverCfg.GrpcPort)
+	}
+
+	if receiverCfg.ShutdownTimeout < 0 {
+		e.add("receiver.shutdown_timeout must be >= 0, got %s", receiverCfg.ShutdownTimeout)
+	}
+	if receiverCfg.HealthCheckInterval < 0 {
+		e.add("receiver.health_check_interval must be >= 0, got %s", receiverCfg.HealthCheckInterval)
+	}
+	if receiverCfg.HealthCheckTimeout < 0 {
+		e.add("receiver.health_check_timeout must be >= 0, got %s", receiverCfg.HealthCheckTimeout)
+	}
+
+	e.checkServerTLS("receiver.tls", &receiverCfg.TLS)
+	authCfg := receiverCfg.Auth
+	if authCfg.Enable {
+		if len(authCfg.Tokens) == 0 && authCfg.JWT.KeySetFile == "" {
+			e.add("receiver.auth.tokens or receiver.auth.jwt.key_set_file must be specified when auth is enabled")
+		}
+		for i, token := range authCfg.Tokens {
+			if token == nil || (token.Token == "" && token.TokenFile == "") {
+				e.add("receiver.auth.tokens[%d].token or token_file must be specified", i)
+			}
+		}
+	}
+
+	rateLimitCfg := receiverCfg.RateLimit
+	e.checkQuota("receiver.rate_limit.node_quota", rateLimitCfg.NodeQuota.DataPerSecond, rateLimitCfg.NodeQuota.Burst)
+	for name, quota := range rateLimitCfg.DataGroupQuotas {
+		e.checkQuota("receiver.rate_limit.data_group_quotas."+name, quota.DataPerSecond, quota.Burst)
+	}
+
+	if receiverCfg.Stream.AckInterval < 0 {
+		e.add("receiver.stream.ack_interval must be >= 0, got %s", receiverCfg.Stream.AckInterval)
+	}
+
+	sampleCfg := cfg.SampleCfg
+	if sampleCfg.Enable {
+		if sampleCfg.MinSample < 0 {
+			e.add("sample.min_sample must be >= 0, got %d", sampleCfg.MinSample)
+		}
+		if sampleCfg.MinSample > sampleCfg.InitSample || sampleCfg.InitSample > sampleCfg.MaxSample {
+			e.add("sample must satisfy min_sample <= init_sample <= max_sample, got %d, %d, %d",
+				sampleCfg.MinSample, sampleCfg.InitSample, sampleCfg.MaxSample)
+		}
+		if sampleCfg.ResetSamplePeriod <= 0 {
+			e.add("sample.reset_sample_period must be > 0, got %s", sampleCfg.ResetSamplePeriod)
+		}
+	}
+
+	profileCfg := cfg.ProfileCfg
+	if profileCfg.TraceIdCacheTime <= 0 {
+		e.add("profile.traceid_cache_time must be > 0, got %d", profileCfg.TraceIdCacheTime)
+	}
+	if profileCfg.OpenWindowSample && profileCfg.WindowSampleNum <= 0 {
+		e.add("profile.window_sample_num must be > 0 when open_window_sample is true, got %d", profileCfg.WindowSampleNum)
+	}
+
+	prometheusCfg := cfg.PrometheusCfg
+	if prometheusCfg.Address == "" {
+		e.add("prometheus.address must be specified")
+	}
+	e.checkOneOf("prometheus.storage", prometheusCfg.Storage, "vm", "prom")
+	if prometheusCfg.CacheSize < 0 {
+		e.add("prometheus.cache_size must be >= 0, got %d", prometheusCfg.CacheSize)
+	}
+	if prometheusCfg.SendInterval < 0 {
+		e.add("prometheus.send_interval must be >= 0, got %d", prometheusCfg.SendInterval)
+	}
+	if len(prometheusCfg.LatencyHistogramBuckets) == 0 && prometheusCfg.Storage == "prom" && prometheusCfg.GenerateClientMetric {
+		e.add("prometheus.latency_histogram_buckets must be specified when storage is prom and generate_client_metric is true")
+	}
+	for i, bucket := range prometheusCfg.LatencyHistogramBuckets {
+		if bucket <= 0 {
+			e.add("prometheus.latency_histogram_buckets[%d] must be > 0, got %s", i, bucket)
+		}
+		if i > 0 && bucket <= prometheusCfg.LatencyHistogramBuckets[i-1] {
+			e.add("prometheus.latency_histogram_buckets must be in ascending order, got %s after %s",
+				bucket, prometheusCfg.LatencyHistogramBuckets[i-1])
+		}
+	}
+
+	e.checkClientTLS("prometheus.tls", &prometheusCfg.TLS)
+
+	clickHouseCfg := cfg.ClickHouseCfg
+	if clickHouseCfg.Endpoint == "" {
+		e.add("clickhouse.endpoint must be specified")
+	} else if _, err := url.Parse(clickHouseCfg.Endpoint); err != nil {
+		e.add("clickhouse.endpoint must be url format: %s", err.Error())
+	}
+	if clickHouseCfg.WriteMode != "" {
+		e.checkOneOf("clickhouse.write_mode", clickHouseCfg.WriteMode, "sql", "native")
+	}
+	if clickHouseCfg.Native.BatchSize < 0 {
+		e.add("clickhouse.native.batch_size must be >= 0, got %d", clickHouseCfg.Native.BatchSize)
+	}
+	for table, batchSize := range clickHouseCfg.Native.TableBatchSizes {
+		if batchSize <= 0 {
+			e.add("clickhouse.native.table_batch_sizes.%s must be > 0, got %d", table, batchSize)
+		}
+	}
+	spoolCfg := clickHouseCfg.Spool
+	if spoolCfg.Enable {
+		if spoolCfg.Path == "" {
+			e.add("clickhouse.spool.path must be specified when spool is enabled")
+		}
+		if spoolCfg.MaxSizeMB < 0 || spoolCfg.SegmentSizeMB < 0 {
+			e.add("clickhouse.spool.max_size_mb and segment_size_mb must be >= 0")
+		} else if spoolCfg.MaxSizeMB > 0 && spoolCfg.SegmentSizeMB > spoolCfg.MaxSizeMB {
+			e.add("clickhouse.spool.segment_size_mb must be <= max_size_mb, got %d > %d", spoolCfg.SegmentSizeMB, spoolCfg.MaxSizeMB)
+		}
+		if spoolCfg.RetryMaxSeconds > 0 && spoolCfg.RetryMinSeconds > spoolCfg.RetryMaxSeconds {
+			e.add("clickhouse.spool.retry_min_seconds must be <= retry_max_seconds, got %d > %d", spoolCfg.RetryMinSeconds, spoolCfg.RetryMaxSeconds)
+		}
+	}
+
+	if clickHouseCfg.CacheMaxSizeMB < 0 {
+		e.add("clickhouse.cache_max_size_mb must be >= 0, got %d", clickHouseCfg.CacheMaxSizeMB)
+	}
+	e.checkClientTLS("clickhouse.tls", &clickHouseCfg.TLS)
+
+	analyzerCfg := cfg.AnalyzerCfg
+	if analyzerCfg.ThreadCount <= 0 {
+		e.add("analyzer.thread_count must be > 0, got %d", analyzerCfg.ThreadCount)
+	}
+	if analyzerCfg.DelayDuration < 0 {
+		e.add("analyzer.delay_duration must be >= 0, got %d", analyzerCfg.DelayDuration)
+	}
+	if analyzerCfg.RetryTimes < 0 {
+		e.add("analyzer.retry_times must be >= 0, got %d", analyzerCfg.RetryTimes)
+	}
+	if analyzerCfg.RetryTimes > 0 && analyzerCfg.RetryDuration <= 0 {
+		e.add("analyzer.retry_duration must be > 0 when retry_times > 0, got %d", analyzerCfg.RetryDuration)
+	}
+	if analyzerCfg.RatioThreshold < 0 || analyzerCfg.RatioThreshold > 100 {
+		e.add("analyzer.ratio_threshold must be in [0, 100], got %d", analyzerCfg.RatioThreshold)
+	}
+	if analyzerCfg.SegmentSize < 0 {
+		e.add("analyzer.segment_size must be >= 0, got %d", analyzerCfg.SegmentSize)
+	}
+	if analyzerCfg.MuateNodeMode != "" {
+		e.checkOneOf("analyzer.mutate_node_mode", analyzerCfg.MuateNodeMode, "single", "maxService", "top3Service")
+	}
+	// The services are built from the pushed spans without the APM trace backend when OTLP is enabled.
+	if analyzerCfg.TraceAddress == "" && !cfg.OtlpCfg.Enable {
+		e.add("analyzer.trace_address must be specified when otlp is not enabled")
+	}
+	if analyzerCfg.Timeout <= 0 {
+		e.add("analyzer.timeout must be > 0, got %d", analyzerCfg.Timeout)
+	}
+	if analyzerCfg.HttpParser != "" {
+		e.checkOneOf("analyzer.http_parser", analyzerCfg.HttpParser, "httpMethod", "topUrl", "normalizedUrl")
+	}
+	for i, pattern := range analyzerCfg.UrlNormalizer.Patterns {
+		if _, err := regexp.Compile(pattern.Regex); err != nil || pattern.Regex == "" {
+			e.add("analyzer.url_normalizer.patterns[%d].regex must be a valid regex, got %q", i, pattern.Regex)
+		}
+		if pattern.Placeholder == "" {
+			e.add("analyzer.url_normalizer.patterns[%d].placeholder must be specified", i)
+		}
+	}
+	if analyzerCfg.UrlNormalizer.MaxTemplates < 0 {
+		e.add("analyzer.url_normalizer.max_templates must be >= 0, got %d", analyzerCfg.UrlNormalizer.MaxTemplates)
+	}
+	if analyzerCfg.UrlNormalizer.VariableThreshold < 0 {
+		e.add("analyzer.url_normalizer.variable_threshold must be >= 0, got %d", analyzerCfg.UrlNormalizer.VariableThreshold)
+	}
+	if analyzerCfg.MqCorrelation.CacheTime < 0 {
+		e.add("analyzer.mq_correlation.cache_time must be >= 0, got %s", analyzerCfg.MqCorrelation.CacheTime)
+	}
+	if analyzerCfg.MqCorrelation.MaxMessages < 0 {
+		e.add("analyzer.mq_correlation.max_messages must be >= 0, got %d", analyzerCfg.MqCorrelation.MaxMessages)
+	}
+	if analyzerCfg.DependencyAggregation.FlushDelay < 0 {
+		e.add("analyzer.dependency_aggregation.flush_delay must be >= 0, got %s", analyzerCfg.DependencyAggregation.FlushDelay)
+	}
+	if analyzerCfg.DependencyAggregation.MaxEdges < 0 {
+		e.add("analyzer.dependency_aggregation.max_edges must be >= 0, got %d", analyzerCfg.DependencyAggregation.MaxEdges)
+	}
+	if analyzerCfg.DependencyChange.BaselineWindow < 0 {
+		e.add("analyzer.dependency_change.baseline_window must be >= 0, got %s", analyzerCfg.DependencyChange.BaselineWindow)
+	}
+	if analyzerCfg.DependencyChange.Warmup < 0 {
+		e.add("analyzer.dependency_change.warmup must be >= 0, got %s", analyzerCfg.DependencyChange.Warmup)
+	}
+	if analyzerCfg.DependencyChange.MaxEdges < 0 {
+		e.add("analyzer.dependency_change.max_edges must be >= 0, got %d", analyzerCfg.DependencyChange.MaxEdges)
+	}
+	if analyzerCfg.DependencyChange.MinRemovedCalls < 0 {
+		e.add("analyzer.dependency_change.min_removed_calls must be >= 0, got %d", analyzerCfg.DependencyChange.MinRemovedCalls)
+	}
+	ruleNames := make(map[string]bool)
+	for i, rule := range analyzerCfg.ExternalRules {
+		field := fmt.Sprintf("analyzer.external_rules[%d]", i)
+		if rule.Name == "" {
+			e.add("%s.name must be specified", field)
+		} else if ruleNames[rule.Name] {
+			e.add("%s.name %q is duplicated", field, rule.Name)
+		}
+		ruleNames[rule.Name] = true
+		for _, kind := range rule.Kinds {
+			e.checkOneOf(field+".kinds", kind, "client", "producer", "consumer", "server", "internal")
+		}
+		if len(rule.Match) == 0 {
+			e.add("%s.match must be specified", field)
+		}
+		for j, match := range rule.Match {
+			if match.Attribute == "" {
+				e.add("%s.match[%d].attribute must be specified", field, j)
+			}
+			if _, err := regexp.Compile(match.Regex); err != nil {
+				e.add("%s.match[%d].regex is invalid: %s", field, j, err.Error())
+			}
+		}
+		if rule.External.Group != "" {
+			e.checkOneOf(field+".external.group", rule.External.Group, "external", "db", "mq")
+		}
+	}
+
+	redisCfg := cfg.RedisCfg
+	if redisCfg.Enable && redisCfg.Address == "" {
+		e.add("redis.address must be specified when redis is enabled")
+	}
+	if redisCfg.ExpireTime <= 0 {
+		e.add("redis.expire_time must be > 0, got %d", redisCfg.ExpireTime)
+	}
+	if redisCfg.WriteFormat != "" {
+		e.checkOneOf("redis.write_format", redisCfg.WriteFormat, "json", "protobuf")
+	}
+	e.checkClientTLS("redis.tls", &redisCfg.TLS)
+
+	k8sCfg := cfg.K8sCfg
+	if k8sCfg.Enable && k8sCfg.MetaServerConfig == nil {
+		e.add("k8s.meta_server_config must be specified when k8s is enabled")
+	}
+
+	tenantCfg := cfg.TenantCfg
+	e.checkQuota("tenant.default_quota", tenantCfg.DefaultQuota.DataPerSecond, tenantCfg.DefaultQuota.Burst)
+	quotaTenants := make(map[string]bool)
+	for i, quota := range tenantCfg.Quotas {
+		if quota == nil || quota.Tenant == "" {
+			e.add("tenant.quotas[%d].tenant must be specified", i)
+			continue
+		}
+		if quotaTenants[quota.Tenant] {
+			e.add("tenant.quotas[%d].tenant %q is duplicated", i, quota.Tenant)
+		}
+		quotaTenants[quota.Tenant] = true
+		e.checkQuota(fmt.Sprintf("tenant.quotas[%d]", i), quota.DataPerSecond, quota.Burst)
+	}
+
+	otlpCfg := cfg.OtlpCfg
+	if otlpCfg.SpanCacheTime < 0 {
+		e.add("otlp.span_cache_time must be >= 0, got %s", otlpCfg.SpanCacheTime)
+	}
+	if otlpCfg.MaxTraces < 0 {
+		e.add("otlp.max_traces must be >= 0, got %d", otlpCfg.MaxTraces)
+	}
+	if otlpCfg.SpanQuietTime < 0 {
+		e.add("otlp.span_quiet_time must be >= 0, got %s", otlpCfg.SpanQuietTime)
+	}
+	if otlpCfg.MaxSpansPerTrace < 0 {
+		e.add("otlp.max_spans_per_trace must be >= 0, got %d", otlpCfg.MaxSpansPerTrace)
+	}
+	if otlpCfg.MaxRequestSizeMB < 0 {
+		e.add("otlp.max_request_size_mb must be >= 0, got %d", otlpCfg.MaxRequestSizeMB)
+	}
+}
@@ -3,13 +3,12 @@ package global
 import (
 	"github.com/CloudDetail/apo-receiver/pkg/clickhouse"
 	"github.com/CloudDetail/apo-receiver/pkg/componment/redis"
-
-	"github.com/CloudDetail/apo-module/apm/client/v1/api"
+	"github.com/CloudDetail/apo-receiver/pkg/componment/spanstore"
 )
 
 var (
 	CLICK_HOUSE  *clickhouse.ClickHouseClient
-	TRACE_CLIENT api.ApmTraceAPI
+	TRACE_CLIENT *spanstore.TraceClient
 	CACHE        redis.ExpirableCache
 	PROM_RANGE   string
 )
@@ -0,0 +1,218 @@
+package health
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultTimeout  = 3 * time.Second
+)
+
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDown     Status = "down"
+	StatusDegraded Status = "degraded"
+	StatusUnknown  Status = "unknown"
+)
+
+// Probe checks a dependency, it should return when ctx is done.
+type Probe func(ctx context.Context) error
+
+type check struct {
+	name     string
+	critical bool
+	probe    Probe
+}
+
+// Result is the last result of a dependency check.
+type Result struct {
+	Name      string    `json:"name"`
+	Status    Status    `json:"status"`
+	Critical  bool      `json:"critical"`
+	LatencyMs float64   `json:"latencyMs"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Report is the detail view of all the dependency checks.
+type Report struct {
+	Status Status    `json:"status"`
+	Checks []*Result `json:"checks"`
+}
+
+// Checker checks the dependencies periodically and keeps the last results,
+// so the probes of Kubernetes never wait for a slow dependency.
+type Checker struct {
+	interval  time.Duration
+	timeout   time.Duration
+	lock      sync.RWMutex
+	checks    []*check
+	results   map[string]*Result
+	listeners map[string][]func(up bool)
+	stopChan  chan struct{}
+	routines  sync.WaitGroup
+}
+
+func NewChecker(interval time.Duration, timeout time.Duration) *Checker {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Checker{
+		interval:  interval,
+		timeout:   timeout,
+		checks:    make([]*check, 0),
+		results:   make(map[string]*Result),
+		listeners: make(map[string][]func(up bool)),
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Register adds a dependency check, the receiver is not ready when a critical check fails.
+func (checker *Checker) Register(name string, critical bool, probe Probe) {
+	checker.lock.Lock()
+	defer checker.lock.Unlock()
+	checker.checks = append(checker.checks, &check{name: name, critical: critical, probe: probe})
+	checker.results[name] = &Result{Name: name, Status: StatusUnknown, Critical: critical}
+}
+
+// OnChange registers a function called when the check of name turns up or down.
+func (checker *Checker) OnChange(name string, listener func(up bool)) {
+	checker.lock.Lock()
+	defer checker.lock.Unlock()
+	checker.listeners[name] = append(checker.listeners[name], listener)
+}
+
+// Start checks all the dependencies once and then checks them in background until Stop is called.
+func (checker *Checker) Start() {
+	checker.CheckAll(context.Background())
+	checker.routines.Add(1)
+	go func() {
+		defer checker.routines.Done()
+		ticker := time.NewTicker(checker.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-checker.stopChan:
+				return
+			case <-ticker.C:
+				checker.CheckAll(context.Background())
+			}
+		}
+	}()
+}
+
+func (checker *Checker) Stop() {
+	close(checker.stopChan)
+	checker.routines.Wait()
+}
+
+// CheckAll runs all the checks concurrently and updates the results.
+func (checker *Checker) CheckAll(ctx context.Context) {
+	checker.lock.RLock()
+	checks := checker.checks
+	checker.lock.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c *check) {
+			defer wg.Done()
+			checker.update(checker.run(ctx, c))
+		}(c)
+	}
+	wg.Wait()
+}
+
+func (checker *Checker) run(ctx context.Context, c *check) *Result {
+	ctx, cancel := context.WithTimeout(ctx, checker.timeout)
+	defer cancel()
+
+	startTime := time.Now()
+	err := c.probe(ctx)
+	result := &Result{
+		Name:      c.name,
+		Status:    StatusUp,
+		Critical:  c.critical,
+		LatencyMs: float64(time.Since(startTime).Microseconds()) / 1000,
+		CheckedAt: startTime,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (checker *Checker) update(result *Result) {
+	checker.lock.Lock()
+	previous := checker.results[result.Name]
+	checker.results[result.Name] = result
+	var listeners []func(up bool)
+	if previous == nil || previous.Status != result.Status {
+		listeners = checker.listeners[result.Name]
+	}
+	checker.lock.Unlock()
+
+	if previous != nil && previous.Status != result.Status {
+		if result.Status == StatusDown {
+			log.Printf("[x Health Check %s] %s", result.Name, result.Error)
+		} else if previous.Status == StatusDown {
+			log.Printf("[Health Check %s] Recovered", result.Name)
+		}
+	}
+	for _, listener := range listeners {
+		listener(result.Status == StatusUp)
+	}
+}
+
+// Report returns the last results in the registered order, the status is down when a critical check
+// is not up and degraded when only the non-critical checks fail.
+func (checker *Checker) Report() *Report {
+	checker.lock.RLock()
+	defer checker.lock.RUnlock()
+
+	report := &Report{
+		Status: StatusUp,
+		Checks: make([]*Result, 0, len(checker.checks)),
+	}
+	for _, c := range checker.checks {
+		result := checker.results[c.name]
+		report.Checks = append(report.Checks, result)
+		if result.Status == StatusUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// Ready returns whether all the critical checks are up.
+func (checker *Checker) Ready() bool {
+	return checker.Report().Status != StatusDown
+}
+
+// DialProbe checks the address accepts TCP connections, it is used for the backends without a health API.
+func DialProbe(address string) Probe {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
@@ -0,0 +1,63 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckerReport(t *testing.T) {
+	errDown := errors.New("connection refused")
+	tests := []struct {
+		name       string
+		clickhouse error
+		prometheus error
+		status     Status
+	}{
+		{name: "all up", status: StatusUp},
+		{name: "non-critical down", prometheus: errDown, status: StatusDegraded},
+		{name: "critical down", clickhouse: errDown, status: StatusDown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(time.Minute, 100*time.Millisecond)
+			checker.Register("clickhouse", true, func(ctx context.Context) error { return tt.clickhouse })
+			checker.Register("prometheus", false, func(ctx context.Context) error { return tt.prometheus })
+			changes := make([]bool, 0)
+			checker.OnChange("clickhouse", func(up bool) {
+				changes = append(changes, up)
+			})
+			assert.Equal(t, StatusDown, checker.Report().Status, "critical checks are unknown before the first run")
+
+			checker.CheckAll(context.Background())
+			report := checker.Report()
+			assert.Equal(t, tt.status, report.Status)
+			assert.Equal(t, tt.status != StatusDown, checker.Ready())
+			assert.Equal(t, []bool{tt.clickhouse == nil}, changes)
+			assert.Equal(t, "clickhouse", report.Checks[0].Name)
+			if tt.prometheus != nil {
+				assert.Equal(t, tt.prometheus.Error(), report.Checks[1].Error)
+			}
+
+			// The listeners are only called when the status changes.
+			checker.CheckAll(context.Background())
+			assert.Equal(t, 1, len(changes))
+		})
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	checker := NewChecker(time.Minute, 50*time.Millisecond)
+	checker.Register("apm_trace", false, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	checker.CheckAll(context.Background())
+	result := checker.Report().Checks[0]
+	assert.Equal(t, StatusDown, result.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), result.Error)
+	assert.GreaterOrEqual(t, result.LatencyMs, float64(50))
+}
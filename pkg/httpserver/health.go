@@ -0,0 +1,26 @@
+package httpserver
+
+import (
+	"github.com/kataras/iris/v12"
+
+	"github.com/CloudDetail/apo-receiver/pkg/health"
+)
+
+// healthz reports the receiver is alive, a dependency failure is shown in the detail but does not fail the probe,
+// otherwise Kubernetes would restart the receiver for an unreachable ClickHouse.
+func healthz(checker *health.Checker) iris.Handler {
+	return func(ctx iris.Context) {
+		_ = ctx.JSON(checker.Report())
+	}
+}
+
+// readyz returns 503 while any critical dependency is down.
+func readyz(checker *health.Checker) iris.Handler {
+	return func(ctx iris.Context) {
+		report := checker.Report()
+		if report.Status == health.StatusDown {
+			ctx.StatusCode(iris.StatusServiceUnavailable)
+		}
+		_ = ctx.JSON(report)
+	}
+}
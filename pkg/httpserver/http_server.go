@@ -2,51 +2,70 @@ package httpserver
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"log"
-	"os"
-	"os/signal"
+	"net"
 	"strconv"
-	"syscall"
+	"time"
 
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/middleware/pprof"
 
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	"github.com/CloudDetail/apo-receiver/pkg/clickhouse/tables"
 	"github.com/CloudDetail/apo-receiver/pkg/componment/threshold"
 	"github.com/CloudDetail/apo-receiver/pkg/global"
+	"github.com/CloudDetail/apo-receiver/pkg/health"
 	"github.com/CloudDetail/apo-receiver/pkg/metrics"
 
 	slomodel "github.com/CloudDetail/apo-module/slo/api/v1/model"
 	sloconfig "github.com/CloudDetail/apo-module/slo/sdk/v1/config"
 )
 
-func StartHttpServer(port int, openMetricsApi bool) {
+// StartHttpServer listens on port in background, the returned app is used to shut down the server.
+// The server is served by TLS if tlsConfig is not nil, OTLP/HTTP is served if otlpHandler is not nil.
+// The tenant of the query APIs is resolved by authenticator, only the default tenant is queried if it is nil.
+func StartHttpServer(port int, openMetricsApi bool, checker *health.Checker, tlsConfig *tls.Config, otlpHandler iris.Handler, authenticator *auth.Authenticator) *iris.Application {
 	app := iris.Default()
 
+	app.Get("/healthz", healthz(checker))
+	app.Get("/readyz", readyz(checker))
+
 	if openMetricsApi {
 		app.Get("/metrics", getPromMetrics)
 	}
+	app.Get("/debug/metrics", getSelfMetrics)
 	app.Post("/config/slo", setSLOConfig)
 	app.Get("/debug/thresholds", getThresholds)
-	app.Get("/realtimereport/slow/{traceId:string}", realtimeSlowReport)
-	app.Get("/realtimereport/error/{traceId:string}", realtimeErrorReport)
+	app.Get("/realtimereport/slow/{traceId:string}", requireTenant(authenticator), realtimeSlowReport)
+	app.Get("/realtimereport/error/{traceId:string}", requireTenant(authenticator), realtimeErrorReport)
+	app.Get("/dependency/changes", requireTenant(authenticator), queryDependencyChanges(global.CLICK_HOUSE.QueryDependencyChanges))
+	if otlpHandler != nil {
+		app.Post("/v1/traces", otlpHandler)
+	}
 
 	p := pprof.New()
 	app.Any("/debug/pprof", p)
 	app.Any("/debug/pprof/{action:path}", p)
 
-	// Graceful shutdown
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-		<-c
-		log.Println("Shutting down HTTP server...")
-		_ = app.Shutdown(context.Background())
-	}()
-
-	err := app.Listen(":" + strconv.Itoa(port))
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
 	if err != nil {
 		log.Fatalf("Failed to start the http server %v", err)
 	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		log.Println("Enable TLS for the http server")
+	}
+	go func() {
+		// The receiver lifecycle shuts down the server, so the interrupt handler of iris is disabled.
+		err := app.Run(iris.Listener(listener), iris.WithoutInterruptHandler, iris.WithoutServerError(iris.ErrServerClosed))
+		if err != nil {
+			log.Fatalf("Failed to start the http server %v", err)
+		}
+	}()
+	return app
 }
 
 type BasicStatus string
@@ -100,10 +119,9 @@ func getThresholds(ctx iris.Context) {
 
 func realtimeSlowReport(ctx iris.Context) {
 	traceId := ctx.Params().GetString("traceId")
-
-	traces, err := global.CLICK_HOUSE.QueryTraces(ctx, traceId)
+	traces, err := global.CLICK_HOUSE.QueryTraces(ctx, getTenant(ctx), traceId)
 	if err != nil {
-		responseWithError(ctx, err)
+		responseWithQueryError(ctx, err)
 		return
 	}
 
@@ -121,10 +139,9 @@ func realtimeSlowReport(ctx iris.Context) {
 
 func realtimeErrorReport(ctx iris.Context) {
 	traceId := ctx.Params().GetString("traceId")
-
-	traces, err := global.CLICK_HOUSE.QueryTraces(ctx, traceId)
+	traces, err := global.CLICK_HOUSE.QueryTraces(ctx, getTenant(ctx), traceId)
 	if err != nil {
-		responseWithError(ctx, err)
+		responseWithQueryError(ctx, err)
 		return
 	}
 
@@ -139,12 +156,101 @@ func realtimeErrorReport(ctx iris.Context) {
 	})
 }
 
+const (
+	defaultDependencyChangeRange = time.Hour
+	defaultDependencyChangeLimit = 100
+	maxDependencyChangeLimit     = 1000
+)
+
+type dependencyChangeQuerier func(ctx context.Context, tenantName string, query *tables.DependencyChangeQuery) ([]*report.DependencyChange, error)
+
+// queryDependencyChanges returns the edges added to or removed from the services, the latest first.
+// startTime and endTime are in unix seconds, the last hour is queried if they are not set.
+// The changes are filtered by service and change (added / removed) if set.
+func queryDependencyChanges(querier dependencyChangeQuerier) iris.Handler {
+	return func(ctx iris.Context) {
+		query, err := getDependencyChangeQuery(ctx, time.Now())
+		if err != nil {
+			responseWithStatus(ctx, iris.StatusBadRequest, err)
+			return
+		}
+
+		changes, err := querier(ctx, getTenant(ctx), query)
+		if err != nil {
+			responseWithQueryError(ctx, err)
+			return
+		}
+		ctx.JSON(iris.Map{
+			"success": true,
+			"data":    changes,
+		})
+	}
+}
+
+func getDependencyChangeQuery(ctx iris.Context, now time.Time) (*tables.DependencyChangeQuery, error) {
+	endTime, err := getInt64Param(ctx, "endTime", now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	startTime, err := getInt64Param(ctx, "startTime", endTime-int64(defaultDependencyChangeRange.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	if startTime > endTime {
+		return nil, fmt.Errorf("startTime %d is after endTime %d", startTime, endTime)
+	}
+	change := ctx.URLParam("change")
+	if change != "" && change != report.DependencyAdded && change != report.DependencyRemoved {
+		return nil, fmt.Errorf("invalid change %q, must be %s or %s", change, report.DependencyAdded, report.DependencyRemoved)
+	}
+	limit, err := getInt64Param(ctx, "limit", defaultDependencyChangeLimit)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxDependencyChangeLimit {
+		return nil, fmt.Errorf("invalid limit %d, must be in (0, %d]", limit, maxDependencyChangeLimit)
+	}
+	return &tables.DependencyChangeQuery{
+		StartTime: time.Unix(startTime, 0).UTC(),
+		EndTime:   time.Unix(endTime, 0).UTC(),
+		Service:   ctx.URLParam("service"),
+		Change:    change,
+		Limit:     int(limit),
+	}, nil
+}
+
+// getInt64Param returns defaultValue if the query param is not set.
+func getInt64Param(ctx iris.Context, name string, defaultValue int64) (int64, error) {
+	value := ctx.URLParam(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return parsed, nil
+}
+
+// getPromMetrics exports the metrics generated from the traces and the metrics of the receiver itself.
 func getPromMetrics(ctx iris.Context) {
+	getSelfMetrics(ctx)
 	metrics.GetMetrics(ctx.ResponseWriter())
 }
 
+// getSelfMetrics exports the metrics of the receiver itself, it is served without open_api_metrics to alert on the receiver.
+func getSelfMetrics(ctx iris.Context) {
+	if err := metrics.GetSelfMetrics(ctx.ResponseWriter()); err != nil {
+		log.Printf("[x Collect Self Metrics] %s", err.Error())
+	}
+}
+
 func responseWithError(ctx iris.Context, err error) {
-	ctx.StopWithStatus(iris.StatusInternalServerError)
+	responseWithStatus(ctx, iris.StatusInternalServerError, err)
+}
+
+func responseWithStatus(ctx iris.Context, statusCode int, err error) {
+	ctx.StopWithStatus(statusCode)
 	ctx.JSON(iris.Map{
 		"success":  false,
 		"errorMsg": err.Error(),
@@ -0,0 +1,137 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/analyzer/report"
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	"github.com/CloudDetail/apo-receiver/pkg/clickhouse"
+	"github.com/CloudDetail/apo-receiver/pkg/clickhouse/tables"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+func TestGetDependencyChangeQuery(t *testing.T) {
+	now := time.Unix(10000, 0)
+	app := iris.New()
+	var query *tables.DependencyChangeQuery
+	var queryErr error
+	app.Get("/", func(ctx iris.Context) {
+		query, queryErr = getDependencyChangeQuery(ctx, now)
+	})
+	assert.NoError(t, app.Build())
+	get := func(url string) {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, url, nil))
+	}
+
+	// The last hour is queried by default.
+	get("/")
+	if assert.NoError(t, queryErr) {
+		assert.Equal(t, &tables.DependencyChangeQuery{
+			StartTime: time.Unix(10000-3600, 0).UTC(),
+			EndTime:   now.UTC(),
+			Limit:     defaultDependencyChangeLimit,
+		}, query)
+	}
+
+	get("/?startTime=100&endTime=200&service=order&change=removed&limit=1000")
+	if assert.NoError(t, queryErr) {
+		assert.Equal(t, &tables.DependencyChangeQuery{
+			StartTime: time.Unix(100, 0).UTC(),
+			EndTime:   time.Unix(200, 0).UTC(),
+			Service:   "order",
+			Change:    report.DependencyRemoved,
+			Limit:     1000,
+		}, query)
+	}
+
+	// The range ends at endTime if only it is set.
+	get("/?endTime=7200")
+	if assert.NoError(t, queryErr) {
+		assert.Equal(t, time.Unix(3600, 0).UTC(), query.StartTime)
+	}
+
+	for _, url := range []string{
+		"/?startTime=300&endTime=200",
+		"/?startTime=abc",
+		"/?endTime=1.5",
+		"/?change=changed",
+		"/?limit=0",
+		"/?limit=1001",
+		"/?limit=-1",
+	} {
+		get(url)
+		assert.Error(t, queryErr, url)
+	}
+}
+
+type dependencyChangesResponse struct {
+	Success  bool                       `json:"success"`
+	ErrorMsg string                     `json:"errorMsg"`
+	Data     []*report.DependencyChange `json:"data"`
+}
+
+func TestQueryDependencyChanges(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(&config.AuthConfig{
+		Enable: true,
+		Tokens: []*config.AuthTokenConfig{
+			{Token: "token-1", Tenant: "t1"},
+			{Token: "token-2", Tenant: "t2"},
+		},
+	})
+	assert.NoError(t, err)
+	var queriedTenant string
+	app := iris.New()
+	app.Get("/dependency/changes", requireTenant(authenticator), queryDependencyChanges(func(ctx context.Context, tenantName string, query *tables.DependencyChangeQuery) ([]*report.DependencyChange, error) {
+		queriedTenant = tenantName
+		switch tenantName {
+		case "t1":
+			return []*report.DependencyChange{{Service: query.Service, Change: report.DependencyAdded}}, nil
+		case "t2":
+			return nil, clickhouse.ErrUnknownTenant
+		}
+		return nil, errors.New("unexpected tenant")
+	}))
+	assert.NoError(t, app.Build())
+	request := func(url string, token string) (int, *dependencyChangesResponse) {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+		response := &dependencyChangesResponse{}
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), response))
+		return recorder.Code, response
+	}
+
+	code, response := request("/dependency/changes?service=order", "token-1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, response.Success)
+	if assert.Len(t, response.Data, 1) {
+		assert.Equal(t, "order", response.Data[0].Service)
+	}
+	assert.Equal(t, "t1", queriedTenant)
+
+	// The database of the tenant is not created by the query.
+	code, response = request("/dependency/changes", "token-2")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.False(t, response.Success)
+
+	queriedTenant = ""
+	code, _ = request("/dependency/changes?limit=0", "token-1")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = request("/dependency/changes?tenant=t2", "token-1")
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = request("/dependency/changes", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "", queriedTenant)
+}
@@ -0,0 +1,59 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kataras/iris/v12"
+
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	"github.com/CloudDetail/apo-receiver/pkg/clickhouse"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
+)
+
+const tenantValueKey = "tenant"
+
+// requireTenant resolves the tenant of the query APIs by the same auth with the gRPC services.
+// The tenant param is only allowed to be the tenant of the identity, the other tenants are forbidden if auth is disabled.
+func requireTenant(authenticator *auth.Authenticator) iris.Handler {
+	return func(ctx iris.Context) {
+		tenantName := ctx.URLParam("tenant")
+		if !tenant.ValidName(tenantName) {
+			responseWithStatus(ctx, iris.StatusBadRequest, fmt.Errorf("invalid tenant %q", tenantName))
+			return
+		}
+		if authenticator == nil {
+			if tenantName != "" {
+				responseWithStatus(ctx, iris.StatusForbidden, fmt.Errorf("tenant %q is not allowed without auth", tenantName))
+				return
+			}
+		} else {
+			identity, err := authenticator.AuthenticateHttp(ctx.Request().Context(), ctx.Request().Header)
+			if err != nil {
+				responseWithStatus(ctx, iris.StatusUnauthorized, err)
+				return
+			}
+			if tenantName != "" && tenantName != identity.GetTenant() {
+				responseWithStatus(ctx, iris.StatusForbidden, fmt.Errorf("tenant %q is not allowed", tenantName))
+				return
+			}
+			tenantName = identity.GetTenant()
+		}
+		ctx.Values().Set(tenantValueKey, tenantName)
+		ctx.Next()
+	}
+}
+
+// getTenant returns the tenant resolved by requireTenant, empty for the default tenant.
+func getTenant(ctx iris.Context) string {
+	return ctx.Values().GetString(tenantValueKey)
+}
+
+// responseWithQueryError responds 404 for the unknown tenants, they are not created by the queries.
+func responseWithQueryError(ctx iris.Context, err error) {
+	if errors.Is(err, clickhouse.ErrUnknownTenant) {
+		responseWithStatus(ctx, iris.StatusNotFound, err)
+		return
+	}
+	responseWithError(ctx, err)
+}
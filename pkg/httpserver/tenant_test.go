@@ -0,0 +1,68 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kataras/iris/v12"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+func newTenantApp(t *testing.T, authenticator *auth.Authenticator) *iris.Application {
+	app := iris.New()
+	app.Get("/tenant", requireTenant(authenticator), func(ctx iris.Context) {
+		ctx.WriteString(getTenant(ctx))
+	})
+	assert.NoError(t, app.Build())
+	return app
+}
+
+func requestTenant(app *iris.Application, url string, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, url, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestRequireTenantWithoutAuth(t *testing.T) {
+	app := newTenantApp(t, nil)
+
+	response := requestTenant(app, "/tenant", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "", response.Body.String())
+
+	// The other tenants can not be queried without auth.
+	assert.Equal(t, http.StatusForbidden, requestTenant(app, "/tenant?tenant=t1", "").Code)
+	assert.Equal(t, http.StatusBadRequest, requestTenant(app, "/tenant?tenant=a.b", "").Code)
+}
+
+func TestRequireTenantWithAuth(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(&config.AuthConfig{
+		Enable: true,
+		Tokens: []*config.AuthTokenConfig{
+			{Token: "token-1", Tenant: "t1"},
+			{Token: "token-default"},
+		},
+	})
+	assert.NoError(t, err)
+	app := newTenantApp(t, authenticator)
+
+	assert.Equal(t, http.StatusUnauthorized, requestTenant(app, "/tenant", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, requestTenant(app, "/tenant", "unknown").Code)
+
+	// The tenant is resolved from the token.
+	response := requestTenant(app, "/tenant", "token-1")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "t1", response.Body.String())
+	assert.Equal(t, http.StatusOK, requestTenant(app, "/tenant?tenant=t1", "token-1").Code)
+
+	assert.Equal(t, http.StatusForbidden, requestTenant(app, "/tenant?tenant=t2", "token-1").Code)
+	assert.Equal(t, http.StatusForbidden, requestTenant(app, "/tenant?tenant=t1", "token-default").Code)
+}
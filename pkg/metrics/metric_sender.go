@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"time"
 
 	pb "github.com/CloudDetail/apo-receiver/internal/prometheus"
@@ -16,7 +17,11 @@ type Sender interface {
 	SendMetrics(ctx context.Context) error
 }
 
-func InitMetricSend(url string, interval int, promType string) error {
+// metricSender is the started sender, nil if the metrics are not sent.
+var metricSender Sender
+
+// InitMetricSend sends the metrics to url periodically, client is used to send the requests.
+func InitMetricSend(url string, interval int, promType string, client *http.Client) error {
 	var (
 		sender Sender
 		err    error
@@ -26,12 +31,12 @@ func InitMetricSend(url string, interval int, promType string) error {
 		collectMetrics := func(w io.Writer) {
 			GetMetrics(w)
 		}
-		sender, err = vm.NewVmPusher(url, collectMetrics)
+		sender, err = vm.NewVmPusher(url, collectMetrics, client)
 	} else {
 		buildMetricRequest := func() *pb.WriteRequest {
 			return BuildPromWriteRequest()
 		}
-		sender, err = pm.NewPromRemoteWriter(url, buildMetricRequest)
+		sender, err = pm.NewPromRemoteWriter(url, buildMetricRequest, client)
 	}
 
 	if err != nil {
@@ -46,6 +51,7 @@ func InitMetricSendWithOptions(ctx context.Context, interval time.Duration, send
 		return fmt.Errorf("interval must be positive; got %s", interval)
 	}
 
+	metricSender = sender
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
@@ -67,3 +73,11 @@ func InitMetricSendWithOptions(ctx context.Context, interval time.Duration, send
 
 	return nil
 }
+
+// FlushMetrics sends the metrics once, it is called when shutting down to not lose the last interval.
+func FlushMetrics(ctx context.Context) error {
+	if metricSender == nil {
+		return nil
+	}
+	return metricSender.SendMetrics(ctx)
+}
@@ -8,6 +8,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+
 	pb "github.com/CloudDetail/apo-receiver/internal/prometheus"
 	"github.com/CloudDetail/apo-receiver/pkg/metrics/model"
 	"github.com/CloudDetail/apo-receiver/pkg/metrics/pm"
@@ -136,6 +139,22 @@ func GetMetrics(w io.Writer) {
 	}
 }
 
+// GetSelfMetrics writes the metrics registered in the default prometheus registry,
+// which observe the receiver itself, e.g. the task pool and the ClickHouse writes.
+func GetSelfMetrics(w io.Writer) error {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return err
+	}
+	encoder := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func BuildPromWriteRequest() *pb.WriteRequest {
 	ts := time.Now().UnixMilli()
 	timeSeries := make([]*pb.TimeSeries, 0)
@@ -14,7 +14,7 @@ var (
 		Type: MetricHistogram,
 		Keys: []string{
 			"svc_name", "content_key", "node_name", "node_ip", "pid", "containerId",
-			"name", "db_system", "db_name", "db_url", "is_error", "source",
+			"name", "db_system", "db_name", "db_url", "db_fingerprint", "is_error", "source", "tenant",
 		},
 	}
 
@@ -24,7 +24,7 @@ var (
 		Type: MetricHistogram,
 		Keys: []string{
 			"svc_name", "content_key", "node_name", "node_ip", "pid", "containerId",
-			"name", "system", "address", "is_error", "source",
+			"name", "system", "address", "is_error", "source", "tenant",
 		},
 	}
 
@@ -34,7 +34,7 @@ var (
 		Type: MetricHistogram,
 		Keys: []string{
 			"svc_name", "content_key", "node_name", "node_ip", "pid", "containerId",
-			"name", "system", "role", "address", "is_error", "source",
+			"name", "system", "role", "address", "is_error", "source", "tenant",
 		},
 	}
 )
@@ -15,9 +15,10 @@ import (
 type PromRemoteWriter struct {
 	remoteWriteURL       string
 	buildMetricRequestFn func() *pb.WriteRequest
+	client               *http.Client
 }
 
-func NewPromRemoteWriter(writeURL string, buildMetricRequestFn func() *pb.WriteRequest) (*PromRemoteWriter, error) {
+func NewPromRemoteWriter(writeURL string, buildMetricRequestFn func() *pb.WriteRequest, client *http.Client) (*PromRemoteWriter, error) {
 	wu, err := url.Parse(writeURL)
 	if err != nil {
 		return nil, fmt.Errorf("cannot parse writeURL=%q: %w", writeURL, err)
@@ -31,6 +32,7 @@ func NewPromRemoteWriter(writeURL string, buildMetricRequestFn func() *pb.WriteR
 	return &PromRemoteWriter{
 		remoteWriteURL:       writeURL,
 		buildMetricRequestFn: buildMetricRequestFn,
+		client:               client,
 	}, nil
 }
 
@@ -55,7 +57,7 @@ func (pm *PromRemoteWriter) SendMetrics(ctx context.Context) error {
 	httpReq.Header.Set("Content-Type", "application/x-protobuf")
 	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
 
-	if _, err := http.DefaultClient.Do(httpReq); err != nil {
+	if _, err := pm.client.Do(httpReq); err != nil {
 		return fmt.Errorf("unable to send metrics to Prometheus remote write destination: %v", err)
 	}
 	return nil
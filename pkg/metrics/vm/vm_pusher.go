@@ -23,7 +23,7 @@ type VmPusher struct {
 	collectMetricsFn func(w io.Writer)
 }
 
-func NewVmPusher(pushURL string, collectMetricsFn func(w io.Writer)) (*VmPusher, error) {
+func NewVmPusher(pushURL string, collectMetricsFn func(w io.Writer), client *http.Client) (*VmPusher, error) {
 	// validate pushURL
 	pu, err := url.Parse(pushURL)
 	if err != nil {
@@ -40,7 +40,6 @@ func NewVmPusher(pushURL string, collectMetricsFn func(w io.Writer)) (*VmPusher,
 	// validate Headers
 	headers := make(http.Header)
 	pushURLRedacted := pu.Redacted()
-	client := &http.Client{}
 	return &VmPusher{
 		pushURL:            pu,
 		method:             method,
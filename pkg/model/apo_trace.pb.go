@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.30.0
+// 	protoc-gen-go v1.33.0
 // 	protoc        v3.20.3
 // source: pkg/model/apo_trace.proto
 
@@ -26,8 +26,15 @@ type DataGroups struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Name  string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// The data in JSON, sent by the old agents.
 	Datas []string `protobuf:"bytes,2,rep,name=datas,proto3" json:"datas,omitempty"`
+	// The typed data of span_trace and onoff_metric_group, sent instead of datas.
+	//
+	// Types that are assignable to Payload:
+	//	*DataGroups_Traces
+	//	*DataGroups_OnoffMetrics
+	Payload isDataGroups_Payload `protobuf_oneof:"payload"`
 }
 
 func (x *DataGroups) Reset() {
@@ -76,6 +83,853 @@ func (x *DataGroups) GetDatas() []string {
 	return nil
 }
 
+func (m *DataGroups) GetPayload() isDataGroups_Payload {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (x *DataGroups) GetTraces() *Traces {
+	if x, ok := x.GetPayload().(*DataGroups_Traces); ok {
+		return x.Traces
+	}
+	return nil
+}
+
+func (x *DataGroups) GetOnoffMetrics() *OnOffMetrics {
+	if x, ok := x.GetPayload().(*DataGroups_OnoffMetrics); ok {
+		return x.OnoffMetrics
+	}
+	return nil
+}
+
+type isDataGroups_Payload interface {
+	isDataGroups_Payload()
+}
+
+type DataGroups_Traces struct {
+	Traces *Traces `protobuf:"bytes,3,opt,name=traces,proto3,oneof"`
+}
+
+type DataGroups_OnoffMetrics struct {
+	OnoffMetrics *OnOffMetrics `protobuf:"bytes,4,opt,name=onoff_metrics,json=onoffMetrics,proto3,oneof"`
+}
+
+func (*DataGroups_Traces) isDataGroups_Payload() {}
+
+func (*DataGroups_OnoffMetrics) isDataGroups_Payload() {}
+
+type Traces struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Traces []*Trace `protobuf:"bytes,1,rep,name=traces,proto3" json:"traces,omitempty"`
+}
+
+func (x *Traces) Reset() {
+	*x = Traces{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_model_apo_trace_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Traces) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Traces) ProtoMessage() {}
+
+func (x *Traces) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_model_apo_trace_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Traces.ProtoReflect.Descriptor instead.
+func (*Traces) Descriptor() ([]byte, []int) {
+	return file_pkg_model_apo_trace_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Traces) GetTraces() []*Trace {
+	if x != nil {
+		return x.Traces
+	}
+	return nil
+}
+
+// Trace mirrors model.Trace of apo-module.
+type Trace struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Timestamp        uint64       `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	DataVersion      string       `protobuf:"bytes,2,opt,name=data_version,json=dataVersion,proto3" json:"data_version,omitempty"`
+	DataSource       string       `protobuf:"bytes,3,opt,name=data_source,json=dataSource,proto3" json:"data_source,omitempty"`
+	Labels           *TraceLabels `protobuf:"bytes,4,opt,name=labels,proto3" json:"labels,omitempty"`
+	WorkloadName     string       `protobuf:"bytes,5,opt,name=workload_name,json=workloadName,proto3" json:"workload_name,omitempty"`
+	WorkloadKind     string       `protobuf:"bytes,6,opt,name=workload_kind,json=workloadKind,proto3" json:"workload_kind,omitempty"`
+	PodIp            string       `protobuf:"bytes,7,opt,name=pod_ip,json=podIp,proto3" json:"pod_ip,omitempty"`
+	PodName          string       `protobuf:"bytes,8,opt,name=pod_name,json=podName,proto3" json:"pod_name,omitempty"`
+	Namespace        string       `protobuf:"bytes,9,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	OnoffMetrics     string       `protobuf:"bytes,10,opt,name=onoff_metrics,json=onoffMetrics,proto3" json:"onoff_metrics,omitempty"`
+	BaseOnoffMetrics string       `protobuf:"bytes,11,opt,name=base_onoff_metrics,json=baseOnoffMetrics,proto3" json:"base_onoff_metrics,omitempty"`
+	BaseRange        string       `protobuf:"bytes,12,opt,name=base_range,json=baseRange,proto3" json:"base_range,omitempty"`
+	MutatedType      string       `protobuf:"bytes,13,opt,name=mutated_type,json=mutatedType,proto3" json:"mutated_type,omitempty"`
+	// The identity of the agent who sent the trace, only set by the receivers for the traces cached in Redis.
+	// The identity sent by the agents is ignored.
+	Identity *Identity `protobuf:"bytes,14,opt,name=identity,proto3" json:"identity,omitempty"`
+}
+
+func (x *Trace) Reset() {
+	*x = Trace{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_model_apo_trace_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Trace) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Trace) ProtoMessage() {}
+
+func (x *Trace) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_model_apo_trace_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Trace.ProtoReflect.Descriptor instead.
+func (*Trace) Descriptor() ([]byte, []int) {
+	return file_pkg_model_apo_trace_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Trace) GetTimestamp() uint64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *Trace) GetDataVersion() string {
+	if x != nil {
+		return x.DataVersion
+	}
+	return ""
+}
+
+func (x *Trace) GetDataSource() string {
+	if x != nil {
+		return x.DataSource
+	}
+	return ""
+}
+
+func (x *Trace) GetLabels() *TraceLabels {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *Trace) GetWorkloadName() string {
+	if x != nil {
+		return x.WorkloadName
+	}
+	return ""
+}
+
+func (x *Trace) GetWorkloadKind() string {
+	if x != nil {
+		return x.WorkloadKind
+	}
+	return ""
+}
+
+func (x *Trace) GetPodIp() string {
+	if x != nil {
+		return x.PodIp
+	}
+	return ""
+}
+
+func (x *Trace) GetPodName() string {
+	if x != nil {
+		return x.PodName
+	}
+	return ""
+}
+
+func (x *Trace) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *Trace) GetOnoffMetrics() string {
+	if x != nil {
+		return x.OnoffMetrics
+	}
+	return ""
+}
+
+func (x *Trace) GetBaseOnoffMetrics() string {
+	if x != nil {
+		return x.BaseOnoffMetrics
+	}
+	return ""
+}
+
+func (x *Trace) GetBaseRange() string {
+	if x != nil {
+		return x.BaseRange
+	}
+	return ""
+}
+
+func (x *Trace) GetMutatedType() string {
+	if x != nil {
+		return x.MutatedType
+	}
+	return ""
+}
+
+func (x *Trace) GetIdentity() *Identity {
+	if x != nil {
+		return x.Identity
+	}
+	return nil
+}
+
+// Identity mirrors auth.Identity.
+type Identity struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Cluster string `protobuf:"bytes,1,opt,name=cluster,proto3" json:"cluster,omitempty"`
+	Tenant  string `protobuf:"bytes,2,opt,name=tenant,proto3" json:"tenant,omitempty"`
+	Node    string `protobuf:"bytes,3,opt,name=node,proto3" json:"node,omitempty"`
+}
+
+func (x *Identity) Reset() {
+	*x = Identity{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_model_apo_trace_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Identity) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Identity) ProtoMessage() {}
+
+func (x *Identity) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_model_apo_trace_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Identity.ProtoReflect.Descriptor instead.
+func (*Identity) Descriptor() ([]byte, []int) {
+	return file_pkg_model_apo_trace_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Identity) GetCluster() string {
+	if x != nil {
+		return x.Cluster
+	}
+	return ""
+}
+
+func (x *Identity) GetTenant() string {
+	if x != nil {
+		return x.Tenant
+	}
+	return ""
+}
+
+func (x *Identity) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+// TraceLabels mirrors model.TraceLabels of apo-module.
+type TraceLabels struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Pid            uint32  `protobuf:"varint,1,opt,name=pid,proto3" json:"pid,omitempty"`
+	Tid            uint32  `protobuf:"varint,2,opt,name=tid,proto3" json:"tid,omitempty"`
+	TopSpan        bool    `protobuf:"varint,3,opt,name=top_span,json=topSpan,proto3" json:"top_span,omitempty"`
+	Protocol       string  `protobuf:"bytes,4,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	ServiceName    string  `protobuf:"bytes,5,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`
+	ContentKey     string  `protobuf:"bytes,6,opt,name=content_key,json=contentKey,proto3" json:"content_key,omitempty"`
+	HttpUrl        string  `protobuf:"bytes,7,opt,name=http_url,json=httpUrl,proto3" json:"http_url,omitempty"`
+	IsSilent       bool    `protobuf:"varint,8,opt,name=is_silent,json=isSilent,proto3" json:"is_silent,omitempty"`
+	IsSampled      bool    `protobuf:"varint,9,opt,name=is_sampled,json=isSampled,proto3" json:"is_sampled,omitempty"`
+	IsSlow         bool    `protobuf:"varint,10,opt,name=is_slow,json=isSlow,proto3" json:"is_slow,omitempty"`
+	IsServer       bool    `protobuf:"varint,11,opt,name=is_server,json=isServer,proto3" json:"is_server,omitempty"`
+	IsError        bool    `protobuf:"varint,12,opt,name=is_error,json=isError,proto3" json:"is_error,omitempty"`
+	IsProfiled     bool    `protobuf:"varint,13,opt,name=is_profiled,json=isProfiled,proto3" json:"is_profiled,omitempty"`
+	SampleValue    int64   `protobuf:"varint,14,opt,name=sample_value,json=sampleValue,proto3" json:"sample_value,omitempty"`
+	ReportType     uint32  `protobuf:"varint,15,opt,name=report_type,json=reportType,proto3" json:"report_type,omitempty"`
+	ThresholdType  string  `protobuf:"bytes,16,opt,name=threshold_type,json=thresholdType,proto3" json:"threshold_type,omitempty"`
+	ThresholdValue float64 `protobuf:"fixed64,17,opt,name=threshold_value,json=thresholdValue,proto3" json:"threshold_value,omitempty"`
+	ThresholdRange string  `protobuf:"bytes,18,opt,name=threshold_range,json=thresholdRange,proto3" json:"threshold_range,omitempty"`
+	// 0 is taken as 1.
+	ThresholdMultiple float64 `protobuf:"fixed64,19,opt,name=threshold_multiple,json=thresholdMultiple,proto3" json:"threshold_multiple,omitempty"`
+	TraceId           string  `protobuf:"bytes,20,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`
+	ApmType           string  `protobuf:"bytes,21,opt,name=apm_type,json=apmType,proto3" json:"apm_type,omitempty"`
+	ApmSpanId         string  `protobuf:"bytes,22,opt,name=apm_span_id,json=apmSpanId,proto3" json:"apm_span_id,omitempty"`
+	Attributes        string  `protobuf:"bytes,23,opt,name=attributes,proto3" json:"attributes,omitempty"`
+	ContainerId       string  `protobuf:"bytes,24,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	ContainerName     string  `protobuf:"bytes,25,opt,name=container_name,json=containerName,proto3" json:"container_name,omitempty"`
+	StartTime         uint64  `protobuf:"varint,26,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	Duration          uint64  `protobuf:"varint,27,opt,name=duration,proto3" json:"duration,omitempty"`
+	EndTime           uint64  `protobuf:"varint,28,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	NodeName          string  `protobuf:"bytes,29,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`
+	NodeIp            string  `protobuf:"bytes,30,opt,name=node_ip,json=nodeIp,proto3" json:"node_ip,omitempty"`
+	OffsetTs          int64   `protobuf:"varint,31,opt,name=offset_ts,json=offsetTs,proto3" json:"offset_ts,omitempty"`
+}
+
+func (x *TraceLabels) Reset() {
+	*x = TraceLabels{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_model_apo_trace_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TraceLabels) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TraceLabels) ProtoMessage() {}
+
+func (x *TraceLabels) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_model_apo_trace_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TraceLabels.ProtoReflect.Descriptor instead.
+func (*TraceLabels) Descriptor() ([]byte, []int) {
+	return file_pkg_model_apo_trace_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TraceLabels) GetPid() uint32 {
+	if x != nil {
+		return x.Pid
+	}
+	return 0
+}
+
+func (x *TraceLabels) GetTid() uint32 {
+	if x != nil {
+		return x.Tid
+	}
+	return 0
+}
+
+func (x *TraceLabels) GetTopSpan() bool {
+	if x != nil {
+		return x.TopSpan
+	}
+	return false
+}
+
+func (x *TraceLabels) GetProtocol() string {
+	if x != nil {
+		return x.Protocol
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetServiceName() string {
+	if x != nil {
+		return x.ServiceName
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetContentKey() string {
+	if x != nil {
+		return x.ContentKey
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetHttpUrl() string {
+	if x != nil {
+		return x.HttpUrl
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetIsSilent() bool {
+	if x != nil {
+		return x.IsSilent
+	}
+	return false
+}
+
+func (x *TraceLabels) GetIsSampled() bool {
+	if x != nil {
+		return x.IsSampled
+	}
+	return false
+}
+
+func (x *TraceLabels) GetIsSlow() bool {
+	if x != nil {
+		return x.IsSlow
+	}
+	return false
+}
+
+func (x *TraceLabels) GetIsServer() bool {
+	if x != nil {
+		return x.IsServer
+	}
+	return false
+}
+
+func (x *TraceLabels) GetIsError() bool {
+	if x != nil {
+		return x.IsError
+	}
+	return false
+}
+
+func (x *TraceLabels) GetIsProfiled() bool {
+	if x != nil {
+		return x.IsProfiled
+	}
+	return false
+}
+
+func (x *TraceLabels) GetSampleValue() int64 {
+	if x != nil {
+		return x.SampleValue
+	}
+	return 0
+}
+
+func (x *TraceLabels) GetReportType() uint32 {
+	if x != nil {
+		return x.ReportType
+	}
+	return 0
+}
+
+func (x *TraceLabels) GetThresholdType() string {
+	if x != nil {
+		return x.ThresholdType
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetThresholdValue() float64 {
+	if x != nil {
+		return x.ThresholdValue
+	}
+	return 0
+}
+
+func (x *TraceLabels) GetThresholdRange() string {
+	if x != nil {
+		return x.ThresholdRange
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetThresholdMultiple() float64 {
+	if x != nil {
+		return x.ThresholdMultiple
+	}
+	return 0
+}
+
+func (x *TraceLabels) GetTraceId() string {
+	if x != nil {
+		return x.TraceId
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetApmType() string {
+	if x != nil {
+		return x.ApmType
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetApmSpanId() string {
+	if x != nil {
+		return x.ApmSpanId
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetAttributes() string {
+	if x != nil {
+		return x.Attributes
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetContainerId() string {
+	if x != nil {
+		return x.ContainerId
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetContainerName() string {
+	if x != nil {
+		return x.ContainerName
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetStartTime() uint64 {
+	if x != nil {
+		return x.StartTime
+	}
+	return 0
+}
+
+func (x *TraceLabels) GetDuration() uint64 {
+	if x != nil {
+		return x.Duration
+	}
+	return 0
+}
+
+func (x *TraceLabels) GetEndTime() uint64 {
+	if x != nil {
+		return x.EndTime
+	}
+	return 0
+}
+
+func (x *TraceLabels) GetNodeName() string {
+	if x != nil {
+		return x.NodeName
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetNodeIp() string {
+	if x != nil {
+		return x.NodeIp
+	}
+	return ""
+}
+
+func (x *TraceLabels) GetOffsetTs() int64 {
+	if x != nil {
+		return x.OffsetTs
+	}
+	return 0
+}
+
+type OnOffMetrics struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Metrics []*OnOffMetric `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+}
+
+func (x *OnOffMetrics) Reset() {
+	*x = OnOffMetrics{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_model_apo_trace_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *OnOffMetrics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OnOffMetrics) ProtoMessage() {}
+
+func (x *OnOffMetrics) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_model_apo_trace_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OnOffMetrics.ProtoReflect.Descriptor instead.
+func (*OnOffMetrics) Descriptor() ([]byte, []int) {
+	return file_pkg_model_apo_trace_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *OnOffMetrics) GetMetrics() []*OnOffMetric {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+// OnOffMetric is the on/off cpu metrics of a span.
+type OnOffMetric struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Timestamp   uint64 `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Pid         uint32 `protobuf:"varint,2,opt,name=pid,proto3" json:"pid,omitempty"`
+	Tid         uint32 `protobuf:"varint,3,opt,name=tid,proto3" json:"tid,omitempty"`
+	ContainerId string `protobuf:"bytes,4,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	TraceId     string `protobuf:"bytes,5,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`
+	SpanId      string `protobuf:"bytes,6,opt,name=span_id,json=spanId,proto3" json:"span_id,omitempty"`
+	Metrics     string `protobuf:"bytes,7,opt,name=metrics,proto3" json:"metrics,omitempty"`
+}
+
+func (x *OnOffMetric) Reset() {
+	*x = OnOffMetric{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_model_apo_trace_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *OnOffMetric) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OnOffMetric) ProtoMessage() {}
+
+func (x *OnOffMetric) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_model_apo_trace_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OnOffMetric.ProtoReflect.Descriptor instead.
+func (*OnOffMetric) Descriptor() ([]byte, []int) {
+	return file_pkg_model_apo_trace_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *OnOffMetric) GetTimestamp() uint64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *OnOffMetric) GetPid() uint32 {
+	if x != nil {
+		return x.Pid
+	}
+	return 0
+}
+
+func (x *OnOffMetric) GetTid() uint32 {
+	if x != nil {
+		return x.Tid
+	}
+	return 0
+}
+
+func (x *OnOffMetric) GetContainerId() string {
+	if x != nil {
+		return x.ContainerId
+	}
+	return ""
+}
+
+func (x *OnOffMetric) GetTraceId() string {
+	if x != nil {
+		return x.TraceId
+	}
+	return ""
+}
+
+func (x *OnOffMetric) GetSpanId() string {
+	if x != nil {
+		return x.SpanId
+	}
+	return ""
+}
+
+func (x *OnOffMetric) GetMetrics() string {
+	if x != nil {
+		return x.Metrics
+	}
+	return ""
+}
+
+type DataGroupsMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Increased by 1 for each message on the stream, the first seq can be any positive value.
+	Seq        uint64      `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	DataGroups *DataGroups `protobuf:"bytes,2,opt,name=data_groups,json=dataGroups,proto3" json:"data_groups,omitempty"`
+}
+
+func (x *DataGroupsMessage) Reset() {
+	*x = DataGroupsMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_model_apo_trace_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DataGroupsMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DataGroupsMessage) ProtoMessage() {}
+
+func (x *DataGroupsMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_model_apo_trace_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DataGroupsMessage.ProtoReflect.Descriptor instead.
+func (*DataGroupsMessage) Descriptor() ([]byte, []int) {
+	return file_pkg_model_apo_trace_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DataGroupsMessage) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *DataGroupsMessage) GetDataGroups() *DataGroups {
+	if x != nil {
+		return x.DataGroups
+	}
+	return nil
+}
+
+type DataGroupsAck struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The last seq whose data groups are written or spooled by the receiver.
+	AckedSeq uint64 `protobuf:"varint,1,opt,name=acked_seq,json=ackedSeq,proto3" json:"acked_seq,omitempty"`
+	// The number of messages can be sent after acked_seq.
+	Window uint32 `protobuf:"varint,2,opt,name=window,proto3" json:"window,omitempty"`
+}
+
+func (x *DataGroupsAck) Reset() {
+	*x = DataGroupsAck{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_model_apo_trace_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DataGroupsAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DataGroupsAck) ProtoMessage() {}
+
+func (x *DataGroupsAck) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_model_apo_trace_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DataGroupsAck.ProtoReflect.Descriptor instead.
+func (*DataGroupsAck) Descriptor() ([]byte, []int) {
+	return file_pkg_model_apo_trace_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DataGroupsAck) GetAckedSeq() uint64 {
+	if x != nil {
+		return x.AckedSeq
+	}
+	return 0
+}
+
+func (x *DataGroupsAck) GetWindow() uint32 {
+	if x != nil {
+		return x.Window
+	}
+	return 0
+}
+
 var File_pkg_model_apo_trace_proto protoreflect.FileDescriptor
 
 var file_pkg_model_apo_trace_proto_rawDesc = []byte{
@@ -83,16 +937,156 @@ var file_pkg_model_apo_trace_proto_rawDesc = []byte{
 	0x74, 0x72, 0x61, 0x63, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x08, 0x6b, 0x69, 0x6e,
 	0x64, 0x6c, 0x69, 0x6e, 0x67, 0x1a, 0x1b, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72,
 	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x65, 0x6d, 0x70, 0x74, 0x79, 0x2e, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x22, 0x36, 0x0a, 0x0a, 0x44, 0x61, 0x74, 0x61, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x73,
-	0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
-	0x6e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x64, 0x61, 0x74, 0x61, 0x73, 0x18, 0x02, 0x20,
-	0x03, 0x28, 0x09, 0x52, 0x05, 0x64, 0x61, 0x74, 0x61, 0x73, 0x32, 0x4f, 0x0a, 0x0c, 0x54, 0x72,
-	0x61, 0x63, 0x65, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x3f, 0x0a, 0x0f, 0x53, 0x74,
-	0x6f, 0x72, 0x65, 0x44, 0x61, 0x74, 0x61, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x73, 0x12, 0x14, 0x2e,
+	0x74, 0x6f, 0x22, 0xac, 0x01, 0x0a, 0x0a, 0x44, 0x61, 0x74, 0x61, 0x47, 0x72, 0x6f, 0x75, 0x70,
+	0x73, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x64, 0x61, 0x74, 0x61, 0x73, 0x18, 0x02,
+	0x20, 0x03, 0x28, 0x09, 0x52, 0x05, 0x64, 0x61, 0x74, 0x61, 0x73, 0x12, 0x2a, 0x0a, 0x06, 0x74,
+	0x72, 0x61, 0x63, 0x65, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x6b, 0x69,
+	0x6e, 0x64, 0x6c, 0x69, 0x6e, 0x67, 0x2e, 0x54, 0x72, 0x61, 0x63, 0x65, 0x73, 0x48, 0x00, 0x52,
+	0x06, 0x74, 0x72, 0x61, 0x63, 0x65, 0x73, 0x12, 0x3d, 0x0a, 0x0d, 0x6f, 0x6e, 0x6f, 0x66, 0x66,
+	0x5f, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16,
+	0x2e, 0x6b, 0x69, 0x6e, 0x64, 0x6c, 0x69, 0x6e, 0x67, 0x2e, 0x4f, 0x6e, 0x4f, 0x66, 0x66, 0x4d,
+	0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x48, 0x00, 0x52, 0x0c, 0x6f, 0x6e, 0x6f, 0x66, 0x66, 0x4d,
+	0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x42, 0x09, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61,
+	0x64, 0x22, 0x31, 0x0a, 0x06, 0x54, 0x72, 0x61, 0x63, 0x65, 0x73, 0x12, 0x27, 0x0a, 0x06, 0x74,
+	0x72, 0x61, 0x63, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x6b, 0x69,
+	0x6e, 0x64, 0x6c, 0x69, 0x6e, 0x67, 0x2e, 0x54, 0x72, 0x61, 0x63, 0x65, 0x52, 0x06, 0x74, 0x72,
+	0x61, 0x63, 0x65, 0x73, 0x22, 0xf7, 0x03, 0x0a, 0x05, 0x54, 0x72, 0x61, 0x63, 0x65, 0x12, 0x1c,
+	0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x21, 0x0a, 0x0c,
+	0x64, 0x61, 0x74, 0x61, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0b, 0x64, 0x61, 0x74, 0x61, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12,
+	0x1f, 0x0a, 0x0b, 0x64, 0x61, 0x74, 0x61, 0x5f, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x64, 0x61, 0x74, 0x61, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65,
+	0x12, 0x2d, 0x0a, 0x06, 0x6c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x15, 0x2e, 0x6b, 0x69, 0x6e, 0x64, 0x6c, 0x69, 0x6e, 0x67, 0x2e, 0x54, 0x72, 0x61, 0x63,
+	0x65, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x52, 0x06, 0x6c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x12,
+	0x23, 0x0a, 0x0d, 0x77, 0x6f, 0x72, 0x6b, 0x6c, 0x6f, 0x61, 0x64, 0x5f, 0x6e, 0x61, 0x6d, 0x65,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x77, 0x6f, 0x72, 0x6b, 0x6c, 0x6f, 0x61, 0x64,
+	0x4e, 0x61, 0x6d, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x77, 0x6f, 0x72, 0x6b, 0x6c, 0x6f, 0x61, 0x64,
+	0x5f, 0x6b, 0x69, 0x6e, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x77, 0x6f, 0x72,
+	0x6b, 0x6c, 0x6f, 0x61, 0x64, 0x4b, 0x69, 0x6e, 0x64, 0x12, 0x15, 0x0a, 0x06, 0x70, 0x6f, 0x64,
+	0x5f, 0x69, 0x70, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x70, 0x6f, 0x64, 0x49, 0x70,
+	0x12, 0x19, 0x0a, 0x08, 0x70, 0x6f, 0x64, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x08, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x07, 0x70, 0x6f, 0x64, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x6e,
+	0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09,
+	0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x6f, 0x6e, 0x6f,
+	0x66, 0x66, 0x5f, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0c, 0x6f, 0x6e, 0x6f, 0x66, 0x66, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x12, 0x2c,
+	0x0a, 0x12, 0x62, 0x61, 0x73, 0x65, 0x5f, 0x6f, 0x6e, 0x6f, 0x66, 0x66, 0x5f, 0x6d, 0x65, 0x74,
+	0x72, 0x69, 0x63, 0x73, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x62, 0x61, 0x73, 0x65,
+	0x4f, 0x6e, 0x6f, 0x66, 0x66, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x12, 0x1d, 0x0a, 0x0a,
+	0x62, 0x61, 0x73, 0x65, 0x5f, 0x72, 0x61, 0x6e, 0x67, 0x65, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x62, 0x61, 0x73, 0x65, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x12, 0x21, 0x0a, 0x0c, 0x6d,
+	0x75, 0x74, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x0d, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0b, 0x6d, 0x75, 0x74, 0x61, 0x74, 0x65, 0x64, 0x54, 0x79, 0x70, 0x65, 0x12, 0x2e,
+	0x0a, 0x08, 0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x12, 0x2e, 0x6b, 0x69, 0x6e, 0x64, 0x6c, 0x69, 0x6e, 0x67, 0x2e, 0x49, 0x64, 0x65, 0x6e,
+	0x74, 0x69, 0x74, 0x79, 0x52, 0x08, 0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x22, 0x50,
+	0x0a, 0x08, 0x49, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6c,
+	0x75, 0x73, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6c, 0x75,
+	0x73, 0x74, 0x65, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x12, 0x12, 0x0a, 0x04,
+	0x6e, 0x6f, 0x64, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x6f, 0x64, 0x65,
+	0x22, 0xca, 0x07, 0x0a, 0x0b, 0x54, 0x72, 0x61, 0x63, 0x65, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73,
+	0x12, 0x10, 0x0a, 0x03, 0x70, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x70,
+	0x69, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x74, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x03, 0x74, 0x69, 0x64, 0x12, 0x19, 0x0a, 0x08, 0x74, 0x6f, 0x70, 0x5f, 0x73, 0x70, 0x61, 0x6e,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x74, 0x6f, 0x70, 0x53, 0x70, 0x61, 0x6e, 0x12,
+	0x1a, 0x0a, 0x08, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x12, 0x21, 0x0a, 0x0c, 0x73,
+	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0b, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x1f,
+	0x0a, 0x0b, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0a, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x4b, 0x65, 0x79, 0x12,
+	0x19, 0x0a, 0x08, 0x68, 0x74, 0x74, 0x70, 0x5f, 0x75, 0x72, 0x6c, 0x18, 0x07, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x07, 0x68, 0x74, 0x74, 0x70, 0x55, 0x72, 0x6c, 0x12, 0x1b, 0x0a, 0x09, 0x69, 0x73,
+	0x5f, 0x73, 0x69, 0x6c, 0x65, 0x6e, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x69,
+	0x73, 0x53, 0x69, 0x6c, 0x65, 0x6e, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x69, 0x73, 0x5f, 0x73, 0x61,
+	0x6d, 0x70, 0x6c, 0x65, 0x64, 0x18, 0x09, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x69, 0x73, 0x53,
+	0x61, 0x6d, 0x70, 0x6c, 0x65, 0x64, 0x12, 0x17, 0x0a, 0x07, 0x69, 0x73, 0x5f, 0x73, 0x6c, 0x6f,
+	0x77, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x69, 0x73, 0x53, 0x6c, 0x6f, 0x77, 0x12,
+	0x1b, 0x0a, 0x09, 0x69, 0x73, 0x5f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x18, 0x0b, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x08, 0x69, 0x73, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x12, 0x19, 0x0a, 0x08,
+	0x69, 0x73, 0x5f, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07,
+	0x69, 0x73, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x1f, 0x0a, 0x0b, 0x69, 0x73, 0x5f, 0x70, 0x72,
+	0x6f, 0x66, 0x69, 0x6c, 0x65, 0x64, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x69, 0x73,
+	0x50, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x73, 0x61, 0x6d, 0x70,
+	0x6c, 0x65, 0x5f, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0b,
+	0x73, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x72,
+	0x65, 0x70, 0x6f, 0x72, 0x74, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x0a, 0x72, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x25, 0x0a, 0x0e,
+	0x74, 0x68, 0x72, 0x65, 0x73, 0x68, 0x6f, 0x6c, 0x64, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x10,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x74, 0x68, 0x72, 0x65, 0x73, 0x68, 0x6f, 0x6c, 0x64, 0x54,
+	0x79, 0x70, 0x65, 0x12, 0x27, 0x0a, 0x0f, 0x74, 0x68, 0x72, 0x65, 0x73, 0x68, 0x6f, 0x6c, 0x64,
+	0x5f, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x11, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0e, 0x74, 0x68,
+	0x72, 0x65, 0x73, 0x68, 0x6f, 0x6c, 0x64, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x27, 0x0a, 0x0f,
+	0x74, 0x68, 0x72, 0x65, 0x73, 0x68, 0x6f, 0x6c, 0x64, 0x5f, 0x72, 0x61, 0x6e, 0x67, 0x65, 0x18,
+	0x12, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x74, 0x68, 0x72, 0x65, 0x73, 0x68, 0x6f, 0x6c, 0x64,
+	0x52, 0x61, 0x6e, 0x67, 0x65, 0x12, 0x2d, 0x0a, 0x12, 0x74, 0x68, 0x72, 0x65, 0x73, 0x68, 0x6f,
+	0x6c, 0x64, 0x5f, 0x6d, 0x75, 0x6c, 0x74, 0x69, 0x70, 0x6c, 0x65, 0x18, 0x13, 0x20, 0x01, 0x28,
+	0x01, 0x52, 0x11, 0x74, 0x68, 0x72, 0x65, 0x73, 0x68, 0x6f, 0x6c, 0x64, 0x4d, 0x75, 0x6c, 0x74,
+	0x69, 0x70, 0x6c, 0x65, 0x12, 0x19, 0x0a, 0x08, 0x74, 0x72, 0x61, 0x63, 0x65, 0x5f, 0x69, 0x64,
+	0x18, 0x14, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x74, 0x72, 0x61, 0x63, 0x65, 0x49, 0x64, 0x12,
+	0x19, 0x0a, 0x08, 0x61, 0x70, 0x6d, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x15, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x07, 0x61, 0x70, 0x6d, 0x54, 0x79, 0x70, 0x65, 0x12, 0x1e, 0x0a, 0x0b, 0x61, 0x70,
+	0x6d, 0x5f, 0x73, 0x70, 0x61, 0x6e, 0x5f, 0x69, 0x64, 0x18, 0x16, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x09, 0x61, 0x70, 0x6d, 0x53, 0x70, 0x61, 0x6e, 0x49, 0x64, 0x12, 0x1e, 0x0a, 0x0a, 0x61, 0x74,
+	0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x65, 0x73, 0x18, 0x17, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a,
+	0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x65, 0x73, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x6f,
+	0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x18, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0b, 0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x49, 0x64, 0x12, 0x25, 0x0a,
+	0x0e, 0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18,
+	0x19, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72,
+	0x4e, 0x61, 0x6d, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x73, 0x74, 0x61, 0x72, 0x74, 0x5f, 0x74, 0x69,
+	0x6d, 0x65, 0x18, 0x1a, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x73, 0x74, 0x61, 0x72, 0x74, 0x54,
+	0x69, 0x6d, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18,
+	0x1b, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12,
+	0x19, 0x0a, 0x08, 0x65, 0x6e, 0x64, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x1c, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x07, 0x65, 0x6e, 0x64, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x6e, 0x6f,
+	0x64, 0x65, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x1d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6e,
+	0x6f, 0x64, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x17, 0x0a, 0x07, 0x6e, 0x6f, 0x64, 0x65, 0x5f,
+	0x69, 0x70, 0x18, 0x1e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6e, 0x6f, 0x64, 0x65, 0x49, 0x70,
+	0x12, 0x1b, 0x0a, 0x09, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x5f, 0x74, 0x73, 0x18, 0x1f, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x08, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x54, 0x73, 0x22, 0x3f, 0x0a,
+	0x0c, 0x4f, 0x6e, 0x4f, 0x66, 0x66, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x12, 0x2f, 0x0a,
+	0x07, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x15,
+	0x2e, 0x6b, 0x69, 0x6e, 0x64, 0x6c, 0x69, 0x6e, 0x67, 0x2e, 0x4f, 0x6e, 0x4f, 0x66, 0x66, 0x4d,
+	0x65, 0x74, 0x72, 0x69, 0x63, 0x52, 0x07, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x22, 0xc0,
+	0x01, 0x0a, 0x0b, 0x4f, 0x6e, 0x4f, 0x66, 0x66, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x12, 0x1c,
+	0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x10, 0x0a, 0x03,
+	0x70, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x70, 0x69, 0x64, 0x12, 0x10,
+	0x0a, 0x03, 0x74, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x74, 0x69, 0x64,
+	0x12, 0x21, 0x0a, 0x0c, 0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x5f, 0x69, 0x64,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x63, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65,
+	0x72, 0x49, 0x64, 0x12, 0x19, 0x0a, 0x08, 0x74, 0x72, 0x61, 0x63, 0x65, 0x5f, 0x69, 0x64, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x74, 0x72, 0x61, 0x63, 0x65, 0x49, 0x64, 0x12, 0x17,
+	0x0a, 0x07, 0x73, 0x70, 0x61, 0x6e, 0x5f, 0x69, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x06, 0x73, 0x70, 0x61, 0x6e, 0x49, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x74, 0x72, 0x69,
+	0x63, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63,
+	0x73, 0x22, 0x5c, 0x0a, 0x11, 0x44, 0x61, 0x74, 0x61, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x73, 0x4d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x71, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x03, 0x73, 0x65, 0x71, 0x12, 0x35, 0x0a, 0x0b, 0x64, 0x61, 0x74, 0x61,
+	0x5f, 0x67, 0x72, 0x6f, 0x75, 0x70, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e,
 	0x6b, 0x69, 0x6e, 0x64, 0x6c, 0x69, 0x6e, 0x67, 0x2e, 0x44, 0x61, 0x74, 0x61, 0x47, 0x72, 0x6f,
-	0x75, 0x70, 0x73, 0x1a, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x42, 0x09, 0x5a, 0x07, 0x2e,
-	0x3b, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x75, 0x70, 0x73, 0x52, 0x0a, 0x64, 0x61, 0x74, 0x61, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x73, 0x22,
+	0x44, 0x0a, 0x0d, 0x44, 0x61, 0x74, 0x61, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x73, 0x41, 0x63, 0x6b,
+	0x12, 0x1b, 0x0a, 0x09, 0x61, 0x63, 0x6b, 0x65, 0x64, 0x5f, 0x73, 0x65, 0x71, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x08, 0x61, 0x63, 0x6b, 0x65, 0x64, 0x53, 0x65, 0x71, 0x12, 0x16, 0x0a,
+	0x06, 0x77, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x77,
+	0x69, 0x6e, 0x64, 0x6f, 0x77, 0x32, 0x9d, 0x01, 0x0a, 0x0c, 0x54, 0x72, 0x61, 0x63, 0x65, 0x53,
+	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x3f, 0x0a, 0x0f, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x44,
+	0x61, 0x74, 0x61, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x73, 0x12, 0x14, 0x2e, 0x6b, 0x69, 0x6e, 0x64,
+	0x6c, 0x69, 0x6e, 0x67, 0x2e, 0x44, 0x61, 0x74, 0x61, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x73, 0x1a,
+	0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x12, 0x4c, 0x0a, 0x10, 0x53, 0x74, 0x72, 0x65, 0x61,
+	0x6d, 0x44, 0x61, 0x74, 0x61, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x73, 0x12, 0x1b, 0x2e, 0x6b, 0x69,
+	0x6e, 0x64, 0x6c, 0x69, 0x6e, 0x67, 0x2e, 0x44, 0x61, 0x74, 0x61, 0x47, 0x72, 0x6f, 0x75, 0x70,
+	0x73, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x1a, 0x17, 0x2e, 0x6b, 0x69, 0x6e, 0x64, 0x6c,
+	0x69, 0x6e, 0x67, 0x2e, 0x44, 0x61, 0x74, 0x61, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x73, 0x41, 0x63,
+	0x6b, 0x28, 0x01, 0x30, 0x01, 0x42, 0x09, 0x5a, 0x07, 0x2e, 0x3b, 0x6d, 0x6f, 0x64, 0x65, 0x6c,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -107,19 +1101,36 @@ func file_pkg_model_apo_trace_proto_rawDescGZIP() []byte {
 	return file_pkg_model_apo_trace_proto_rawDescData
 }
 
-var file_pkg_model_apo_trace_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_pkg_model_apo_trace_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_pkg_model_apo_trace_proto_goTypes = []interface{}{
-	(*DataGroups)(nil),    // 0: kindling.DataGroups
-	(*emptypb.Empty)(nil), // 1: google.protobuf.Empty
+	(*DataGroups)(nil),        // 0: kindling.DataGroups
+	(*Traces)(nil),            // 1: kindling.Traces
+	(*Trace)(nil),             // 2: kindling.Trace
+	(*Identity)(nil),          // 3: kindling.Identity
+	(*TraceLabels)(nil),       // 4: kindling.TraceLabels
+	(*OnOffMetrics)(nil),      // 5: kindling.OnOffMetrics
+	(*OnOffMetric)(nil),       // 6: kindling.OnOffMetric
+	(*DataGroupsMessage)(nil), // 7: kindling.DataGroupsMessage
+	(*DataGroupsAck)(nil),     // 8: kindling.DataGroupsAck
+	(*emptypb.Empty)(nil),     // 9: google.protobuf.Empty
 }
 var file_pkg_model_apo_trace_proto_depIdxs = []int32{
-	0, // 0: kindling.TraceService.StoreDataGroups:input_type -> kindling.DataGroups
-	1, // 1: kindling.TraceService.StoreDataGroups:output_type -> google.protobuf.Empty
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	1, // 0: kindling.DataGroups.traces:type_name -> kindling.Traces
+	5, // 1: kindling.DataGroups.onoff_metrics:type_name -> kindling.OnOffMetrics
+	2, // 2: kindling.Traces.traces:type_name -> kindling.Trace
+	4, // 3: kindling.Trace.labels:type_name -> kindling.TraceLabels
+	3, // 4: kindling.Trace.identity:type_name -> kindling.Identity
+	6, // 5: kindling.OnOffMetrics.metrics:type_name -> kindling.OnOffMetric
+	0, // 6: kindling.DataGroupsMessage.data_groups:type_name -> kindling.DataGroups
+	0, // 7: kindling.TraceService.StoreDataGroups:input_type -> kindling.DataGroups
+	7, // 8: kindling.TraceService.StreamDataGroups:input_type -> kindling.DataGroupsMessage
+	9, // 9: kindling.TraceService.StoreDataGroups:output_type -> google.protobuf.Empty
+	8, // 10: kindling.TraceService.StreamDataGroups:output_type -> kindling.DataGroupsAck
+	9, // [9:11] is the sub-list for method output_type
+	7, // [7:9] is the sub-list for method input_type
+	7, // [7:7] is the sub-list for extension type_name
+	7, // [7:7] is the sub-list for extension extendee
+	0, // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_pkg_model_apo_trace_proto_init() }
@@ -140,6 +1151,106 @@ func file_pkg_model_apo_trace_proto_init() {
 				return nil
 			}
 		}
+		file_pkg_model_apo_trace_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Traces); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_model_apo_trace_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Trace); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_model_apo_trace_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Identity); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_model_apo_trace_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TraceLabels); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_model_apo_trace_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*OnOffMetrics); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_model_apo_trace_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*OnOffMetric); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_model_apo_trace_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DataGroupsMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_model_apo_trace_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DataGroupsAck); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_pkg_model_apo_trace_proto_msgTypes[0].OneofWrappers = []interface{}{
+		(*DataGroups_Traces)(nil),
+		(*DataGroups_OnoffMetrics)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -147,7 +1258,7 @@ func file_pkg_model_apo_trace_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_pkg_model_apo_trace_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   1,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -20,7 +20,8 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	TraceService_StoreDataGroups_FullMethodName = "/kindling.TraceService/StoreDataGroups"
+	TraceService_StoreDataGroups_FullMethodName  = "/kindling.TraceService/StoreDataGroups"
+	TraceService_StreamDataGroups_FullMethodName = "/kindling.TraceService/StreamDataGroups"
 )
 
 // TraceServiceClient is the client API for TraceService service.
@@ -28,6 +29,9 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type TraceServiceClient interface {
 	StoreDataGroups(ctx context.Context, in *DataGroups, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// StreamDataGroups sends the data groups on one long-lived stream, the receiver acks the data groups periodically once they are flushed.
+	// The agent must not send the messages beyond acked_seq + window, and resends the messages after acked_seq on a new stream when it is broken.
+	StreamDataGroups(ctx context.Context, opts ...grpc.CallOption) (TraceService_StreamDataGroupsClient, error)
 }
 
 type traceServiceClient struct {
@@ -47,11 +51,45 @@ func (c *traceServiceClient) StoreDataGroups(ctx context.Context, in *DataGroups
 	return out, nil
 }
 
+func (c *traceServiceClient) StreamDataGroups(ctx context.Context, opts ...grpc.CallOption) (TraceService_StreamDataGroupsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &TraceService_ServiceDesc.Streams[0], TraceService_StreamDataGroups_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &traceServiceStreamDataGroupsClient{stream}
+	return x, nil
+}
+
+type TraceService_StreamDataGroupsClient interface {
+	Send(*DataGroupsMessage) error
+	Recv() (*DataGroupsAck, error)
+	grpc.ClientStream
+}
+
+type traceServiceStreamDataGroupsClient struct {
+	grpc.ClientStream
+}
+
+func (x *traceServiceStreamDataGroupsClient) Send(m *DataGroupsMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *traceServiceStreamDataGroupsClient) Recv() (*DataGroupsAck, error) {
+	m := new(DataGroupsAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // TraceServiceServer is the server API for TraceService service.
 // All implementations must embed UnimplementedTraceServiceServer
 // for forward compatibility
 type TraceServiceServer interface {
 	StoreDataGroups(context.Context, *DataGroups) (*emptypb.Empty, error)
+	// StreamDataGroups sends the data groups on one long-lived stream, the receiver acks the data groups periodically once they are flushed.
+	// The agent must not send the messages beyond acked_seq + window, and resends the messages after acked_seq on a new stream when it is broken.
+	StreamDataGroups(TraceService_StreamDataGroupsServer) error
 	mustEmbedUnimplementedTraceServiceServer()
 }
 
@@ -62,6 +100,9 @@ type UnimplementedTraceServiceServer struct {
 func (UnimplementedTraceServiceServer) StoreDataGroups(context.Context, *DataGroups) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method StoreDataGroups not implemented")
 }
+func (UnimplementedTraceServiceServer) StreamDataGroups(TraceService_StreamDataGroupsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamDataGroups not implemented")
+}
 func (UnimplementedTraceServiceServer) mustEmbedUnimplementedTraceServiceServer() {}
 
 // UnsafeTraceServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -93,6 +134,32 @@ func _TraceService_StoreDataGroups_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TraceService_StreamDataGroups_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TraceServiceServer).StreamDataGroups(&traceServiceStreamDataGroupsServer{stream})
+}
+
+type TraceService_StreamDataGroupsServer interface {
+	Send(*DataGroupsAck) error
+	Recv() (*DataGroupsMessage, error)
+	grpc.ServerStream
+}
+
+type traceServiceStreamDataGroupsServer struct {
+	grpc.ServerStream
+}
+
+func (x *traceServiceStreamDataGroupsServer) Send(m *DataGroupsAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *traceServiceStreamDataGroupsServer) Recv() (*DataGroupsMessage, error) {
+	m := new(DataGroupsMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // TraceService_ServiceDesc is the grpc.ServiceDesc for TraceService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -105,6 +172,13 @@ var TraceService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _TraceService_StoreDataGroups_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamDataGroups",
+			Handler:       _TraceService_StreamDataGroups_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "pkg/model/apo_trace.proto",
 }
@@ -0,0 +1,138 @@
+package model
+
+import (
+	apomodel "github.com/CloudDetail/apo-module/model/v1"
+)
+
+// NewTrace converts the trace to the typed payload.
+func NewTrace(trace *apomodel.Trace) *Trace {
+	result := &Trace{
+		Timestamp:        trace.Timestamp,
+		DataVersion:      trace.Version,
+		DataSource:       trace.Source,
+		WorkloadName:     trace.WorkloadName,
+		WorkloadKind:     trace.WorkloadKind,
+		PodIp:            trace.PodIp,
+		PodName:          trace.PodName,
+		Namespace:        trace.Namespace,
+		OnoffMetrics:     trace.OnOffMetrics,
+		BaseOnoffMetrics: trace.BaseOnOffMetrics,
+		BaseRange:        trace.BaseRange,
+		MutatedType:      trace.MutatedType,
+	}
+	if labels := trace.Labels; labels != nil {
+		result.Labels = &TraceLabels{
+			Pid:               labels.Pid,
+			Tid:               labels.Tid,
+			TopSpan:           labels.TopSpan,
+			Protocol:          labels.Protocol,
+			ServiceName:       labels.ServiceName,
+			ContentKey:        labels.Url,
+			HttpUrl:           labels.HttpUrl,
+			IsSilent:          labels.IsSilent,
+			IsSampled:         labels.IsSampled,
+			IsSlow:            labels.IsSlow,
+			IsServer:          labels.IsServer,
+			IsError:           labels.IsError,
+			IsProfiled:        labels.IsProfiled,
+			SampleValue:       int64(labels.SampleValue),
+			ReportType:        labels.ReportType,
+			ThresholdType:     string(labels.ThresholdType),
+			ThresholdValue:    labels.ThresholdValue,
+			ThresholdRange:    string(labels.ThresholdRange),
+			ThresholdMultiple: labels.ThresholdMultiple,
+			TraceId:           labels.TraceId,
+			ApmType:           labels.ApmType,
+			ApmSpanId:         labels.ApmSpanId,
+			Attributes:        labels.Attributes,
+			ContainerId:       labels.ContainerId,
+			ContainerName:     labels.ContainerName,
+			StartTime:         labels.StartTime,
+			Duration:          labels.Duration,
+			EndTime:           labels.EndTime,
+			NodeName:          labels.NodeName,
+			NodeIp:            labels.NodeIp,
+			OffsetTs:          labels.OffsetTs,
+		}
+	}
+	return result
+}
+
+// ToTrace converts the typed payload to the trace, the labels are never nil as the trace parsed from json.
+func (x *Trace) ToTrace() *apomodel.Trace {
+	trace := &apomodel.Trace{
+		Timestamp:        x.GetTimestamp(),
+		Version:          x.GetDataVersion(),
+		Source:           x.GetDataSource(),
+		WorkloadName:     x.GetWorkloadName(),
+		WorkloadKind:     x.GetWorkloadKind(),
+		PodIp:            x.GetPodIp(),
+		PodName:          x.GetPodName(),
+		Namespace:        x.GetNamespace(),
+		OnOffMetrics:     x.GetOnoffMetrics(),
+		BaseOnOffMetrics: x.GetBaseOnoffMetrics(),
+		BaseRange:        x.GetBaseRange(),
+		MutatedType:      x.GetMutatedType(),
+	}
+	labels := x.GetLabels()
+	trace.Labels = &apomodel.TraceLabels{
+		Pid:               labels.GetPid(),
+		Tid:               labels.GetTid(),
+		TopSpan:           labels.GetTopSpan(),
+		Protocol:          labels.GetProtocol(),
+		ServiceName:       labels.GetServiceName(),
+		Url:               labels.GetContentKey(),
+		HttpUrl:           labels.GetHttpUrl(),
+		IsSilent:          labels.GetIsSilent(),
+		IsSampled:         labels.GetIsSampled(),
+		IsSlow:            labels.GetIsSlow(),
+		IsServer:          labels.GetIsServer(),
+		IsError:           labels.GetIsError(),
+		IsProfiled:        labels.GetIsProfiled(),
+		SampleValue:       int(labels.GetSampleValue()),
+		ReportType:        labels.GetReportType(),
+		ThresholdType:     apomodel.ThresholdType(labels.GetThresholdType()),
+		ThresholdValue:    labels.GetThresholdValue(),
+		ThresholdRange:    apomodel.ThresholdRange(labels.GetThresholdRange()),
+		ThresholdMultiple: labels.GetThresholdMultiple(),
+		TraceId:           labels.GetTraceId(),
+		ApmType:           labels.GetApmType(),
+		ApmSpanId:         labels.GetApmSpanId(),
+		Attributes:        labels.GetAttributes(),
+		ContainerId:       labels.GetContainerId(),
+		ContainerName:     labels.GetContainerName(),
+		StartTime:         labels.GetStartTime(),
+		Duration:          labels.GetDuration(),
+		EndTime:           labels.GetEndTime(),
+		NodeName:          labels.GetNodeName(),
+		NodeIp:            labels.GetNodeIp(),
+		OffsetTs:          labels.GetOffsetTs(),
+	}
+	// Same with the default of the json.
+	if trace.Labels.ThresholdMultiple == 0 {
+		trace.Labels.ThresholdMultiple = 1.0
+	}
+	return trace
+}
+
+// NewOnOffMetric converts the metric group cached by the analyzer to the typed payload.
+func NewOnOffMetric(metric *apomodel.OnOffMetricGroup) *OnOffMetric {
+	return &OnOffMetric{
+		TraceId: metric.TraceId,
+		SpanId:  metric.SpanId,
+		Metrics: metric.Metrics,
+	}
+}
+
+func (x *OnOffMetric) ToOnOffMetricGroup() *apomodel.OnOffMetricGroup {
+	return &apomodel.OnOffMetricGroup{
+		TraceId: x.GetTraceId(),
+		SpanId:  x.GetSpanId(),
+		Metrics: x.GetMetrics(),
+	}
+}
+
+// Count returns the number of the data in datas or the typed payload.
+func (x *DataGroups) Count() int {
+	return len(x.GetDatas()) + len(x.GetTraces().GetTraces()) + len(x.GetOnoffMetrics().GetMetrics())
+}
@@ -0,0 +1,31 @@
+package receiver
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/CloudDetail/apo-receiver/pkg/clickhouse"
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+// Migrate runs the ClickHouse DDL and schema migrations only, dryRun prints the rendered SQL instead.
+func Migrate(configPath string, dryRun bool, out io.Writer) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("fail to read configuration: %w", err)
+	}
+	if dryRun {
+		return clickhouse.PrintMigrateSql(cfg.ClickHouseCfg, out)
+	}
+	if err := clickhouse.Migrate(cfg.ClickHouseCfg); err != nil {
+		return fmt.Errorf("fail to migrate ClickHouse: %w", err)
+	}
+	fmt.Fprintln(out, "ClickHouse schema is up to date")
+	return nil
+}
+
+// CheckConfig reads and validates the configuration.
+func CheckConfig(configPath string) error {
+	_, err := config.Load(configPath)
+	return err
+}
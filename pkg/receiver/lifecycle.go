@@ -0,0 +1,108 @@
+package receiver
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+type shutdownStage struct {
+	name string
+	// timeout bounds the stage itself, 0 means it is only bounded by the deadline of the shutdown.
+	timeout time.Duration
+	// reserve is the time kept for the stage, the stages before it end earlier so it always runs.
+	reserve time.Duration
+	stop    func(ctx context.Context)
+}
+
+// lifecycle stops the components in the registered order when the context of Run is done.
+// The stages share one deadline so the receiver exits in time even if a stage hangs,
+// the time reserved by the later stages is not used by the earlier ones, eg. a slow analyzer drain does not skip the flush.
+type lifecycle struct {
+	timeout time.Duration
+	stages  []shutdownStage
+}
+
+func newLifecycle(timeout time.Duration) *lifecycle {
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	return &lifecycle{
+		timeout: timeout,
+		stages:  make([]shutdownStage, 0),
+	}
+}
+
+// onShutdown registers a stage, stop should return when ctx is done.
+func (l *lifecycle) onShutdown(name string, stop func(ctx context.Context)) {
+	l.stages = append(l.stages, shutdownStage{name: name, stop: stop})
+}
+
+// onShutdownWithin registers a stage bounded by timeout.
+func (l *lifecycle) onShutdownWithin(name string, timeout time.Duration, stop func(ctx context.Context)) {
+	l.stages = append(l.stages, shutdownStage{name: name, timeout: timeout, stop: stop})
+}
+
+// onShutdownReserved registers a stage which always runs with at least reserve.
+func (l *lifecycle) onShutdownReserved(name string, reserve time.Duration, stop func(ctx context.Context)) {
+	l.stages = append(l.stages, shutdownStage{name: name, reserve: reserve, stop: stop})
+}
+
+func (l *lifecycle) shutdown() {
+	log.Printf("Shutting down receiver, timeout: %s", l.timeout)
+	deadline := time.Now().Add(l.timeout)
+	// reserves[i] is the time reserved by the stages after i.
+	reserves := make([]time.Duration, len(l.stages))
+	for i := len(l.stages) - 2; i >= 0; i-- {
+		reserves[i] = reserves[i+1] + l.stages[i+1].reserve
+	}
+
+	var running sync.WaitGroup
+	pendings := make([]string, 0)
+	for i, stage := range l.stages {
+		startTime := time.Now()
+		stageDeadline := deadline.Add(-reserves[i])
+		if stage.timeout > 0 && startTime.Add(stage.timeout).Before(stageDeadline) {
+			stageDeadline = startTime.Add(stage.timeout)
+		}
+		if stage.reserve > 0 && startTime.Add(stage.reserve).After(stageDeadline) {
+			stageDeadline = startTime.Add(stage.reserve)
+		}
+		if !stageDeadline.After(startTime) {
+			log.Printf("[x Shutdown %s] Skipped, %s", stage.name, context.DeadlineExceeded.Error())
+			continue
+		}
+
+		ctx, cancel := context.WithDeadline(context.Background(), stageDeadline)
+		done := make(chan struct{})
+		running.Add(1)
+		go func(stage shutdownStage) {
+			defer running.Done()
+			defer close(done)
+			stage.stop(ctx)
+		}(stage)
+		select {
+		case <-done:
+			log.Printf("[Shutdown %s] Done in %s", stage.name, time.Since(startTime))
+		case <-ctx.Done():
+			log.Printf("[x Shutdown %s] %s", stage.name, ctx.Err().Error())
+			pendings = append(pendings, stage.name)
+		}
+		cancel()
+	}
+
+	// The stages past their deadlines are waited until the deadline of the shutdown, so they are not left running silently.
+	allDone := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(allDone)
+	}()
+	select {
+	case <-allDone:
+	case <-time.After(time.Until(deadline)):
+		log.Printf("[x Shutdown] Stages still running: %v", pendings)
+	}
+}
@@ -0,0 +1,75 @@
+package receiver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycleShutdown(t *testing.T) {
+	l := newLifecycle(200 * time.Millisecond)
+	var mutex sync.Mutex
+	stopped := make([]string, 0)
+	record := func(name string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		stopped = append(stopped, name)
+	}
+	l.onShutdown("intake", func(ctx context.Context) {
+		record("intake")
+	})
+	l.onShutdown("hang", func(ctx context.Context) {
+		<-ctx.Done()
+	})
+	l.onShutdown("skipped", func(ctx context.Context) {
+		record("skipped")
+	})
+	l.onShutdownReserved("flush", 50*time.Millisecond, func(ctx context.Context) {
+		deadline, _ := ctx.Deadline()
+		assert.GreaterOrEqual(t, time.Until(deadline), 40*time.Millisecond)
+		record("flush")
+	})
+
+	startTime := time.Now()
+	l.shutdown()
+	assert.Less(t, time.Since(startTime), time.Second)
+	// The stages without reserve are skipped after the hang, the flush still runs in its reserved time.
+	assert.Equal(t, []string{"intake", "flush"}, stopped)
+}
+
+func TestLifecycleShutdownWithin(t *testing.T) {
+	l := newLifecycle(time.Second)
+	stopped := make([]string, 0)
+	l.onShutdownWithin("drain", 50*time.Millisecond, func(ctx context.Context) {
+		<-ctx.Done()
+	})
+	l.onShutdown("flush", func(ctx context.Context) {
+		stopped = append(stopped, "flush")
+	})
+
+	startTime := time.Now()
+	l.shutdown()
+	assert.Less(t, time.Since(startTime), 500*time.Millisecond)
+	assert.Equal(t, []string{"flush"}, stopped)
+}
+
+func TestLifecycleWaitStages(t *testing.T) {
+	l := newLifecycle(200 * time.Millisecond)
+	finished := make(chan struct{})
+	l.onShutdownWithin("slow", 20*time.Millisecond, func(ctx context.Context) {
+		<-ctx.Done()
+		// Returns a while after its deadline.
+		time.Sleep(50 * time.Millisecond)
+		close(finished)
+	})
+
+	l.shutdown()
+	select {
+	case <-finished:
+	default:
+		t.Fatal("the stage past its deadline is not waited")
+	}
+}
@@ -2,70 +2,109 @@ package receiver
 
 import (
 	"context"
-	"errors"
-	"flag"
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
-	"os"
-	"os/signal"
+	"net/http"
 	"strconv"
-	"sync"
-	"syscall"
+	"time"
 
 	"github.com/CloudDetail/apo-receiver/pkg/componment/ebpffile"
 	"github.com/CloudDetail/apo-receiver/pkg/componment/redis"
+	"github.com/CloudDetail/apo-receiver/pkg/componment/spanstore"
+	"github.com/CloudDetail/apo-receiver/pkg/health"
 	"github.com/CloudDetail/apo-receiver/pkg/httphelper"
 	"github.com/CloudDetail/apo-receiver/pkg/httpserver"
 	"github.com/CloudDetail/apo-receiver/pkg/metrics"
+	"github.com/CloudDetail/apo-receiver/pkg/tlsconfig"
 
+	"github.com/kataras/iris/v12"
 	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
-	"github.com/spf13/viper"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 
 	"github.com/CloudDetail/apo-receiver/pkg/analyzer"
+	"github.com/CloudDetail/apo-receiver/pkg/auth"
 	"github.com/CloudDetail/apo-receiver/pkg/clickhouse"
 	"github.com/CloudDetail/apo-receiver/pkg/componment/onoffmetric"
+	"github.com/CloudDetail/apo-receiver/pkg/componment/otlp"
 	"github.com/CloudDetail/apo-receiver/pkg/componment/profile"
 	"github.com/CloudDetail/apo-receiver/pkg/componment/threshold"
 	"github.com/CloudDetail/apo-receiver/pkg/componment/trace"
 	"github.com/CloudDetail/apo-receiver/pkg/config"
 	"github.com/CloudDetail/apo-receiver/pkg/global"
 	"github.com/CloudDetail/apo-receiver/pkg/model"
+	"github.com/CloudDetail/apo-receiver/pkg/tenant"
 
 	"github.com/CloudDetail/apo-module/apm/client/v1"
-	"github.com/CloudDetail/metadata/source"
 	sloconfig "github.com/CloudDetail/apo-module/slo/sdk/v1/config"
 	slomanager "github.com/CloudDetail/apo-module/slo/sdk/v1/manager"
+	"github.com/CloudDetail/metadata/source"
 )
 
-func Run(ctx context.Context) error {
-	// Initialize flags
-	configPath := flag.String("config", "receiver-config.yml", "Configuration file")
-	flag.Parse()
-	receiverCfg, sampleCfg, profileCfg, prometheusCfg, clickHouseCfg, analyzerCfg, redisCfg, k8sCfg, err := readInConfig(*configPath)
+func Run(ctx context.Context, configPath string) error {
+	cfg, err := config.Load(configPath)
 	if err != nil {
 		return fmt.Errorf("fail to read configuration: %w", err)
 	}
+	receiverCfg, sampleCfg, profileCfg, prometheusCfg, clickHouseCfg, analyzerCfg, redisCfg, k8sCfg :=
+		cfg.ReceiverCfg, cfg.SampleCfg, cfg.ProfileCfg, cfg.PrometheusCfg, cfg.ClickHouseCfg, cfg.AnalyzerCfg, cfg.RedisCfg, cfg.K8sCfg
+	reloader := newConfigReloader(configPath, cfg)
+	reloadStopChan := make(chan struct{})
+	defer close(reloadStopChan)
+	checker := health.NewChecker(receiverCfg.HealthCheckInterval, receiverCfg.HealthCheckTimeout)
+
+	serverCerts, err := tlsconfig.NewServerCerts(&receiverCfg.TLS)
+	if err != nil {
+		return fmt.Errorf("fail to load TLS certificate: %w", err)
+	}
+	if serverCerts != nil {
+		go serverCerts.Watch(reloadStopChan)
+	}
+	authenticator, err := auth.NewAuthenticator(&receiverCfg.Auth)
+	if err != nil {
+		return fmt.Errorf("fail to load auth: %w", err)
+	}
+	if authenticator != nil {
+		go authenticator.Watch(reloadStopChan)
+	}
+	quotas, err := tenant.NewQuotas(cfg.TenantCfg)
+	if err != nil {
+		return fmt.Errorf("fail to load tenant quotas: %w", err)
+	}
+	spanStore := spanstore.NewStore(cfg.OtlpCfg)
+	if spanStore != nil {
+		spanStore.Start()
+		defer spanStore.Stop()
+	}
+	otlpReceiver := otlp.NewReceiver(cfg.OtlpCfg, spanStore, authenticator, quotas)
 
 	if redisCfg.Enable {
-		redisClient, err := redis.NewRedisClient(redisCfg.Address, redisCfg.Password, redisCfg.ExpireTime)
+		redisTLS, err := tlsconfig.NewClientTLS(&redisCfg.TLS)
+		if err != nil {
+			return fmt.Errorf("fail to create redis client: %w", err)
+		}
+		redisClient, err := redis.NewRedisClient(redisCfg.Address, redisCfg.Password, redisCfg.ExpireTime, redisCfg.WriteFormat, redisTLS)
 		if err != nil {
 			return fmt.Errorf("fail to create redis client: %w", err)
 		}
 		global.CACHE = redisClient
+		checker.Register("redis", true, redisClient.Ping)
 	} else {
 		global.CACHE = redis.NewLocalCache(redisCfg.ExpireTime)
 	}
 	global.CACHE.Start()
 
-	global.TRACE_CLIENT = client.NewApmTraceClient(
-		analyzerCfg.TraceAddress,
-		analyzerCfg.Timeout,
-		analyzerCfg.RatioThreshold,
-		analyzerCfg.MuateNodeMode,
-		analyzerCfg.GetDetailTypes)
+	global.TRACE_CLIENT = newTraceClient(analyzerCfg, spanStore, checker)
+	// The ratio and mode of the mutated slow trace trees are kept by the APM client, so it is rebuilt on reload.
+	reloader.onReload(func(cfg *config.Config) {
+		global.TRACE_CLIENT.UpdateRemote(newApmTraceClient(cfg.AnalyzerCfg))
+	})
 
 	clickHouseClient, err := clickhouse.NewClickHouseClient(ctx, clickHouseCfg, prometheusCfg.GenerateClientMetric, prometheusCfg.ClientMetricWithUrl)
 	if err != nil {
@@ -73,21 +112,34 @@ func Run(ctx context.Context) error {
 	}
 	global.CLICK_HOUSE = clickHouseClient
 	clickHouseClient.Start()
+	checker.Register("clickhouse", true, clickHouseClient.Ping)
 
-	if len(prometheusCfg.LatencyHistogramBuckets) == 0 && prometheusCfg.Storage == "prom" && prometheusCfg.GenerateClientMetric {
-		return errors.New("miss latency_histogram_buckets for promethues")
-	}
 	metrics.UpdateMetricConfig(prometheusCfg.Storage, prometheusCfg.CacheSize, prometheusCfg.LatencyHistogramBuckets)
 	global.PROM_RANGE = prometheusCfg.GetRange()
+	prometheusTLS, err := tlsconfig.NewClientTLS(&prometheusCfg.TLS)
+	if err != nil {
+		return fmt.Errorf("fail to create Prometheus client: %w", err)
+	}
+	prometheusTransport := tlsconfig.NewTransport(prometheusTLS)
 	prometheusClient, err := api.NewClient(api.Config{
-		Address: prometheusCfg.Address,
+		Address:      prometheusCfg.Address,
+		RoundTripper: prometheusTransport,
 	})
 	if err != nil {
 		return fmt.Errorf("fail to create Prometheus client: %w", err)
 	}
 	log.Printf("Use the prometheus address %v", prometheusCfg.Address)
 	prometheusV1Api := v1.NewAPI(prometheusClient)
+	// Query a constant as both Prometheus and VictoriaMetrics support it.
+	checker.Register("prometheus", false, func(ctx context.Context) error {
+		_, _, err := prometheusV1Api.Query(ctx, "1", time.Now())
+		return err
+	})
 
+	if prometheusTLS != nil {
+		// The SLO manager creates its own Prometheus client with only the address, which uses the default transport.
+		api.DefaultRoundTripper = prometheusTransport
+	}
 	portalClient := httphelper.CreateHttpClient(receiverCfg.PortalAddress != "", receiverCfg.PortalAddress)
 	slomanager.InitDefaultSLOConfigCache(receiverCfg.CenterApiServer, portalClient, prometheusCfg.Address)
 
@@ -99,63 +151,80 @@ func Run(ctx context.Context) error {
 
 	startMetadataFetch(k8sCfg)
 
-	// Start gRPC server
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		startGrpcServer(receiverCfg, sampleCfg, profileCfg, analyzerCfg, threshold.CacheInstance)
-	}()
-	// Start HTTP server
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		httpserver.StartHttpServer(receiverCfg.HttpPort, prometheusCfg.OpenApiMetrics)
-	}()
+	grpcServer, healthServer, traceServer, reportAnalyzer := startGrpcServer(receiverCfg, sampleCfg, profileCfg, analyzerCfg, threshold.CacheInstance, reloader, checker, serverCerts, authenticator, quotas, otlpReceiver)
+	// Started after the appliers are registered by startGrpcServer, so no reload is accepted without being applied.
+	go reloader.watch(reloadStopChan)
+	var httpTLS *tls.Config
+	if serverCerts != nil {
+		httpTLS = serverCerts.TLSConfig("http/1.1")
+	}
+	var otlpHandler iris.Handler
+	if otlpReceiver != nil {
+		otlpHandler = otlpReceiver.HandleHttp
+	}
+	httpServer := httpserver.StartHttpServer(receiverCfg.HttpPort, prometheusCfg.OpenApiMetrics, checker, httpTLS, otlpHandler, authenticator)
 	if prometheusCfg.SendApi != "" && prometheusCfg.SendInterval > 0 {
-		if err := metrics.InitMetricSend(fmt.Sprintf("%s%s", prometheusCfg.Address, prometheusCfg.SendApi), prometheusCfg.SendInterval, prometheusCfg.Storage); err != nil {
+		if err := metrics.InitMetricSend(fmt.Sprintf("%s%s", prometheusCfg.Address, prometheusCfg.SendApi), prometheusCfg.SendInterval, prometheusCfg.Storage,
+			&http.Client{Transport: prometheusTransport}); err != nil {
 			return err
 		}
 	}
 
-	// Wait for the two servers shutting down
-	wg.Wait()
-	log.Println("All servers shut down gracefully")
+	// Stop the intake first, then write the data in memory out.
+	lifecycle := newLifecycle(receiverCfg.ShutdownTimeout)
+	lifecycle.onShutdown("gRPC Server", func(ctx context.Context) {
+		checker.Stop()
+		// Report NOT_SERVING so the agents switch to another receiver while draining.
+		healthServer.Shutdown()
+		// The streams are never idle, end them so the graceful stop does not wait until timeout.
+		traceServer.CloseStreams()
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	})
+	lifecycle.onShutdown("HTTP Server", func(ctx context.Context) {
+		_ = httpServer.Shutdown(ctx)
+	})
+	// The drain queries the APM trace backend, it is bounded so the data in memory is still flushed.
+	lifecycle.onShutdownWithin("Analyzer", lifecycle.timeout/2, reportAnalyzer.Drain)
+	lifecycle.onShutdownReserved("ClickHouse", lifecycle.timeout/4, clickHouseClient.Stop)
+	lifecycle.onShutdownReserved("Metrics", lifecycle.timeout/10, func(ctx context.Context) {
+		if err := metrics.FlushMetrics(ctx); err != nil {
+			log.Printf("[x Send Metrics] %s", err)
+		}
+	})
+
+	<-ctx.Done()
+	lifecycle.shutdown()
+	log.Println("Receiver shut down gracefully")
 	return nil
 }
 
-func readInConfig(path string) (*config.ReceiverConfig, *config.SampleConfig, *config.ProfileConfig, *config.PrometheusConfig, *config.ClickHouseConfig, *config.AnalyzerConfig, *config.RedisConfig, *config.K8sConfig, error) {
-	viper := viper.New()
-	viper.SetConfigFile(path)
-	err := viper.ReadInConfig()
-	if err != nil { // Handle errors reading the config file
-		return nil, nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("error happened while reading config file: %w", err)
+// newTraceClient reads the pushed spans first, the APM trace backend is not queried if analyzer.trace_address is not set.
+func newTraceClient(analyzerCfg *config.AnalyzerConfig, spanStore *spanstore.Store, checker *health.Checker) *spanstore.TraceClient {
+	if analyzerCfg.TraceAddress == "" {
+		log.Println("No analyzer.trace_address is set, the services are only built from the pushed spans")
+		return spanstore.NewTraceClient(spanStore, nil)
 	}
-	receiverCfg := &config.ReceiverConfig{}
-	_ = viper.UnmarshalKey("receiver", receiverCfg)
-
-	sampleCfg := &config.SampleConfig{}
-	_ = viper.UnmarshalKey("sample", sampleCfg)
-
-	profileCfg := &config.ProfileConfig{}
-	_ = viper.UnmarshalKey("profile", profileCfg)
-
-	prometheusCfg := &config.PrometheusConfig{}
-	_ = viper.UnmarshalKey("promethues", prometheusCfg)
-
-	clickHouseCfg := &config.ClickHouseConfig{}
-	_ = viper.UnmarshalKey("clickhouse", clickHouseCfg)
-
-	analyzerCfg := &config.AnalyzerConfig{}
-	_ = viper.UnmarshalKey("analyzer", analyzerCfg)
-
-	redisCfg := &config.RedisConfig{}
-	_ = viper.UnmarshalKey("redis", redisCfg)
-
-	k8sCfg := &config.K8sConfig{}
-	_ = viper.UnmarshalKey("k8s", k8sCfg)
+	// The trace backend is only queried for the slow and error reports, the data is still received without it.
+	checker.Register("apm_trace", false, health.DialProbe(analyzerCfg.TraceAddress))
+	return spanstore.NewTraceClient(spanStore, newApmTraceClient(analyzerCfg))
+}
 
-	return receiverCfg, sampleCfg, profileCfg, prometheusCfg, clickHouseCfg, analyzerCfg, redisCfg, k8sCfg, nil
+func newApmTraceClient(analyzerCfg *config.AnalyzerConfig) *client.ApmTraceClient {
+	return client.NewApmTraceClient(
+		analyzerCfg.TraceAddress,
+		analyzerCfg.Timeout,
+		analyzerCfg.RatioThreshold,
+		analyzerCfg.MuateNodeMode,
+		analyzerCfg.GetDetailTypes)
 }
 
 func startGrpcServer(
@@ -163,13 +232,30 @@ func startGrpcServer(
 	sampleCfg *config.SampleConfig,
 	profileCfg *config.ProfileConfig,
 	analyzerCfg *config.AnalyzerConfig,
-	thresholdCache *threshold.ThresholdCache) {
+	thresholdCache *threshold.ThresholdCache,
+	reloader *configReloader,
+	checker *health.Checker,
+	serverCerts *tlsconfig.ServerCerts,
+	authenticator *auth.Authenticator,
+	quotas *tenant.Quotas,
+	otlpReceiver *otlp.Receiver) (*grpc.Server, *grpchealth.Server, *trace.TraceServer, *analyzer.ReportAnalyzer) {
 	listen, err := net.Listen("tcp", ":"+strconv.Itoa(receiverCfg.GrpcPort))
 	if err != nil {
 		log.Fatalf("Fail to listen Grpc Port: %v\n", err)
 	}
 
-	server := grpc.NewServer()
+	serverOptions := make([]grpc.ServerOption, 0)
+	if serverCerts != nil {
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(serverCerts.TLSConfig("h2"))))
+		log.Println("Enable TLS for the Grpc Server")
+	}
+	if authenticator != nil {
+		serverOptions = append(serverOptions,
+			grpc.ChainUnaryInterceptor(authenticator.UnaryServerInterceptor()),
+			grpc.ChainStreamInterceptor(authenticator.StreamServerInterceptor()))
+		log.Println("Enable Auth for the Grpc Server")
+	}
+	server := grpc.NewServer(serverOptions...)
 
 	sampleServer := trace.NewSampleServer(sampleCfg.Enable, sampleCfg.MinSample, sampleCfg.InitSample, sampleCfg.MaxSample, sampleCfg.ResetSamplePeriod)
 	model.RegisterSampleServiceServer(server, sampleServer)
@@ -183,32 +269,48 @@ func startGrpcServer(
 	thresholdServer := threshold.NewThresholdServer(thresholdCache)
 	model.RegisterSlowThresholdServiceServer(server, thresholdServer)
 
-	analyzer := analyzer.NewReportAnalyzer(analyzerCfg, profileServer.SignalsCache)
+	reportAnalyzer := analyzer.NewReportAnalyzer(analyzerCfg, profileServer.SignalsCache)
 
-	traceServer := trace.NewTraceServer(analyzer)
+	traceServer := trace.NewTraceServer(reportAnalyzer, quotas, &receiverCfg.RateLimit, &receiverCfg.Stream)
 	model.RegisterTraceServiceServer(server, traceServer)
 	traceServer.Start()
 
-	ebpfFileReceiver := ebpffile.NewEbpfFIleServer(receiverCfg.CenterApiServer, receiverCfg.PortalAddress)
-	model.RegisterFileServiceServer(server, ebpfFileReceiver)
-
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	reloader.onReload(func(cfg *config.Config) {
+		sampleServer.UpdateConfig(cfg.SampleCfg.Enable, cfg.SampleCfg.MinSample, cfg.SampleCfg.InitSample, cfg.SampleCfg.MaxSample, cfg.SampleCfg.ResetSamplePeriod)
+		profileServer.UpdateWindowSample(cfg.ProfileCfg.OpenWindowSample, cfg.ProfileCfg.WindowSampleNum)
+		reportAnalyzer.UpdateSettings(cfg.AnalyzerCfg)
+	})
 
-		<-c
-		log.Println("Shutting down gRPC server...")
+	if otlpReceiver != nil {
+		coltracepb.RegisterTraceServiceServer(server, otlpReceiver)
+		log.Println("Enable OTLP for the Grpc Server")
+	}
 
-		server.GracefulStop()
+	ebpfFileReceiver := ebpffile.NewEbpfFIleServer(receiverCfg.CenterApiServer, receiverCfg.PortalAddress)
+	model.RegisterFileServiceServer(server, ebpfFileReceiver)
 
-		_ = listen.Close()
-		log.Println("gRPC server closed.")
-	}()
+	// The data can not be stored while ClickHouse is unreachable, so all the services are NOT_SERVING.
+	healthServer := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	checker.OnChange("clickhouse", func(up bool) {
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		if up {
+			status = healthpb.HealthCheckResponse_SERVING
+		}
+		healthServer.SetServingStatus("", status)
+		for service := range server.GetServiceInfo() {
+			healthServer.SetServingStatus(service, status)
+		}
+	})
+	checker.Start()
 
 	log.Printf("Start Grpc Server: %d", receiverCfg.GrpcPort)
-	if err := server.Serve(listen); err != nil {
-		log.Fatalf("Fail to start server: %v", err)
-	}
+	go func() {
+		if err := server.Serve(listen); err != nil {
+			log.Fatalf("Fail to start server: %v", err)
+		}
+	}()
+	return server, healthServer, traceServer, reportAnalyzer
 }
 
 func startMetadataFetch(k8sCfg *config.K8sConfig) {
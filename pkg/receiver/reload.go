@@ -0,0 +1,173 @@
+package receiver
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+const reloadDebounce = time.Second
+
+// configReloader reloads the configuration when the file is changed or SIGHUP is received.
+//
+// Only analyzer.ratio_threshold, analyzer.mutate_node_mode, analyzer.http_parser, analyzer.external_rules,
+// analyzer.url_normalizer, sample.*, profile.open_window_sample and profile.window_sample_num are applied live,
+// a reload changing any other key is rejected as it requires a restart.
+type configReloader struct {
+	lock     sync.Mutex
+	path     string
+	current  *config.Config
+	appliers []func(cfg *config.Config)
+}
+
+func newConfigReloader(path string, cfg *config.Config) *configReloader {
+	return &configReloader{
+		path:     path,
+		current:  cfg,
+		appliers: make([]func(cfg *config.Config), 0),
+	}
+}
+
+// onReload registers a function to apply the reloaded configuration.
+func (reloader *configReloader) onReload(apply func(cfg *config.Config)) {
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+	reloader.appliers = append(reloader.appliers, apply)
+}
+
+// watch reloads the configuration until stopChan is closed, the appliers are registered by onReload before it is started.
+func (reloader *configReloader) watch(stopChan <-chan struct{}) {
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	defer signal.Stop(hupChan)
+
+	var events chan fsnotify.Event
+	var watchErrors chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("[x Watch Config] %s, only SIGHUP is supported to reload", err.Error())
+	} else {
+		defer watcher.Close()
+		// Watch the directory as the file is replaced rather than written by editors and Kubernetes ConfigMaps.
+		if err := watcher.Add(filepath.Dir(reloader.path)); err != nil {
+			log.Printf("[x Watch Config] %s, only SIGHUP is supported to reload", err.Error())
+		} else {
+			events = watcher.Events
+			watchErrors = watcher.Errors
+		}
+	}
+
+	fileName := filepath.Base(reloader.path)
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-hupChan:
+			log.Println("Receive SIGHUP, reload config")
+			reloader.reload()
+		case event := <-events:
+			name := filepath.Base(event.Name)
+			if name == fileName || name == "..data" {
+				debounce.Reset(reloadDebounce)
+			}
+		case err := <-watchErrors:
+			// The errors are drained so the watcher is not blocked, eg. the event queue overflows.
+			log.Printf("[x Watch Config] %s", err.Error())
+			debounce.Reset(reloadDebounce)
+		case <-debounce.C:
+			reloader.reload()
+		}
+	}
+}
+
+func (reloader *configReloader) reload() {
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+
+	cfg, err := config.Load(reloader.path)
+	if err != nil {
+		log.Printf("[x Reload Config] %s", err.Error())
+		return
+	}
+	if reflect.DeepEqual(reloader.current, cfg) {
+		return
+	}
+	if changes := restartRequiredChanges(reloader.current, cfg); len(changes) > 0 {
+		log.Printf("[x Reload Config] Rejected, restart is required to change %s", strings.Join(changes, ", "))
+		return
+	}
+	for _, apply := range reloader.appliers {
+		apply(cfg)
+	}
+	reloader.current = cfg
+	log.Printf("Reload config %s", reloader.path)
+}
+
+// restartRequiredChanges returns the changed keys which can not be applied live.
+func restartRequiredChanges(current *config.Config, reloaded *config.Config) []string {
+	masked := *reloaded
+
+	analyzerCfg := *reloaded.AnalyzerCfg
+	analyzerCfg.RatioThreshold = current.AnalyzerCfg.RatioThreshold
+	analyzerCfg.MuateNodeMode = current.AnalyzerCfg.MuateNodeMode
+	analyzerCfg.HttpParser = current.AnalyzerCfg.HttpParser
+	analyzerCfg.ExternalRules = current.AnalyzerCfg.ExternalRules
+	analyzerCfg.UrlNormalizer = current.AnalyzerCfg.UrlNormalizer
+	masked.AnalyzerCfg = &analyzerCfg
+
+	profileCfg := *reloaded.ProfileCfg
+	profileCfg.OpenWindowSample = current.ProfileCfg.OpenWindowSample
+	profileCfg.WindowSampleNum = current.ProfileCfg.WindowSampleNum
+	masked.ProfileCfg = &profileCfg
+
+	masked.SampleCfg = current.SampleCfg
+
+	return diffKeys("", reflect.ValueOf(current).Elem(), reflect.ValueOf(&masked).Elem())
+}
+
+func diffKeys(prefix string, current reflect.Value, reloaded reflect.Value) []string {
+	if current.Kind() == reflect.Pointer {
+		if current.IsNil() || reloaded.IsNil() {
+			if current.IsNil() != reloaded.IsNil() {
+				return []string{prefix}
+			}
+			return nil
+		}
+		return diffKeys(prefix, current.Elem(), reloaded.Elem())
+	}
+	if current.Kind() != reflect.Struct {
+		if reflect.DeepEqual(current.Interface(), reloaded.Interface()) {
+			return nil
+		}
+		return []string{prefix}
+	}
+
+	keys := make([]string, 0)
+	for i := 0; i < current.NumField(); i++ {
+		field := current.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		keys = append(keys, diffKeys(name, current.Field(i), reloaded.Field(i))...)
+	}
+	return keys
+}
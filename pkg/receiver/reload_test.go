@@ -0,0 +1,67 @@
+package receiver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+func TestConfigReload(t *testing.T) {
+	content, err := os.ReadFile("../../receiver-config.yml")
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "receiver-config.yml")
+	assert.NoError(t, os.WriteFile(path, content, 0o644))
+
+	cfg, err := config.Load(path)
+	assert.NoError(t, err)
+	reloader := newConfigReloader(path, cfg)
+	var applied *config.Config
+	reloader.onReload(func(cfg *config.Config) {
+		applied = cfg
+	})
+
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		applied bool
+	}{
+		{name: "ratio threshold", old: "ratio_threshold: 20", new: "ratio_threshold: 30", applied: true},
+		{name: "sample", old: "max_sample: 10", new: "max_sample: 8", applied: true},
+		{name: "grpc port", old: "grpc_port: 29090", new: "grpc_port: 29091", applied: false},
+		{name: "invalid", old: "thread_count: 10", new: "thread_count: 0", applied: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied = nil
+			changed := strings.Replace(string(content), tt.old, tt.new, 1)
+			assert.NoError(t, os.WriteFile(path, []byte(changed), 0o644))
+			reloader.reload()
+			assert.Equal(t, tt.applied, applied != nil)
+			// Restore the file for the next case.
+			assert.NoError(t, os.WriteFile(path, content, 0o644))
+			reloader.reload()
+		})
+	}
+}
+
+func TestRestartRequiredChanges(t *testing.T) {
+	current, err := config.Load("../../receiver-config.yml")
+	assert.NoError(t, err)
+	reloaded, err := config.Load("../../receiver-config.yml")
+	assert.NoError(t, err)
+
+	reloaded.AnalyzerCfg.HttpParser = "httpMethod"
+	reloaded.ProfileCfg.WindowSampleNum = 20
+	reloaded.SampleCfg.Enable = true
+	assert.Empty(t, restartRequiredChanges(current, reloaded))
+
+	reloaded.ReceiverCfg.HttpPort = 8081
+	reloaded.ClickHouseCfg.Endpoint = "tcp://clickhouse:9000"
+	assert.Equal(t, []string{"receiver.http_port", "clickhouse.endpoint"}, restartRequiredChanges(current, reloaded))
+}
@@ -0,0 +1,92 @@
+package tenant
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+var (
+	IngestedDataTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_tenant_ingested_data_total",
+			Help: "The total number of data accepted from the agents of each tenant",
+		},
+		[]string{"tenant", "type"},
+	)
+	RejectedDataTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "originx_receiver_tenant_rejected_data_total",
+			Help: "The total number of data rejected as the quota of the tenant is exceeded",
+		},
+		[]string{"tenant", "type"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(IngestedDataTotal, RejectedDataTotal)
+}
+
+// Quotas limits the data ingested by each tenant with a token bucket per tenant.
+type Quotas struct {
+	defaultQuota *config.TenantQuotaConfig
+	quotas       map[string]*config.TenantQuotaConfig
+	limiters     sync.Map // <tenant, *rate.Limiter>
+}
+
+// NewQuotas returns nil if no quota is set.
+func NewQuotas(cfg *config.TenantConfig) (*Quotas, error) {
+	quotas := &Quotas{
+		defaultQuota: &cfg.DefaultQuota,
+		quotas:       make(map[string]*config.TenantQuotaConfig),
+	}
+	limited := cfg.DefaultQuota.DataPerSecond > 0
+	for _, quota := range cfg.Quotas {
+		if !ValidName(quota.Tenant) {
+			return nil, fmt.Errorf("invalid tenant %q, expect %s", quota.Tenant, namePattern.String())
+		}
+		quotas.quotas[quota.Tenant] = quota
+		limited = limited || quota.DataPerSecond > 0
+	}
+	if !limited {
+		return nil, nil
+	}
+	return quotas, nil
+}
+
+// Allow takes count tokens of tenant, the data are rejected as a whole if the tokens are not enough.
+// The data more than burst take all the tokens, so they are not rejected forever.
+func (quotas *Quotas) Allow(tenant string, dataType string, count int) bool {
+	if quotas != nil {
+		if limiter := quotas.getLimiter(tenant); limiter != nil && !limiter.AllowN(time.Now(), min(count, limiter.Burst())) {
+			RejectedDataTotal.WithLabelValues(tenant, dataType).Add(float64(count))
+			return false
+		}
+	}
+	IngestedDataTotal.WithLabelValues(tenant, dataType).Add(float64(count))
+	return true
+}
+
+func (quotas *Quotas) getLimiter(tenant string) *rate.Limiter {
+	if limiter, found := quotas.limiters.Load(tenant); found {
+		return limiter.(*rate.Limiter)
+	}
+	quota, found := quotas.quotas[tenant]
+	if !found {
+		quota = quotas.defaultQuota
+	}
+	if quota.DataPerSecond <= 0 {
+		return nil
+	}
+	burst := quota.Burst
+	if burst <= 0 {
+		burst = max(int(quota.DataPerSecond), 1)
+	}
+	limiter, _ := quotas.limiters.LoadOrStore(tenant, rate.NewLimiter(rate.Limit(quota.DataPerSecond), burst))
+	return limiter.(*rate.Limiter)
+}
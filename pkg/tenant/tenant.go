@@ -0,0 +1,41 @@
+package tenant
+
+import (
+	"regexp"
+	"strings"
+)
+
+// keySeparator joins the tenant and the key, it is not allowed in the tenant names.
+const keySeparator = "/"
+
+// The tenant is used as a part of the database names and cache keys.
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,64}$`)
+
+// ValidName returns whether name can be used as a tenant, the empty name is the default tenant.
+func ValidName(name string) bool {
+	return name == "" || namePattern.MatchString(name)
+}
+
+// Key namespaces key of the caches by tenant, key is unchanged for the default tenant.
+func Key(tenant string, key string) string {
+	if tenant == "" {
+		return key
+	}
+	return tenant + keySeparator + key
+}
+
+// SplitKey returns the tenant and the key namespaced by Key.
+func SplitKey(tenantKey string) (string, string) {
+	if tenant, key, found := strings.Cut(tenantKey, keySeparator); found {
+		return tenant, key
+	}
+	return "", tenantKey
+}
+
+// Database returns the database to write the data of tenant.
+func Database(database string, tenant string) string {
+	if tenant == "" {
+		return database
+	}
+	return database + "_" + tenant
+}
@@ -0,0 +1,70 @@
+package tenant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		tenant string
+		key    string
+		expect string
+	}{
+		{"default tenant", "", "trace-1", "trace-1"},
+		{"tenant", "t1", "trace-1", "t1/trace-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenantKey := Key(tt.tenant, tt.key)
+			assert.Equal(t, tt.expect, tenantKey)
+
+			tenant, key := SplitKey(tenantKey)
+			assert.Equal(t, tt.tenant, tenant)
+			assert.Equal(t, tt.key, key)
+		})
+	}
+}
+
+func TestValidName(t *testing.T) {
+	assert.True(t, ValidName(""))
+	assert.True(t, ValidName("Tenant_01"))
+	assert.False(t, ValidName("a/b"))
+	assert.False(t, ValidName("a-b"))
+	assert.False(t, ValidName("a;DROP"))
+	assert.Equal(t, "originx", Database("originx", ""))
+	assert.Equal(t, "originx_t1", Database("originx", "t1"))
+}
+
+func TestQuotas(t *testing.T) {
+	quotas, err := NewQuotas(&config.TenantConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, quotas)
+	assert.True(t, quotas.Allow("t1", "span_trace", 100))
+
+	_, err = NewQuotas(&config.TenantConfig{
+		Quotas: []*config.TenantQuotaConfig{{Tenant: "a/b", DataPerSecond: 1}},
+	})
+	assert.Error(t, err)
+
+	quotas, err = NewQuotas(&config.TenantConfig{
+		DefaultQuota: config.TenantQuotaConfig{DataPerSecond: 0.001, Burst: 10},
+		Quotas: []*config.TenantQuotaConfig{
+			{Tenant: "unlimited"},
+			{Tenant: "small", DataPerSecond: 0.001},
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, quotas.Allow("t1", "span_trace", 6))
+	assert.False(t, quotas.Allow("t1", "span_trace", 6))
+	// The other tenants are not affected.
+	assert.True(t, quotas.Allow("t2", "span_trace", 10))
+	assert.True(t, quotas.Allow("unlimited", "span_trace", 1000))
+	// The data more than burst take all the tokens.
+	assert.True(t, quotas.Allow("small", "span_trace", 5))
+	assert.False(t, quotas.Allow("small", "span_trace", 1))
+}
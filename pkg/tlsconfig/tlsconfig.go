@@ -0,0 +1,180 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+const reloadDebounce = time.Second
+
+var errNoCertificate = errors.New("no certificate is found")
+
+// ServerCerts keeps the certificate and client CAs of the listeners, they are reloaded when the files are changed
+// so the rotated certificates are served to the new connections without restarting.
+type ServerCerts struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	cert         atomic.Pointer[tls.Certificate]
+	clientCAs    atomic.Pointer[x509.CertPool]
+}
+
+// NewServerCerts loads the files of cfg, nil is returned if TLS is not enabled.
+func NewServerCerts(cfg *config.TLSServerConfig) (*ServerCerts, error) {
+	if !cfg.Enable {
+		return nil, nil
+	}
+	certs := &ServerCerts{
+		certFile:     cfg.CertFile,
+		keyFile:      cfg.KeyFile,
+		clientCAFile: cfg.ClientCAFile,
+	}
+	if err := certs.load(); err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+func (certs *ServerCerts) load() error {
+	cert, err := tls.LoadX509KeyPair(certs.certFile, certs.keyFile)
+	if err != nil {
+		return fmt.Errorf("load server certificate: %w", err)
+	}
+	if certs.clientCAFile != "" {
+		clientCAs, err := loadCertPool(certs.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("load client CA: %w", err)
+		}
+		certs.clientCAs.Store(clientCAs)
+	}
+	certs.cert.Store(&cert)
+	return nil
+}
+
+// TLSConfig returns the config for a listener, nextProtos is negotiated by ALPN, e.g. h2 for gRPC.
+// The client certificates are required and verified if client_ca_file is set.
+func (certs *ServerCerts) TLSConfig(nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			serverCfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   nextProtos,
+				Certificates: []tls.Certificate{*certs.cert.Load()},
+			}
+			if clientCAs := certs.clientCAs.Load(); clientCAs != nil {
+				serverCfg.ClientCAs = clientCAs
+				serverCfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return serverCfg, nil
+		},
+	}
+}
+
+// Watch reloads the files when they are changed until stopChan is closed,
+// the previous certificate is kept if the new files are invalid.
+func (certs *ServerCerts) Watch(stopChan <-chan struct{}) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("[x Watch Certificate] %s, the certificate will not be reloaded", err.Error())
+		return
+	}
+	defer watcher.Close()
+
+	files := make(map[string]bool)
+	for _, file := range []string{certs.certFile, certs.keyFile, certs.clientCAFile} {
+		if file == "" {
+			continue
+		}
+		files[filepath.Base(file)] = true
+		// Watch the directory as the files are replaced by Kubernetes Secrets and cert-manager.
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			log.Printf("[x Watch Certificate] %s, the certificate will not be reloaded", err.Error())
+			return
+		}
+	}
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case <-stopChan:
+			return
+		case event := <-watcher.Events:
+			name := filepath.Base(event.Name)
+			if files[name] || name == "..data" {
+				debounce.Reset(reloadDebounce)
+			}
+		case err := <-watcher.Errors:
+			log.Printf("[x Watch Certificate] %s", err.Error())
+		case <-debounce.C:
+			if err := certs.load(); err != nil {
+				log.Printf("[x Reload Certificate] %s, keep the previous certificate", err.Error())
+			} else {
+				log.Printf("Reload certificate %s", certs.certFile)
+			}
+		}
+	}
+}
+
+// NewClientTLS builds the config to connect ClickHouse, Redis and Prometheus, nil is returned if TLS is not enabled.
+func NewClientTLS(cfg *config.TLSClientConfig) (*tls.Config, error) {
+	if !cfg.Enable {
+		return nil, nil
+	}
+	clientCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		rootCAs, err := loadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("load CA: %w", err)
+		}
+		clientCfg.RootCAs = rootCAs
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		clientCfg.Certificates = []tls.Certificate{cert}
+	}
+	return clientCfg, nil
+}
+
+// NewTransport returns the transport of HTTP clients, the default transport is used if tlsConfig is nil.
+func NewTransport(tlsConfig *tls.Config) http.RoundTripper {
+	if tlsConfig == nil {
+		return http.DefaultTransport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("%s: %w", file, errNoCertificate)
+	}
+	return pool, nil
+}
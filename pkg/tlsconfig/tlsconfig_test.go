@@ -0,0 +1,145 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CloudDetail/apo-receiver/pkg/config"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "apo-receiver"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, certFile string, keyFile string) {
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	if keyFile == "" {
+		return
+	}
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+}
+
+func TestServerCerts(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, 1, nil)
+	ca.write(t, filepath.Join(dir, "ca.crt"), "")
+	newTestCert(t, 2, ca).write(t, filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	newTestCert(t, 3, ca).write(t, filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"))
+
+	certs, err := NewServerCerts(&config.TLSServerConfig{
+		Enable:       true,
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	})
+	assert.NoError(t, err)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", certs.TLSConfig("h2"))
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+
+	handshake := func(clientCfg *config.TLSClientConfig) (*big.Int, error) {
+		tlsConfig, err := NewClientTLS(clientCfg)
+		assert.NoError(t, err)
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", listener.Addr().String(), tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		// The client certificate is verified after the client finishes the handshake in TLS 1.3.
+		if _, err := conn.Read(make([]byte, 1)); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber, nil
+	}
+	mtlsCfg := &config.TLSClientConfig{
+		Enable:     true,
+		CAFile:     filepath.Join(dir, "ca.crt"),
+		CertFile:   filepath.Join(dir, "client.crt"),
+		KeyFile:    filepath.Join(dir, "client.key"),
+		ServerName: "localhost",
+	}
+
+	serial, err := handshake(mtlsCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), serial.Int64())
+
+	_, err = handshake(&config.TLSClientConfig{Enable: true, CAFile: filepath.Join(dir, "ca.crt"), ServerName: "localhost"})
+	assert.Error(t, err, "the client without certificate must be rejected")
+
+	// The rotated certificate is served to the new connections.
+	newTestCert(t, 4, ca).write(t, filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	assert.NoError(t, certs.load())
+	serial, err = handshake(mtlsCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), serial.Int64())
+
+	// The previous certificate is kept if the new files are invalid.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "tls.crt"), []byte("invalid"), 0o600))
+	assert.Error(t, certs.load())
+	serial, err = handshake(mtlsCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), serial.Int64())
+}
+
+func TestNewClientTLSDisabled(t *testing.T) {
+	tlsConfig, err := NewClientTLS(&config.TLSClientConfig{Enable: false, CAFile: "missing"})
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	_, err = NewClientTLS(&config.TLSClientConfig{Enable: true, CAFile: filepath.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set by -ldflags "-X github.com/CloudDetail/apo-receiver/pkg/version.Version=..." when building.
+var (
+	Version   = "dev"
+	GitCommit = ""
+	BuildDate = ""
+)
+
+// Info returns the build info, the vcs revision recorded by go build is used if GitCommit is not set.
+func Info() string {
+	commit := GitCommit
+	if commit == "" {
+		if buildInfo, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range buildInfo.Settings {
+				if setting.Key == "vcs.revision" {
+					commit = setting.Value
+				}
+			}
+		}
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	buildDate := BuildDate
+	if buildDate == "" {
+		buildDate = "unknown"
+	}
+	return fmt.Sprintf("apo-receiver %s (commit: %s, built: %s, %s %s/%s)",
+		Version, commit, buildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS service_dependency_1m{{if .Cluster}}_local ON CLUSTER {{.Cluster}}{{end}}
+(
+    timestamp DateTime CODEC(Delta, ZSTD(1)),
+    parent_service LowCardinality(String) CODEC(ZSTD(1)),
+    parent_url String CODEC(ZSTD(1)),
+    client_group LowCardinality(String) CODEC(ZSTD(1)),
+    client_type LowCardinality(String) CODEC(ZSTD(1)),
+    client_peer String CODEC(ZSTD(1)),
+    service LowCardinality(String) CODEC(ZSTD(1)),
+    url String CODEC(ZSTD(1)),
+    is_async Bool,
+    calls UInt64 CODEC(ZSTD(1)),
+    errors UInt64 CODEC(ZSTD(1)),
+    duration_sum UInt64 CODEC(ZSTD(1)),
+    duration_min UInt64 CODEC(ZSTD(1)),
+    duration_max UInt64 CODEC(ZSTD(1)),
+    latency Map(Int16, UInt64) CODEC(ZSTD(1)),
+    INDEX idx_service service TYPE bloom_filter(0.01) GRANULARITY 1
+) ENGINE {{if .Replication}}ReplicatedMergeTree{{else}}MergeTree(){{end}}
+    PARTITION BY toDate(timestamp)
+    ORDER BY (parent_service, toUnixTimestamp(timestamp))
+    TTL toDateTime(timestamp) + toIntervalDay({{.TTLDay}})
+    SETTINGS index_granularity=8192, ttl_only_drop_parts = 1
\ No newline at end of file
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS service_dependency_change{{if .Cluster}}_local ON CLUSTER {{.Cluster}}{{end}}
+(
+    timestamp DateTime CODEC(Delta, ZSTD(1)),
+    service LowCardinality(String) CODEC(ZSTD(1)),
+    change LowCardinality(String) CODEC(ZSTD(1)),
+    parent_service LowCardinality(String) CODEC(ZSTD(1)),
+    client_group LowCardinality(String) CODEC(ZSTD(1)),
+    client_type LowCardinality(String) CODEC(ZSTD(1)),
+    client_peer String CODEC(ZSTD(1)),
+    destination String CODEC(ZSTD(1)),
+    child_service LowCardinality(String) CODEC(ZSTD(1)),
+    trace_id String CODEC(ZSTD(1)),
+    first_seen DateTime CODEC(Delta, ZSTD(1)),
+    last_seen DateTime CODEC(Delta, ZSTD(1))
+) ENGINE {{if .Replication}}ReplicatedMergeTree{{else}}MergeTree(){{end}}
+    PARTITION BY toDate(timestamp)
+    ORDER BY (service, toUnixTimestamp(timestamp))
+    TTL toDateTime(timestamp) + toIntervalDay({{.TTLDay}})
+    SETTINGS index_granularity=8192, ttl_only_drop_parts = 1
\ No newline at end of file